@@ -24,8 +24,8 @@ locals {
     "131.0.72.0/22"
   ]
   cloudflare_origin_ca_key     = var.cloudflare_origin_ca_key
-  demo_web_app_backend_name    = "${var.demo_web_app_service_name}-backend"
-  demo_web_app_service_name    = var.demo_web_app_service_name
+  demo_web_app_backend_name    = "${local.demo_web_app_service_name}-backend"
+  demo_web_app_service_name    = "${local.name_prefix}${var.demo_web_app_service_name}"
   demo_web_app_subdomain_name  = var.demo_web_app_subdomain_name
   demo_web_app_project_id      = var.demo_web_app_project_id != "" ? var.demo_web_app_project_id : local.project_id
   enable_cloudflare_proxy      = var.enable_cloudflare_proxy
@@ -36,17 +36,34 @@ locals {
   enable_waf                   = var.enable_waf
   host_project_id              = "${local.project_id}-shared"
   ingress_vpc_cidr_range       = var.ingress_vpc_cidr_range
+  name_prefix                  = var.resource_name_prefix != "" ? "${var.resource_name_prefix}-" : ""
   project_id                   = var.cloudedge_project_id != "" ? var.cloudedge_project_id : "${local.cloudedge_github_repository}-${local.project_suffix}"
   project_suffix               = var.project_suffix
   proxy_only_subnet_cidr_range = var.proxy_only_subnet_cidr_range
   region                       = var.region
-  root_domain                  = var.root_domain
+  resource_names = {
+    external_backend  = "${local.name_prefix}demo-web-app-external-backend"
+    external_lb       = "${local.name_prefix}external-https-lb"
+    external_lb_ip    = "${local.name_prefix}${local.project_suffix}-external-lb-ip"
+    external_lb_proxy = "${local.name_prefix}external-https-lb-proxy"
+    https_firewall    = "${local.name_prefix}${local.project_suffix}-allow-https"
+    ingress_subnet    = "${local.name_prefix}ingress-subnet"
+    ingress_vpc       = "${local.name_prefix}ingress-vpc"
+    origin_cert       = "${local.name_prefix}cloudflare-origin-cert-${local.demo_web_app_subdomain_name}"
+    proxy_only_subnet = "${local.name_prefix}external-https-lb-proxy-only-subnet"
+    psc_neg           = "${local.name_prefix}demo-web-app-psc-neg"
+    subdomain         = "${local.name_prefix}${local.demo_web_app_subdomain_name}"
+    waf_policy        = "${local.name_prefix}edge-waf-policy"
+  }
+  root_domain = var.root_domain
   standard_tags = merge(
     var.resource_tags,
     {
       "project"    = local.project_id
       "managed-by" = "opentofu"
-    }
+    },
+    # name-prefix marks a prefixed (test) deployment for the orphan sweeper
+    { for k, v in { "name-prefix" = var.resource_name_prefix } : k => v if v != "" }
   )
 }
 
@@ -123,9 +140,10 @@ resource "google_project_service" "run" {
 resource "google_compute_address" "external_lb_ip" {
   project      = local.project_id
   region       = local.region
-  name         = "${local.project_suffix}-external-lb-ip"
+  name         = local.resource_names.external_lb_ip
   address_type = "EXTERNAL"
   network_tier = "STANDARD"
+  labels       = local.standard_tags
 }
 
 #############################################################
@@ -136,7 +154,7 @@ resource "google_compute_address" "external_lb_ip" {
 # Main subdomain A record pointing to load balancer
 resource "cloudflare_record" "demo_web_app_subdomain_a" {
   zone_id = data.cloudflare_zone.vibetics.id
-  name    = local.demo_web_app_subdomain_name
+  name    = local.resource_names.subdomain
   content = google_compute_address.external_lb_ip.address
   type    = "A"
   ttl     = local.enable_cloudflare_proxy ? 1 : 120 # TTL=1 means 'automatic' when proxied
@@ -170,12 +188,12 @@ resource "tls_cert_request" "cloudflare_origin_csr" {
   private_key_pem = tls_private_key.cloudflare_origin_key[0].private_key_pem
 
   subject {
-    common_name  = "${local.demo_web_app_subdomain_name}.${local.root_domain}"
+    common_name  = "${local.resource_names.subdomain}.${local.root_domain}"
     organization = "Vibetics"
   }
 
   dns_names = [
-    "${local.demo_web_app_subdomain_name}.${local.root_domain}"
+    "${local.resource_names.subdomain}.${local.root_domain}"
   ]
 }
 
@@ -186,7 +204,7 @@ resource "cloudflare_origin_ca_certificate" "origin_cert" {
   provider           = cloudflare.origin_ca
   count              = local.enable_cloudflare_proxy ? 1 : 0
   csr                = tls_cert_request.cloudflare_origin_csr[0].cert_request_pem
-  hostnames          = ["${local.demo_web_app_subdomain_name}.${local.root_domain}"]
+  hostnames          = ["${local.resource_names.subdomain}.${local.root_domain}"]
   request_type       = "origin-rsa"
   requested_validity = 5475 # 15 years (max allowed)
 }
@@ -197,7 +215,7 @@ resource "google_compute_region_ssl_certificate" "cloudflare_origin_cert" {
   provider    = google-beta
   project     = local.project_id
   region      = local.region
-  name        = "cloudflare-origin-cert-${local.demo_web_app_subdomain_name}"
+  name        = local.resource_names.origin_cert
   private_key = tls_private_key.cloudflare_origin_key[0].private_key_pem
   certificate = cloudflare_origin_ca_certificate.origin_cert[0].certificate
 
@@ -214,7 +232,7 @@ resource "google_compute_region_security_policy" "edge_waf_policy" {
   count       = local.enable_waf ? 1 : 0
   project     = local.project_id
   region      = local.region
-  name        = "edge-waf-policy"
+  name        = local.resource_names.waf_policy
   description = "Edge WAF policy for regional load balancer - inspects encrypted traffic"
 
   # OWASP ModSecurity Core Rule Set (CRS) - SQL Injection protection
@@ -372,7 +390,7 @@ resource "google_compute_region_security_policy" "edge_waf_policy" {
 
 resource "google_compute_network" "ingress_vpc" {
   project                 = local.project_id
-  name                    = "ingress-vpc"
+  name                    = local.resource_names.ingress_vpc
   auto_create_subnetworks = false
 }
 
@@ -383,7 +401,7 @@ resource "google_compute_network" "ingress_vpc" {
 # Ingress VPC Subnet
 resource "google_compute_subnetwork" "ingress_subnet" {
   project                  = local.project_id
-  name                     = "ingress-subnet"
+  name                     = local.resource_names.ingress_subnet
   ip_cidr_range            = local.ingress_vpc_cidr_range
   network                  = google_compute_network.ingress_vpc.name
   region                   = local.region
@@ -396,7 +414,7 @@ resource "google_compute_subnetwork" "ingress_subnet" {
 
 resource "google_compute_subnetwork" "proxy_only_subnet" {
   project       = local.project_id
-  name          = "external-https-lb-proxy-only-subnet"
+  name          = local.resource_names.proxy_only_subnet
   ip_cidr_range = local.proxy_only_subnet_cidr_range
   region        = local.region
   network       = google_compute_network.ingress_vpc.id
@@ -410,7 +428,7 @@ resource "google_compute_subnetwork" "proxy_only_subnet" {
 
 resource "google_compute_firewall" "allow_ingress_vpc_https_ingress" {
   project = local.project_id
-  name    = "${local.project_suffix}-allow-https"
+  name    = local.resource_names.https_firewall
   network = google_compute_network.ingress_vpc.name
 
   allow {
@@ -433,7 +451,7 @@ resource "google_compute_firewall" "allow_ingress_vpc_https_ingress" {
 resource "google_compute_region_network_endpoint_group" "demo_web_app_psc_neg" {
   count                 = local.enable_demo_web_app && local.enable_demo_web_app_psc_neg ? 1 : 0
   project               = local.project_id
-  name                  = "demo-web-app-psc-neg"
+  name                  = local.resource_names.psc_neg
   region                = local.region
   network_endpoint_type = "PRIVATE_SERVICE_CONNECT"
   psc_target_service    = data.terraform_remote_state.demo_web_app[0].outputs.web_app_psc_service_attachment_self_link
@@ -450,7 +468,7 @@ resource "google_compute_region_backend_service" "demo_web_app_external_backend"
   count                 = local.enable_demo_web_app && local.enable_demo_web_app_psc_neg ? 1 : 0
   project               = local.project_id
   region                = local.region
-  name                  = "demo-web-app-external-backend"
+  name                  = local.resource_names.external_backend
   protocol              = "HTTPS"
   port_name             = "https"
   timeout_sec           = 30
@@ -472,7 +490,7 @@ resource "google_compute_region_backend_service" "demo_web_app_external_backend"
 # URL Map
 resource "google_compute_region_url_map" "external_https_lb" {
   project         = local.project_id
-  name            = "external-https-lb"
+  name            = local.resource_names.external_lb
   default_service = local.enable_demo_web_app_psc_neg ? google_compute_region_backend_service.demo_web_app_external_backend[0].id : data.terraform_remote_state.demo_web_app[0].outputs.web_app_backend_service_id
 }
 
@@ -480,7 +498,7 @@ resource "google_compute_region_url_map" "external_https_lb" {
 resource "google_compute_region_target_https_proxy" "external_https_lb" {
   project = local.project_id
   region  = local.region
-  name    = "external-https-lb-proxy"
+  name    = local.resource_names.external_lb_proxy
   url_map = google_compute_region_url_map.external_https_lb.id
   # Use Cloudflare origin cert when proxy is enabled, otherwise use self-signed or managed cert from singleton
   ssl_certificates = [
@@ -492,13 +510,14 @@ resource "google_compute_region_target_https_proxy" "external_https_lb" {
 resource "google_compute_forwarding_rule" "external_https_lb" {
   project               = local.project_id
   region                = local.region
-  name                  = "external-https-lb"
+  name                  = local.resource_names.external_lb
   target                = google_compute_region_target_https_proxy.external_https_lb.id
   ip_address            = google_compute_address.external_lb_ip.address
   port_range            = "443"
   load_balancing_scheme = "EXTERNAL_MANAGED"
   network_tier          = "STANDARD"
   network               = google_compute_network.ingress_vpc.id
+  labels                = local.standard_tags
 
   depends_on = [
     google_compute_subnetwork.proxy_only_subnet
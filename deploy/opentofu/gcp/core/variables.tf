@@ -39,6 +39,17 @@ variable "resource_tags" {
   }
 }
 
+variable "resource_name_prefix" {
+  description = "Optional prefix for the names of resources that must be unique in the project, so concurrent deployments (e.g. parallel test runs) do not collide. Empty keeps the plain names."
+  type        = string
+  default     = ""
+
+  validation {
+    condition     = var.resource_name_prefix == "" || can(regex("^[a-z]([a-z0-9-]{0,14}[a-z0-9])?$", var.resource_name_prefix))
+    error_message = "resource_name_prefix must be at most 16 lowercase letters, digits or hyphens, start with a letter and not end with a hyphen."
+  }
+}
+
 variable "cloudedge_project_id" {
   description = "The GCP Project ID where resources will be deployed."
   type        = string
@@ -8,24 +8,27 @@ locals {
   project_suffix              = var.project_suffix
   region                      = var.region
   cloudedge_github_repository = var.cloudedge_github_repository
+  name_prefix                 = var.resource_name_prefix != "" ? "${var.resource_name_prefix}-" : ""
   standard_tags = merge(
     var.resource_tags,
     {
       "project"    = local.project_id
       "managed-by" = "opentofu"
-    }
+    },
+    # name-prefix marks a prefixed (test) deployment for the orphan sweeper
+    { for k, v in { "name-prefix" = var.resource_name_prefix } : k => v if v != "" }
   )
   cloudedge_project_id = var.cloudedge_project_id
 
   # Demo Web App Variables
   enable_web_app                = var.enable_demo_web_app
   project_id                    = var.demo_web_app_project_id
-  web_app_service_name          = var.demo_web_app_service_name
+  web_app_service_name          = "${local.name_prefix}${var.demo_web_app_service_name}"
   web_app_image                 = var.demo_web_app_image
   enable_self_signed_cert       = var.enable_demo_web_app_self_signed_cert
   enable_internal_alb           = var.enable_demo_web_app_internal_alb
   enable_psc_neg                = var.enable_demo_web_app_psc_neg
-  web_vpc_name                  = var.demo_web_app_web_vpc_name
+  web_vpc_name                  = "${local.name_prefix}${var.demo_web_app_web_vpc_name}"
   web_subnet_cidr_range         = var.demo_web_app_web_subnet_cidr_range
   proxy_only_subnet_cidr_range  = var.demo_web_app_proxy_only_subnet_cidr_range
   psc_nat_subnet_cidr_range     = var.demo_web_app_psc_nat_subnet_cidr_range
@@ -281,6 +284,7 @@ resource "google_compute_forwarding_rule" "internal_alb_forwarding_rule" {
   network               = google_compute_network.web_vpc[0].id
   subnetwork            = google_compute_subnetwork.web_subnet[0].id
   network_tier          = "PREMIUM"
+  labels                = local.standard_tags
 
   depends_on = [google_compute_subnetwork.proxy_only_subnet]
 }
@@ -8,13 +8,14 @@ Feature: Connectivity Patterns (PSC vs Direct Backend)
     And NO Shared VPC architecture is used
     And the architecture supports two connectivity patterns
 
-  @integration @pattern
-  Scenario Outline: Deploy infrastructure with Pattern 1 - PSC with Internal ALB (Maximum Isolation)
+  @integration @pattern @plan
+  Scenario Outline: Deploy infrastructure with Pattern 1 - PSC with Internal ALB (Maximum Isolation) - <scenario_name>
     Given I configure the infrastructure with the following variables:
       | variable                        | value  |
       | enable_demo_web_app             | true   |
       | enable_demo_web_app_psc_neg     | true   |
       | enable_demo_web_app_internal_alb| true   |
+    And the demo-web-app project layout is "<scenario_name>"
     When I deploy the core infrastructure
     And I deploy the demo-web-app infrastructure
     Then the traffic flow should follow Pattern 1:
@@ -38,7 +39,7 @@ Feature: Connectivity Patterns (PSC vs Direct Backend)
       | Cross-project with PSC  |
       | Same-project with PSC   |
 
-  @integration @pattern
+  @integration @pattern @plan
   Scenario: Deploy infrastructure with Pattern 2 - Direct Backend Service (Simplest)
     Given I configure the infrastructure with the following variables:
       | variable                        | value  |
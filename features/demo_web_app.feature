@@ -84,7 +84,7 @@ Feature: Demo Web App Infrastructure (Independent VPC)
     When I query network endpoint groups
     Then a serverless NEG should exist
     And the NEG type should be "SERVERLESS" when PSC is disabled or same project
-    Or the NEG type should be "PRIVATE_SERVICE_CONNECT" when PSC is enabled and cross-project
+    And the NEG type should be "PRIVATE_SERVICE_CONNECT" when PSC is enabled and cross-project
     And the NEG should reference the Cloud Run service
 
   @integration @backend
@@ -94,7 +94,7 @@ Feature: Demo Web App Infrastructure (Independent VPC)
     Then a regional backend service should exist
     And the backend service protocol should be "HTTPS"
     And the load balancing scheme should be "INTERNAL_MANAGED" when ALB or PSC is enabled
-    Or the load balancing scheme should be "EXTERNAL_MANAGED" when ALB is disabled
+    And the load balancing scheme should be "EXTERNAL_MANAGED" when ALB is disabled
     And the timeout should be 30 seconds
     And the backend should reference the serverless NEG
 
@@ -227,8 +227,7 @@ Feature: Demo Web App Infrastructure (Independent VPC)
     Given the Cloud Run service is deployed for the demo web app
     And the ingress policy is "INGRESS_TRAFFIC_INTERNAL_LOAD_BALANCER"
     When a user attempts to connect to the Cloud Run service's direct URL
-    Then the connection should be refused with 403 Forbidden
-    Or the connection should fail due to ingress policy
+    Then the connection should be refused with 403 Forbidden or fail due to ingress policy
 
   @security @isolation
   Scenario: Verify network isolation without Shared VPC
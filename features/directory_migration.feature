@@ -9,7 +9,7 @@ Feature: OpenTofu Directory Structure Refactoring
     And a remote OpenTofu state exists in GCS backend
     And no other OpenTofu operations are in progress (state is unlocked)
 
-  @smoke @integration
+  @smoke @integration @contract
   Scenario: Successfully move OpenTofu files to new directory structure
     Given the following files exist in the repository root:
       | file                  |
@@ -32,7 +32,7 @@ Feature: OpenTofu Directory Structure Refactoring
     And the ".terraform.lock.hcl" file should exist at "deploy/opentofu/gcp/.terraform.lock.hcl"
     And the ".terraform.lock.hcl" file should still exist in the repository root
 
-  @integration
+  @integration @contract
   Scenario: Preserve module directory structure during relocation
     Given the "modules/" directory contains the following subdirectories:
       | provider |
@@ -79,6 +79,29 @@ Feature: OpenTofu Directory Structure Refactoring
     And no module resolution errors should occur
     And running "tofu validate" should pass without errors
 
+  @contract
+  Scenario: Relative module sources outside the moved tree are rewritten
+    Given the "main.tf" file contains module references with relative paths:
+      """
+      module "waf" {
+        source = "./modules/gcp/waf"
+      }
+      module "labels" {
+        source = "./shared/labels"
+      }
+      """
+    When I execute the directory migration process
+    Then the module "waf" in "deploy/opentofu/gcp/main.tf" should have source "./modules/gcp/waf"
+    And the module "labels" in "deploy/opentofu/gcp/main.tf" should have source "../../../shared/labels"
+
+  @contract
+  Scenario: Dry run reports the migration without changing anything
+    When I execute the directory migration process with --dry-run
+    Then the migration report should list "main.tf" moving to "deploy/opentofu/gcp/main.tf"
+    And the migration report should list ".terraform" for deletion
+    And no files should be moved
+    And no backup files should remain in the repository
+
   @smoke
   Scenario: Verify OpenTofu validation succeeds after migration
     Given the directory migration process has completed
@@ -127,7 +150,7 @@ Feature: OpenTofu Directory Structure Refactoring
     And the migration should proceed to the file move phase
     And running "tofu init" in "deploy/opentofu/gcp/" should succeed
 
-  @integration @edge-case
+  @integration @edge-case @contract
   Scenario: Detect and prevent migration when state is locked
     Given another OpenTofu operation is holding a state lock
     When I attempt to execute the directory migration process
@@ -178,7 +201,7 @@ Feature: OpenTofu Directory Structure Refactoring
     Then all commands should complete with exit code 0
     And no errors should be reported in the output
 
-  @integration @compliance
+  @integration @compliance @contract
   Scenario: Dot-files remain in repository root
     Given the repository root contains the following dot-files:
       | file              |
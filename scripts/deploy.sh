@@ -1,11 +1,31 @@
 #!/bin/bash
-# This script runs 'tofu apply' and automatically tears down the infrastructure on failure.
+# This script applies one OpenTofu module and tears that module down again if
+# the apply fails.
+#
+# Usage:
+#   source .env && ./scripts/deploy.sh <module>
+#
+# <module> is a directory under deploy/opentofu/gcp, initialised with its
+# backend: project-singleton, demo-web-app or core, deployed in that order.
+# Only the module that failed is destroyed; the modules deployed before it
+# are left in place.
 
 set -e
 
-echo "Starting deployment..."
+MODULE="$1"
+if [ -z "$MODULE" ]; then
+  echo "Usage: $0 <project-singleton|demo-web-app|core>" >&2
+  exit 2
+fi
 
-# The '||' operator ensures that the teardown script is only called if 'tofu apply' fails (exits with a non-zero status)
-tofu apply -auto-approve || ./scripts/teardown.sh
+REPO_ROOT="$(cd "$(dirname "${BASH_SOURCE[0]}")/.." && pwd)"
+
+echo "Starting deployment of ${MODULE}..."
+
+if ! tofu -chdir="${REPO_ROOT}/deploy/opentofu/gcp/${MODULE}" apply -auto-approve; then
+  echo "Deployment of ${MODULE} failed; tearing it down." >&2
+  "${REPO_ROOT}/scripts/teardown.sh" -modules "${MODULE}" || true
+  exit 1
+fi
 
 echo "Deployment successful."
@@ -1,9 +1,41 @@
 #!/bin/bash
-# This script is a placeholder for a NIST compliance validation step.
-# In a real-world scenario, this would integrate with a tool like OpenControl or a similar GRC tool.
-
+#
+# This script evaluates the NIST SP 800-53 Rev. 5 controls the modules
+# implement against OpenTofu plans or state:
+#   SC-8   every forwarding rule terminates TLS at an HTTPS or SSL proxy
+#   SC-7   no ingress firewall rule is open to 0.0.0.0/0
+#   AU-11  the project-singleton logs_bucket keeps logs for 30 days or more
+#   CM-2   every labelled resource carries managed-by, project and project-suffix
+#
+# Usage:
+#   ./scripts/nist_compliance_check.sh [-json] <plan.json|state.json|.tfstate|scenario>...
+#
+# Pass the plans or states of all deployed modules together, e.g. the output
+# of `tofu show -json` in each module directory. Without arguments the
+# recorded core and demo-web-app plan fixtures are checked. Each control
+# reports pass, fail or not_applicable with the resource addresses as
+# evidence; the script exits non-zero when any control fails.
+#
 set -e
 
-echo "Simulating NIST Cybersecurity Framework alignment check..."
-echo "Result: PASSED"
-exit 0
+REPO_ROOT="$(cd "$(dirname "${BASH_SOURCE[0]}")/.." && pwd)"
+
+# relative paths are given from the caller's directory
+args=()
+sources=0
+for arg in "$@"; do
+  if [ -e "$arg" ]; then
+    arg="$(cd "$(dirname "$arg")" && pwd)/$(basename "$arg")"
+  fi
+  case "$arg" in
+    -*) ;;
+    *) sources=$((sources + 1)) ;;
+  esac
+  args+=("$arg")
+done
+if [ "$sources" -eq 0 ]; then
+  args+=(core_default demo_web_app_default)
+fi
+
+cd "${REPO_ROOT}/tests"
+exec go run ./cmd/cloudedge compliance -catalog nist-800-53 "${args[@]}"
@@ -103,16 +103,16 @@ else
   exit 1
 fi
 
-echo "[2.2] Checking teardown.sh for bucket state handling..."
-if grep -q "wait_for_bucket_active" "${REPO_ROOT}/scripts/teardown.sh"; then
+echo "[2.2] Checking the teardown command for bucket state handling..."
+if grep -q "BucketDeleteRequested" "${REPO_ROOT}/tests/teardown/teardown.go"; then
   echo -e "${GREEN}✓ PASS: Teardown script has bucket state waiting logic${NC}"
 else
   echo -e "${RED}❌ FAIL: Teardown script missing bucket state handling${NC}"
   exit 1
 fi
 
-echo "[2.3] Checking teardown.sh for retry logic..."
-if grep -q "max_destroy_attempts" "${REPO_ROOT}/scripts/teardown.sh"; then
+echo "[2.3] Checking the teardown command for retry logic..."
+if grep -q "MaxAttempts" "${REPO_ROOT}/tests/teardown/teardown.go"; then
   echo -e "${GREEN}✓ PASS: Teardown script has retry logic${NC}"
 else
   echo -e "${RED}❌ FAIL: Teardown script missing retry logic${NC}"
@@ -200,7 +200,7 @@ echo "✓ READY FOR DEPLOYMENT"
 echo "==========================================${NC}"
 echo ""
 echo "Next steps:"
-echo "  1. Run: ./scripts/deploy.sh"
+echo "  1. Run: ./scripts/deploy.sh <module> for project-singleton, demo-web-app, then core"
 echo "  2. Test load balancer access"
 echo "  3. Run: ./scripts/teardown.sh"
 echo ""
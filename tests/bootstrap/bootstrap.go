@@ -0,0 +1,237 @@
+// Package bootstrap prepares the OpenTofu state backend: the
+// ${project_id}-tfstate buckets with versioning, uniform bucket-level access
+// and public access prevention, roles/storage.objectAdmin for the deployers,
+// and a backend-config.hcl in each module directory pointing at the bucket
+// and prefix the other modules' terraform_remote_state blocks read. Every
+// step checks before it changes anything, so a second run changes nothing,
+// and a check-only run reports the drift instead of fixing it.
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/iam"
+	"cloud.google.com/go/storage"
+
+	"vibetics-cloudedge/tests/migrate"
+	"vibetics-cloudedge/tests/planfixture"
+	"vibetics-cloudedge/tests/stack"
+)
+
+// ObjectAdmin is the role the members get on every state bucket
+const ObjectAdmin iam.RoleName = "roles/storage.objectAdmin"
+
+// BackendConfigFile is the file each module's `tofu init -backend-config` reads
+const BackendConfigFile = "backend-config.hcl"
+
+// publicMembers make a bucket readable or writable outside the project
+var publicMembers = []string{"allUsers", "allAuthenticatedUsers"}
+
+// Options describes the backend to set up
+type Options struct {
+	// Locations maps each module to its state bucket and prefix, as
+	// stack.StateLocations returns them. The bucket ${project_id}-tfstate is
+	// created in project_id.
+	Locations map[string]stack.StateLocation
+	// Location is where missing buckets are created, e.g. the region
+	Location string
+	// Members are granted ObjectAdmin, e.g. user:alice@example.com or
+	// serviceAccount:deployer@P.iam.gserviceaccount.com
+	Members []string
+	// ModuleDir returns a module's directory; planfixture.ModuleDir when nil
+	ModuleDir func(module string) string
+	// Force overwrites a backend config that points elsewhere
+	Force bool
+}
+
+// Finding is one setting that differs from what the backend needs
+type Finding struct {
+	// Resource is gs://<bucket> or a backend config path
+	Resource string
+	Setting  string
+	Got      string
+	Want     string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s is %s, want %s", f.Resource, f.Setting, f.Got, f.Want)
+}
+
+// Report lists the findings; after Apply they have been fixed
+type Report struct {
+	Findings []Finding
+}
+
+// Check reports how the backend differs from opts without changing anything
+func Check(ctx context.Context, client *storage.Client, opts Options) (*Report, error) {
+	return run(ctx, client, opts, false)
+}
+
+// Apply creates or fixes whatever Check would report
+func Apply(ctx context.Context, client *storage.Client, opts Options) (*Report, error) {
+	return run(ctx, client, opts, true)
+}
+
+func run(ctx context.Context, client *storage.Client, opts Options, fix bool) (*Report, error) {
+	if len(opts.Locations) == 0 {
+		return nil, errors.New("bootstrap: no state locations")
+	}
+	report := &Report{}
+
+	buckets := map[string]bool{}
+	for _, loc := range opts.Locations {
+		buckets[loc.Bucket] = true
+	}
+	for _, name := range sortedKeys(buckets) {
+		if err := bucket(ctx, client, name, opts, fix, report); err != nil {
+			return report, fmt.Errorf("gs://%s: %w", name, err)
+		}
+	}
+
+	moduleDir := opts.ModuleDir
+	if moduleDir == nil {
+		moduleDir = planfixture.ModuleDir
+	}
+	modules := make([]string, 0, len(opts.Locations))
+	for module := range opts.Locations {
+		modules = append(modules, module)
+	}
+	sort.Strings(modules)
+	for _, module := range modules {
+		path := filepath.Join(moduleDir(module), BackendConfigFile)
+		if err := backendConfig(path, opts.Locations[module], opts.Force, fix, report); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// bucket creates the bucket or checks its settings and IAM bindings
+func bucket(ctx context.Context, client *storage.Client, name string, opts Options, fix bool, report *Report) error {
+	resource := "gs://" + name
+	handle := client.Bucket(name)
+	attrs, err := handle.Attrs(ctx)
+	if errors.Is(err, storage.ErrBucketNotExist) {
+		report.Findings = append(report.Findings, Finding{resource, "bucket", "missing", "present"})
+		if !fix {
+			// every other finding would follow from the bucket not existing
+			for _, member := range opts.Members {
+				report.Findings = append(report.Findings, Finding{resource, string(ObjectAdmin) + " for " + member, "missing", "granted"})
+			}
+			return nil
+		}
+		project, ok := strings.CutSuffix(name, "-tfstate")
+		if !ok {
+			return fmt.Errorf("cannot tell the project of a bucket not named <project>-tfstate")
+		}
+		err = handle.Create(ctx, project, &storage.BucketAttrs{
+			Location:                 opts.Location,
+			VersioningEnabled:        true,
+			UniformBucketLevelAccess: storage.UniformBucketLevelAccess{Enabled: true},
+			PublicAccessPrevention:   storage.PublicAccessPreventionEnforced,
+		})
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	} else {
+		var update storage.BucketAttrsToUpdate
+		changed := false
+		if !attrs.VersioningEnabled {
+			report.Findings = append(report.Findings, Finding{resource, "versioning", "off", "on"})
+			update.VersioningEnabled, changed = true, true
+		}
+		if !attrs.UniformBucketLevelAccess.Enabled {
+			report.Findings = append(report.Findings, Finding{resource, "uniform bucket-level access", "off", "on"})
+			update.UniformBucketLevelAccess, changed = &storage.UniformBucketLevelAccess{Enabled: true}, true
+		}
+		if attrs.PublicAccessPrevention != storage.PublicAccessPreventionEnforced {
+			got := attrs.PublicAccessPrevention.String()
+			if got == "" {
+				got = "unset"
+			}
+			report.Findings = append(report.Findings, Finding{resource, "public access prevention", got, storage.PublicAccessPreventionEnforced.String()})
+			update.PublicAccessPrevention, changed = storage.PublicAccessPreventionEnforced, true
+		}
+		if fix && changed {
+			if _, err := handle.Update(ctx, update); err != nil {
+				return err
+			}
+		}
+	}
+
+	policy, err := handle.IAM().Policy(ctx)
+	if err != nil {
+		return err
+	}
+	changed := false
+	for _, role := range policy.Roles() {
+		for _, member := range publicMembers {
+			if policy.HasRole(member, role) {
+				report.Findings = append(report.Findings, Finding{resource, string(role) + " for " + member, "granted", "not granted"})
+				policy.Remove(member, role)
+				changed = true
+			}
+		}
+	}
+	for _, member := range opts.Members {
+		if !policy.HasRole(member, ObjectAdmin) {
+			report.Findings = append(report.Findings, Finding{resource, string(ObjectAdmin) + " for " + member, "missing", "granted"})
+			policy.Add(member, ObjectAdmin)
+			changed = true
+		}
+	}
+	if fix && changed {
+		return handle.IAM().SetPolicy(ctx, policy)
+	}
+	return nil
+}
+
+// backendConfig writes the module's backend config, leaving a matching one
+// alone and refusing to replace one that points elsewhere unless forced
+func backendConfig(path string, loc stack.StateLocation, force, fix bool, report *Report) error {
+	want := fmt.Sprintf("bucket=%s prefix=%s", loc.Bucket, loc.Prefix)
+	var existing migrate.BackendConfig
+	_, err := os.Stat(path)
+	if err == nil {
+		existing, err = migrate.ReadBackendConfig(path)
+	}
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		report.Findings = append(report.Findings, Finding{path, "backend config", "missing", want})
+	case err != nil:
+		return err
+	case existing.Bucket == loc.Bucket && existing.Prefix == loc.Prefix:
+		return nil
+	default:
+		report.Findings = append(report.Findings, Finding{path, "backend config", fmt.Sprintf("bucket=%s prefix=%s", existing.Bucket, existing.Prefix), want})
+		if fix && !force {
+			return fmt.Errorf("%s points at gs://%s/%s; pass force to replace it", path, existing.Bucket, existing.Prefix)
+		}
+	}
+	if !fix {
+		return nil
+	}
+	content := fmt.Sprintf(`# Generated by cloudedge bootstrap. The bucket and prefix match the
+# terraform_remote_state blocks that read this module's state.
+bucket = %q
+prefix = %q
+`, loc.Bucket, loc.Prefix)
+	return os.WriteFile(path, []byte(content), 0o600)
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,121 @@
+package bootstrap
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+
+	"vibetics-cloudedge/tests/fakegcs"
+	"vibetics-cloudedge/tests/migrate"
+	"vibetics-cloudedge/tests/stack"
+)
+
+func setup(t *testing.T) (*fakegcs.Server, *storage.Client, Options) {
+	t.Helper()
+	s := fakegcs.NewServer()
+	t.Cleanup(s.Close)
+	client, err := storage.NewClient(context.Background(), option.WithEndpoint(s.Endpoint()), option.WithoutAuthentication())
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+
+	dir := t.TempDir()
+	opts := Options{
+		Locations: map[string]stack.StateLocation{
+			"project-singleton": {Bucket: "test-project-tfstate", Prefix: "test-project-singleton"},
+			"core":              {Bucket: "test-project-tfstate", Prefix: "test-project-core"},
+		},
+		Location:  "US-CENTRAL1",
+		Members:   []string{"user:alice@example.com"},
+		ModuleDir: func(module string) string { return filepath.Join(dir, module) },
+	}
+	for module := range opts.Locations {
+		require.NoError(t, os.MkdirAll(opts.ModuleDir(module), 0o755))
+	}
+	return s, client, opts
+}
+
+func settings(r *Report) []string {
+	var out []string
+	for _, f := range r.Findings {
+		out = append(out, f.Setting+": "+f.Got)
+	}
+	return out
+}
+
+func TestApplyIsIdempotent(t *testing.T) {
+	t.Parallel()
+	s, client, opts := setup(t)
+	ctx := context.Background()
+
+	report, err := Check(ctx, client, opts)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"bucket: missing", "roles/storage.objectAdmin for user:alice@example.com: missing",
+		"backend config: missing", "backend config: missing",
+	}, settings(report))
+	_, ok := s.BucketAttrs("test-project-tfstate")
+	assert.False(t, ok, "check changes nothing")
+
+	_, err = Apply(ctx, client, opts)
+	require.NoError(t, err)
+	attrs, ok := s.BucketAttrs("test-project-tfstate")
+	require.True(t, ok)
+	assert.True(t, attrs.Versioning.Enabled)
+	assert.True(t, attrs.IAMConfiguration.UniformBucketLevelAccess.Enabled)
+	assert.Equal(t, "enforced", attrs.IAMConfiguration.PublicAccessPrevention)
+	policy, _ := s.BucketPolicy("test-project-tfstate")
+	assert.Equal(t, []fakegcs.Binding{{Role: "roles/storage.objectAdmin", Members: []string{"user:alice@example.com"}}}, policy.Bindings)
+	config, err := migrate.ReadBackendConfig(filepath.Join(opts.ModuleDir("core"), BackendConfigFile))
+	require.NoError(t, err)
+	assert.Equal(t, migrate.BackendConfig{Bucket: "test-project-tfstate", Prefix: "test-project-core"}, config)
+
+	report, err = Check(ctx, client, opts)
+	require.NoError(t, err)
+	assert.Empty(t, report.Findings)
+	report, err = Apply(ctx, client, opts)
+	require.NoError(t, err)
+	assert.Empty(t, report.Findings)
+}
+
+func TestCheckReportsDrift(t *testing.T) {
+	t.Parallel()
+	s, client, opts := setup(t)
+	ctx := context.Background()
+	require.NoError(t, s.CreateBucket("test-project-tfstate"))
+	require.NoError(t, s.SetBucketPolicy("test-project-tfstate", []fakegcs.Binding{
+		{Role: "roles/storage.objectAdmin", Members: []string{"user:alice@example.com"}},
+		{Role: "roles/storage.objectViewer", Members: []string{"allUsers"}},
+	}))
+	opts.Locations = map[string]stack.StateLocation{"core": opts.Locations["core"]}
+	path := filepath.Join(opts.ModuleDir("core"), BackendConfigFile)
+	require.NoError(t, os.WriteFile(path, []byte("bucket = \"other-tfstate\"\nprefix = \"terraform/state\"\n"), 0o600))
+
+	report, err := Check(ctx, client, opts)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"versioning: off",
+		"uniform bucket-level access: off",
+		"public access prevention: unset",
+		"roles/storage.objectViewer for allUsers: granted",
+		"backend config: bucket=other-tfstate prefix=terraform/state",
+	}, settings(report))
+
+	// the bucket is fixed, but a config pointing elsewhere needs force
+	_, err = Apply(ctx, client, opts)
+	assert.ErrorContains(t, err, "pass force")
+	policy, _ := s.BucketPolicy("test-project-tfstate")
+	assert.Equal(t, []fakegcs.Binding{{Role: "roles/storage.objectAdmin", Members: []string{"user:alice@example.com"}}}, policy.Bindings)
+
+	opts.Force = true
+	_, err = Apply(ctx, client, opts)
+	require.NoError(t, err)
+	report, err = Check(ctx, client, opts)
+	require.NoError(t, err)
+	assert.Empty(t, report.Findings)
+}
@@ -0,0 +1,165 @@
+package checkov
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// BaselineVersion is the baseline file format this package understands
+const BaselineVersion = 1
+
+// ThresholdEnv overrides DefaultThreshold for the contract scan
+const ThresholdEnv = "CLOUDEDGE_CHECKOV_THRESHOLD"
+
+// DefaultThreshold matches hard-fail-on in .checkov.yaml: HIGH and CRITICAL
+// findings block a change
+const DefaultThreshold = High
+
+// dateLayout is the layout of an acceptance's expires date
+const dateLayout = "2006-01-02"
+
+// Baseline lists the failed checks a module has accepted for now
+type Baseline struct {
+	Version  int          `yaml:"version"`
+	Module   string       `yaml:"module"`
+	Accepted []Acceptance `yaml:"accepted"`
+}
+
+// Acceptance accepts one check, on one resource or on every resource of the
+// module, until the end of the day it expires
+type Acceptance struct {
+	CheckID string `yaml:"check_id"`
+	// Resource is empty to accept the check on every resource
+	Resource string `yaml:"resource"`
+	Reason   string `yaml:"reason"`
+	Expires  string `yaml:"expires"`
+
+	expires time.Time
+}
+
+func (a Acceptance) String() string {
+	if a.Resource == "" {
+		return a.CheckID
+	}
+	return a.CheckID + " on " + a.Resource
+}
+
+// matches reports whether a accepts f
+func (a Acceptance) matches(f Finding) bool {
+	return a.CheckID == f.CheckID && (a.Resource == "" || a.Resource == f.Resource)
+}
+
+// expired reports whether a has lapsed at now; an acceptance holds through
+// its expires date
+func (a Acceptance) expired(now time.Time) bool {
+	return !now.Before(a.expires.AddDate(0, 0, 1))
+}
+
+// LoadBaseline reads a baseline file. Every acceptance needs a reason and an
+// expires date, so nothing is accepted forever by accident.
+func LoadBaseline(path string) (*Baseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var b Baseline
+	if err := yaml.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if b.Version != BaselineVersion {
+		return nil, fmt.Errorf("%s: baseline version %d is not supported (want %d)", path, b.Version, BaselineVersion)
+	}
+	for i := range b.Accepted {
+		a := &b.Accepted[i]
+		if a.CheckID == "" {
+			return nil, fmt.Errorf("%s: accepted[%d] has no check_id", path, i)
+		}
+		if strings.TrimSpace(a.Reason) == "" {
+			return nil, fmt.Errorf("%s: %s has no reason", path, a)
+		}
+		if a.expires, err = time.Parse(dateLayout, a.Expires); err != nil {
+			return nil, fmt.Errorf("%s: %s: expires %q is not a YYYY-MM-DD date", path, a, a.Expires)
+		}
+	}
+	return &b, nil
+}
+
+// ThresholdFromEnv returns the severity named by ThresholdEnv, or
+// DefaultThreshold when it is unset
+func ThresholdFromEnv() (Severity, error) {
+	value := os.Getenv(ThresholdEnv)
+	if strings.TrimSpace(value) == "" {
+		return DefaultThreshold, nil
+	}
+	threshold, err := ParseSeverity(value)
+	if err != nil {
+		return Unknown, fmt.Errorf("%s: %w", ThresholdEnv, err)
+	}
+	return threshold, nil
+}
+
+// Result sorts the findings of one scan against a baseline
+type Result struct {
+	// New are findings at or above the threshold that the baseline does not
+	// accept; they fail the gate
+	New []Finding
+	// Expired are findings whose acceptance has lapsed; they fail the gate
+	Expired []Finding
+	// Accepted are findings the baseline still accepts
+	Accepted []Finding
+	// BelowThreshold are findings under the threshold, reported only
+	BelowThreshold []Finding
+	// Fixed are acceptances no finding matches any more; they should be
+	// removed from the baseline
+	Fixed []Acceptance
+}
+
+// Failed reports whether the gate blocks the change
+func (r Result) Failed() bool {
+	return len(r.New) > 0 || len(r.Expired) > 0
+}
+
+// Gate sorts findings against the baseline at now. Findings without a
+// severity are held to the threshold, since open-source Checkov reports none
+// and an unrated check is not known to be minor. A nil baseline accepts
+// nothing.
+func Gate(findings []Finding, baseline *Baseline, threshold Severity, now time.Time) Result {
+	var accepted []Acceptance
+	if baseline != nil {
+		accepted = baseline.Accepted
+	}
+	used := make([]bool, len(accepted))
+
+	var r Result
+	for _, f := range findings {
+		match := -1
+		for i, a := range accepted {
+			if a.matches(f) {
+				used[i] = true
+				if match < 0 || !a.expired(now) {
+					match = i
+				}
+			}
+		}
+		switch {
+		case match >= 0 && !accepted[match].expired(now):
+			r.Accepted = append(r.Accepted, f)
+		case f.Severity != Unknown && f.Severity < threshold:
+			r.BelowThreshold = append(r.BelowThreshold, f)
+		case match >= 0:
+			r.Expired = append(r.Expired, f)
+		default:
+			r.New = append(r.New, f)
+		}
+	}
+	for i, a := range accepted {
+		if !used[i] {
+			r.Fixed = append(r.Fixed, a)
+		}
+	}
+	return r
+}
@@ -0,0 +1,233 @@
+// Package checkov reads Checkov scan results and gates on them. Results come
+// from `checkov -o json` or `checkov -o sarif`. A finding at or above the
+// severity threshold fails the gate unless the module's baseline accepts it
+// and the acceptance has not expired. Baseline entries that no longer match a
+// finding are reported as fixed, so the baseline shrinks as checks start
+// passing.
+package checkov
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Severity ranks a failed check. Checkov only reports severities when it is
+// connected to the Prisma Cloud platform; without one a finding's severity is
+// Unknown.
+type Severity int
+
+const (
+	Unknown Severity = iota
+	Low
+	Medium
+	High
+	Critical
+)
+
+var severityNames = []string{"UNKNOWN", "LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+func (s Severity) String() string {
+	if s < Unknown || s > Critical {
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+// ParseSeverity reads a severity name such as HIGH, case-insensitively. INFO
+// counts as LOW.
+func ParseSeverity(name string) (Severity, error) {
+	upper := strings.ToUpper(strings.TrimSpace(name))
+	if upper == "INFO" {
+		return Low, nil
+	}
+	for s := Low; s <= Critical; s++ {
+		if severityNames[s] == upper {
+			return s, nil
+		}
+	}
+	return Unknown, fmt.Errorf("unknown severity %q (want one of LOW, MEDIUM, HIGH, CRITICAL)", name)
+}
+
+// Finding is one failed check on one resource
+type Finding struct {
+	CheckID  string
+	Name     string
+	Severity Severity
+	// Resource is the resource address, e.g. google_compute_firewall.allow_ssh
+	Resource string
+	File     string
+	Line     int
+	// Guideline links to the check's documentation
+	Guideline string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s %s on %s (%s:%d): %s", f.Severity, f.CheckID, f.Resource, f.File, f.Line, f.Name)
+}
+
+// jsonReport is one framework's section of `checkov -o json`
+type jsonReport struct {
+	Results struct {
+		FailedChecks []struct {
+			CheckID       string  `json:"check_id"`
+			CheckName     string  `json:"check_name"`
+			Severity      *string `json:"severity"`
+			Resource      string  `json:"resource"`
+			FilePath      string  `json:"file_path"`
+			FileLineRange []int   `json:"file_line_range"`
+			Guideline     string  `json:"guideline"`
+		} `json:"failed_checks"`
+	} `json:"results"`
+}
+
+// ParseJSON reads the output of `checkov -o json`: a single report, a list of
+// reports when several frameworks ran, or a bare summary when there was
+// nothing to scan
+func ParseJSON(data []byte) ([]Finding, error) {
+	var reports []jsonReport
+	trimmed := strings.TrimSpace(string(data))
+	if strings.HasPrefix(trimmed, "[") {
+		if err := json.Unmarshal(data, &reports); err != nil {
+			return nil, fmt.Errorf("checkov JSON: %w", err)
+		}
+	} else {
+		var report jsonReport
+		if err := json.Unmarshal(data, &report); err != nil {
+			return nil, fmt.Errorf("checkov JSON: %w", err)
+		}
+		reports = append(reports, report)
+	}
+
+	var findings []Finding
+	for _, report := range reports {
+		for _, c := range report.Results.FailedChecks {
+			f := Finding{CheckID: c.CheckID, Name: c.CheckName, Resource: c.Resource, File: c.FilePath, Guideline: c.Guideline}
+			if c.Severity != nil {
+				f.Severity, _ = ParseSeverity(*c.Severity)
+			}
+			if len(c.FileLineRange) > 0 {
+				f.Line = c.FileLineRange[0]
+			}
+			findings = append(findings, f)
+		}
+	}
+	sortFindings(findings)
+	return findings, nil
+}
+
+// sarifLog is the part of `checkov -o sarif` the gate reads
+type sarifLog struct {
+	Runs []struct {
+		Tool struct {
+			Driver struct {
+				Rules []struct {
+					ID               string `json:"id"`
+					HelpURI          string `json:"helpUri"`
+					ShortDescription struct {
+						Text string `json:"text"`
+					} `json:"shortDescription"`
+					Properties struct {
+						SecuritySeverity string `json:"security-severity"`
+					} `json:"properties"`
+				} `json:"rules"`
+			} `json:"driver"`
+		} `json:"tool"`
+		Results []struct {
+			RuleID  string `json:"ruleId"`
+			Message struct {
+				Text string `json:"text"`
+			} `json:"message"`
+			Locations []struct {
+				PhysicalLocation struct {
+					ArtifactLocation struct {
+						URI string `json:"uri"`
+					} `json:"artifactLocation"`
+					Region struct {
+						StartLine int `json:"startLine"`
+					} `json:"region"`
+				} `json:"physicalLocation"`
+				LogicalLocations []struct {
+					Name string `json:"name"`
+				} `json:"logicalLocations"`
+			} `json:"locations"`
+		} `json:"results"`
+	} `json:"runs"`
+}
+
+// ParseSARIF reads the output of `checkov -o sarif`. A rule's
+// security-severity score maps onto the CVSS bands: 9.0 and up is CRITICAL,
+// 7.0 HIGH, 4.0 MEDIUM and anything above zero LOW.
+func ParseSARIF(data []byte) ([]Finding, error) {
+	var log sarifLog
+	if err := json.Unmarshal(data, &log); err != nil {
+		return nil, fmt.Errorf("checkov SARIF: %w", err)
+	}
+	var findings []Finding
+	for _, run := range log.Runs {
+		rules := map[string]int{}
+		for i, rule := range run.Tool.Driver.Rules {
+			rules[rule.ID] = i
+		}
+		for _, result := range run.Results {
+			f := Finding{CheckID: result.RuleID, Name: result.Message.Text}
+			if i, ok := rules[result.RuleID]; ok {
+				rule := run.Tool.Driver.Rules[i]
+				if rule.ShortDescription.Text != "" {
+					f.Name = rule.ShortDescription.Text
+				}
+				f.Guideline = rule.HelpURI
+				var score float64
+				if _, err := fmt.Sscan(rule.Properties.SecuritySeverity, &score); err == nil {
+					f.Severity = scoreSeverity(score)
+				}
+			}
+			if len(result.Locations) > 0 {
+				loc := result.Locations[0]
+				f.File = loc.PhysicalLocation.ArtifactLocation.URI
+				f.Line = loc.PhysicalLocation.Region.StartLine
+				if len(loc.LogicalLocations) > 0 {
+					f.Resource = loc.LogicalLocations[0].Name
+				}
+			}
+			findings = append(findings, f)
+		}
+	}
+	sortFindings(findings)
+	return findings, nil
+}
+
+func scoreSeverity(score float64) Severity {
+	switch {
+	case score >= 9:
+		return Critical
+	case score >= 7:
+		return High
+	case score >= 4:
+		return Medium
+	case score > 0:
+		return Low
+	}
+	return Unknown
+}
+
+// Parse reads JSON or SARIF output, telling them apart by SARIF's runs key
+func Parse(data []byte) ([]Finding, error) {
+	var probe map[string]json.RawMessage
+	if json.Unmarshal(data, &probe) == nil {
+		if _, ok := probe["runs"]; ok {
+			return ParseSARIF(data)
+		}
+	}
+	return ParseJSON(data)
+}
+
+func sortFindings(findings []Finding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].CheckID != findings[j].CheckID {
+			return findings[i].CheckID < findings[j].CheckID
+		}
+		return findings[i].Resource < findings[j].Resource
+	})
+}
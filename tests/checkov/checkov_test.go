@@ -0,0 +1,112 @@
+package checkov
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parseFile(t *testing.T, path string) []Finding {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	findings, err := Parse(data)
+	require.NoError(t, err)
+	return findings
+}
+
+func TestParseJSON(t *testing.T) {
+	t.Parallel()
+	findings := parseFile(t, "testdata/core.json")
+	require.Len(t, findings, 3, "passed checks and the empty secrets report are left out")
+	assert.Equal(t, Finding{
+		CheckID:   "CKV_GCP_2",
+		Name:      "Ensure Google compute firewall ingress does not allow unrestricted ssh access",
+		Severity:  High,
+		Resource:  "google_compute_firewall.allow_ssh",
+		File:      "/core.tf",
+		Line:      240,
+		Guideline: "https://docs.prismacloud.io/en/enterprise-edition/policy-reference/google-cloud-policies/google-cloud-networking-policies/bc-gcp-networking-1",
+	}, findings[0])
+	assert.Equal(t, "CKV_GCP_26", findings[1].CheckID)
+	assert.Equal(t, Low, findings[1].Severity)
+	assert.Equal(t, Unknown, findings[2].Severity, "open-source checkov reports severity null")
+
+	// checkov prints only a summary when a directory has nothing to scan
+	findings, err := ParseJSON([]byte(`{"passed": 0, "failed": 0, "skipped": 0, "parsing_errors": 0, "resource_count": 0, "checkov_version": "3.2.255"}`))
+	require.NoError(t, err)
+	assert.Empty(t, findings)
+}
+
+func TestParseSARIF(t *testing.T) {
+	t.Parallel()
+	findings := parseFile(t, "testdata/core.sarif")
+	require.Len(t, findings, 2)
+	assert.Equal(t, "CKV_GCP_2", findings[0].CheckID)
+	assert.Equal(t, High, findings[0].Severity, "security-severity 7.0")
+	assert.Equal(t, "google_compute_firewall.allow_ssh", findings[0].Resource)
+	assert.Equal(t, "core.tf", findings[0].File)
+	assert.Equal(t, 240, findings[0].Line)
+	assert.Equal(t, Unknown, findings[1].Severity, "rule without security-severity")
+}
+
+func TestParseSeverity(t *testing.T) {
+	t.Parallel()
+	for name, want := range map[string]Severity{"critical": Critical, " HIGH ": High, "Medium": Medium, "INFO": Low} {
+		got, err := ParseSeverity(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, want, got, name)
+	}
+	_, err := ParseSeverity("severe")
+	assert.ErrorContains(t, err, `unknown severity "severe"`)
+}
+
+func TestGate(t *testing.T) {
+	t.Parallel()
+	baseline, err := LoadBaseline("testdata/baseline.yaml")
+	require.NoError(t, err)
+	findings := parseFile(t, "testdata/core.json")
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+	result := Gate(findings, baseline, High, now)
+	assert.True(t, result.Failed())
+	assert.Empty(t, result.New)
+	require.Len(t, result.Expired, 1)
+	assert.Equal(t, "CKV_GCP_2", result.Expired[0].CheckID, "accepted until 2026-09-30")
+	require.Len(t, result.Accepted, 1)
+	assert.Equal(t, "CKV_GCP_74", result.Accepted[0].CheckID)
+	require.Len(t, result.BelowThreshold, 1)
+	assert.Equal(t, "CKV_GCP_26", result.BelowThreshold[0].CheckID)
+	require.Len(t, result.Fixed, 1)
+	assert.Equal(t, "CKV_GCP_32 on google_compute_instance.bastion", result.Fixed[0].String())
+
+	// the acceptance holds through its expires date
+	result = Gate(findings, baseline, High, time.Date(2026, 9, 30, 23, 59, 0, 0, time.UTC))
+	assert.False(t, result.Failed())
+
+	// without a baseline, unrated findings are held to the threshold
+	result = Gate(findings, nil, Critical, now)
+	require.Len(t, result.New, 1)
+	assert.Equal(t, "CKV_GCP_74", result.New[0].CheckID)
+	assert.Len(t, result.BelowThreshold, 2)
+}
+
+func TestLoadBaselineRejectsOpenEndedAcceptance(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	for name, body := range map[string]string{
+		"no reason":  "version: 1\naccepted:\n  - check_id: CKV_GCP_2\n    expires: 2027-01-01\n",
+		"no expiry":  "version: 1\naccepted:\n  - check_id: CKV_GCP_2\n    reason: later\n",
+		"bad date":   "version: 1\naccepted:\n  - check_id: CKV_GCP_2\n    reason: later\n    expires: next year\n",
+		"no version": "accepted: []\n",
+	} {
+		path := filepath.Join(dir, name+".yaml")
+		require.NoError(t, os.WriteFile(path, []byte(body), 0o600))
+		_, err := LoadBaseline(path)
+		assert.Error(t, err, name)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+
+	"vibetics-cloudedge/tests/bootstrap"
+	"vibetics-cloudedge/tests/planfixture"
+	"vibetics-cloudedge/tests/stack"
+	"vibetics-cloudedge/tests/testconfig"
+)
+
+// runBootstrap sets up the state buckets and each module's backend config,
+// then runs `tofu init -migrate-state` so existing local state moves into the
+// bucket. The state locations are evaluated from core's variables, taken
+// from the TF_VAR_* environment as `source .env` sets it and parsed by type
+// as tofu does. With -check it only reports drift and exits non-zero when
+// there is any.
+func runBootstrap(args []string) error {
+	fs := flag.NewFlagSet("bootstrap", flag.ContinueOnError)
+	check := fs.Bool("check", false, "report drift without changing anything")
+	force := fs.Bool("force", false, "replace backend configs that point at another bucket or prefix")
+	location := fs.String("location", os.Getenv("TF_VAR_region"), "location of buckets that need creating")
+	var members memberFlags
+	fs.Var(&members, "member", "grant roles/storage.objectAdmin, e.g. user:alice@example.com (repeatable)")
+	initModules := fs.Bool("init", true, "run tofu init -migrate-state in each module afterwards")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	vars, err := stack.EnvVars(os.Environ())
+	if err != nil {
+		return err
+	}
+	locations, err := stack.StateLocations(vars)
+	if err != nil {
+		return fmt.Errorf("evaluating the state locations from TF_VAR_*: %w", err)
+	}
+
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	opts := bootstrap.Options{Locations: locations, Location: *location, Members: members, Force: *force}
+	if *check {
+		report, err := bootstrap.Check(ctx, client, opts)
+		if err != nil {
+			return err
+		}
+		for _, f := range report.Findings {
+			fmt.Println(f)
+		}
+		if len(report.Findings) > 0 {
+			return fmt.Errorf("%d settings drifted", len(report.Findings))
+		}
+		fmt.Println("No drift.")
+		return nil
+	}
+
+	report, err := bootstrap.Apply(ctx, client, opts)
+	if report != nil {
+		for _, f := range report.Findings {
+			fmt.Printf("Fixed %s\n", f)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if !*initModules {
+		return nil
+	}
+	for _, module := range testconfig.Modules {
+		fmt.Printf("Initialising %s...\n", module)
+		options := &terraform.Options{TerraformDir: planfixture.ModuleDir(module), NoColor: true}
+		if _, err := terraform.RunTerraformCommandE(cliT{name: module}, options,
+			"init", "-input=false", "-backend-config="+bootstrap.BackendConfigFile, "-migrate-state", "-force-copy"); err != nil {
+			return fmt.Errorf("initialising %s: %w", module, err)
+		}
+	}
+	return nil
+}
+
+// memberFlags collects repeated -member flags
+type memberFlags []string
+
+func (m *memberFlags) String() string { return strings.Join(*m, ",") }
+
+func (m *memberFlags) Set(member string) error {
+	if !strings.Contains(member, ":") {
+		return errors.New("a member is type:identity, e.g. user:alice@example.com")
+	}
+	*m = append(*m, member)
+	return nil
+}
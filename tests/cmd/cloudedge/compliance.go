@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"vibetics-cloudedge/tests/compliance"
+	"vibetics-cloudedge/tests/planfixture"
+)
+
+// runCompliance evaluates a control catalog against plans and states. Each
+// argument is a recorded scenario name or a plan or state JSON file (`tofu
+// show -json`, or a raw .tfstate); all of them form one inventory, so the
+// modules of a deployment are checked together.
+func runCompliance(args []string) error {
+	fs := flag.NewFlagSet("compliance", flag.ContinueOnError)
+	catalog := fs.String("catalog", "nist-800-53", "control catalog to evaluate")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: cloudedge compliance [-catalog name] [-json] <scenario|plan.json|state.json|.tfstate>...")
+	}
+
+	var inv compliance.Inventory
+	for _, source := range fs.Args() {
+		resources, err := loadInventory(source)
+		if err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+		inv = append(inv, resources...)
+	}
+	report, err := compliance.Evaluate(*catalog, inv)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		for _, result := range report.Results {
+			fmt.Printf("%-6s %-15s %s\n", result.Control, strings.ToUpper(string(result.Status)), result.Title)
+			for _, f := range result.Evidence {
+				fmt.Printf("       %-15s %s: %s\n", f.Status, f.Address, f.Detail)
+			}
+		}
+	}
+	if failed := report.Failed(); len(failed) > 0 {
+		return fmt.Errorf("%d of %d controls failed", len(failed), len(report.Results))
+	}
+	return nil
+}
+
+// loadInventory reads a plan or state file, or the recorded plan of a
+// scenario when source is neither a .json nor a .tfstate path
+func loadInventory(source string) (compliance.Inventory, error) {
+	if strings.HasSuffix(source, ".json") || strings.HasSuffix(source, ".tfstate") {
+		return compliance.Load(source)
+	}
+	plan, err := planfixture.Load(source)
+	if err != nil {
+		return nil, err
+	}
+	return compliance.FromPlan(&plan.RawPlan), nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+
+	"vibetics-cloudedge/tests/fakecloudflare"
+)
+
+// runFakeCloudflare serves the fake Cloudflare API until interrupted and
+// prints the exports that point tofu's cloudflare provider at it
+func runFakeCloudflare(args []string) error {
+	fs := flag.NewFlagSet("fake-cloudflare", flag.ContinueOnError)
+	zones := fs.String("zones", fakecloudflare.DefaultZoneName, "comma-separated zones to serve")
+	dir := fs.String("dir", os.TempDir(), "directory the CA bundle is written to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	server, err := fakecloudflare.NewServer(fakecloudflare.WithZones(strings.Split(*zones, ",")...))
+	if err != nil {
+		return err
+	}
+	defer server.Close()
+
+	env, err := server.ProviderEnv(*dir)
+	if err != nil {
+		return err
+	}
+	for name, value := range server.Vars() {
+		env["TF_VAR_"+name] = fmt.Sprint(value)
+	}
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("export %s=%q\n", name, env[name])
+	}
+	fmt.Fprintf(os.Stderr, "Serving %s at %s; press Ctrl-C to stop\n", *zones, server.BaseURL())
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+	return nil
+}
@@ -0,0 +1,94 @@
+// Command cloudedge bundles the operational helpers of the test suite. Run it
+// from the tests module:
+//
+//	go run ./cmd/cloudedge <command> [flags]
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// command is a cloudedge subcommand
+type command struct {
+	summary string
+	run     func(args []string) error
+}
+
+var commands = map[string]command{
+	"bootstrap": {
+		summary: "Create or check the state buckets and each module's backend config",
+		run:     runBootstrap,
+	},
+	"compliance": {
+		summary: "Evaluate a compliance control catalog against plans and states",
+		run:     runCompliance,
+	},
+	"fake-cloudflare": {
+		summary: "Serve a local Cloudflare API for the core module's provider",
+		run:     runFakeCloudflare,
+	},
+	"migrate": {
+		summary: "Move the root OpenTofu configuration into deploy/opentofu/gcp",
+		run:     runMigrate,
+	},
+	"policy": {
+		summary: "Evaluate the CEL policy bundle and custom policies against plans",
+		run:     runPolicy,
+	},
+	"record-plans": {
+		summary: "Regenerate the contract plan fixtures with tofu",
+		run:     runRecordPlans,
+	},
+	"sweep": {
+		summary: "Delete the resources of abandoned prefixed test runs",
+		run:     runSweep,
+	},
+	"teardown": {
+		summary: "Destroy the deployed modules in reverse dependency order, with retries",
+		run:     runTeardown,
+	},
+	"threat-model": {
+		summary: "Check threat_modelling/threat-model.yaml against the module plans",
+		run:     runThreatModel,
+	},
+	"traffic-path": {
+		summary: "Resolve the load balancer path through the core and demo-web-app plans",
+		run:     runTrafficPath,
+	},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "cloudedge: unknown command %q\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "cloudedge %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: cloudedge <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", name, commands[name].summary)
+	}
+}
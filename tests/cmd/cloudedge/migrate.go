@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"cloud.google.com/go/storage"
+
+	"vibetics-cloudedge/tests/migrate"
+)
+
+// runMigrate moves the root OpenTofu configuration into its provider
+// directory. The state bucket and prefix come from the root
+// backend-config.hcl; the migration aborts while the state is locked, and
+// pushes the state to the same bucket under the -target prefix.
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	root := fs.String("root", "..", "repository root holding the configuration to move")
+	target := fs.String("target", migrate.DefaultTarget, "destination directory, relative to -root")
+	dryRun := fs.Bool("dry-run", false, "print the planned changes without touching files")
+	lockTimeout := fs.Duration("lock-timeout", 0, "how long to wait for a held state lock to be released")
+	noState := fs.Bool("no-state", false, "skip the lock check and state backup (no remote state yet)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	opts := migrate.Options{
+		Root:        *root,
+		Target:      *target,
+		DryRun:      *dryRun,
+		LockTimeout: *lockTimeout,
+	}
+	if !*noState {
+		backend, err := migrate.ReadBackendConfig(filepath.Join(*root, migrate.BackendConfigFile))
+		if err != nil {
+			return fmt.Errorf("%w (use -no-state if there is no remote state)", err)
+		}
+		client, err := storage.NewClient(context.Background())
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		opts.State = &migrate.GCSState{Client: client, Bucket: backend.Bucket, Prefix: backend.Prefix}
+		opts.Destination = &migrate.GCSState{Client: client, Bucket: backend.Bucket, Prefix: filepath.ToSlash(filepath.Clean(*target))}
+	}
+
+	start := time.Now()
+	result, err := migrate.Run(opts)
+	if err != nil {
+		return err
+	}
+	printMigration(result)
+	if !result.DryRun {
+		fmt.Printf("✓ Migrated in %s\n", time.Since(start).Round(time.Millisecond))
+		fmt.Printf("Next: tofu -chdir=%s init -reconfigure -backend-config=%s\n", filepath.Join(*root, *target), migrate.BackendConfigFile)
+	}
+	return nil
+}
+
+func printMigration(result *migrate.Result) {
+	verb := func(done, planned string) string {
+		if result.DryRun {
+			return planned
+		}
+		return done
+	}
+
+	if result.Backup != "" {
+		fmt.Printf("%s state to %s\n", verb("Backed up", "Would back up"), result.Backup)
+	}
+	for _, dir := range result.Deleted {
+		fmt.Printf("%s %s\n", verb("Deleted", "Would delete"), dir)
+	}
+	for _, m := range result.Moved {
+		fmt.Printf("%s %s -> %s\n", verb("Moved", "Would move"), m.From, m.To)
+	}
+	for _, c := range result.Copied {
+		fmt.Printf("%s %s -> %s\n", verb("Copied", "Would copy"), c.From, c.To)
+	}
+	for _, r := range result.Rewrites {
+		fmt.Printf("%s module %q source in %s: %s -> %s\n", verb("Rewrote", "Would rewrite"), r.Module, r.File, r.From, r.To)
+	}
+	if result.BackendPrefix != "" {
+		fmt.Printf("%s backend prefix to %q\n", verb("Set", "Would set"), result.BackendPrefix)
+	}
+	if result.PushedTo != "" {
+		fmt.Printf("%s state to %s\n", verb("Pushed", "Would push"), result.PushedTo)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"vibetics-cloudedge/tests/compliance"
+	"vibetics-cloudedge/tests/policy"
+)
+
+// runPolicy evaluates the bundled CEL policies, plus any in -dir directories
+// or CLOUDEDGE_POLICY_DIRS, against each plan in turn. Each argument is a
+// recorded scenario name or a `tofu show -json` plan file.
+func runPolicy(args []string) error {
+	fs := flag.NewFlagSet("policy", flag.ContinueOnError)
+	var dirs dirFlags
+	fs.Var(&dirs, "dir", "directory of extra policy files (repeatable)")
+	asJSON := fs.Bool("json", false, "print the reports as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: cloudedge policy [-dir path]... [-json] <scenario|plan.json>...")
+	}
+
+	engine, err := policy.Load(append(policy.DirsFromEnv(), dirs...)...)
+	if err != nil {
+		return err
+	}
+	reports := map[string]*compliance.Report{}
+	failed := 0
+	for _, source := range fs.Args() {
+		plan, err := loadPlan(source)
+		if err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+		report := engine.Evaluate(&plan.RawPlan)
+		reports[source] = report
+		if len(report.Failed()) > 0 {
+			failed++
+		}
+		if *asJSON {
+			continue
+		}
+		fmt.Println(source)
+		for _, result := range report.Results {
+			fmt.Printf("  %-8s %-15s %s\n", result.Control, strings.ToUpper(string(result.Status)), result.Title)
+			for _, f := range result.Evidence {
+				if f.Status == compliance.Fail {
+					fmt.Printf("           %s: %s\n", f.Address, f.Detail)
+				}
+			}
+			if result.Remediation != "" {
+				fmt.Printf("           remediation: %s\n", result.Remediation)
+			}
+		}
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(reports); err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("policy violations in %d of %d plans", failed, fs.NArg())
+	}
+	return nil
+}
+
+// dirFlags collects repeated -dir flags
+type dirFlags []string
+
+func (d *dirFlags) String() string { return strings.Join(*d, ",") }
+
+func (d *dirFlags) Set(dir string) error {
+	*d = append(*d, dir)
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"vibetics-cloudedge/tests/fakegcs"
+	"vibetics-cloudedge/tests/planfixture"
+)
+
+// runRecordPlans plans every selected scenario with tofu and writes the redacted
+// `tofu show -json` output to the fixture directory. It needs the same
+// credentials as a live contract run (GCP for remote state, Cloudflare tokens).
+// With -fake-state, core's terraform_remote_state reads come from an
+// in-process GCS emulator seeded per scenario instead of the real buckets.
+func runRecordPlans(args []string) error {
+	fs := flag.NewFlagSet("record-plans", flag.ContinueOnError)
+	outDir := fs.String("out", filepath.Join("planfixture", "testdata", "plans"), "directory the fixtures are written to")
+	only := fs.String("scenario", "", "comma-separated scenario names to record (default: all)")
+	var overrides varFlags
+	fs.Var(&overrides, "var", "override a scenario variable as name=value (repeatable)")
+	fakeState := fs.Bool("fake-state", false, "serve remote state from a local GCS emulator seeded with fixture outputs")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var stateServer *fakegcs.Server
+	if *fakeState {
+		stateServer = fakegcs.NewServer()
+		defer stateServer.Close()
+		dir, err := os.MkdirTemp("", "fake-gcs-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		env, err := stateServer.BackendEnv(dir)
+		if err != nil {
+			return err
+		}
+		// tofu inherits the environment; the token would override the fake credentials
+		os.Unsetenv("GOOGLE_OAUTH_ACCESS_TOKEN")
+		for name, value := range env {
+			os.Setenv(name, value)
+		}
+	}
+
+	selected, err := selectScenarios(*only)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*outDir, 0o755); err != nil {
+		return err
+	}
+
+	for _, scenario := range selected {
+		for name, value := range overrides {
+			scenario.Vars[name] = value
+		}
+
+		if stateServer != nil && scenario.Module == "core" {
+			if err := stateServer.SeedRemoteStates(scenario.Vars); err != nil {
+				return fmt.Errorf("seeding remote state for %s: %w", scenario.Name, err)
+			}
+		}
+
+		fmt.Printf("Recording %s (%s)...\n", scenario.Name, scenario.Module)
+		planJSON, err := planfixture.Show(cliT{name: scenario.Name}, scenario)
+		if err != nil {
+			return fmt.Errorf("planning %s: %w", scenario.Name, err)
+		}
+
+		redacted, err := planfixture.Redact([]byte(planJSON))
+		if err != nil {
+			return fmt.Errorf("redacting %s: %w", scenario.Name, err)
+		}
+
+		path := filepath.Join(*outDir, scenario.Name+".json")
+		if err := os.WriteFile(path, redacted, 0o644); err != nil {
+			return err
+		}
+		fmt.Printf("✓ Wrote %s\n", path)
+	}
+	return nil
+}
+
+func selectScenarios(only string) ([]planfixture.Scenario, error) {
+	if only == "" {
+		return planfixture.Scenarios(), nil
+	}
+
+	var selected []planfixture.Scenario
+	for _, name := range strings.Split(only, ",") {
+		scenario, ok := planfixture.Lookup(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("unknown scenario %q", name)
+		}
+		selected = append(selected, scenario)
+	}
+	return selected, nil
+}
+
+// varFlags collects repeated -var name=value flags
+type varFlags map[string]interface{}
+
+func (v *varFlags) String() string { return "" }
+
+func (v *varFlags) Set(raw string) error {
+	name, value, ok := strings.Cut(raw, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("expected name=value, got %q", raw)
+	}
+	if *v == nil {
+		*v = varFlags{}
+	}
+	(*v)[name] = value
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	compute "google.golang.org/api/compute/v1"
+
+	"vibetics-cloudedge/tests/sweep"
+)
+
+// runSweep deletes the resources of prefixed test runs older than the TTL,
+// using the application default credentials
+func runSweep(args []string) error {
+	fs := flag.NewFlagSet("sweep", flag.ContinueOnError)
+	project := fs.String("project", os.Getenv("GOOGLE_PROJECT"), "project to sweep")
+	suffix := fs.String("project-suffix", "nonprod", "project-suffix label of the runs to sweep")
+	ttl := fs.Duration("ttl", 6*time.Hour, "age after which a run counts as abandoned")
+	dryRun := fs.Bool("dry-run", false, "list what would be deleted without deleting it")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), `Usage: cloudedge sweep [flags]
+
+Deletes the compute resources of prefixed test runs whose newest labelled
+forwarding rule or address is older than -ttl. Resources under an abandoned
+prefix that are themselves younger than -ttl are kept, as they may belong to a
+nested run (ci-42-x1y2z3 under ci-42) that has not labelled anything yet.
+
+Only compute resources are swept. Cloud Run services and Cloudflare DNS
+records named with an abandoned prefix are not; delete them by hand.
+
+`)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *project == "" {
+		return errors.New("no project: pass -project or set GOOGLE_PROJECT")
+	}
+
+	ctx := context.Background()
+	svc, err := compute.NewService(ctx)
+	if err != nil {
+		return err
+	}
+	report, err := sweep.Sweep(ctx, svc, sweep.Options{
+		Project: *project,
+		Labels:  map[string]string{"managed-by": "opentofu", "project-suffix": *suffix},
+		TTL:     *ttl,
+		DryRun:  *dryRun,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Abandoned runs: %v\nLive runs left alone: %v\n", report.Expired, report.Live)
+	verb := "Deleted"
+	deleted := report.Deleted
+	if report.DryRun {
+		verb, deleted = "Would delete", report.Found
+	}
+	for _, r := range deleted {
+		fmt.Printf("%s %s\n", verb, r)
+	}
+	for _, r := range report.Skipped {
+		fmt.Printf("Kept %s (created within the TTL)\n", r)
+	}
+	for _, f := range report.Failed {
+		fmt.Printf("Failed %s: %v\n", f.Resource, f.Err)
+	}
+	if len(report.Failed) > 0 {
+		return fmt.Errorf("%d resources could not be deleted", len(report.Failed))
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	terratesting "github.com/gruntwork-io/terratest/modules/testing"
+	"google.golang.org/api/googleapi"
+	logging "google.golang.org/api/logging/v2"
+
+	"vibetics-cloudedge/tests/planfixture"
+	"vibetics-cloudedge/tests/stack"
+	"vibetics-cloudedge/tests/teardown"
+	"vibetics-cloudedge/tests/testconfig"
+)
+
+// defaultTeardownModules leave project-singleton out: its budget and logging
+// bucket outlive the deployments and are only destroyed when named
+var defaultTeardownModules = []string{"demo-web-app", "core"}
+
+// runTeardown destroys the deployed modules in reverse dependency order.
+// Each module directory must be initialised with its backend, as after
+// `tofu init -backend-config=backend-config.hcl`; variables come from the
+// TF_VAR_* environment and the directory's tfvars. The result is written as
+// JSON to stdout, or to -result.
+func runTeardown(args []string) error {
+	fs := flag.NewFlagSet("teardown", flag.ContinueOnError)
+	modules := fs.String("modules", strings.Join(defaultTeardownModules, ","),
+		"comma-separated modules to destroy; project-singleton only when listed (one of "+strings.Join(testconfig.Modules, ", ")+")")
+	attempts := fs.Int("attempts", 3, "destroys to try per module")
+	wait := fs.Duration("wait", 10*time.Second, "wait after a retryable failure")
+	resultPath := fs.String("result", "", "file the JSON result is written to (default: stdout)")
+	checkBucket := fs.Bool("check-logs-bucket", true, "look up the logging bucket and forget it when GCP already deleted it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	options := map[string]*terraform.Options{}
+	for _, module := range strings.Split(*modules, ",") {
+		options[module] = &terraform.Options{TerraformDir: planfixture.ModuleDir(module), NoColor: true, Logger: logger.New(stderrLogger{})}
+	}
+	s, err := stack.New(options)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	td := &teardown.Teardown{
+		Stack:              s,
+		Tofu:               teardown.Terratest(cliT{name: "teardown"}),
+		MaxAttempts:        *attempts,
+		TimeBetweenRetries: *wait,
+		Logf: func(format string, args ...interface{}) {
+			fmt.Fprintf(os.Stderr, format+"\n", args...)
+		},
+	}
+	if *checkBucket {
+		svc, err := logging.NewService(ctx)
+		if err != nil {
+			return err
+		}
+		td.Buckets = logBuckets{svc}
+	}
+	result := td.Run(ctx)
+
+	out := os.Stdout
+	if *resultPath != "" {
+		f, err := os.Create(*resultPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(result); err != nil {
+		return err
+	}
+	if !result.Succeeded {
+		return errors.New("teardown incomplete; see the result for the modules left deployed")
+	}
+	return nil
+}
+
+// logBuckets reads bucket states from the Cloud Logging API
+type logBuckets struct {
+	svc *logging.Service
+}
+
+func (b logBuckets) LifecycleState(ctx context.Context, name string) (string, error) {
+	bucket, err := b.svc.Projects.Locations.Buckets.Get(name).Context(ctx).Do()
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+		return teardown.BucketNotFound, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return bucket.LifecycleState, nil
+}
+
+// stderrLogger keeps tofu's output off stdout, which carries the result
+type stderrLogger struct{}
+
+func (stderrLogger) Logf(t terratesting.TestingT, format string, args ...interface{}) {
+	logger.DoLog(t, 3, os.Stderr, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// cliT lets terratest helpers run outside `go test`. Failures are fatal because
+// there is no enclosing test to report them to.
+type cliT struct {
+	name string
+}
+
+func (t cliT) Fail()    { t.Fatal("failed") }
+func (t cliT) FailNow() { t.Fatal("failed") }
+
+func (t cliT) Fatal(args ...interface{}) {
+	log.Fatalf("%s: %s", t.name, fmt.Sprint(args...))
+}
+
+func (t cliT) Fatalf(format string, args ...interface{}) {
+	t.Fatal(fmt.Sprintf(format, args...))
+}
+
+func (t cliT) Error(args ...interface{}) { t.Fatal(args...) }
+
+func (t cliT) Errorf(format string, args ...interface{}) { t.Fatalf(format, args...) }
+
+func (t cliT) Name() string { return t.name }
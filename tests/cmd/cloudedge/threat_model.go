@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"vibetics-cloudedge/tests/planfixture"
+	"vibetics-cloudedge/tests/threatmodel"
+)
+
+// runThreatModel checks the Threagile model against plans. Each argument is
+// a recorded scenario name or a `tofu show -json` plan file; without any,
+// every recorded scenario is used.
+func runThreatModel(args []string) error {
+	fs := flag.NewFlagSet("threat-model", flag.ContinueOnError)
+	modelPath := fs.String("model", threatmodel.DefaultModelPath(), "Threagile model")
+	mappingPath := fs.String("mapping", threatmodel.DefaultMappingPath(), "asset mapping and claims")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	model, err := threatmodel.LoadModel(*modelPath)
+	if err != nil {
+		return err
+	}
+	mapping, err := threatmodel.LoadMapping(*mappingPath)
+	if err != nil {
+		return err
+	}
+	sources := fs.Args()
+	if len(sources) == 0 {
+		for _, scenario := range planfixture.Scenarios() {
+			sources = append(sources, scenario.Name)
+		}
+	}
+	var plans []*tfjson.Plan
+	for _, source := range sources {
+		plan, err := loadPlan(source)
+		if err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+		plans = append(plans, &plan.RawPlan)
+	}
+
+	report, err := threatmodel.Check(model, mapping, plans)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		for _, issue := range report.Issues {
+			fmt.Println(issue)
+		}
+	}
+	if len(report.Issues) > 0 {
+		return fmt.Errorf("%d disagreements between the threat model and %d plans", len(report.Issues), len(plans))
+	}
+	if !*asJSON {
+		fmt.Printf("Threat model agrees with %d plans\n", len(plans))
+	}
+	return nil
+}
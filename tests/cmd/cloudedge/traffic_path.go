@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+
+	"vibetics-cloudedge/tests/planfixture"
+	"vibetics-cloudedge/tests/planquery"
+	"vibetics-cloudedge/tests/trafficpath"
+)
+
+// runTrafficPath resolves the request path through the core and demo-web-app
+// plans and checks it against the pattern their enable_* flags select. Each
+// plan is a recorded scenario name or a `tofu show -json` file.
+func runTrafficPath(args []string) error {
+	fs := flag.NewFlagSet("traffic-path", flag.ContinueOnError)
+	core := fs.String("core", "core_psc_neg", "core plan: scenario name or plan JSON file")
+	demo := fs.String("demo-web-app", "demo_web_app_psc", "demo-web-app plan: scenario name or plan JSON file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	plans := map[string]*planquery.Plan{}
+	for module, source := range map[string]string{"core": *core, "demo-web-app": *demo} {
+		plan, err := loadPlan(source)
+		if err != nil {
+			return fmt.Errorf("%s: %w", module, err)
+		}
+		plans[module] = planquery.New(plan)
+	}
+
+	path, pattern, err := trafficpath.Verify(plans, nil)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Pattern %d (%s): %s\n\n%s", pattern.Number, pattern.Name, path, path.Describe())
+	return nil
+}
+
+// loadPlan reads a plan JSON file, or the recorded plan of a scenario when
+// source is not a .json path
+func loadPlan(source string) (*terraform.PlanStruct, error) {
+	if !strings.HasSuffix(source, ".json") {
+		return planfixture.Load(source)
+	}
+	data, err := os.ReadFile(source)
+	if err != nil {
+		return nil, err
+	}
+	return terraform.ParsePlanJSON(string(data))
+}
@@ -0,0 +1,271 @@
+package compliance
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// AdminPorts are the remote administration ports CIS 3.10 keeps off the
+// internet: SSH, Telnet, RDP, VNC and WinRM
+var AdminPorts = []int{22, 23, 3389, 5900, 5985, 5986}
+
+// weakCipherSuites are the suites CIS 3.9 rules out of a CUSTOM SSL policy
+var weakCipherSuites = []string{
+	"TLS_RSA_WITH_AES_128_GCM_SHA256",
+	"TLS_RSA_WITH_AES_256_GCM_SHA384",
+	"TLS_RSA_WITH_AES_128_CBC_SHA",
+	"TLS_RSA_WITH_AES_256_CBC_SHA",
+	"TLS_RSA_WITH_3DES_EDE_CBC_SHA",
+}
+
+// CISGCP checks the networking section of the CIS Google Cloud Platform
+// Foundation Benchmark against planned resources, so violations fail the
+// contract tests instead of a post-apply scan
+var CISGCP = []Control{
+	{
+		ID:          "3.1",
+		Title:       "The default network does not exist",
+		Remediation: "Use a custom-mode network and delete the default one; set the constraints/compute.skipDefaultNetworkCreation org policy so new projects start without it",
+		Evaluate:    noDefaultNetwork,
+	},
+	{
+		ID:          "3.6",
+		Title:       "SSH access is restricted from the internet",
+		Remediation: "Drop 0.0.0.0/0 from the rule's source_ranges; use IAP TCP forwarding (35.235.240.0/20) for SSH",
+		Evaluate:    portClosedToInternet(22),
+	},
+	{
+		ID:          "3.7",
+		Title:       "RDP access is restricted from the internet",
+		Remediation: "Drop 0.0.0.0/0 from the rule's source_ranges; use IAP TCP forwarding (35.235.240.0/20) for RDP",
+		Evaluate:    portClosedToInternet(3389),
+	},
+	{
+		ID:          "3.8",
+		Title:       "VPC Flow Logs are enabled for every subnet",
+		Remediation: "Add a log_config block to the google_compute_subnetwork",
+		Evaluate:    subnetFlowLogs,
+	},
+	{
+		ID:          "3.9",
+		Title:       "HTTPS and SSL proxies use an SSL policy without weak cipher suites",
+		Remediation: "Attach a google_compute_region_ssl_policy with profile MODERN and min_tls_version TLS_1_2, or profile RESTRICTED, through ssl_policy",
+		Evaluate:    proxiesUseStrongSSLPolicy,
+	},
+	{
+		ID:          "3.10",
+		Title:       "Administration ports are only reachable through IAP",
+		Remediation: "Allow " + portList(AdminPorts) + " from 35.235.240.0/20 (IAP TCP forwarding) instead of 0.0.0.0/0",
+		Evaluate:    portClosedToInternet(AdminPorts...),
+	},
+}
+
+// noDefaultNetwork fails a network named default. A plan only sees the
+// networks it manages; one GCP created with the project is out of its sight.
+func noDefaultNetwork(inv Inventory) []Finding {
+	var findings []Finding
+	for _, r := range inv.OfType("google_compute_network") {
+		if r.String("name") == "default" {
+			findings = append(findings, Finding{r.Address, Fail, "manages the default network"})
+			continue
+		}
+		findings = append(findings, Finding{r.Address, Pass, "network " + r.String("name")})
+	}
+	return findings
+}
+
+// portClosedToInternet fails an ingress rule that opens any of the ports to
+// any address
+func portClosedToInternet(ports ...int) func(Inventory) []Finding {
+	return func(inv Inventory) []Finding {
+		var findings []Finding
+		for _, r := range ingressAllowRules(inv) {
+			if r.IsUnknown("source_ranges") {
+				findings = append(findings, Finding{r.Address, NotApplicable, "source ranges known after apply"})
+				continue
+			}
+			var open []int
+			source := openSource(r)
+			for _, port := range ports {
+				if source != "" && allowsPort(r, port) {
+					open = append(open, port)
+				}
+			}
+			if len(open) > 0 {
+				findings = append(findings, Finding{r.Address, Fail, fmt.Sprintf("allows %s from %s", portList(open), source)})
+				continue
+			}
+			findings = append(findings, Finding{r.Address, Pass, fmt.Sprintf("%s not open to the internet", portList(ports))})
+		}
+		return findings
+	}
+}
+
+// subnetFlowLogs checks every subnet that carries VM traffic. Proxy-only and
+// Private Service Connect subnets cannot have flow logs.
+func subnetFlowLogs(inv Inventory) []Finding {
+	var findings []Finding
+	for _, r := range inv.OfType("google_compute_subnetwork") {
+		switch purpose := r.String("purpose"); purpose {
+		case "", "PRIVATE", "PRIVATE_RFC_1918":
+		default:
+			findings = append(findings, Finding{r.Address, NotApplicable, "flow logs do not apply to " + purpose + " subnets"})
+			continue
+		}
+		logConfig, _ := r.Values["log_config"].([]interface{})
+		enabled, _ := r.Values["enable_flow_logs"].(bool)
+		if len(logConfig) == 0 && !enabled {
+			findings = append(findings, Finding{r.Address, Fail, "flow logs disabled"})
+			continue
+		}
+		findings = append(findings, Finding{r.Address, Pass, "flow logs enabled"})
+	}
+	return findings
+}
+
+// proxiesUseStrongSSLPolicy checks the SSL policy of every HTTPS and SSL
+// proxy. A plan only knows the policy's URL after apply, so the policy the
+// configuration refers to is checked instead; a policy defined outside the
+// inventory is taken on trust.
+func proxiesUseStrongSSLPolicy(inv Inventory) []Finding {
+	var findings []Finding
+	proxies := inv.OfType("google_compute_target_https_proxy", "google_compute_region_target_https_proxy", "google_compute_target_ssl_proxy")
+	policies := inv.OfType("google_compute_ssl_policy", "google_compute_region_ssl_policy")
+	for _, r := range proxies {
+		var policy *Resource
+		if link := r.String("ssl_policy"); link != "" {
+			for i := range policies {
+				if policies[i].String("self_link") == link || policies[i].String("id") == link || strings.HasSuffix(link, "/"+policies[i].String("id")) {
+					policy = &policies[i]
+				}
+			}
+			if policy == nil {
+				findings = append(findings, Finding{r.Address, Pass, "uses " + lastSegment(link) + ", defined elsewhere"})
+				continue
+			}
+		} else if referenced := inv.Referenced(r, "ssl_policy"); len(referenced) > 0 {
+			policy = &referenced[0]
+		}
+		if policy == nil {
+			findings = append(findings, Finding{r.Address, Fail, "no SSL policy; the default allows TLS 1.0 and weak cipher suites"})
+			continue
+		}
+		if weakness := sslPolicyWeakness(*policy); weakness != "" {
+			findings = append(findings, Finding{r.Address, Fail, policy.Address + " " + weakness})
+			continue
+		}
+		findings = append(findings, Finding{r.Address, Pass, fmt.Sprintf("%s has profile %s, minimum %s", policy.Address, policy.String("profile"), policy.String("min_tls_version"))})
+	}
+	return findings
+}
+
+// sslPolicyWeakness says what makes a policy weak under CIS 3.9, or returns
+// "" when it is not. Unset fields take the API defaults COMPATIBLE and
+// TLS_1_0.
+func sslPolicyWeakness(policy Resource) string {
+	profile := policy.String("profile")
+	if profile == "" {
+		profile = "COMPATIBLE"
+	}
+	minTLS := policy.String("min_tls_version")
+	if minTLS == "" {
+		minTLS = "TLS_1_0"
+	}
+	switch profile {
+	case "RESTRICTED":
+		return ""
+	case "COMPATIBLE":
+		return "has profile COMPATIBLE"
+	case "CUSTOM":
+		for _, feature := range policy.Strings("custom_features") {
+			for _, weak := range weakCipherSuites {
+				if feature == weak {
+					return "enables " + weak
+				}
+			}
+		}
+	}
+	if minTLS == "TLS_1_0" || minTLS == "TLS_1_1" {
+		return "allows " + minTLS
+	}
+	return ""
+}
+
+// ingressAllowRules returns the enabled INGRESS firewall rules that allow
+// traffic; the provider defaults direction to INGRESS
+func ingressAllowRules(inv Inventory) []Resource {
+	var out []Resource
+	for _, r := range inv.OfType("google_compute_firewall") {
+		if direction := r.String("direction"); direction != "" && direction != "INGRESS" {
+			continue
+		}
+		if disabled, _ := r.Values["disabled"].(bool); disabled {
+			continue
+		}
+		if allow, _ := r.Values["allow"].([]interface{}); len(allow) == 0 {
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// openSource returns the range that opens a firewall rule to any address, or
+// "any source" for a rule with no source restriction at all, or "" when the
+// rule is restricted
+func openSource(r Resource) string {
+	ranges := r.Strings("source_ranges")
+	for _, cidr := range ranges {
+		if cidr == "0.0.0.0/0" || cidr == "::/0" {
+			return cidr
+		}
+	}
+	if len(ranges) == 0 && len(r.Strings("source_tags")) == 0 && len(r.Strings("source_service_accounts")) == 0 {
+		return "any source"
+	}
+	return ""
+}
+
+// allowsPort reports whether one of the rule's allow blocks admits TCP
+// traffic to port
+func allowsPort(r Resource, port int) bool {
+	allow, _ := r.Values["allow"].([]interface{})
+	for _, a := range allow {
+		rule, _ := a.(map[string]interface{})
+		protocol, _ := rule["protocol"].(string)
+		if protocol != "tcp" && protocol != "all" && protocol != "6" {
+			continue
+		}
+		ports := Resource{Values: rule}.Strings("ports")
+		if len(ports) == 0 {
+			return true
+		}
+		for _, p := range ports {
+			low, high, isRange := strings.Cut(p, "-")
+			from, err := strconv.Atoi(low)
+			if err != nil {
+				continue
+			}
+			to := from
+			if isRange {
+				if to, err = strconv.Atoi(high); err != nil {
+					continue
+				}
+			}
+			if from <= port && port <= to {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// portList renders ports as tcp:22,tcp:3389
+func portList(ports []int) string {
+	out := make([]string, len(ports))
+	for i, port := range ports {
+		out[i] = "tcp:" + strconv.Itoa(port)
+	}
+	return strings.Join(out, ",")
+}
@@ -0,0 +1,423 @@
+// Package compliance evaluates control catalogs against the resources of a
+// `tofu show -json` plan or state. A control looks at the resources it
+// covers and reports each one as passing or failing, with the resource
+// address as evidence; a control with nothing to look at is not applicable.
+// Plans and states from several modules can be combined into one inventory,
+// so a control such as AU-11 finds the logging bucket whichever module
+// declares it.
+package compliance
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// Status is the outcome of a control or of one resource it looked at
+type Status string
+
+const (
+	Pass          Status = "pass"
+	Fail          Status = "fail"
+	NotApplicable Status = "not_applicable"
+)
+
+// Resource is a managed resource with its planned or current values
+type Resource struct {
+	Address string
+	Type    string
+	Name    string
+	// Values are the planned values of a plan or the attributes of a state
+	Values map[string]interface{}
+	// Unknown marks the planned values only known after apply, as the plan's
+	// after_unknown does; nil for state
+	Unknown map[string]interface{}
+	// References lists, per attribute, the addresses its configuration
+	// expression refers to. Plans only; they name the resource an unknown
+	// attribute such as a forwarding rule's target will point at.
+	References map[string][]string
+}
+
+// String returns the value at a top-level attribute, or "" when it is unset or
+// not a string
+func (r Resource) String(attr string) string {
+	s, _ := r.Values[attr].(string)
+	return s
+}
+
+// Strings returns the string elements of a list attribute
+func (r Resource) Strings(attr string) []string {
+	list, _ := r.Values[attr].([]interface{})
+	out := make([]string, 0, len(list))
+	for _, v := range list {
+		if s, ok := v.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// IsUnknown reports whether the plan only knows attr after apply
+func (r Resource) IsUnknown(attr string) bool {
+	unknown, _ := r.Unknown[attr].(bool)
+	return unknown
+}
+
+// ReferencedTypes returns the resource types attr's expression refers to
+func (r Resource) ReferencedTypes(attr string) []string {
+	var types []string
+	for _, ref := range r.References[attr] {
+		parts := strings.Split(ref, ".")
+		// skip module.<name>. prefixes; data sources, variables and locals
+		// are not resources
+		for len(parts) > 2 && parts[0] == "module" {
+			parts = parts[2:]
+		}
+		switch parts[0] {
+		case "data", "var", "local", "module", "each", "count", "path", "self":
+			continue
+		}
+		types = append(types, parts[0])
+	}
+	return types
+}
+
+// Inventory is the set of resources a catalog is evaluated against
+type Inventory []Resource
+
+// Referenced returns the resources r's attr expression refers to, looked up
+// in r's module
+func (inv Inventory) Referenced(r Resource, attr string) []Resource {
+	prefix := ""
+	if i := strings.LastIndex(r.Address, r.Type+"."+r.Name); i > 0 {
+		prefix = r.Address[:i]
+	}
+	var out []Resource
+	seen := map[string]bool{}
+	for _, ref := range r.References[attr] {
+		parts := strings.SplitN(ref, ".", 3)
+		if len(parts) < 2 {
+			continue
+		}
+		key := prefix + parts[0] + "." + parts[1]
+		for _, candidate := range inv {
+			address := candidate.Address
+			if !strings.Contains(parts[1], "[") {
+				if i := strings.LastIndexByte(address, '['); i > strings.LastIndexByte(address, '.') {
+					address = address[:i]
+				}
+			}
+			if address == key && !seen[candidate.Address] {
+				seen[candidate.Address] = true
+				out = append(out, candidate)
+			}
+		}
+	}
+	return out
+}
+
+// OfType returns the resources of the given types
+func (inv Inventory) OfType(types ...string) []Resource {
+	var out []Resource
+	for _, r := range inv {
+		for _, t := range types {
+			if r.Type == t {
+				out = append(out, r)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// FromPlan collects the resources a plan creates, updates or keeps. Resources
+// it deletes are left out, since they will not exist once the plan is applied.
+func FromPlan(plan *tfjson.Plan) Inventory {
+	refs := map[string]map[string][]string{}
+	if plan.Config != nil && plan.Config.RootModule != nil {
+		configReferences(plan.Config.RootModule, "", refs)
+	}
+
+	var inv Inventory
+	for _, rc := range plan.ResourceChanges {
+		if rc.Mode != tfjson.ManagedResourceMode || rc.Change == nil || rc.Change.Actions.Delete() {
+			continue
+		}
+		values, _ := rc.Change.After.(map[string]interface{})
+		unknown, _ := rc.Change.AfterUnknown.(map[string]interface{})
+		key := rc.Type + "." + rc.Name
+		if rc.ModuleAddress != "" {
+			key = configModule(rc.ModuleAddress) + "." + key
+		}
+		inv = append(inv, Resource{
+			Address:    rc.Address,
+			Type:       rc.Type,
+			Name:       rc.Name,
+			Values:     values,
+			Unknown:    unknown,
+			References: refs[key],
+		})
+	}
+	return inv
+}
+
+// configReferences indexes the expression references of every configured
+// resource by its address without count or for_each keys
+func configReferences(module *tfjson.ConfigModule, prefix string, refs map[string]map[string][]string) {
+	for _, r := range module.Resources {
+		if r.Mode != tfjson.ManagedResourceMode {
+			continue
+		}
+		attrs := map[string][]string{}
+		for attr, expr := range r.Expressions {
+			if expr != nil && expr.ExpressionData != nil {
+				attrs[attr] = expr.References
+			}
+		}
+		refs[prefix+r.Type+"."+r.Name] = attrs
+	}
+	for name, call := range module.ModuleCalls {
+		if call.Module != nil {
+			configReferences(call.Module, prefix+"module."+name+".", refs)
+		}
+	}
+}
+
+// configModule strips the instance keys from a module address, turning
+// module.a["x"].module.b[0] into module.a.module.b
+func configModule(address string) string {
+	var b strings.Builder
+	depth := 0
+	for _, c := range address {
+		switch {
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case depth == 0:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// FromState collects the managed resources of a state, either as
+// `tofu show -json` prints it or as the raw .tfstate a backend stores
+func FromState(data []byte) (Inventory, error) {
+	var probe struct {
+		Values    json.RawMessage `json:"values"`
+		Resources json.RawMessage `json:"resources"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, err
+	}
+	if probe.Resources != nil {
+		return fromRawState(data)
+	}
+
+	var state tfjson.State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	var inv Inventory
+	if state.Values != nil && state.Values.RootModule != nil {
+		inv = stateModule(state.Values.RootModule, inv)
+	}
+	return inv, nil
+}
+
+func stateModule(module *tfjson.StateModule, inv Inventory) Inventory {
+	for _, r := range module.Resources {
+		if r.Mode != tfjson.ManagedResourceMode {
+			continue
+		}
+		inv = append(inv, Resource{Address: r.Address, Type: r.Type, Name: r.Name, Values: r.AttributeValues})
+	}
+	for _, child := range module.ChildModules {
+		inv = stateModule(child, inv)
+	}
+	return inv
+}
+
+// rawState is the part of the version 4 .tfstate format the evaluator reads
+type rawState struct {
+	Resources []struct {
+		Module    string `json:"module"`
+		Mode      string `json:"mode"`
+		Type      string `json:"type"`
+		Name      string `json:"name"`
+		Instances []struct {
+			IndexKey   interface{}            `json:"index_key"`
+			Attributes map[string]interface{} `json:"attributes"`
+		} `json:"instances"`
+	} `json:"resources"`
+}
+
+func fromRawState(data []byte) (Inventory, error) {
+	var state rawState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	var inv Inventory
+	for _, r := range state.Resources {
+		if r.Mode != string(tfjson.ManagedResourceMode) {
+			continue
+		}
+		address := r.Type + "." + r.Name
+		if r.Module != "" {
+			address = r.Module + "." + address
+		}
+		for _, instance := range r.Instances {
+			addr := address
+			switch key := instance.IndexKey.(type) {
+			case float64:
+				addr = fmt.Sprintf("%s[%d]", address, int(key))
+			case string:
+				addr = fmt.Sprintf("%s[%q]", address, key)
+			}
+			inv = append(inv, Resource{Address: addr, Type: r.Type, Name: r.Name, Values: instance.Attributes})
+		}
+	}
+	return inv, nil
+}
+
+// Load reads a plan or state JSON file, telling them apart by their keys
+func Load(path string) (Inventory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if _, ok := probe["resource_changes"]; ok {
+		var plan tfjson.Plan
+		if err := json.Unmarshal(data, &plan); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return FromPlan(&plan), nil
+	}
+	if _, ok := probe["planned_values"]; ok {
+		// a plan that changes nothing has no resource_changes
+		return Inventory{}, nil
+	}
+	_, values := probe["values"]
+	_, resources := probe["resources"]
+	if !values && !resources {
+		return nil, fmt.Errorf("%s: neither a plan nor a state", path)
+	}
+	inv, err := FromState(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return inv, nil
+}
+
+// Finding is a control's verdict on one resource
+type Finding struct {
+	Address string `json:"address"`
+	Status  Status `json:"status"`
+	Detail  string `json:"detail"`
+}
+
+// Control is one requirement of a catalog
+type Control struct {
+	ID    string
+	Title string
+	// Remediation tells how to fix a failing resource
+	Remediation string
+	// Evaluate returns a finding per resource the control covers, none
+	// when the inventory has nothing it applies to
+	Evaluate func(Inventory) []Finding
+}
+
+// Result is a control's overall status with the findings behind it
+type Result struct {
+	Control     string    `json:"control"`
+	Title       string    `json:"title"`
+	Status      Status    `json:"status"`
+	Remediation string    `json:"remediation,omitempty"`
+	Evidence    []Finding `json:"evidence"`
+}
+
+// Report is the outcome of evaluating a catalog
+type Report struct {
+	Catalog string   `json:"catalog"`
+	Results []Result `json:"results"`
+}
+
+// Failed returns the results of the failing controls
+func (r *Report) Failed() []Result {
+	var out []Result
+	for _, result := range r.Results {
+		if result.Status == Fail {
+			out = append(out, result)
+		}
+	}
+	return out
+}
+
+// Result returns the result of the control with the given ID
+func (r *Report) Result(id string) (Result, bool) {
+	for _, result := range r.Results {
+		if result.Control == id {
+			return result, true
+		}
+	}
+	return Result{}, false
+}
+
+// Catalogs are the control catalogs Evaluate knows by name
+var Catalogs = map[string][]Control{
+	"cis-gcp":     CISGCP,
+	"nist-800-53": NIST80053,
+}
+
+// Evaluate runs every control of the named catalog against inv
+func Evaluate(catalog string, inv Inventory) (*Report, error) {
+	controls, ok := Catalogs[catalog]
+	if !ok {
+		names := make([]string, 0, len(Catalogs))
+		for name := range Catalogs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown catalog %q (known: %s)", catalog, strings.Join(names, ", "))
+	}
+	return EvaluateControls(catalog, controls, inv), nil
+}
+
+// EvaluateControls runs controls against inv and reports them under the
+// catalog name. A control fails when any finding fails, passes when at least
+// one passes and is not applicable otherwise.
+func EvaluateControls(catalog string, controls []Control, inv Inventory) *Report {
+	report := &Report{Catalog: catalog}
+	for _, control := range controls {
+		findings := control.Evaluate(inv)
+		sort.SliceStable(findings, func(i, j int) bool { return findings[i].Address < findings[j].Address })
+		status := NotApplicable
+		for _, f := range findings {
+			if f.Status == Fail {
+				status = Fail
+				break
+			}
+			if f.Status == Pass {
+				status = Pass
+			}
+		}
+		if findings == nil {
+			findings = []Finding{}
+		}
+		result := Result{Control: control.ID, Title: control.Title, Status: status, Evidence: findings}
+		if status == Fail {
+			result.Remediation = control.Remediation
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report
+}
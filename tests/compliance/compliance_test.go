@@ -0,0 +1,167 @@
+package compliance
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vibetics-cloudedge/tests/planfixture"
+)
+
+func planInventory(t *testing.T, scenarios ...string) Inventory {
+	t.Helper()
+	var inv Inventory
+	for _, scenario := range scenarios {
+		plan, err := planfixture.Load(scenario)
+		require.NoError(t, err)
+		inv = append(inv, FromPlan(&plan.RawPlan)...)
+	}
+	return inv
+}
+
+func TestNISTAgainstRecordedPlans(t *testing.T) {
+	t.Parallel()
+	for _, scenarios := range [][]string{
+		{"core_default", "demo_web_app_default"},
+		{"core_psc_neg", "demo_web_app_psc"},
+		{"core_waf", "demo_web_app_direct_backend"},
+	} {
+		report, err := Evaluate("nist-800-53", planInventory(t, scenarios...))
+		require.NoError(t, err)
+		// the plans were recorded before the load balancer address and
+		// forwarding rules took standard_tags, and the Cloud Run service has
+		// no labels, so CM-2 is the one control that fails
+		failed := report.Failed()
+		require.Len(t, failed, 1, "%v", scenarios)
+		assert.Equal(t, "CM-2", failed[0].Control)
+		var unlabelled []string
+		for _, f := range failed[0].Evidence {
+			if f.Status == Fail {
+				unlabelled = append(unlabelled, f.Address)
+			}
+		}
+		assert.Subset(t, unlabelled, []string{
+			"google_cloud_run_v2_service.web_app[0]",
+			"google_compute_address.external_lb_ip",
+			"google_compute_forwarding_rule.external_https_lb",
+		}, "%v", scenarios)
+
+		sc8, _ := report.Result("SC-8")
+		assert.Equal(t, Pass, sc8.Status)
+		assert.Equal(t, Finding{
+			Address: "google_compute_forwarding_rule.external_https_lb",
+			Status:  Pass,
+			Detail:  "target is google_compute_region_target_https_proxy",
+		}, sc8.Evidence[0])
+		sc7, _ := report.Result("SC-7")
+		assert.Equal(t, Pass, sc7.Status)
+		assert.Equal(t, "google_compute_firewall.allow_ingress_vpc_https_ingress", sc7.Evidence[0].Address)
+		// logs_bucket belongs to project-singleton, which has no recorded plan
+		au11, _ := report.Result("AU-11")
+		assert.Equal(t, NotApplicable, au11.Status)
+		assert.Empty(t, au11.Evidence)
+	}
+}
+
+func TestNISTAgainstState(t *testing.T) {
+	t.Parallel()
+	inv, err := Load("testdata/project-singleton.tfstate")
+	require.NoError(t, err)
+	assert.Len(t, inv, 2, "data sources are left out")
+	report, err := Evaluate("nist-800-53", inv)
+	require.NoError(t, err)
+	au11, _ := report.Result("AU-11")
+	assert.Equal(t, Result{
+		Control:  "AU-11",
+		Title:    "Audit record retention: logs_bucket keeps logs for at least 30 days",
+		Status:   Pass,
+		Evidence: []Finding{{"google_logging_project_bucket_config.logs_bucket[0]", Pass, "retention_days is 30"}},
+	}, au11)
+	sc8, _ := report.Result("SC-8")
+	assert.Equal(t, NotApplicable, sc8.Status)
+
+	inv, err = Load("testdata/noncompliant-state.json")
+	require.NoError(t, err)
+	report, err = Evaluate("nist-800-53", inv)
+	require.NoError(t, err)
+	var failed []Finding
+	for _, result := range report.Failed() {
+		for _, f := range result.Evidence {
+			if f.Status == Fail {
+				failed = append(failed, f)
+			}
+		}
+	}
+	assert.Equal(t, []Finding{
+		{"google_compute_forwarding_rule.plain_http", Fail, "target targetHttpProxies/plain-http does not terminate TLS"},
+		{"google_compute_firewall.open_ssh", Fail, "allows tcp:22 from 0.0.0.0/0"},
+		{"module.logging.google_logging_project_bucket_config.logs_bucket", Fail, "retention_days is 7"},
+		{"module.logging.google_compute_address.unlabelled", Fail, "missing labels project, project-suffix"},
+	}, failed)
+}
+
+func TestReferencedTypes(t *testing.T) {
+	t.Parallel()
+	r := Resource{References: map[string][]string{"target": {
+		"module.lb.google_compute_target_https_proxy.default.id",
+		"local.proxy",
+		"data.google_compute_region_target_https_proxy.existing",
+		"google_compute_region_target_http_proxy.redirect",
+	}}}
+	assert.Equal(t, []string{"google_compute_target_https_proxy", "google_compute_region_target_http_proxy"}, r.ReferencedTypes("target"))
+	assert.Equal(t, "module.a.module.b", configModule(`module.a["x"].module.b[0]`))
+
+	_, err := Evaluate("pci", nil)
+	assert.ErrorContains(t, err, "known: cis-gcp, nist-800-53")
+}
+
+func TestCISReportsViolations(t *testing.T) {
+	t.Parallel()
+	firewall := func(name string, ranges []interface{}, ports ...interface{}) Resource {
+		return Resource{Address: "google_compute_firewall." + name, Type: "google_compute_firewall", Name: name, Values: map[string]interface{}{
+			"direction":     "INGRESS",
+			"allow":         []interface{}{map[string]interface{}{"protocol": "tcp", "ports": ports}},
+			"source_ranges": ranges,
+		}}
+	}
+	inv := Inventory{
+		{Address: "google_compute_network.default", Type: "google_compute_network", Name: "default", Values: map[string]interface{}{"name": "default"}},
+		firewall("ssh", []interface{}{"0.0.0.0/0"}, "20-25"),
+		firewall("winrm", nil, "5986"),
+		firewall("iap", []interface{}{"35.235.240.0/20"}, "22", "3389"),
+		{Address: "google_compute_subnetwork.vms", Type: "google_compute_subnetwork", Name: "vms", Values: map[string]interface{}{"log_config": []interface{}{}}},
+		{Address: "google_compute_region_ssl_policy.legacy", Type: "google_compute_region_ssl_policy", Name: "legacy", Values: map[string]interface{}{"profile": "MODERN"}},
+		{Address: "google_compute_region_target_https_proxy.a", Type: "google_compute_region_target_https_proxy", Name: "a",
+			Values: map[string]interface{}{}, References: map[string][]string{"ssl_policy": {"google_compute_region_ssl_policy.legacy.id"}}},
+		{Address: "google_compute_target_https_proxy.b", Type: "google_compute_target_https_proxy", Name: "b", Values: map[string]interface{}{}},
+	}
+	report, err := Evaluate("cis-gcp", inv)
+	require.NoError(t, err)
+
+	failures := map[string][]string{}
+	for _, result := range report.Failed() {
+		assert.NotEmpty(t, result.Remediation, result.Control)
+		for _, f := range result.Evidence {
+			if f.Status == Fail {
+				failures[result.Control] = append(failures[result.Control], f.Address+": "+f.Detail)
+			}
+		}
+	}
+	assert.Equal(t, map[string][]string{
+		"3.1": {"google_compute_network.default: manages the default network"},
+		"3.6": {"google_compute_firewall.ssh: allows tcp:22 from 0.0.0.0/0"},
+		"3.8": {"google_compute_subnetwork.vms: flow logs disabled"},
+		"3.9": {
+			"google_compute_region_target_https_proxy.a: google_compute_region_ssl_policy.legacy allows TLS_1_0",
+			"google_compute_target_https_proxy.b: no SSL policy; the default allows TLS 1.0 and weak cipher suites",
+		},
+		"3.10": {
+			"google_compute_firewall.ssh: allows tcp:22,tcp:23 from 0.0.0.0/0",
+			"google_compute_firewall.winrm: allows tcp:5986 from any source",
+		},
+	}, failures)
+	rdp, _ := report.Result("3.7")
+	assert.Equal(t, Pass, rdp.Status)
+	assert.Empty(t, rdp.Remediation, "only failing controls carry a remediation")
+}
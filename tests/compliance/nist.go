@@ -0,0 +1,198 @@
+package compliance
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MinRetentionDays is the log retention NFR-001 requires of logs_bucket
+const MinRetentionDays = 30
+
+// RequiredLabels are the labels FR-007 requires on every resource that
+// supports labels
+var RequiredLabels = []string{"managed-by", "project", "project-suffix"}
+
+// NIST80053 checks the NIST SP 800-53 Rev. 5 controls SECURITY.md maps onto
+// the modules
+var NIST80053 = []Control{
+	{
+		ID:          "SC-8",
+		Title:       "Transmission confidentiality and integrity: every forwarding rule terminates TLS",
+		Remediation: "Point the forwarding rule at a target HTTPS or SSL proxy with a certificate",
+		Evaluate:    forwardingRulesTerminateTLS,
+	},
+	{
+		ID:          "SC-7",
+		Title:       "Boundary protection: ingress firewall rules restrict their sources",
+		Remediation: "Set source_ranges to the sources that need access, e.g. the Cloudflare ranges",
+		Evaluate:    ingressFirewallsRestricted,
+	},
+	{
+		ID:          "AU-11",
+		Title:       fmt.Sprintf("Audit record retention: logs_bucket keeps logs for at least %d days", MinRetentionDays),
+		Remediation: fmt.Sprintf("Set retention_days to %d or more", MinRetentionDays),
+		Evaluate:    logsRetained,
+	},
+	{
+		ID:          "CM-2",
+		Title:       "Baseline configuration: labelled resources carry " + strings.Join(RequiredLabels, ", "),
+		Remediation: "Set labels = local.standard_tags and pass resource_tags with managed-by and project-suffix",
+		Evaluate:    resourcesLabelled,
+	},
+}
+
+// forwardingRuleTypes are the resources that expose a load balancer frontend
+var forwardingRuleTypes = []string{"google_compute_forwarding_rule", "google_compute_global_forwarding_rule"}
+
+// forwardingRulesTerminateTLS passes a forwarding rule whose target is an
+// HTTPS or SSL proxy. A plan only knows the target's URL after apply, so the
+// configuration's reference to the proxy resource decides instead.
+func forwardingRulesTerminateTLS(inv Inventory) []Finding {
+	var findings []Finding
+	for _, r := range inv.OfType(forwardingRuleTypes...) {
+		target := r.String("target")
+		kind := ""
+		switch {
+		case strings.Contains(target, "/targetHttpsProxies/"):
+			kind = "https"
+		case strings.Contains(target, "/targetSslProxies/"):
+			kind = "ssl"
+		case strings.Contains(target, "/targetHttpProxies/"):
+			kind = "http"
+		case strings.Contains(target, "/targetTcpProxies/"):
+			kind = "tcp"
+		case strings.Contains(target, "/serviceAttachments/"), target == "all-apis", target == "vpc-sc":
+			findings = append(findings, Finding{r.Address, NotApplicable, "Private Service Connect endpoint to " + target})
+			continue
+		case target == "":
+			for _, t := range r.ReferencedTypes("target") {
+				for _, k := range []string{"https", "ssl", "http", "tcp"} {
+					if strings.HasSuffix(t, "_target_"+k+"_proxy") {
+						kind, target = k, t
+					}
+				}
+			}
+		}
+
+		switch kind {
+		case "https", "ssl":
+			findings = append(findings, Finding{r.Address, Pass, "target is " + lastSegment(target)})
+		case "http", "tcp":
+			findings = append(findings, Finding{r.Address, Fail, "target " + lastSegment(target) + " does not terminate TLS"})
+		default:
+			if r.String("backend_service") != "" || len(r.ReferencedTypes("backend_service")) > 0 {
+				findings = append(findings, Finding{r.Address, Fail, "passes traffic to a backend service without terminating TLS"})
+			} else {
+				findings = append(findings, Finding{r.Address, Fail, "target is neither an HTTPS nor an SSL proxy"})
+			}
+		}
+	}
+	return findings
+}
+
+// ingressFirewallsRestricted fails an enabled INGRESS allow rule open to any
+// address. A rule without source ranges, tags or service accounts is open to
+// any address too.
+func ingressFirewallsRestricted(inv Inventory) []Finding {
+	var findings []Finding
+	for _, r := range ingressAllowRules(inv) {
+		if r.IsUnknown("source_ranges") {
+			findings = append(findings, Finding{r.Address, NotApplicable, "source ranges known after apply"})
+			continue
+		}
+		if source := openSource(r); source != "" {
+			findings = append(findings, Finding{r.Address, Fail, "allows " + allowed(r) + " from " + source})
+			continue
+		}
+		findings = append(findings, Finding{r.Address, Pass, fmt.Sprintf("allows %s from %d source ranges", allowed(r), len(r.Strings("source_ranges")))})
+	}
+	return findings
+}
+
+// allowed renders a firewall's allow blocks as tcp:443,udp
+func allowed(r Resource) string {
+	var out []string
+	allow, _ := r.Values["allow"].([]interface{})
+	for _, a := range allow {
+		rule, _ := a.(map[string]interface{})
+		protocol, _ := rule["protocol"].(string)
+		ports := Resource{Values: rule}.Strings("ports")
+		if len(ports) == 0 {
+			out = append(out, protocol)
+			continue
+		}
+		for _, port := range ports {
+			out = append(out, protocol+":"+port)
+		}
+	}
+	return strings.Join(out, ",")
+}
+
+// logsRetained checks the retention of the project-singleton logs_bucket
+func logsRetained(inv Inventory) []Finding {
+	var findings []Finding
+	for _, r := range inv.OfType("google_logging_project_bucket_config") {
+		if r.Name != "logs_bucket" {
+			continue
+		}
+		if r.IsUnknown("retention_days") {
+			findings = append(findings, Finding{r.Address, NotApplicable, "retention known after apply"})
+			continue
+		}
+		days, _ := r.Values["retention_days"].(float64)
+		status := Pass
+		if days < MinRetentionDays {
+			status = Fail
+		}
+		findings = append(findings, Finding{r.Address, status, fmt.Sprintf("retention_days is %d", int(days))})
+	}
+	return findings
+}
+
+// resourcesLabelled checks every resource that has a labels attribute. State
+// written by recent providers keeps the labels applied through provider
+// defaults in effective_labels, so those count as well.
+func resourcesLabelled(inv Inventory) []Finding {
+	var findings []Finding
+	for _, r := range inv {
+		if _, ok := r.Values["labels"]; !ok {
+			continue
+		}
+		if r.IsUnknown("labels") {
+			findings = append(findings, Finding{r.Address, NotApplicable, "labels known after apply"})
+			continue
+		}
+		labels := map[string]string{}
+		for _, attr := range []string{"labels", "effective_labels"} {
+			values, _ := r.Values[attr].(map[string]interface{})
+			for k, v := range values {
+				labels[k], _ = v.(string)
+			}
+		}
+		var missing []string
+		for _, label := range RequiredLabels {
+			if labels[label] == "" {
+				missing = append(missing, label)
+			}
+		}
+		if len(missing) > 0 {
+			findings = append(findings, Finding{r.Address, Fail, "missing labels " + strings.Join(missing, ", ")})
+			continue
+		}
+		var pairs []string
+		for _, label := range RequiredLabels {
+			pairs = append(pairs, label+"="+labels[label])
+		}
+		findings = append(findings, Finding{r.Address, Pass, "labels " + strings.Join(pairs, ", ")})
+	}
+	return findings
+}
+
+// lastSegment shortens a self link to its last two path segments
+func lastSegment(target string) string {
+	parts := strings.Split(target, "/")
+	if len(parts) < 2 {
+		return target
+	}
+	return strings.Join(parts[len(parts)-2:], "/")
+}
@@ -0,0 +1,66 @@
+package contract
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"vibetics-cloudedge/tests/compliance"
+	"vibetics-cloudedge/tests/planfixture"
+)
+
+// knownCISFailures are controls the modules do not meet yet, with the
+// reason. Their findings are logged instead of failing the test; remove an
+// entry once the modules fix it, as the test fails when a listed control no
+// longer fails in any scenario.
+var knownCISFailures = map[string]string{
+	"3.8": "ingress_subnet and web_subnet have no log_config",
+	"3.9": "the external and internal HTTPS proxies use the default SSL policy",
+}
+
+// TestCISBenchmarkContract evaluates the CIS GCP networking rules against the
+// plan of every scenario, so a change that opens an admin port, drops flow
+// logs or weakens an SSL policy fails here rather than after an apply
+func TestCISBenchmarkContract(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	stillFailing := map[string]bool{}
+	t.Cleanup(func() {
+		for control, reason := range knownCISFailures {
+			if !stillFailing[control] {
+				t.Errorf("CIS %s is listed as a known failure (%s) but passes in every scenario; remove it from knownCISFailures", control, reason)
+			}
+		}
+	})
+
+	for _, scenario := range planfixture.Scenarios() {
+		scenario := scenario
+		t.Run(scenario.Name, func(t *testing.T) {
+			t.Parallel()
+
+			plan := planfixture.Plan(t, scenario.Name)
+			report, err := compliance.Evaluate("cis-gcp", compliance.FromPlan(&plan.RawPlan))
+			require.NoError(t, err)
+
+			for _, result := range report.Failed() {
+				reason, known := knownCISFailures[result.Control]
+				if known {
+					mu.Lock()
+					stillFailing[result.Control] = true
+					mu.Unlock()
+				}
+				for _, f := range result.Evidence {
+					switch {
+					case f.Status != compliance.Fail:
+					case known:
+						t.Logf("known failure CIS %s (%s) %s: %s", result.Control, reason, f.Address, f.Detail)
+					default:
+						t.Errorf("CIS %s (%s) %s: %s\n  remediation: %s", result.Control, result.Title, f.Address, f.Detail, result.Remediation)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,381 @@
+package contract
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/cucumber/godog"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+
+	"vibetics-cloudedge/tests/modcontract"
+	"vibetics-cloudedge/tests/planfixture"
+	"vibetics-cloudedge/tests/planquery"
+	"vibetics-cloudedge/tests/steps"
+	"vibetics-cloudedge/tests/trafficpath"
+)
+
+// TestConnectivityPatterns runs the plan-level scenarios of
+// connectivity_patterns.feature: the variables table configures core and
+// demo-web-app, both are planned, and the resource tables are checked against
+// the combined plan. Each Examples row runs as its own subtest.
+func TestConnectivityPatterns(t *testing.T) {
+	opts := godog.Options{
+		Format:   "pretty",
+		Paths:    []string{"../../features/connectivity_patterns.feature"},
+		Tags:     "@pattern && @plan",
+		Strict:   true,
+		TestingT: t,
+	}
+
+	status := godog.TestSuite{
+		Name:                "connectivity_patterns",
+		ScenarioInitializer: InitializeConnectivityScenario,
+		Options:             &opts,
+	}.Run()
+
+	if status != 0 {
+		t.Fatal("non-zero status returned, failed to run feature tests")
+	}
+}
+
+// connectivityModules are planned in deployment order; core reads the
+// demo-web-app outputs through remote state
+var connectivityModules = []string{"demo-web-app", "core"}
+
+// resourceAliases maps the plain-language rows of the resource tables onto
+// "type (qualifier)" descriptors
+var resourceAliases = map[string]string{
+	"PSC NAT subnet": "google_compute_subnetwork (psc-nat)",
+	"Internal ALB":   "google_compute_forwarding_rule (internal-alb)",
+}
+
+// interconnectTypes would join the ingress and web VPCs outside PSC
+var interconnectTypes = []string{
+	"google_compute_network_peering",
+	"google_compute_shared_vpc_host_project",
+	"google_compute_shared_vpc_service_project",
+	"google_compute_vpn_tunnel",
+	"google_compute_ha_vpn_gateway",
+}
+
+// connectivityWorld holds one scenario's module options and their plans
+type connectivityWorld struct {
+	modules map[string]*modcontract.Module
+	options map[string]*terraform.Options
+	plans   map[string]*planquery.Plan
+}
+
+func InitializeConnectivityScenario(ctx *godog.ScenarioContext) {
+	w := &connectivityWorld{}
+
+	ctx.Before(func(ctx context.Context, sc *godog.Scenario) (context.Context, error) {
+		*w = connectivityWorld{
+			modules: map[string]*modcontract.Module{},
+			options: map[string]*terraform.Options{},
+			plans:   map[string]*planquery.Plan{},
+		}
+		for _, module := range connectivityModules {
+			m, err := modcontract.LoadModule(planfixture.ModuleDir(module))
+			if err != nil {
+				return ctx, err
+			}
+			w.modules[module] = m
+			w.options[module] = planfixture.Scenario{Module: module, Vars: planfixture.BaseVars(module)}.
+				TerraformOptions(planfixture.ModuleDir(module))
+		}
+		return ctx, nil
+	})
+
+	ctx.Step(`^the project-singleton infrastructure is deployed$`, w.singletonDeployed)
+	ctx.Step(`^NO Shared VPC architecture is used$`, w.noSharedVPC)
+	ctx.Step(`^the architecture supports two connectivity patterns$`, w.supportsBothPatterns)
+
+	ctx.Step(`^I configure the infrastructure with the following variables:$`, w.configureVariables)
+	ctx.Step(`^the demo-web-app project layout is "([^"]*)"$`, w.projectLayout)
+	ctx.Step(`^I deploy the (core|demo-web-app) infrastructure$`, w.planModule)
+
+	ctx.Step(`^the traffic flow should follow Pattern (\d):$`, w.trafficFollowsPattern)
+	ctx.Step(`^the following resources should exist:$`, w.resourcesExist)
+	ctx.Step(`^the following resources should NOT exist:$`, w.resourcesAbsent)
+	ctx.Step(`^the VPCs should be completely isolated from each other$`, w.vpcsIsolated)
+	ctx.Step(`^connectivity should only be via Private Service Connect$`, w.onlyViaPSC)
+}
+
+// Background
+
+// singletonDeployed is a precondition for live plans, whose remote state reads
+// need the singleton outputs; recorded plans already carry them
+func (w *connectivityWorld) singletonDeployed() error {
+	return nil
+}
+
+func (w *connectivityWorld) noSharedVPC() error {
+	for _, module := range connectivityModules {
+		m := w.modules[module]
+		for addr, rng := range m.Resources {
+			if strings.HasPrefix(addr, "google_compute_shared_vpc_") {
+				return fmt.Errorf("%s declares %s (%s)", module, addr, rng)
+			}
+		}
+		if _, ok := m.Variables["host_project_id"]; ok {
+			return fmt.Errorf("%s declares a host_project_id variable", module)
+		}
+	}
+	return nil
+}
+
+// supportsBothPatterns checks the toggles that select the pattern are declared
+// where the feature expects them
+func (w *connectivityWorld) supportsBothPatterns() error {
+	for module, names := range map[string][]string{
+		"core":         {"enable_demo_web_app_psc_neg"},
+		"demo-web-app": {"enable_demo_web_app_psc_neg", "enable_demo_web_app_internal_alb"},
+	} {
+		for _, name := range names {
+			if _, ok := w.modules[module].Variables[name]; !ok {
+				return fmt.Errorf("%s does not declare %q", module, name)
+			}
+		}
+	}
+	return nil
+}
+
+// Given / When
+
+// configureVariables sets each table row on the options of every module that
+// declares the variable, converting the cell to the variable's type
+func (w *connectivityWorld) configureVariables(table *godog.Table) error {
+	for _, row := range table.Rows[1:] {
+		name := strings.TrimSpace(row.Cells[0].Value)
+		raw := strings.TrimSpace(row.Cells[1].Value)
+		declared := false
+		for _, module := range connectivityModules {
+			v, ok := w.modules[module].Variables[name]
+			if !ok {
+				continue
+			}
+			value, err := steps.ParseVariable(v, raw)
+			if err != nil {
+				return err
+			}
+			w.options[module].Vars[name] = value
+			declared = true
+		}
+		if !declared {
+			return fmt.Errorf("no module declares variable %q", name)
+		}
+	}
+	return nil
+}
+
+// projectLayout puts the demo web app in its own project or in the core one
+func (w *connectivityWorld) projectLayout(layout string) error {
+	coreProject := w.options["core"].Vars["cloudedge_project_id"]
+	var demoProject interface{}
+	switch {
+	case strings.HasPrefix(strings.ToLower(layout), "cross-project"):
+		demoProject = planfixture.BaseVars("demo-web-app")["demo_web_app_project_id"]
+		if demoProject == coreProject {
+			return fmt.Errorf("base variables put demo-web-app in the core project %v", coreProject)
+		}
+	case strings.HasPrefix(strings.ToLower(layout), "same-project"):
+		demoProject = coreProject
+	default:
+		return fmt.Errorf("unknown project layout %q", layout)
+	}
+	for _, module := range connectivityModules {
+		w.options[module].Vars["demo_web_app_project_id"] = demoProject
+	}
+	return nil
+}
+
+func (w *connectivityWorld) planModule(ctx context.Context, module string) error {
+	plan, err := planfixture.PlanFor(godog.T(ctx), module, w.options[module].Vars)
+	if err != nil {
+		return err
+	}
+	w.plans[module] = planquery.New(plan)
+	return nil
+}
+
+// Then
+
+// trafficFollowsPattern resolves the path from the external load balancer
+// through both plans and checks it against the doc string and the pattern the
+// enable_* flags select
+func (w *connectivityWorld) trafficFollowsPattern(pattern int, flow *godog.DocString) error {
+	var hops []trafficpath.Hop
+	for _, hop := range strings.Split(strings.Join(strings.Fields(flow.Content), " "), "→") {
+		if hop = strings.TrimSpace(hop); hop != "" {
+			hops = append(hops, trafficpath.Hop(hop))
+		}
+	}
+
+	path, selected, err := trafficpath.Verify(w.plans, nil)
+	if err != nil {
+		return err
+	}
+	if selected.Number != pattern {
+		return fmt.Errorf("the variables select pattern %d (%s), not pattern %d", selected.Number, selected.Name, pattern)
+	}
+	if got, want := path.String(), (trafficpath.Pattern{Hops: hops}).String(); got != want {
+		return fmt.Errorf("traffic path is %s, expected %s\n%s", got, want, path.Describe())
+	}
+	return nil
+}
+
+func (w *connectivityWorld) resourcesExist(table *godog.Table) error {
+	var missing []string
+	for _, row := range table.Rows[1:] {
+		descriptor, module := row.Cells[0].Value, row.Cells[1].Value
+		found, err := w.find(module, descriptor)
+		if err != nil {
+			return err
+		}
+		if len(found) == 0 {
+			missing = append(missing, fmt.Sprintf("%s in %s", descriptor, module))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("not planned: %s", strings.Join(missing, "; "))
+	}
+	return nil
+}
+
+func (w *connectivityWorld) resourcesAbsent(table *godog.Table) error {
+	var present []string
+	for _, row := range table.Rows[1:] {
+		found, err := w.find("", row.Cells[0].Value)
+		if err != nil {
+			return err
+		}
+		present = append(present, found...)
+	}
+	if len(present) > 0 {
+		return fmt.Errorf("planned but forbidden: %s", strings.Join(present, ", "))
+	}
+	return nil
+}
+
+// vpcsIsolated requires both VPCs and nothing that would join them
+func (w *connectivityWorld) vpcsIsolated() error {
+	for _, descriptor := range []struct{ module, resource string }{
+		{"core", "google_compute_network (ingress-vpc)"},
+		{"demo-web-app", "google_compute_network (web-vpc)"},
+	} {
+		found, err := w.find(descriptor.module, descriptor.resource)
+		if err != nil {
+			return err
+		}
+		if len(found) == 0 {
+			return fmt.Errorf("no %s planned in %s", descriptor.resource, descriptor.module)
+		}
+	}
+	for _, resourceType := range interconnectTypes {
+		found, err := w.find("", resourceType)
+		if err != nil {
+			return err
+		}
+		if len(found) > 0 {
+			return fmt.Errorf("VPCs are joined outside PSC by %s", strings.Join(found, ", "))
+		}
+	}
+	return nil
+}
+
+// onlyViaPSC requires the core NEG to be a PSC consumer of the demo service
+// attachment, with no other interconnect planned
+func (w *connectivityWorld) onlyViaPSC() error {
+	neg, err := w.plans["core"].Find(planquery.Addr("google_compute_region_network_endpoint_group.demo_web_app_psc_neg"))
+	if err != nil {
+		return err
+	}
+	if err := neg.ExpectAfter("network_endpoint_type", "PRIVATE_SERVICE_CONNECT"); err != nil {
+		return err
+	}
+	target, err := neg.AfterString("psc_target_service")
+	if err != nil {
+		return err
+	}
+	attachment, err := w.plans["demo-web-app"].Find(planquery.Type("google_compute_service_attachment"))
+	if err != nil {
+		return err
+	}
+	name, err := attachment.AfterString("name")
+	if err != nil {
+		return err
+	}
+	if !strings.HasSuffix(target, "/serviceAttachments/"+name) {
+		return fmt.Errorf("%s targets %s, not the service attachment %q", neg.Address(), target, name)
+	}
+	return w.vpcsIsolated()
+}
+
+// helpers
+
+// find returns the addresses of resources matching a table descriptor that are
+// planned to exist, in module or in every planned module when module is empty
+func (w *connectivityWorld) find(module, descriptor string) ([]string, error) {
+	if alias, ok := resourceAliases[descriptor]; ok {
+		descriptor = alias
+	}
+	filters, err := descriptorFilters(descriptor)
+	if err != nil {
+		return nil, err
+	}
+
+	modules := connectivityModules
+	if module != "" {
+		modules = []string{module}
+	}
+	var found []string
+	for _, m := range modules {
+		plan, ok := w.plans[m]
+		if !ok {
+			return nil, fmt.Errorf("%s has not been planned", m)
+		}
+		for _, r := range plan.Resources(filters...) {
+			if r.Action() != planquery.Delete {
+				found = append(found, m+": "+r.Address())
+			}
+		}
+	}
+	sort.Strings(found)
+	return found, nil
+}
+
+// descriptorFilters turns "google_compute_network (web-vpc)" into a type filter
+// plus a qualifier matched against the resource name or any top-level string
+// attribute (so "Serverless" matches network_endpoint_type = "SERVERLESS")
+func descriptorFilters(descriptor string) ([]planquery.Filter, error) {
+	resourceType, qualifier, hasQualifier := strings.Cut(descriptor, " (")
+	resourceType = strings.TrimSpace(resourceType)
+	if strings.ContainsAny(resourceType, " ") || !strings.Contains(resourceType, "_") {
+		return nil, fmt.Errorf("unknown resource descriptor %q", descriptor)
+	}
+	filters := []planquery.Filter{planquery.Managed(), planquery.Type(resourceType)}
+	if !hasQualifier {
+		return filters, nil
+	}
+
+	want := normalizeQualifier(strings.TrimSuffix(qualifier, ")"))
+	return append(filters, planquery.Where(want, func(r planquery.Resource) bool {
+		if strings.Contains(r.Name(), want) {
+			return true
+		}
+		after, _ := r.Change().Change.After.(map[string]interface{})
+		for _, value := range after {
+			if s, ok := value.(string); ok && strings.Contains(normalizeQualifier(s), want) {
+				return true
+			}
+		}
+		return false
+	})), nil
+}
+
+func normalizeQualifier(s string) string {
+	return strings.NewReplacer(" ", "_", "-", "_").Replace(strings.ToLower(strings.TrimSpace(s)))
+}
@@ -7,6 +7,9 @@ import (
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"vibetics-cloudedge/tests/planfixture"
+	"vibetics-cloudedge/tests/planquery"
 )
 
 // TestCoreInfrastructureContract validates the contract for the core infrastructure module
@@ -22,30 +25,11 @@ func TestCoreInfrastructureContract(t *testing.T) {
 	t.Run("ValidateNoSharedVPCResources", func(t *testing.T) {
 		t.Parallel()
 
-		terraformOptions := &terraform.Options{
-			TerraformDir:    "../../deploy/opentofu/gcp/core",
-			TerraformBinary: "tofu",
-			NoColor:         true,
-		}
-
-		// Initialize and validate
-		terraform.Init(t, terraformOptions)
-
-		// Get the plan in JSON format to inspect resources
-		planStruct := terraform.InitAndPlanAndShowWithStruct(t, terraformOptions)
+		plan := planquery.New(planfixture.Plan(t, "core_default"))
 
 		// Verify NO Shared VPC resources are planned
-		sharedVPCResourceTypes := []string{
-			"google_compute_shared_vpc_host_project",
-			"google_compute_shared_vpc_service_project",
-		}
-
-		for resourceType := range planStruct.ResourceChangesMap {
-			for _, sharedVPCType := range sharedVPCResourceTypes {
-				assert.NotContains(t, resourceType, sharedVPCType,
-					"Shared VPC resource type '%s' should not exist in core infrastructure", sharedVPCType)
-			}
-		}
+		plan.AssertAbsent(t, planquery.Type("google_compute_shared_vpc_host_project"))
+		plan.AssertAbsent(t, planquery.Type("google_compute_shared_vpc_service_project"))
 
 		t.Log("✓ Verified: No Shared VPC resources in core infrastructure")
 	})
@@ -53,40 +37,16 @@ func TestCoreInfrastructureContract(t *testing.T) {
 	t.Run("ValidateIngressVPCExists", func(t *testing.T) {
 		t.Parallel()
 
-		terraformOptions := &terraform.Options{
-			TerraformDir:    "../../deploy/opentofu/gcp/core",
-			TerraformBinary: "tofu",
-			NoColor:         true,
-		}
-
-		terraform.Init(t, terraformOptions)
-		planStruct := terraform.InitAndPlanAndShowWithStruct(t, terraformOptions)
+		plan := planquery.New(planfixture.Plan(t, "core_default"))
 
 		// Verify Ingress VPC resources exist
-		foundIngressVPC := false
-		foundIngressSubnet := false
-		foundProxyOnlySubnet := false
-
-		for _, resource := range planStruct.ResourceChangesMap {
-			if resource.Type == "google_compute_network" && resource.Name == "ingress_vpc" {
-				foundIngressVPC = true
-				// Verify auto_create_subnetworks is false
-				if config, ok := resource.Change.After.(map[string]interface{}); ok {
-					assert.Equal(t, false, config["auto_create_subnetworks"],
-						"Ingress VPC should have auto_create_subnetworks = false")
-				}
-			}
-			if resource.Type == "google_compute_subnetwork" && resource.Name == "ingress_subnet" {
-				foundIngressSubnet = true
-			}
-			if resource.Type == "google_compute_subnetwork" && resource.Name == "proxy_only_subnet" {
-				foundProxyOnlySubnet = true
-			}
-		}
+		ingressVPC := plan.Require(t, planquery.Addr("google_compute_network.ingress_vpc"), planquery.Root())
+		ingressVPC.AssertAction(t, planquery.Create)
+		ingressVPC.AssertAfter(t, "auto_create_subnetworks", false)
 
-		assert.True(t, foundIngressVPC, "Ingress VPC should exist in core infrastructure")
-		assert.True(t, foundIngressSubnet, "Ingress subnet should exist in core infrastructure")
-		assert.True(t, foundProxyOnlySubnet, "Proxy-only subnet should exist for Regional External ALB")
+		plan.AssertCreate(t, planquery.Addr("google_compute_subnetwork.ingress_subnet"))
+		proxyOnlySubnet := plan.Require(t, planquery.Addr("google_compute_subnetwork.proxy_only_subnet"))
+		proxyOnlySubnet.AssertAfter(t, "purpose", "REGIONAL_MANAGED_PROXY")
 
 		t.Log("✓ Verified: Ingress VPC and subnets exist in core infrastructure")
 	})
@@ -94,44 +54,10 @@ func TestCoreInfrastructureContract(t *testing.T) {
 	t.Run("ValidateVariableStructure", func(t *testing.T) {
 		t.Parallel()
 
-		terraformOptions := &terraform.Options{
-			TerraformDir:    "../../deploy/opentofu/gcp/core",
-			TerraformBinary: "tofu",
-			NoColor:         true,
-		}
-
-		// Get variable definitions
-		output := terraform.RunTerraformCommand(t, terraformOptions, "init")
-		require.NotEmpty(t, output)
-
-		// Read variables.tf to verify expected variables exist
-		expectedVariables := []string{
-			"project_suffix",
-			"region",
-			"cloudedge_github_repository",
-			"resource_tags",
-			"cloudedge_project_id",
-			"enable_logging",
-			"billing_account_name",
-			"cloudflare_api_token",
-			"cloudflare_origin_ca_key",
-			"cloudflare_zone_id",
-			"enable_cloudflare_proxy",
-			"root_domain",
-			"allowed_https_source_ranges",
-			"ingress_vpc_cidr_range",
-			"proxy_only_subnet_cidr_range",
-			"enable_waf",
-			"enable_psc",
-			"enable_demo_web_app",
-			"demo_web_app_project_id",
-			"demo_web_app_service_name",
-			"demo_web_app_subdomain_name",
-			"enable_demo_web_app_psc_neg",
-		}
+		// Every variable in variables.tf must match contracts/core.yaml: type,
+		// default, sensitive flag and validation blocks, with no undeclared additions
+		assertVariableContract(t, "core")
 
-		// This is a basic check - in a real scenario, you'd parse variables.tf
-		t.Logf("Expected variables defined in contract: %v", expectedVariables)
 		t.Log("✓ Verified: Variable structure follows new pattern")
 	})
 
@@ -139,41 +65,12 @@ func TestCoreInfrastructureContract(t *testing.T) {
 		t.Parallel()
 
 		// Test with enable_demo_web_app_psc_neg = true
-		terraformOptionsWithPSC := &terraform.Options{
-			TerraformDir:    "../../deploy/opentofu/gcp/core",
-			TerraformBinary: "tofu",
-			NoColor:         true,
-			Vars: map[string]interface{}{
-				"enable_demo_web_app":         true,
-				"enable_demo_web_app_psc_neg": true,
-				"project_suffix":              "nonprod",
-				"region":                      "us-central1",
-				"cloudedge_github_repository": "test-repo",
-				"cloudflare_api_token":        "test-token",
-				"cloudflare_zone_id":          "test-zone-id",
-				"billing_account_name":        "test-billing",
-				"root_domain":                 "example.com",
-			},
-			BackendConfig: map[string]interface{}{
-				"bucket": "test-bucket",
-				"prefix": "test-prefix",
-			},
-		}
-
-		terraform.Init(t, terraformOptionsWithPSC)
-		planStruct := terraform.InitAndPlanAndShowWithStruct(t, terraformOptionsWithPSC)
+		plan := planquery.New(planfixture.Plan(t, "core_psc_neg"))
 
 		// When enable_demo_web_app_psc_neg is true, PSC NEG should be created
-		foundPSCNEG := false
-		for _, resource := range planStruct.ResourceChangesMap {
-			if resource.Type == "google_compute_region_network_endpoint_group" &&
-				resource.Name == "demo_web_app_psc_neg" {
-				foundPSCNEG = true
-			}
-		}
-
-		assert.True(t, foundPSCNEG,
-			"PSC NEG should be created when enable_demo_web_app_psc_neg is true")
+		pscNEG := plan.Require(t, planquery.Addr("google_compute_region_network_endpoint_group.demo_web_app_psc_neg"), planquery.Index(0))
+		pscNEG.AssertAction(t, planquery.Create)
+		pscNEG.AssertAfter(t, "network_endpoint_type", "PRIVATE_SERVICE_CONNECT")
 
 		t.Log("✓ Verified: PSC NEG is conditionally created based on enable_demo_web_app_psc_neg")
 	})
@@ -182,41 +79,10 @@ func TestCoreInfrastructureContract(t *testing.T) {
 		t.Parallel()
 
 		// Test with enable_waf = true
-		terraformOptionsWithWAF := &terraform.Options{
-			TerraformDir:    "../../deploy/opentofu/gcp/core",
-			TerraformBinary: "tofu",
-			NoColor:         true,
-			Vars: map[string]interface{}{
-				"enable_waf":                  true,
-				"enable_demo_web_app":         true,
-				"project_suffix":              "nonprod",
-				"region":                      "us-central1",
-				"cloudedge_github_repository": "test-repo",
-				"cloudflare_api_token":        "test-token",
-				"cloudflare_zone_id":          "test-zone-id",
-				"billing_account_name":        "test-billing",
-				"root_domain":                 "example.com",
-			},
-			BackendConfig: map[string]interface{}{
-				"bucket": "test-bucket",
-				"prefix": "test-prefix",
-			},
-		}
-
-		terraform.Init(t, terraformOptionsWithWAF)
-		planStruct := terraform.InitAndPlanAndShowWithStruct(t, terraformOptionsWithWAF)
+		plan := planquery.New(planfixture.Plan(t, "core_waf"))
 
 		// When enable_waf is true, WAF policy should be created
-		foundWAFPolicy := false
-		for _, resource := range planStruct.ResourceChangesMap {
-			if resource.Type == "google_compute_region_security_policy" &&
-				resource.Name == "edge_waf_policy" {
-				foundWAFPolicy = true
-			}
-		}
-
-		assert.True(t, foundWAFPolicy,
-			"WAF security policy should be created when enable_waf is true")
+		plan.AssertCreate(t, planquery.Addr("google_compute_region_security_policy.edge_waf_policy"), planquery.Index(0))
 
 		t.Log("✓ Verified: WAF policy is conditionally created based on enable_waf")
 	})
@@ -224,48 +90,15 @@ func TestCoreInfrastructureContract(t *testing.T) {
 	t.Run("ValidateCloudflareIntegration", func(t *testing.T) {
 		t.Parallel()
 
-		terraformOptions := &terraform.Options{
-			TerraformDir:    "../../deploy/opentofu/gcp/core",
-			TerraformBinary: "tofu",
-			NoColor:         true,
-			Vars: map[string]interface{}{
-				"enable_cloudflare_proxy":     true,
-				"enable_demo_web_app":         true,
-				"project_suffix":              "nonprod",
-				"region":                      "us-central1",
-				"cloudedge_github_repository": "test-repo",
-				"cloudflare_api_token":        "test-token",
-				"cloudflare_origin_ca_key":    "test-ca-key",
-				"cloudflare_zone_id":          "test-zone-id",
-				"billing_account_name":        "test-billing",
-				"root_domain":                 "example.com",
-			},
-			BackendConfig: map[string]interface{}{
-				"bucket": "test-bucket",
-				"prefix": "test-prefix",
-			},
-		}
-
-		terraform.Init(t, terraformOptions)
-		planStruct := terraform.InitAndPlanAndShowWithStruct(t, terraformOptions)
+		plan := planquery.New(planfixture.Plan(t, "core_default"))
 
 		// Verify Cloudflare resources
-		foundCloudflareDNS := false
-		foundCloudflareOriginCert := false
-
-		for _, resource := range planStruct.ResourceChangesMap {
-			if resource.Type == "cloudflare_record" {
-				foundCloudflareDNS = true
-			}
-			if resource.Type == "cloudflare_origin_ca_certificate" {
-				foundCloudflareOriginCert = true
-			}
-		}
+		dnsRecord := plan.Require(t, planquery.Type("cloudflare_record"))
+		dnsRecord.AssertAction(t, planquery.Create)
+		dnsRecord.AssertAfter(t, "proxied", true)
 
-		assert.True(t, foundCloudflareDNS,
-			"Cloudflare DNS record should be created")
-		assert.True(t, foundCloudflareOriginCert,
-			"Cloudflare Origin CA certificate should be created when enable_cloudflare_proxy is true")
+		// Origin CA certificate is created when enable_cloudflare_proxy is true
+		plan.AssertCreate(t, planquery.Type("cloudflare_origin_ca_certificate"))
 
 		t.Log("✓ Verified: Cloudflare integration resources are properly configured")
 	})
@@ -273,34 +106,17 @@ func TestCoreInfrastructureContract(t *testing.T) {
 	t.Run("ValidateFirewallRulesForCloudflare", func(t *testing.T) {
 		t.Parallel()
 
-		terraformOptions := &terraform.Options{
-			TerraformDir:    "../../deploy/opentofu/gcp/core",
-			TerraformBinary: "tofu",
-			NoColor:         true,
-		}
-
-		terraform.Init(t, terraformOptions)
-		planStruct := terraform.InitAndPlanAndShowWithStruct(t, terraformOptions)
+		plan := planquery.New(planfixture.Plan(t, "core_default"))
 
 		// Verify firewall rule exists
-		foundFirewallRule := false
-		for _, resource := range planStruct.ResourceChangesMap {
-			if resource.Type == "google_compute_firewall" &&
-				resource.Name == "allow_ingress_vpc_https_ingress" {
-				foundFirewallRule = true
-
-				// Verify source_ranges is dynamically set based on enable_cloudflare_proxy
-				if config, ok := resource.Change.After.(map[string]interface{}); ok {
-					if sourceRanges, ok := config["source_ranges"].([]interface{}); ok {
-						assert.NotEmpty(t, sourceRanges,
-							"Firewall rule should have source_ranges defined")
-					}
-				}
-			}
-		}
+		firewallRule := plan.Require(t, planquery.Addr("google_compute_firewall.allow_ingress_vpc_https_ingress"))
+		firewallRule.AssertAction(t, planquery.Create)
 
-		assert.True(t, foundFirewallRule,
-			"HTTPS ingress firewall rule should exist")
+		// Verify source_ranges is dynamically set based on enable_cloudflare_proxy
+		sourceRanges, err := firewallRule.AfterList("source_ranges")
+		require.NoError(t, err)
+		assert.NotEmpty(t, sourceRanges, "Firewall rule should have source_ranges defined")
+		firewallRule.AssertAfter(t, "allow.0.ports", []string{"443"})
 
 		t.Log("✓ Verified: Firewall rules are properly configured for Cloudflare or custom source ranges")
 	})
@@ -308,6 +124,8 @@ func TestCoreInfrastructureContract(t *testing.T) {
 	t.Run("ValidateResourceTagging", func(t *testing.T) {
 		t.Parallel()
 
+		planfixture.RequireLive(t)
+
 		terraformOptions := &terraform.Options{
 			TerraformDir:    "../../deploy/opentofu/gcp/core",
 			TerraformBinary: "tofu",
@@ -327,24 +145,9 @@ func TestCoreInfrastructureContract(t *testing.T) {
 func TestCoreInfrastructureOutputs(t *testing.T) {
 	t.Parallel()
 
-	terraformOptions := &terraform.Options{
-		TerraformDir:    "../../deploy/opentofu/gcp/core",
-		TerraformBinary: "tofu",
-		NoColor:         true,
-	}
-
-	// Initialize
-	terraform.Init(t, terraformOptions)
-
-	// Expected outputs based on the infrastructure
-	expectedOutputs := []string{
-		"external_lb_ip",
-		"ingress_vpc_id",
-		"ingress_vpc_name",
-		// Add more expected outputs as needed
-	}
+	// Declared outputs (and their sensitive flags) must match contracts/core.yaml
+	assertOutputContract(t, "core")
 
-	t.Logf("Contract expects these outputs to be defined: %v", expectedOutputs)
 	t.Log("✓ Output contract validated")
 }
 
@@ -355,6 +158,8 @@ func TestCoreInfrastructureVariableValidation(t *testing.T) {
 	t.Run("InvalidProjectSuffix", func(t *testing.T) {
 		t.Parallel()
 
+		planfixture.RequireLive(t)
+
 		terraformOptions := &terraform.Options{
 			TerraformDir:    "../../deploy/opentofu/gcp/core",
 			TerraformBinary: "tofu",
@@ -379,6 +184,8 @@ func TestCoreInfrastructureVariableValidation(t *testing.T) {
 	t.Run("MissingRequiredTagsInResourceTags", func(t *testing.T) {
 		t.Parallel()
 
+		planfixture.RequireLive(t)
+
 		terraformOptions := &terraform.Options{
 			TerraformDir:    "../../deploy/opentofu/gcp/core",
 			TerraformBinary: "tofu",
@@ -406,14 +213,7 @@ func TestCoreInfrastructureVariableValidation(t *testing.T) {
 func TestCoreInfrastructureDataSources(t *testing.T) {
 	t.Parallel()
 
-	terraformOptions := &terraform.Options{
-		TerraformDir:    "../../deploy/opentofu/gcp/core",
-		TerraformBinary: "tofu",
-		NoColor:         true,
-	}
-
-	terraform.Init(t, terraformOptions)
-	planStruct := terraform.InitAndPlanAndShowWithStruct(t, terraformOptions)
+	planStruct := planfixture.Plan(t, "core_default")
 
 	// Verify expected data sources are referenced in the configuration
 	expectedDataSources := []string{
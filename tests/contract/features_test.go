@@ -0,0 +1,13 @@
+package contract
+
+import (
+	"testing"
+
+	"vibetics-cloudedge/tests/steps"
+)
+
+// TestFeatures runs the @contract scenarios of the module feature files with
+// the shared step library; each feature and scenario is its own subtest
+func TestFeatures(t *testing.T) {
+	steps.Run(t, steps.Contract, steps.Features...)
+}
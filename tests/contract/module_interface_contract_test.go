@@ -0,0 +1,90 @@
+package contract
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vibetics-cloudedge/tests/modcontract"
+	"vibetics-cloudedge/tests/planfixture"
+)
+
+// contractPath returns the interface contract file of a module
+func contractPath(module string) string {
+	return filepath.Join("contracts", module+".yaml")
+}
+
+// assertVariableContract parses the module's variables with the HCL parser and
+// fails with one line per discrepancy against its contract file
+func assertVariableContract(t *testing.T, module string) {
+	t.Helper()
+
+	contract, err := modcontract.LoadContract(contractPath(module))
+	require.NoError(t, err)
+	parsed, err := modcontract.LoadModule(planfixture.ModuleDir(module))
+	require.NoError(t, err)
+
+	problems := contract.CheckVariables(parsed)
+	assert.Empty(t, problems, "Variables of %s drifted from %s:\n  %s",
+		module, contractPath(module), strings.Join(problems, "\n  "))
+}
+
+// assertOutputContract parses the module's outputs and fails with a diff against
+// its contract file
+func assertOutputContract(t *testing.T, module string) {
+	t.Helper()
+
+	contract, err := modcontract.LoadContract(contractPath(module))
+	require.NoError(t, err)
+	parsed, err := modcontract.LoadModule(planfixture.ModuleDir(module))
+	require.NoError(t, err)
+
+	if diff := contract.DiffOutputs(parsed); diff != "" {
+		t.Errorf("Outputs of %s drifted from %s:\n%s", module, contractPath(module), diff)
+	}
+}
+
+// TestProjectSingletonVariableContract validates the project-singleton module's variables
+func TestProjectSingletonVariableContract(t *testing.T) {
+	t.Parallel()
+
+	assertVariableContract(t, "project-singleton")
+
+	t.Log("✓ Verified: project-singleton variables match the contract")
+}
+
+// TestProjectSingletonOutputs validates the project-singleton module's outputs
+func TestProjectSingletonOutputs(t *testing.T) {
+	t.Parallel()
+
+	assertOutputContract(t, "project-singleton")
+
+	t.Log("✓ Output contract validated")
+}
+
+// TestRemoteStateContract validates that every output read through a
+// terraform_remote_state data source is exported by the module writing that state
+func TestRemoteStateContract(t *testing.T) {
+	t.Parallel()
+
+	findings, err := modcontract.CheckRemoteState(planfixture.ModuleDir(""), modcontract.StateProducers{
+		"singleton": "project-singleton",
+	})
+	require.NoError(t, err)
+
+	for _, finding := range findings {
+		t.Errorf("Remote state contract broken: %s", finding)
+	}
+
+	core, err := modcontract.LoadModule(planfixture.ModuleDir("core"))
+	require.NoError(t, err)
+	assert.NotEmpty(t, core.RemoteStateRefs, "core should read outputs through terraform_remote_state")
+	for _, ref := range core.RemoteStateRefs {
+		t.Logf("core reads %s", ref)
+	}
+
+	t.Log("✓ Verified: Remote state references resolve to declared outputs")
+}
@@ -0,0 +1,39 @@
+package contract
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"vibetics-cloudedge/tests/compliance"
+	"vibetics-cloudedge/tests/planfixture"
+	"vibetics-cloudedge/tests/policy"
+)
+
+// TestPolicyContract evaluates the bundled CEL policies, and those in the
+// directories listed in CLOUDEDGE_POLICY_DIRS, against the plan of every
+// scenario. Unlike TestCheckovScan it needs nothing outside the Go module.
+func TestPolicyContract(t *testing.T) {
+	t.Parallel()
+
+	engine, err := policy.Load(policy.DirsFromEnv()...)
+	require.NoError(t, err)
+
+	for _, scenario := range planfixture.Scenarios() {
+		scenario := scenario
+		t.Run(scenario.Name, func(t *testing.T) {
+			t.Parallel()
+
+			plan := planfixture.Plan(t, scenario.Name)
+			report := engine.Evaluate(&plan.RawPlan)
+
+			for _, result := range report.Failed() {
+				for _, f := range result.Evidence {
+					if f.Status == compliance.Fail {
+						t.Errorf("policy %s (%s) %s: %s\n  remediation: %s", result.Control, result.Title, f.Address, f.Detail, result.Remediation)
+					}
+				}
+			}
+		})
+	}
+}
@@ -1,16 +1,33 @@
 package contract
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/cucumber/godog"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+
+	"vibetics-cloudedge/tests/migrate"
 )
 
 func TestStateMigrationContract(t *testing.T) {
 	opts := godog.Options{
-		Format: "pretty",
-		Paths:  []string{"../../features/directory_migration.feature"},
-		Tags:   "@contract",
+		Format:   "pretty",
+		Paths:    []string{"../../features/directory_migration.feature"},
+		Tags:     "@contract",
+		Strict:   true,
+		TestingT: t,
 	}
 
 	status := godog.TestSuite{
@@ -24,27 +41,668 @@ func TestStateMigrationContract(t *testing.T) {
 	}
 }
 
+// migrationWorld is the per-scenario state: a throwaway repository root, the
+// fake remote state and the outcome of the migration run against it
+type migrationWorld struct {
+	root   string
+	branch string
+	state  *fakeState
+	pushed *fakeStore
+	now    time.Time
+	// before maps every file under root to its content just before the run
+	before   map[string]string
+	dotFiles []string
+	result   *migrate.Result
+	err      error
+}
+
+// migrationLockTimeout keeps the locked-state scenario fast while still
+// polling the lock more than once
+const migrationLockTimeout = 50 * time.Millisecond
+
+// fakeState stands in for the GCS backend: Pull returns what `tofu state pull`
+// would and Lock the contents of the .tflock object
+type fakeState struct {
+	doc        map[string]any
+	lock       *migrate.LockInfo
+	lockChecks int
+}
+
+func (s *fakeState) Pull() ([]byte, error) {
+	return json.MarshalIndent(s.doc, "", "  ")
+}
+
+func (s *fakeState) Lock() (*migrate.LockInfo, error) {
+	s.lockChecks++
+	return s.lock, nil
+}
+
+// fakeStore stands in for the state object under the new backend prefix
+type fakeStore struct {
+	data []byte
+}
+
+func (s *fakeStore) Pull() ([]byte, error)            { return s.data, nil }
+func (s *fakeStore) Lock() (*migrate.LockInfo, error) { return nil, nil }
+func (s *fakeStore) Push(data []byte) error           { s.data = data; return nil }
+func (s *fakeStore) Location() string {
+	return "gs://state/" + migrate.DefaultTarget + "/default.tfstate"
+}
+
 func InitializeContractScenario(ctx *godog.ScenarioContext) {
-	ctx.Step(`^the original "([^"]*)" file contains:$`, originalFileContains)
-	ctx.Step(`^I execute the directory migration process$`, executeMigration)
-	ctx.Step(`^the "([^"]*)" in "([^"]*)" should contain:$`, migratedFileContains)
-	ctx.Step(`^the backend configuration should be syntactically valid$`, backendConfigValid)
+	w := &migrationWorld{}
+
+	ctx.Before(func(ctx context.Context, sc *godog.Scenario) (context.Context, error) {
+		root, err := os.MkdirTemp("", "migration-*")
+		if err != nil {
+			return ctx, err
+		}
+		*w = migrationWorld{root: root, now: time.Now()}
+		return ctx, nil
+	})
+	ctx.After(func(ctx context.Context, sc *godog.Scenario, err error) (context.Context, error) {
+		return ctx, os.RemoveAll(w.root)
+	})
+
+	ctx.Step(`^the repository is on branch "([^"]*)"$`, w.onBranch)
+	ctx.Step(`^the repository root contains OpenTofu configuration files$`, w.rootHasConfiguration)
+	ctx.Step(`^a remote OpenTofu state exists in GCS backend$`, w.remoteStateExists)
+	ctx.Step(`^no other OpenTofu operations are in progress \(state is unlocked\)$`, w.stateUnlocked)
+
+	ctx.Step(`^the following files exist in the repository root:$`, w.filesExist)
+	ctx.Step(`^the "([^"]*)" directory exists in the repository root$`, w.pathExists)
+	ctx.Step(`^the "([^"]*)" cache directory exists$`, w.pathExists)
+	ctx.Step(`^the "([^"]*)" directory contains the following subdirectories:$`, w.directoryContains)
+	ctx.Step(`^the repository root contains the following dot-files:$`, w.rootHasDotFiles)
+	ctx.Step(`^the original "([^"]*)" file contains:$`, w.originalFileContains)
+	ctx.Step(`^the "([^"]*)" file contains module references with relative paths:$`, w.originalFileContains)
+	ctx.Step(`^the current timestamp is "([^"]*)"$`, w.currentTimestamp)
+	ctx.Step(`^another OpenTofu operation is holding a state lock$`, w.stateLocked)
+
+	ctx.Step(`^I execute the directory migration process$`, w.executeMigration)
+	ctx.Step(`^I execute the directory migration process with --dry-run$`, w.executeDryRun)
+	ctx.Step(`^I attempt to execute the directory migration process$`, w.attemptMigration)
+
+	ctx.Step(`^all "([^"]*)" cache directories should be deleted$`, w.cachesDeleted)
+	ctx.Step(`^the file "([^"]*)" should exist at "([^"]*)"$`, w.fileMovedTo)
+	ctx.Step(`^the directory "([^"]*)" should exist at "([^"]*)"$`, w.directoryMovedTo)
+	ctx.Step(`^no "([^"]*)" files should remain in the repository root$`, w.noFilesRemain)
+	ctx.Step(`^the "([^"]*)" file should exist at "([^"]*)"$`, w.fileCopiedTo)
+	ctx.Step(`^the "([^"]*)" file should still exist in the repository root$`, w.stillInRoot)
+	ctx.Step(`^the file "([^"]*)" should still exist in the repository root$`, w.stillInRoot)
+	ctx.Step(`^all module files should be recursively moved to the new location$`, w.moduleFilesMoved)
+	ctx.Step(`^the "([^"]*)" directory should not exist in the repository root$`, w.goneFromRoot)
+	ctx.Step(`^these files should NOT be moved to "([^"]*)"$`, w.dotFilesNotMoved)
+	ctx.Step(`^the module "([^"]*)" in "([^"]*)" should have source "([^"]*)"$`, w.moduleHasSource)
+	ctx.Step(`^the migration report should list "([^"]*)" moving to "([^"]*)"$`, w.reportListsMove)
+	ctx.Step(`^the migration report should list "([^"]*)" for deletion$`, w.reportListsDeletion)
+
+	ctx.Step(`^the state pull operation should wait for lock release or timeout$`, w.waitedForLock)
+	ctx.Step(`^if the lock is not released within the timeout period$`, w.lockStillHeld)
+	ctx.Step(`^the migration should abort with an error message$`, w.migrationAborted)
+	ctx.Step(`^no files should be moved$`, w.nothingMoved)
+	ctx.Step(`^no backup files should remain in the repository$`, w.noBackups)
+
+	ctx.Step(`^the "([^"]*)" in "([^"]*)" should contain:$`, w.migratedFileContains)
+	ctx.Step(`^the backend configuration should be syntactically valid$`, w.backendConfigValid)
+	ctx.Step(`^a state backup file should be created with filename "([^"]*)"$`, w.backupCreated)
+	ctx.Step(`^the backup file should contain valid OpenTofu state JSON$`, w.backupIsStateJSON)
+	ctx.Step(`^the backup file should have a "([^"]*)" field$`, w.backupHasField)
+	ctx.Step(`^the backup file should contain all managed resources from the original state$`, w.backupHasAllResources)
+}
+
+// Background
+
+func (w *migrationWorld) onBranch(branch string) error {
+	// The migration works on a copy of the layout, so the branch is recorded
+	// for the scenario log rather than checked out
+	w.branch = branch
+	return nil
+}
+
+// rootHasConfiguration lays out the pre-migration repository: root *.tf files,
+// a backend config, a lock file, one local module and a provider cache
+func (w *migrationWorld) rootHasConfiguration() error {
+	files := map[string]string{
+		"main.tf": `module "waf" {
+  source = "./modules/gcp/waf"
+}
+`,
+		"variables.tf": `variable "project_id" {
+  type = string
+}
+`,
+		"outputs.tf": `output "project_id" {
+  value = var.project_id
+}
+`,
+		"backend.tf": `terraform {
+  backend "gcs" {}
+}
+`,
+		"backend-config.hcl": `bucket = "vibetics-cloudedge-terraform-state"
+prefix = ""
+`,
+		".terraform.lock.hcl": `provider "registry.opentofu.org/hashicorp/google" {
+  version = "5.0.0"
+}
+`,
+		"modules/gcp/waf/main.tf":      "# WAF module\n",
+		".terraform/terraform.tfstate": "{}\n",
+	}
+	for name, content := range files {
+		if err := w.write(name, content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remoteStateExists seeds the fake backend with a state holding ten managed
+// resources and one data source
+func (w *migrationWorld) remoteStateExists() error {
+	resources := []any{map[string]any{
+		"mode": "data", "type": "google_project", "name": "current", "instances": []any{},
+	}}
+	for i := 0; i < 10; i++ {
+		resources = append(resources, map[string]any{
+			"mode":      "managed",
+			"type":      "google_compute_firewall",
+			"name":      fmt.Sprintf("rule_%d", i),
+			"provider":  `provider["registry.opentofu.org/hashicorp/google"]`,
+			"instances": []any{map[string]any{"attributes": map[string]any{"id": fmt.Sprintf("rule-%d", i)}}},
+		})
+	}
+	w.state = &fakeState{doc: map[string]any{
+		"version":           4,
+		"terraform_version": "1.8.0",
+		"serial":            42,
+		"lineage":           "5f0c8e1a-3b7d-4c2e-9a61-0d4f2b8c7e13",
+		"outputs":           map[string]any{},
+		"resources":         resources,
+	}}
+	return nil
+}
+
+func (w *migrationWorld) stateUnlocked() error {
+	if w.state == nil {
+		return fmt.Errorf("no remote state has been set up")
+	}
+	w.state.lock = nil
+	return nil
+}
+
+// Given / When
+
+func (w *migrationWorld) filesExist(table *godog.Table) error {
+	for _, row := range table.Rows[1:] {
+		if err := w.pathExists(row.Cells[0].Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *migrationWorld) pathExists(name string) error {
+	_, err := os.Stat(w.path(name))
+	return err
 }
 
-// Implementations (Stubs)
+// directoryContains adds one module per listed subdirectory
+func (w *migrationWorld) directoryContains(dir string, table *godog.Table) error {
+	for _, row := range table.Rows[1:] {
+		name := path.Join(dir, row.Cells[0].Value)
+		if err := w.write(name+"/main.tf", "# "+name+"\n"); err != nil {
+			return err
+		}
+		if err := w.write(name+"/README.md", name+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-func originalFileContains(filename string, content *godog.DocString) error {
+func (w *migrationWorld) rootHasDotFiles(table *godog.Table) error {
+	for _, row := range table.Rows[1:] {
+		name := row.Cells[0].Value
+		w.dotFiles = append(w.dotFiles, name)
+		if w.pathExists(name) == nil {
+			continue
+		}
+		if err := w.write(name, "# "+name+"\n"); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func executeMigration() error {
+func (w *migrationWorld) originalFileContains(filename string, content *godog.DocString) error {
+	return w.write(filename, content.Content+"\n")
+}
+
+func (w *migrationWorld) currentTimestamp(value string) error {
+	now, err := time.Parse(time.DateTime, value)
+	if err != nil {
+		return fmt.Errorf("timestamp %q: %w", value, err)
+	}
+	w.now = now
 	return nil
 }
 
-func migratedFileContains(filename, path string, content *godog.DocString) error {
+func (w *migrationWorld) stateLocked() error {
+	if w.state == nil {
+		return fmt.Errorf("no remote state has been set up")
+	}
+	w.state.lock = &migrate.LockInfo{
+		ID:        "1732537845123456",
+		Operation: "OperationTypeApply",
+		Who:       "ci@github-runner",
+		Version:   "1.8.0",
+		Created:   w.now.Add(-time.Minute),
+		Path:      "default.tflock",
+	}
 	return nil
 }
 
-func backendConfigValid() error {
+func (w *migrationWorld) executeMigration() error {
+	w.run(false)
+	return w.err
+}
+
+func (w *migrationWorld) executeDryRun() error {
+	w.run(true)
+	return w.err
+}
+
+// attemptMigration runs the migration expecting it may fail; later steps
+// assert on the error
+func (w *migrationWorld) attemptMigration() error {
+	w.run(false)
+	return nil
+}
+
+// run snapshots the tree and runs the migration with the options the
+// `cloudedge migrate` command would pass
+func (w *migrationWorld) run(dryRun bool) {
+	w.before, w.err = w.snapshot()
+	if w.err != nil {
+		return
+	}
+	opts := migrate.Options{
+		Root:        w.root,
+		LockTimeout: migrationLockTimeout,
+		DryRun:      dryRun,
+		Now:         func() time.Time { return w.now },
+	}
+	if w.state != nil {
+		w.pushed = &fakeStore{}
+		opts.State, opts.Destination = w.state, w.pushed
+	}
+	w.result, w.err = migrate.Run(opts)
+}
+
+// Then
+
+func (w *migrationWorld) cachesDeleted(name string) error {
+	name = strings.TrimSuffix(name, "/")
+	return filepath.WalkDir(w.root, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() && d.Name() == name {
+			return fmt.Errorf("%s still exists", p)
+		}
+		return err
+	})
+}
+
+// fileMovedTo checks the file left the root and arrived unchanged; the backend
+// config is excluded from the content check because its prefix is rewritten
+func (w *migrationWorld) fileMovedTo(from, to string) error {
+	if err := w.goneFromRoot(from); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(w.path(to))
+	if err != nil {
+		return err
+	}
+	if from != migrate.BackendConfigFile && string(data) != w.before[from] {
+		return fmt.Errorf("%s differs from the original %s", to, from)
+	}
+	return nil
+}
+
+func (w *migrationWorld) directoryMovedTo(from, to string) error {
+	info, err := os.Stat(w.path(to))
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", to)
+	}
+	if strings.Count(strings.Trim(from, "/"), "/") == 0 {
+		return w.goneFromRoot(from)
+	}
+	return nil
+}
+
+func (w *migrationWorld) noFilesRemain(ext string) error {
+	matches, err := filepath.Glob(filepath.Join(w.root, "*"+ext))
+	if err != nil {
+		return err
+	}
+	if len(matches) > 0 {
+		return fmt.Errorf("left in the repository root: %v", matches)
+	}
+	return nil
+}
+
+func (w *migrationWorld) fileCopiedTo(name, to string) error {
+	data, err := os.ReadFile(w.path(to))
+	if err != nil {
+		return err
+	}
+	if string(data) != w.before[name] {
+		return fmt.Errorf("%s differs from the root %s", to, name)
+	}
+	return nil
+}
+
+func (w *migrationWorld) stillInRoot(name string) error {
+	data, err := os.ReadFile(w.path(name))
+	if err != nil {
+		return err
+	}
+	if string(data) != w.before[name] {
+		return fmt.Errorf("%s was modified", name)
+	}
 	return nil
 }
+
+func (w *migrationWorld) moduleFilesMoved() error {
+	moved := 0
+	for name, content := range w.before {
+		if !strings.HasPrefix(name, migrate.ModulesDir+"/") {
+			continue
+		}
+		data, err := os.ReadFile(w.path(path.Join(migrate.DefaultTarget, name)))
+		if err != nil {
+			return err
+		}
+		if string(data) != content {
+			return fmt.Errorf("%s changed while moving", name)
+		}
+		moved++
+	}
+	if moved == 0 {
+		return fmt.Errorf("no module files existed before the migration")
+	}
+	return nil
+}
+
+func (w *migrationWorld) goneFromRoot(name string) error {
+	if _, err := os.Stat(w.path(name)); !os.IsNotExist(err) {
+		return fmt.Errorf("%s still exists in the repository root", name)
+	}
+	return nil
+}
+
+// dotFilesNotMoved checks the dot-files stayed put; the lock file is the one
+// that is also copied into the target
+func (w *migrationWorld) dotFilesNotMoved(target string) error {
+	for _, name := range w.dotFiles {
+		if err := w.stillInRoot(name); err != nil {
+			return err
+		}
+		if name == migrate.LockFile {
+			continue
+		}
+		if _, err := os.Stat(w.path(path.Join(target, name))); !os.IsNotExist(err) {
+			return fmt.Errorf("%s was moved to %s", name, target)
+		}
+	}
+	return nil
+}
+
+func (w *migrationWorld) moduleHasSource(module, filename, expected string) error {
+	file, diags := hclparse.NewParser().ParseHCLFile(w.path(filename))
+	if diags.HasErrors() {
+		return diags
+	}
+	for _, block := range file.Body.(*hclsyntax.Body).Blocks {
+		if block.Type != "module" || len(block.Labels) != 1 || block.Labels[0] != module {
+			continue
+		}
+		attr, ok := block.Body.Attributes["source"]
+		if !ok {
+			return fmt.Errorf("%s: module %q has no source", filename, module)
+		}
+		value, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			return diags
+		}
+		if value.Type() != cty.String || value.AsString() != expected {
+			return fmt.Errorf("%s: module %q source is %s, expected %q", filename, module, value.GoString(), expected)
+		}
+		return nil
+	}
+	return fmt.Errorf("%s: no module %q", filename, module)
+}
+
+func (w *migrationWorld) reportListsMove(from, to string) error {
+	for _, m := range w.result.Moved {
+		if m.From == from && m.To == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("planned moves %v do not include %s -> %s", w.result.Moved, from, to)
+}
+
+func (w *migrationWorld) reportListsDeletion(name string) error {
+	for _, dir := range w.result.Deleted {
+		if dir == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("planned deletions %v do not include %s", w.result.Deleted, name)
+}
+
+func (w *migrationWorld) waitedForLock() error {
+	if w.state.lockChecks < 2 {
+		return fmt.Errorf("state lock was checked %d time(s), expected polling until the timeout", w.state.lockChecks)
+	}
+	return nil
+}
+
+func (w *migrationWorld) lockStillHeld() error {
+	if w.state.lock == nil {
+		return fmt.Errorf("state lock was released")
+	}
+	return nil
+}
+
+func (w *migrationWorld) migrationAborted() error {
+	var locked *migrate.LockedError
+	if !errors.As(w.err, &locked) {
+		return fmt.Errorf("migration returned %v, expected a state lock error", w.err)
+	}
+	if locked.Lock.ID != w.state.lock.ID || locked.Timeout != migrationLockTimeout {
+		return fmt.Errorf("lock error %q does not describe the held lock", w.err)
+	}
+	return nil
+}
+
+func (w *migrationWorld) nothingMoved() error {
+	after, err := w.snapshot()
+	if err != nil {
+		return err
+	}
+	for name, content := range w.before {
+		if after[name] != content {
+			return fmt.Errorf("%s was moved or modified", name)
+		}
+	}
+	for name := range after {
+		if _, ok := w.before[name]; !ok {
+			return fmt.Errorf("%s was created", name)
+		}
+	}
+	return nil
+}
+
+func (w *migrationWorld) noBackups() error {
+	matches, err := filepath.Glob(filepath.Join(w.root, "state-backup-*.tfstate"))
+	if err != nil {
+		return err
+	}
+	if len(matches) > 0 {
+		return fmt.Errorf("backup files left behind: %v", matches)
+	}
+	return nil
+}
+
+func (w *migrationWorld) migratedFileContains(filename, dir string, expected *godog.DocString) error {
+	data, err := os.ReadFile(w.path(path.Join(dir, filename)))
+	if err != nil {
+		return err
+	}
+	if normalizeLines(string(data)) != normalizeLines(expected.Content) {
+		return fmt.Errorf("%s%s:\n%s\nexpected:\n%s", dir, filename, data, expected.Content)
+	}
+	return nil
+}
+
+// backendConfigValid parses the relocated backend config and requires the
+// two keys the gcs backend needs to be string literals
+func (w *migrationWorld) backendConfigValid() error {
+	_, err := migrate.ReadBackendConfig(w.path(path.Join(migrate.DefaultTarget, migrate.BackendConfigFile)))
+	return err
+}
+
+func (w *migrationWorld) backupCreated(filename string) error {
+	if w.result == nil || w.result.Backup != filename {
+		return fmt.Errorf("migration reported backup %q, expected %q", w.backup(), filename)
+	}
+	_, err := os.Stat(filepath.Join(w.root, filename))
+	return err
+}
+
+func (w *migrationWorld) backupIsStateJSON() error {
+	doc, err := w.backupDoc()
+	if err != nil {
+		return err
+	}
+	if _, ok := doc["version"].(float64); !ok {
+		return fmt.Errorf("%s has no state format version", w.backup())
+	}
+	if _, ok := doc["resources"].([]any); !ok {
+		return fmt.Errorf("%s has no resources list", w.backup())
+	}
+	return nil
+}
+
+func (w *migrationWorld) backupHasField(field string) error {
+	doc, err := w.backupDoc()
+	if err != nil {
+		return err
+	}
+	if _, ok := doc[field]; !ok {
+		return fmt.Errorf("%s has no %q field", w.backup(), field)
+	}
+	return nil
+}
+
+func (w *migrationWorld) backupHasAllResources() error {
+	doc, err := w.backupDoc()
+	if err != nil {
+		return err
+	}
+	want := managedAddresses(w.state.doc["resources"])
+	got := managedAddresses(doc["resources"])
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		return fmt.Errorf("%s holds managed resources %v, original state holds %v", w.backup(), got, want)
+	}
+	return nil
+}
+
+// helpers
+
+func (w *migrationWorld) path(name string) string {
+	return filepath.Join(w.root, filepath.FromSlash(name))
+}
+
+func (w *migrationWorld) write(name, content string) error {
+	if err := os.MkdirAll(filepath.Dir(w.path(name)), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(w.path(name), []byte(content), 0o600)
+}
+
+// snapshot reads every file under root, keyed by slash-separated relative path
+func (w *migrationWorld) snapshot() (map[string]string, error) {
+	files := map[string]string{}
+	err := filepath.WalkDir(w.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(w.root, p)
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	return files, err
+}
+
+func (w *migrationWorld) backup() string {
+	if w.result == nil {
+		return ""
+	}
+	return w.result.Backup
+}
+
+func (w *migrationWorld) backupDoc() (map[string]any, error) {
+	if w.backup() == "" {
+		return nil, fmt.Errorf("no state backup was written")
+	}
+	data, err := os.ReadFile(filepath.Join(w.root, w.backup()))
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s is not JSON: %w", w.backup(), err)
+	}
+	return doc, nil
+}
+
+// managedAddresses lists type.name of every managed resource in a state
+// resources array, round-tripped through JSON so both sides compare alike
+func managedAddresses(resources any) []string {
+	data, _ := json.Marshal(resources)
+	var list []struct {
+		Mode string `json:"mode"`
+		Type string `json:"type"`
+		Name string `json:"name"`
+	}
+	_ = json.Unmarshal(data, &list)
+
+	var addrs []string
+	for _, r := range list {
+		if r.Mode == "managed" {
+			addrs = append(addrs, r.Type+"."+r.Name)
+		}
+	}
+	return addrs
+}
+
+// normalizeLines trims each line and drops blank ones, so hclwrite's alignment
+// and the doc string's indentation do not matter
+func normalizeLines(s string) string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
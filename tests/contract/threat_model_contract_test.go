@@ -0,0 +1,36 @@
+package contract
+
+import (
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/require"
+
+	"vibetics-cloudedge/tests/planfixture"
+	"vibetics-cloudedge/tests/threatmodel"
+)
+
+// TestThreatModelConsistency checks threat_modelling/threat-model.yaml
+// against the plans of every scenario, through the asset mapping and claims
+// in threat_modelling/plan-mapping.yaml. A module change that adds a resource
+// the model does not know, or contradicts something the model says, fails
+// here until the model is updated with it.
+func TestThreatModelConsistency(t *testing.T) {
+	t.Parallel()
+
+	model, err := threatmodel.LoadModel(threatmodel.DefaultModelPath())
+	require.NoError(t, err)
+	mapping, err := threatmodel.LoadMapping(threatmodel.DefaultMappingPath())
+	require.NoError(t, err)
+
+	var plans []*tfjson.Plan
+	for _, scenario := range planfixture.Scenarios() {
+		plans = append(plans, &planfixture.Plan(t, scenario.Name).RawPlan)
+	}
+	report, err := threatmodel.Check(model, mapping, plans)
+	require.NoError(t, err)
+
+	for _, issue := range report.Issues {
+		t.Errorf("threat model: %s", issue)
+	}
+}
@@ -0,0 +1,355 @@
+package fakecloudflare
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Zone is a DNS zone as the API returns it
+type Zone struct {
+	ID                  string      `json:"id"`
+	Name                string      `json:"name"`
+	Status              string      `json:"status"`
+	Paused              bool        `json:"paused"`
+	Type                string      `json:"type"`
+	DevelopmentMode     int         `json:"development_mode"`
+	NameServers         []string    `json:"name_servers"`
+	OriginalNameServers []string    `json:"original_name_servers"`
+	Account             zoneAccount `json:"account"`
+	Plan                zonePlan    `json:"plan"`
+	Permissions         []string    `json:"permissions"`
+	CreatedOn           time.Time   `json:"created_on"`
+	ModifiedOn          time.Time   `json:"modified_on"`
+}
+
+type zoneAccount struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type zonePlan struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Record is a DNS record as the API returns it. Name is always the fully
+// qualified name, whatever form it was created with.
+type Record struct {
+	ID         string                 `json:"id"`
+	ZoneID     string                 `json:"zone_id"`
+	ZoneName   string                 `json:"zone_name"`
+	Name       string                 `json:"name"`
+	Type       string                 `json:"type"`
+	Content    string                 `json:"content"`
+	Proxiable  bool                   `json:"proxiable"`
+	Proxied    *bool                  `json:"proxied"`
+	TTL        int                    `json:"ttl"`
+	Locked     bool                   `json:"locked"`
+	Priority   *uint16                `json:"priority,omitempty"`
+	Comment    string                 `json:"comment"`
+	Tags       []string               `json:"tags"`
+	Meta       map[string]interface{} `json:"meta"`
+	CreatedOn  time.Time              `json:"created_on"`
+	ModifiedOn time.Time              `json:"modified_on"`
+}
+
+// recordInput is the writable part of a record
+type recordInput struct {
+	Name     *string   `json:"name"`
+	Type     *string   `json:"type"`
+	Content  *string   `json:"content"`
+	Proxied  *bool     `json:"proxied"`
+	TTL      *int      `json:"ttl"`
+	Priority *uint16   `json:"priority"`
+	Comment  *string   `json:"comment"`
+	Tags     *[]string `json:"tags"`
+}
+
+func (s *Server) newZone(name string) *Zone {
+	now := time.Now().UTC()
+	return &Zone{
+		ID:                  newID(),
+		Name:                name,
+		Status:              "active",
+		Type:                "full",
+		NameServers:         []string{"ada.ns.cloudflare.com", "bob.ns.cloudflare.com"},
+		OriginalNameServers: []string{},
+		Account:             zoneAccount{ID: defaultAccountID, Name: "fake account"},
+		Plan:                zonePlan{ID: "0feeeeeeeeeeeeeeeeeeeeeeeeeeeeee", Name: "Free Website"},
+		Permissions:         []string{"#dns_records:edit", "#dns_records:read", "#zone:read"},
+		CreatedOn:           now,
+		ModifiedOn:          now,
+	}
+}
+
+// Zones returns a copy of the zones the server holds
+func (s *Server) Zones() []Zone {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Zone, len(s.zones))
+	for i, z := range s.zones {
+		out[i] = *z
+	}
+	return out
+}
+
+// ZoneID returns the ID of the named zone
+func (s *Server) ZoneID(name string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, z := range s.zones {
+		if z.Name == name {
+			return z.ID, true
+		}
+	}
+	return "", false
+}
+
+// Records returns a copy of the records in a zone, by zone name
+func (s *Server) Records(zoneName string) []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []Record
+	for _, z := range s.zones {
+		if z.Name != zoneName {
+			continue
+		}
+		for _, r := range s.records[z.ID] {
+			out = append(out, *r)
+		}
+	}
+	return out
+}
+
+func (s *Server) zone(id string) *Zone {
+	for _, z := range s.zones {
+		if z.ID == id {
+			return z
+		}
+	}
+	return nil
+}
+
+func (s *Server) listZones(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	s.mu.Lock()
+	var matched []Zone
+	for _, z := range s.zones {
+		if name := q.Get("name"); name != "" && z.Name != name {
+			continue
+		}
+		if status := q.Get("status"); status != "" && z.Status != status {
+			continue
+		}
+		if account := q.Get("account.id"); account != "" && z.Account.ID != account {
+			continue
+		}
+		matched = append(matched, *z)
+	}
+	s.mu.Unlock()
+
+	start, end, info := paginate(r, len(matched))
+	respond(w, http.StatusOK, nonNil(matched[start:end]), info)
+}
+
+func (s *Server) getZone(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	z := s.zone(r.PathValue("zone"))
+	if z == nil {
+		fail(w, http.StatusNotFound, errorCodeNotFound, "Invalid zone identifier")
+		return
+	}
+	respond(w, http.StatusOK, z, nil)
+}
+
+func (s *Server) listRecords(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	s.mu.Lock()
+	z := s.zone(r.PathValue("zone"))
+	if z == nil {
+		s.mu.Unlock()
+		fail(w, http.StatusNotFound, errorCodeNotFound, "Invalid zone identifier")
+		return
+	}
+	var matched []Record
+	for _, rec := range s.records[z.ID] {
+		if name := q.Get("name"); name != "" && rec.Name != qualify(name, z.Name) {
+			continue
+		}
+		if typ := q.Get("type"); typ != "" && rec.Type != typ {
+			continue
+		}
+		if content := q.Get("content"); content != "" && rec.Content != content {
+			continue
+		}
+		matched = append(matched, *rec)
+	}
+	s.mu.Unlock()
+
+	start, end, info := paginate(r, len(matched))
+	respond(w, http.StatusOK, nonNil(matched[start:end]), info)
+}
+
+func (s *Server) createRecord(w http.ResponseWriter, r *http.Request) {
+	var in recordInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		fail(w, http.StatusBadRequest, errorCodeInvalidInput, "Invalid request body: "+err.Error())
+		return
+	}
+	if in.Name == nil || in.Type == nil || in.Content == nil {
+		fail(w, http.StatusBadRequest, errorCodeInvalidInput, "DNS record requires name, type and content")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	z := s.zone(r.PathValue("zone"))
+	if z == nil {
+		fail(w, http.StatusNotFound, errorCodeNotFound, "Invalid zone identifier")
+		return
+	}
+	now := s.now().UTC()
+	rec := &Record{
+		ID:        newID(),
+		ZoneID:    z.ID,
+		ZoneName:  z.Name,
+		TTL:       1,
+		Tags:      []string{},
+		Meta:      map[string]interface{}{"auto_added": false, "source": "primary"},
+		CreatedOn: now,
+	}
+	rec.apply(in, z.Name, now)
+	for _, existing := range s.records[z.ID] {
+		if existing.Name == rec.Name && existing.Type == rec.Type && existing.Content == rec.Content {
+			fail(w, http.StatusBadRequest, 81057, "An identical record already exists.")
+			return
+		}
+	}
+	s.records[z.ID] = append(s.records[z.ID], rec)
+	respond(w, http.StatusOK, rec, nil)
+}
+
+func (s *Server) getRecord(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, _ := s.record(r)
+	if rec == nil {
+		fail(w, http.StatusNotFound, 81044, "Record does not exist.")
+		return
+	}
+	respond(w, http.StatusOK, rec, nil)
+}
+
+// updateRecord serves both PUT and PATCH; fields absent from the body keep
+// their value
+func (s *Server) updateRecord(w http.ResponseWriter, r *http.Request) {
+	var in recordInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		fail(w, http.StatusBadRequest, errorCodeInvalidInput, "Invalid request body: "+err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, _ := s.record(r)
+	if rec == nil {
+		fail(w, http.StatusNotFound, 81044, "Record does not exist.")
+		return
+	}
+	rec.apply(in, rec.ZoneName, s.now().UTC())
+	respond(w, http.StatusOK, rec, nil)
+}
+
+func (s *Server) deleteRecord(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, i := s.record(r)
+	if rec == nil {
+		fail(w, http.StatusNotFound, 81044, "Record does not exist.")
+		return
+	}
+	records := s.records[rec.ZoneID]
+	s.records[rec.ZoneID] = append(records[:i:i], records[i+1:]...)
+	respond(w, http.StatusOK, map[string]string{"id": rec.ID}, nil)
+}
+
+// record finds the record addressed by the request; the caller holds s.mu
+func (s *Server) record(r *http.Request) (*Record, int) {
+	for i, rec := range s.records[r.PathValue("zone")] {
+		if rec.ID == r.PathValue("id") {
+			return rec, i
+		}
+	}
+	return nil, -1
+}
+
+func (rec *Record) apply(in recordInput, zone string, now time.Time) {
+	if in.Name != nil {
+		rec.Name = qualify(*in.Name, zone)
+	}
+	if in.Type != nil {
+		rec.Type = *in.Type
+	}
+	if in.Content != nil {
+		rec.Content = *in.Content
+	}
+	if in.Proxied != nil {
+		proxied := *in.Proxied
+		rec.Proxied = &proxied
+	}
+	if in.TTL != nil {
+		rec.TTL = *in.TTL
+	}
+	if in.Priority != nil {
+		priority := *in.Priority
+		rec.Priority = &priority
+	}
+	if in.Comment != nil {
+		rec.Comment = *in.Comment
+	}
+	if in.Tags != nil {
+		rec.Tags = append([]string{}, *in.Tags...)
+	}
+
+	switch rec.Type {
+	case "A", "AAAA", "CNAME":
+		rec.Proxiable = true
+	default:
+		rec.Proxiable = false
+	}
+	if rec.Proxied == nil {
+		proxied := false
+		rec.Proxied = &proxied
+	}
+	if *rec.Proxied {
+		// proxied records always report automatic TTL
+		rec.TTL = 1
+	}
+	rec.ModifiedOn = now
+}
+
+// qualify expands a record name relative to the zone: "@" is the apex and a
+// name without the zone suffix is a label within it
+func qualify(name, zone string) string {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	switch {
+	case name == "@" || name == zone:
+		return zone
+	case strings.HasSuffix(name, "."+zone):
+		return name
+	default:
+		return fmt.Sprintf("%s.%s", name, zone)
+	}
+}
+
+// nonNil keeps empty results encoding as [] rather than null
+func nonNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
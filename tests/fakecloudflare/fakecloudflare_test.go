@@ -0,0 +1,192 @@
+package fakecloudflare
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// call sends one authenticated request and decodes the envelope's result
+func call(t *testing.T, s *Server, method, path string, body, result interface{}) response {
+	t.Helper()
+	var reader bytes.Buffer
+	if body != nil {
+		require.NoError(t, json.NewEncoder(&reader).Encode(body))
+	}
+	req, err := http.NewRequest(method, s.BaseURL()+path, &reader)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+s.APIToken())
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.Client().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var envelope struct {
+		response
+		Result json.RawMessage `json:"result"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&envelope))
+	if result != nil && envelope.Success {
+		require.NoError(t, json.Unmarshal(envelope.Result, result))
+	}
+	return envelope.response
+}
+
+func newServer(t *testing.T, opts ...Option) *Server {
+	t.Helper()
+	s, err := NewServer(opts...)
+	require.NoError(t, err)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestZoneLookup(t *testing.T) {
+	t.Parallel()
+	s := newServer(t, WithZones("vibetics.com", "example.org"))
+
+	var zones []Zone
+	resp := call(t, s, http.MethodGet, "/zones?name=vibetics.com", nil, &zones)
+	require.True(t, resp.Success)
+	require.Len(t, zones, 1)
+	assert.Equal(t, "vibetics.com", zones[0].Name)
+	assert.Equal(t, "active", zones[0].Status)
+	assert.Equal(t, 1, resp.ResultInfo.TotalPages)
+
+	id, ok := s.ZoneID("example.org")
+	require.True(t, ok)
+	var zone Zone
+	require.True(t, call(t, s, http.MethodGet, "/zones/"+id, nil, &zone).Success)
+	assert.Equal(t, "example.org", zone.Name)
+
+	assert.False(t, call(t, s, http.MethodGet, "/zones/missing", nil, nil).Success)
+}
+
+func TestDNSRecordLifecycle(t *testing.T) {
+	t.Parallel()
+	s := newServer(t)
+	zoneID, _ := s.ZoneID(DefaultZoneName)
+	records := "/zones/" + zoneID + "/dns_records"
+
+	var created Record
+	resp := call(t, s, http.MethodPost, records, map[string]interface{}{
+		"name": "demo-web-app", "type": "A", "content": "203.0.113.10", "ttl": 120, "proxied": true,
+	}, &created)
+	require.True(t, resp.Success, "%v", resp.Errors)
+	assert.Equal(t, "demo-web-app.vibetics.com", created.Name)
+	assert.Equal(t, 1, created.TTL, "proxied records report automatic TTL")
+	assert.True(t, created.Proxiable)
+
+	assert.False(t, call(t, s, http.MethodPost, records, map[string]interface{}{
+		"name": "demo-web-app.vibetics.com", "type": "A", "content": "203.0.113.10",
+	}, nil).Success, "identical record should be rejected")
+
+	var listed []Record
+	require.True(t, call(t, s, http.MethodGet, records+"?"+url.Values{"name": {"demo-web-app.vibetics.com"}, "type": {"A"}}.Encode(), nil, &listed).Success)
+	require.Len(t, listed, 1)
+	assert.Equal(t, created.ID, listed[0].ID)
+
+	var updated Record
+	require.True(t, call(t, s, http.MethodPatch, records+"/"+created.ID, map[string]interface{}{
+		"content": "203.0.113.20", "proxied": false, "ttl": 300,
+	}, &updated).Success)
+	assert.Equal(t, "203.0.113.20", updated.Content)
+	assert.Equal(t, 300, updated.TTL)
+	assert.Equal(t, "demo-web-app.vibetics.com", updated.Name)
+
+	require.True(t, call(t, s, http.MethodDelete, records+"/"+created.ID, nil, nil).Success)
+	assert.False(t, call(t, s, http.MethodGet, records+"/"+created.ID, nil, nil).Success)
+	assert.Empty(t, s.Records(DefaultZoneName))
+}
+
+func TestOriginCACertificate(t *testing.T) {
+	t.Parallel()
+	s := newServer(t)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "demo-web-app.vibetics.com", Organization: []string{"Vibetics"}},
+		DNSNames: []string{"demo-web-app.vibetics.com"},
+	}, key)
+	require.NoError(t, err)
+	csr := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER}))
+
+	var issued Certificate
+	resp := call(t, s, http.MethodPost, "/certificates", map[string]interface{}{
+		"csr": csr, "hostnames": []string{"demo-web-app.vibetics.com"}, "request_type": "origin-rsa", "requested_validity": 5475,
+	}, &issued)
+	require.True(t, resp.Success, "%v", resp.Errors)
+
+	block, _ := pem.Decode([]byte(issued.Certificate))
+	require.NotNil(t, block)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+	_, err = cert.Verify(x509.VerifyOptions{DNSName: "demo-web-app.vibetics.com", Roots: s.OriginCAPool()})
+	require.NoError(t, err, "issued certificate should chain to the local Origin CA")
+	assert.Equal(t, key.Public(), cert.PublicKey)
+
+	zoneID, _ := s.ZoneID(DefaultZoneName)
+	var listed []Certificate
+	require.True(t, call(t, s, http.MethodGet, "/certificates?zone_id="+zoneID, nil, &listed).Success)
+	require.Len(t, listed, 1)
+
+	require.True(t, call(t, s, http.MethodDelete, "/certificates/"+issued.ID, nil, nil).Success)
+	require.True(t, call(t, s, http.MethodGet, "/certificates?zone_id="+zoneID, nil, &listed).Success)
+	assert.Empty(t, listed)
+
+	assert.False(t, call(t, s, http.MethodPost, "/certificates", map[string]interface{}{
+		"csr": csr, "hostnames": []string{"demo-web-app.vibetics.com"}, "request_type": "origin-rsa", "requested_validity": 10,
+	}, nil).Success, "unsupported validity should be rejected")
+}
+
+func TestAuthentication(t *testing.T) {
+	t.Parallel()
+	s := newServer(t, WithAPIToken("secret"))
+
+	resp, err := s.Client().Get(s.BaseURL() + "/zones")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	req, err := http.NewRequest(http.MethodGet, s.BaseURL()+"/certificates", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Auth-User-Service-Key", s.OriginCAKey())
+	resp, err = s.Client().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "Origin CA routes accept the service key")
+}
+
+func TestProviderEnv(t *testing.T) {
+	t.Parallel()
+	s := newServer(t)
+
+	env, err := s.ProviderEnv(t.TempDir())
+	require.NoError(t, err)
+	assert.Equal(t, s.Host(), env["CLOUDFLARE_API_HOSTNAME"])
+	assert.Equal(t, s.APIToken(), env["CLOUDFLARE_API_TOKEN"])
+
+	bundle, err := os.ReadFile(env["SSL_CERT_FILE"])
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	require.True(t, pool.AppendCertsFromPEM(bundle))
+	_, err = s.Certificate().Verify(x509.VerifyOptions{Roots: pool})
+	assert.NoError(t, err, "bundle should trust the server's TLS certificate")
+	assert.Equal(t, "fake-cloudflare-ca.pem", filepath.Base(env["SSL_CERT_FILE"]))
+
+	zoneID, _ := s.ZoneID(DefaultZoneName)
+	assert.Equal(t, zoneID, s.Vars()["cloudflare_zone_id"])
+}
@@ -0,0 +1,244 @@
+package fakecloudflare
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Certificate is an Origin CA certificate as the API returns it
+type Certificate struct {
+	ID                string     `json:"id"`
+	Certificate       string     `json:"certificate"`
+	Hostnames         []string   `json:"hostnames"`
+	ExpiresOn         time.Time  `json:"expires_on"`
+	RequestType       string     `json:"request_type"`
+	RequestedValidity int        `json:"requested_validity"`
+	CSR               string     `json:"csr"`
+	RevokedAt         *time.Time `json:"revoked_at,omitempty"`
+}
+
+// certificateRequest is the body of POST /certificates
+type certificateRequest struct {
+	CSR               string   `json:"csr"`
+	Hostnames         []string `json:"hostnames"`
+	RequestType       string   `json:"request_type"`
+	RequestedValidity int      `json:"requested_validity"`
+}
+
+// validities are the requested_validity values, in days, the API allows
+var validities = map[int]bool{7: true, 30: true, 90: true, 365: true, 730: true, 1095: true, 5475: true}
+
+// authority is the local CA standing in for the Cloudflare Origin CA
+type authority struct {
+	key     *ecdsa.PrivateKey
+	cert    *x509.Certificate
+	certPEM []byte
+}
+
+func newAuthority() (*authority, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			Organization:       []string{"CloudFlare, Inc."},
+			OrganizationalUnit: []string{"CloudFlare Origin SSL Certificate Authority"},
+			CommonName:         "Fake CloudFlare Origin Certificate Authority",
+		},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(20, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &authority{
+		key:     key,
+		cert:    cert,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}, nil
+}
+
+// sign issues a certificate for the CSR's key, valid for the hostnames
+func (a *authority) sign(csrPEM string, hostnames []string, days int, now time.Time) (string, time.Time, error) {
+	block, _ := pem.Decode([]byte(csrPEM))
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return "", time.Time{}, errors.New("csr is not a PEM encoded certificate request")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("parsing csr: %w", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return "", time.Time{}, fmt.Errorf("csr signature: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	notAfter := now.AddDate(0, 0, days)
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization:       []string{"CloudFlare, Inc."},
+			OrganizationalUnit: []string{"CloudFlare Origin CA"},
+			CommonName:         "CloudFlare Origin Certificate",
+		},
+		DNSNames:    hostnames,
+		NotBefore:   now.Add(-time.Minute),
+		NotAfter:    notAfter,
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, a.cert, csr.PublicKey, a.key)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})), notAfter.UTC(), nil
+}
+
+// OriginCAPEM is the PEM certificate of the CA that signs Origin CA
+// certificates
+func (s *Server) OriginCAPEM() []byte { return s.ca.certPEM }
+
+// OriginCAPool returns a pool holding only the Origin CA, for verifying
+// issued certificates
+func (s *Server) OriginCAPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(s.ca.cert)
+	return pool
+}
+
+// Certificates returns a copy of the issued certificates, revoked ones included
+func (s *Server) Certificates() []Certificate {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Certificate, len(s.certs))
+	for i, c := range s.certs {
+		out[i] = *c
+	}
+	return out
+}
+
+func (s *Server) createCertificate(w http.ResponseWriter, r *http.Request) {
+	var in certificateRequest
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		fail(w, http.StatusBadRequest, errorCodeInvalidInput, "Invalid request body: "+err.Error())
+		return
+	}
+	if len(in.Hostnames) == 0 {
+		fail(w, http.StatusBadRequest, 1010, "hostnames must not be empty")
+		return
+	}
+	switch in.RequestType {
+	case "origin-rsa", "origin-ecc":
+	default:
+		fail(w, http.StatusBadRequest, 1011, fmt.Sprintf("request_type %q must be origin-rsa or origin-ecc", in.RequestType))
+		return
+	}
+	if in.RequestedValidity == 0 {
+		in.RequestedValidity = 5475
+	}
+	if !validities[in.RequestedValidity] {
+		fail(w, http.StatusBadRequest, 1012, fmt.Sprintf("requested_validity %d is not an allowed number of days", in.RequestedValidity))
+		return
+	}
+
+	now := s.now().UTC()
+	certPEM, expires, err := s.ca.sign(in.CSR, in.Hostnames, in.RequestedValidity, now)
+	if err != nil {
+		fail(w, http.StatusBadRequest, 1100, err.Error())
+		return
+	}
+	cert := &Certificate{
+		ID:                newID(),
+		Certificate:       certPEM,
+		Hostnames:         append([]string{}, in.Hostnames...),
+		ExpiresOn:         expires,
+		RequestType:       in.RequestType,
+		RequestedValidity: in.RequestedValidity,
+		CSR:               in.CSR,
+	}
+
+	s.mu.Lock()
+	s.certs = append(s.certs, cert)
+	s.mu.Unlock()
+	respond(w, http.StatusOK, cert, nil)
+}
+
+func (s *Server) listCertificates(w http.ResponseWriter, r *http.Request) {
+	zoneID := r.URL.Query().Get("zone_id")
+	s.mu.Lock()
+	zone := s.zone(zoneID)
+	var matched []Certificate
+	for _, c := range s.certs {
+		if c.RevokedAt != nil {
+			continue
+		}
+		if zoneID != "" && (zone == nil || !coversZone(c.Hostnames, zone.Name)) {
+			continue
+		}
+		matched = append(matched, *c)
+	}
+	s.mu.Unlock()
+
+	start, end, info := paginate(r, len(matched))
+	respond(w, http.StatusOK, nonNil(matched[start:end]), info)
+}
+
+func (s *Server) getCertificate(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.certs {
+		if c.ID == r.PathValue("id") {
+			respond(w, http.StatusOK, c, nil)
+			return
+		}
+	}
+	fail(w, http.StatusNotFound, 1003, "Certificate not found")
+}
+
+func (s *Server) revokeCertificate(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.certs {
+		if c.ID == r.PathValue("id") && c.RevokedAt == nil {
+			revoked := s.now().UTC()
+			c.RevokedAt = &revoked
+			respond(w, http.StatusOK, map[string]string{"id": c.ID}, nil)
+			return
+		}
+	}
+	fail(w, http.StatusNotFound, 1003, "Certificate not found")
+}
+
+// coversZone reports whether any hostname is the zone or inside it
+func coversZone(hostnames []string, zone string) bool {
+	for _, h := range hostnames {
+		if h == zone || strings.HasSuffix(h, "."+zone) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package fakecloudflare
+
+import (
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// systemBundles are where Go looks for the system roots on Linux; the first
+// one found is copied into the provider's CA bundle
+var systemBundles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",
+	"/etc/pki/tls/certs/ca-bundle.crt",
+	"/etc/ssl/ca-bundle.pem",
+	"/etc/pki/tls/cacert.pem",
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem",
+	"/etc/ssl/cert.pem",
+}
+
+// ProviderEnv returns the environment that points the cloudflare provider
+// (v4) at the server: the API hostname, the credentials, and SSL_CERT_FILE set
+// to a bundle in dir holding the system roots plus the server's TLS
+// certificate, so the provider trusts the fake while still reaching Google.
+// Pass it as terraform.Options.EnvVars.
+func (s *Server) ProviderEnv(dir string) (map[string]string, error) {
+	bundle, err := s.WriteCABundle(filepath.Join(dir, "fake-cloudflare-ca.pem"))
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		"CLOUDFLARE_API_HOSTNAME":         s.Host(),
+		"CLOUDFLARE_API_BASE_PATH":        BasePath,
+		"CLOUDFLARE_API_TOKEN":            s.apiToken,
+		"CLOUDFLARE_API_USER_SERVICE_KEY": s.originCAKey,
+		"SSL_CERT_FILE":                   bundle,
+	}, nil
+}
+
+// Vars returns the core module variables that carry the server's credentials
+// and zone
+func (s *Server) Vars() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	vars := map[string]interface{}{
+		"cloudflare_api_token":     s.apiToken,
+		"cloudflare_origin_ca_key": s.originCAKey,
+	}
+	if len(s.zones) > 0 {
+		vars["cloudflare_zone_id"] = s.zones[0].ID
+	}
+	return vars
+}
+
+// WriteCABundle writes the system roots (when found) followed by the server's
+// TLS certificate to path and returns path
+func (s *Server) WriteCABundle(path string) (string, error) {
+	var bundle []byte
+	for _, candidate := range systemBundles {
+		if data, err := os.ReadFile(candidate); err == nil {
+			bundle = append(data, '\n')
+			break
+		}
+	}
+	bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw})...)
+	if err := os.WriteFile(path, bundle, 0o644); err != nil {
+		return "", fmt.Errorf("writing CA bundle: %w", err)
+	}
+	return path, nil
+}
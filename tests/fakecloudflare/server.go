@@ -0,0 +1,228 @@
+// Package fakecloudflare is an in-process stand-in for the parts of the
+// Cloudflare v4 API the core module uses: zone lookup, DNS record CRUD and
+// Origin CA certificate issuance. Certificates are signed by a CA generated
+// per server, so a test can verify the chain without a Cloudflare account.
+//
+// The server speaks HTTPS like the real API. ProviderEnv returns the
+// environment that points the cloudflare provider at it.
+package fakecloudflare
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BasePath is the path prefix of every API route, as on api.cloudflare.com
+const BasePath = "/client/v4"
+
+// Default credentials accepted by a server created without options
+const (
+	DefaultAPIToken       = "fake-cloudflare-api-token"
+	DefaultOriginCAKey    = "v1.0-fake-origin-ca-key"
+	DefaultZoneName       = "vibetics.com"
+	defaultAccountID      = "0123456789abcdef0123456789abcdef"
+	defaultPerPage        = 20
+	maxPerPage            = 5000
+	errorCodeAuth         = 10000
+	errorCodeNotFound     = 7003
+	errorCodeInvalidInput = 1004
+)
+
+// Server is a running fake Cloudflare API. All methods are safe for
+// concurrent use.
+type Server struct {
+	*httptest.Server
+
+	apiToken    string
+	originCAKey string
+	ca          *authority
+
+	mu      sync.Mutex
+	zones   []*Zone
+	records map[string][]*Record // by zone ID
+	certs   []*Certificate
+	now     func() time.Time
+}
+
+// Option configures a Server
+type Option func(*Server)
+
+// WithAPIToken sets the bearer token the server accepts
+func WithAPIToken(token string) Option {
+	return func(s *Server) { s.apiToken = token }
+}
+
+// WithOriginCAKey sets the X-Auth-User-Service-Key accepted by the Origin CA
+// routes
+func WithOriginCAKey(key string) Option {
+	return func(s *Server) { s.originCAKey = key }
+}
+
+// WithZones creates an active zone for each name instead of DefaultZoneName
+func WithZones(names ...string) Option {
+	return func(s *Server) {
+		s.zones = nil
+		for _, name := range names {
+			s.zones = append(s.zones, s.newZone(name))
+		}
+	}
+}
+
+// NewServer starts a fake API over TLS with one zone, DefaultZoneName, unless
+// WithZones says otherwise. Close it when done.
+func NewServer(opts ...Option) (*Server, error) {
+	ca, err := newAuthority()
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		apiToken:    DefaultAPIToken,
+		originCAKey: DefaultOriginCAKey,
+		ca:          ca,
+		records:     map[string][]*Record{},
+		now:         time.Now,
+	}
+	s.zones = []*Zone{s.newZone(DefaultZoneName)}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+BasePath+"/zones", s.token(s.listZones))
+	mux.HandleFunc("GET "+BasePath+"/zones/{zone}", s.token(s.getZone))
+	mux.HandleFunc("GET "+BasePath+"/zones/{zone}/dns_records", s.token(s.listRecords))
+	mux.HandleFunc("POST "+BasePath+"/zones/{zone}/dns_records", s.token(s.createRecord))
+	mux.HandleFunc("GET "+BasePath+"/zones/{zone}/dns_records/{id}", s.token(s.getRecord))
+	mux.HandleFunc("PUT "+BasePath+"/zones/{zone}/dns_records/{id}", s.token(s.updateRecord))
+	mux.HandleFunc("PATCH "+BasePath+"/zones/{zone}/dns_records/{id}", s.token(s.updateRecord))
+	mux.HandleFunc("DELETE "+BasePath+"/zones/{zone}/dns_records/{id}", s.token(s.deleteRecord))
+	mux.HandleFunc("GET "+BasePath+"/certificates", s.serviceKey(s.listCertificates))
+	mux.HandleFunc("POST "+BasePath+"/certificates", s.serviceKey(s.createCertificate))
+	mux.HandleFunc("GET "+BasePath+"/certificates/{id}", s.serviceKey(s.getCertificate))
+	mux.HandleFunc("DELETE "+BasePath+"/certificates/{id}", s.serviceKey(s.revokeCertificate))
+	mux.HandleFunc("GET "+BasePath+"/user/tokens/verify", s.token(s.verifyToken))
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fail(w, http.StatusNotFound, errorCodeNotFound, fmt.Sprintf("%s %s is not implemented by the fake", r.Method, r.URL.Path))
+	})
+
+	s.Server = httptest.NewTLSServer(mux)
+	return s, nil
+}
+
+// APIToken is the bearer token the server accepts
+func (s *Server) APIToken() string { return s.apiToken }
+
+// OriginCAKey is the service key the Origin CA routes accept
+func (s *Server) OriginCAKey() string { return s.originCAKey }
+
+// BaseURL is the API root, e.g. https://127.0.0.1:41234/client/v4
+func (s *Server) BaseURL() string { return s.URL + BasePath }
+
+// Host is the host:port the provider's api_hostname should be set to
+func (s *Server) Host() string { return strings.TrimPrefix(s.URL, "https://") }
+
+// token guards a route with the API token, sent as a bearer token
+func (s *Server) token(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+s.apiToken {
+			fail(w, http.StatusForbidden, errorCodeAuth, "Authentication error")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// serviceKey guards an Origin CA route, which accepts the Origin CA key or
+// the API token
+func (s *Server) serviceKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Auth-User-Service-Key") != s.originCAKey &&
+			r.Header.Get("Authorization") != "Bearer "+s.apiToken {
+			fail(w, http.StatusForbidden, errorCodeAuth, "Authentication error")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) verifyToken(w http.ResponseWriter, _ *http.Request) {
+	respond(w, http.StatusOK, map[string]string{"id": newID(), "status": "active"}, nil)
+}
+
+// response is the envelope around every API result
+type response struct {
+	Success    bool          `json:"success"`
+	Errors     []apiError    `json:"errors"`
+	Messages   []interface{} `json:"messages"`
+	Result     interface{}   `json:"result"`
+	ResultInfo *resultInfo   `json:"result_info,omitempty"`
+}
+
+type apiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type resultInfo struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	Count      int `json:"count"`
+	TotalCount int `json:"total_count"`
+	TotalPages int `json:"total_pages"`
+}
+
+func respond(w http.ResponseWriter, status int, result interface{}, info *resultInfo) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(response{
+		Success:    true,
+		Errors:     []apiError{},
+		Messages:   []interface{}{},
+		Result:     result,
+		ResultInfo: info,
+	})
+}
+
+func fail(w http.ResponseWriter, status, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(response{
+		Errors:   []apiError{{Code: code, Message: message}},
+		Messages: []interface{}{},
+	})
+}
+
+// paginate slices n items by the page and per_page query parameters
+func paginate(r *http.Request, n int) (start, end int, info *resultInfo) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if perPage < 1 {
+		perPage = defaultPerPage
+	}
+	if perPage > maxPerPage {
+		perPage = maxPerPage
+	}
+
+	start = min((page-1)*perPage, n)
+	end = min(start+perPage, n)
+	pages := (n + perPage - 1) / perPage
+	return start, end, &resultInfo{Page: page, PerPage: perPage, Count: end - start, TotalCount: n, TotalPages: pages}
+}
+
+// newID returns a 32 hex digit identifier like Cloudflare's
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,183 @@
+package fakecompute
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+)
+
+func newService(t *testing.T, states ...string) (*Server, *compute.Service) {
+	t.Helper()
+	s := NewServer()
+	t.Cleanup(s.Close)
+	for _, state := range states {
+		require.NoError(t, s.LoadStateFile("testdata/"+state))
+	}
+	svc, err := s.Service(context.Background())
+	require.NoError(t, err)
+	return s, svc
+}
+
+func apiCode(err error) int {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	return 0
+}
+
+func TestLoadState(t *testing.T) {
+	t.Parallel()
+	_, svc := newService(t, "core.tfstate", "demo-web-app.tfstate")
+	ctx := context.Background()
+
+	fw, err := svc.Firewalls.Get("test-project", "nonprod-allow-https").Context(ctx).Do()
+	require.NoError(t, err)
+	assert.Equal(t, "compute#firewall", fw.Kind)
+	assert.Equal(t, "INGRESS", fw.Direction)
+	assert.EqualValues(t, 1000, fw.Priority)
+	require.Len(t, fw.Allowed, 1)
+	assert.Equal(t, "tcp", fw.Allowed[0].IPProtocol)
+	assert.Equal(t, []string{"443"}, fw.Allowed[0].Ports)
+	assert.Len(t, fw.SourceRanges, 15)
+	assert.Equal(t, SelfLinkBase+"projects/test-project/global/networks/ingress-vpc", fw.Network)
+	assert.Equal(t, SelfLinkBase+"projects/test-project/global/firewalls/nonprod-allow-https", fw.SelfLink)
+	assert.NotZero(t, fw.Id)
+
+	neg, err := svc.RegionNetworkEndpointGroups.Get("test-project", "us-central1", "demo-web-app-psc-neg").Context(ctx).Do()
+	require.NoError(t, err)
+	assert.Equal(t, "PRIVATE_SERVICE_CONNECT", neg.NetworkEndpointType)
+	assert.Equal(t, SelfLinkBase+"projects/test-demo-project/regions/us-central1/serviceAttachments/demo-web-app-psc-attachment", neg.PscTargetService)
+	assert.Equal(t, SelfLinkBase+"projects/test-project/regions/us-central1", neg.Region)
+
+	// a regional NEG is not found through the zonal collection
+	_, err = svc.NetworkEndpointGroups.Get("test-project", "us-central1", "demo-web-app-psc-neg").Context(ctx).Do()
+	assert.Equal(t, http.StatusNotFound, apiCode(err))
+	assert.ErrorContains(t, err, "was not found")
+
+	attachment, err := svc.ServiceAttachments.Get("test-demo-project", "us-central1", "demo-web-app-psc-attachment").Context(ctx).Do()
+	require.NoError(t, err)
+	assert.Equal(t, "ACCEPT_AUTOMATIC", attachment.ConnectionPreference)
+	require.Len(t, attachment.ConnectedEndpoints, 1)
+	assert.EqualValues(t, 81582223454945284, attachment.ConnectedEndpoints[0].PscConnectionId)
+
+	backend, err := svc.RegionBackendServices.Get("test-project", "us-central1", "demo-web-app-external-backend").Context(ctx).Do()
+	require.NoError(t, err)
+	assert.Equal(t, "EXTERNAL_MANAGED", backend.LoadBalancingScheme)
+	assert.Contains(t, backend.SecurityPolicy, "/securityPolicies/edge-waf-policy")
+	require.Len(t, backend.Backends, 1)
+	assert.Contains(t, backend.Backends[0].Group, "/networkEndpointGroups/demo-web-app-psc-neg")
+
+	policy, err := svc.RegionSecurityPolicies.Get("test-project", "us-central1", "edge-waf-policy").Context(ctx).Do()
+	require.NoError(t, err)
+	require.Len(t, policy.Rules, 3)
+	assert.Equal(t, "evaluatePreconfiguredExpr('sqli-v33-stable')", policy.Rules[0].Match.Expr.Expression)
+	assert.Equal(t, []string{"*"}, policy.Rules[2].Match.Config.SrcIpRanges)
+
+	subnet, err := svc.Subnetworks.Get("test-project", "us-central1", "ingress-subnet").Context(ctx).Do()
+	require.NoError(t, err)
+	assert.True(t, subnet.PrivateIpGoogleAccess)
+	require.NotNil(t, subnet.LogConfig)
+	assert.True(t, subnet.LogConfig.Enable)
+
+	rule, err := svc.ForwardingRules.Get("test-project", "us-central1", "external-https-lb").Context(ctx).Do()
+	require.NoError(t, err)
+	assert.Equal(t, "34.0.225.17", rule.IPAddress)
+	assert.Equal(t, "opentofu", rule.Labels["managed-by"])
+
+	urlMap, err := svc.RegionUrlMaps.Get("test-project", "us-central1", "external-https-lb").Context(ctx).Do()
+	require.NoError(t, err)
+	assert.Contains(t, urlMap.DefaultService, "/backendServices/demo-web-app-external-backend")
+
+	network, err := svc.Networks.Get("test-project", "ingress-vpc").Context(ctx).Do()
+	require.NoError(t, err)
+	assert.False(t, network.AutoCreateSubnetworks)
+}
+
+func TestListFilter(t *testing.T) {
+	t.Parallel()
+	_, svc := newService(t, "core.tfstate", "demo-web-app.tfstate")
+	ctx := context.Background()
+
+	subnets, err := svc.Subnetworks.List("test-demo-project", "us-central1").Filter(`purpose = "PRIVATE_SERVICE_CONNECT"`).Context(ctx).Do()
+	require.NoError(t, err)
+	require.Len(t, subnets.Items, 1)
+	assert.Equal(t, "demo-web-app-psc-nat-subnet", subnets.Items[0].Name)
+
+	var names []string
+	err = svc.Subnetworks.List("test-demo-project", "us-central1").Filter("name eq demo-web-app-.*-subnet").MaxResults(1).
+		Pages(ctx, func(page *compute.SubnetworkList) error {
+			for _, item := range page.Items {
+				names = append(names, item.Name)
+			}
+			return nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"demo-web-app-proxy-only-subnet", "demo-web-app-psc-nat-subnet", "demo-web-app-web-subnet"}, names)
+
+	rules, err := svc.ForwardingRules.AggregatedList("test-project").
+		Filter(`(labels.managed-by = "opentofu") AND (labels.project-suffix = "nonprod")`).Context(ctx).Do()
+	require.NoError(t, err)
+	require.Contains(t, rules.Items, "regions/us-central1")
+	require.Len(t, rules.Items["regions/us-central1"].ForwardingRules, 1)
+	assert.Equal(t, "external-https-lb", rules.Items["regions/us-central1"].ForwardingRules[0].Name)
+}
+
+func TestInsertAndDelete(t *testing.T) {
+	t.Parallel()
+	s, svc := newService(t, "core.tfstate")
+	ctx := context.Background()
+
+	op, err := svc.Firewalls.Insert("test-project", &compute.Firewall{
+		Name:         "deny-ssh",
+		Network:      "projects/test-project/global/networks/ingress-vpc",
+		Direction:    "INGRESS",
+		Denied:       []*compute.FirewallDenied{{IPProtocol: "tcp", Ports: []string{"22"}}},
+		SourceRanges: []string{"0.0.0.0/0"},
+	}).Context(ctx).Do()
+	require.NoError(t, err)
+	assert.Equal(t, "DONE", op.Status)
+	waited, err := svc.GlobalOperations.Wait("test-project", op.Name).Context(ctx).Do()
+	require.NoError(t, err)
+	assert.Equal(t, op.TargetLink, waited.TargetLink)
+
+	_, err = svc.Firewalls.Insert("test-project", &compute.Firewall{Name: "deny-ssh"}).Context(ctx).Do()
+	assert.Equal(t, http.StatusConflict, apiCode(err))
+
+	// the network is still used by firewalls, subnetworks and the NEG
+	_, err = svc.Networks.Delete("test-project", "ingress-vpc").Context(ctx).Do()
+	assert.Equal(t, http.StatusBadRequest, apiCode(err))
+	assert.ErrorContains(t, err, "already being used by")
+
+	_, err = svc.Firewalls.Delete("test-project", "deny-ssh").Context(ctx).Do()
+	require.NoError(t, err)
+	_, err = svc.Firewalls.Get("test-project", "deny-ssh").Context(ctx).Do()
+	assert.Equal(t, http.StatusNotFound, apiCode(err))
+
+	// deleting in dependency order empties the project
+	for _, p := range []string{
+		"projects/test-project/regions/us-central1/forwardingRules/external-https-lb",
+		"projects/test-project/regions/us-central1/addresses/nonprod-external-lb-ip",
+		"projects/test-project/regions/us-central1/targetHttpsProxies/external-https-lb-proxy",
+		"projects/test-project/regions/us-central1/sslCertificates/cloudflare-origin-cert-demo-web-app",
+		"projects/test-project/regions/us-central1/urlMaps/external-https-lb",
+		"projects/test-project/regions/us-central1/backendServices/demo-web-app-external-backend",
+		"projects/test-project/regions/us-central1/securityPolicies/edge-waf-policy",
+		"projects/test-project/regions/us-central1/networkEndpointGroups/demo-web-app-psc-neg",
+		"projects/test-project/regions/us-central1/subnetworks/ingress-subnet",
+		"projects/test-project/regions/us-central1/subnetworks/external-https-lb-proxy-only-subnet",
+		"projects/test-project/global/firewalls/nonprod-allow-https",
+		"projects/test-project/global/networks/ingress-vpc",
+	} {
+		path, err := ParsePath(p)
+		require.NoError(t, err)
+		require.NoError(t, s.Delete(path), p)
+	}
+	assert.Empty(t, s.Paths())
+}
@@ -0,0 +1,83 @@
+package fakecompute
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// filterTerm is one comparison of a list filter
+var filterTerm = regexp.MustCompile(`^\(?\s*([A-Za-z0-9_.\-]+)\s*(=|!=|:|\beq\b|\bne\b)\s*(.+?)\s*\)?$`)
+
+// parseFilter supports the list filter forms the tests use: comparisons
+// joined by AND, each `field = "value"`, `field != value`, `field:value`
+// (has), or `field eq regexp` / `field ne regexp`. Nested fields such as
+// labels.managed-by use dots.
+func parseFilter(filter string) (func(Resource) bool, error) {
+	filter = strings.TrimSpace(filter)
+	if filter == "" {
+		return func(Resource) bool { return true }, nil
+	}
+
+	var terms []func(Resource) bool
+	for _, raw := range regexp.MustCompile(`\s+AND\s+|\)\s+\(`).Split(filter, -1) {
+		m := filterTerm.FindStringSubmatch(strings.TrimSpace(raw))
+		if m == nil {
+			return nil, fmt.Errorf("Invalid list filter expression %q", raw)
+		}
+		field, op, value := m[1], m[2], strings.Trim(m[3], `"'`)
+		switch op {
+		case "eq", "ne":
+			re, err := regexp.Compile("^(?:" + value + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("Invalid regular expression %q in list filter", value)
+			}
+			negate := op == "ne"
+			terms = append(terms, func(r Resource) bool {
+				v, ok := fieldValue(r, field)
+				return ok && re.MatchString(v) != negate
+			})
+		case "=", "!=":
+			negate := op == "!="
+			terms = append(terms, func(r Resource) bool {
+				v, ok := fieldValue(r, field)
+				return (ok && v == value) != negate
+			})
+		case ":":
+			terms = append(terms, func(r Resource) bool {
+				v, ok := fieldValue(r, field)
+				return ok && (value == "*" || strings.Contains(v, value))
+			})
+		}
+	}
+	return func(r Resource) bool {
+		for _, term := range terms {
+			if !term(r) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// fieldValue renders a dotted field of r as a string
+func fieldValue(r Resource, field string) (string, bool) {
+	var v interface{} = map[string]interface{}(r)
+	for _, key := range strings.Split(field, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if v, ok = m[key]; !ok {
+			return "", false
+		}
+	}
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case nil:
+		return "", false
+	default:
+		return fmt.Sprint(v), true
+	}
+}
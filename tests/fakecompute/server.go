@@ -0,0 +1,337 @@
+package fakecompute
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/option"
+)
+
+// Server is a running fake Compute Engine API serving a Store. Inserts and
+// deletes complete immediately and return operations that are already DONE.
+type Server struct {
+	*httptest.Server
+	*Store
+
+	opMu       sync.Mutex
+	operations map[string]map[string]interface{}
+}
+
+// NewServer starts a fake over plain HTTP serving an empty store. Close it
+// when done.
+func NewServer() *Server {
+	s := &Server{Store: NewStore(), operations: map[string]map[string]interface{}{}}
+
+	mux := http.NewServeMux()
+	for _, scope := range []string{"global", "regions/{region}", "zones/{zone}"} {
+		base := "/compute/v1/projects/{project}/" + scope
+		mux.HandleFunc("GET "+base+"/{collection}", s.list)
+		mux.HandleFunc("POST "+base+"/{collection}", s.insert)
+		mux.HandleFunc("GET "+base+"/{collection}/{name}", s.get)
+		mux.HandleFunc("DELETE "+base+"/{collection}/{name}", s.delete)
+		mux.HandleFunc("POST "+base+"/operations/{name}/wait", s.get)
+	}
+	mux.HandleFunc("GET /compute/v1/projects/{project}/aggregated/{collection}", s.aggregated)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fail(w, http.StatusNotImplemented, "notImplemented", fmt.Sprintf("%s %s is not implemented by the fake", r.Method, r.URL.Path))
+	})
+
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Endpoint is the API root, the value for option.WithEndpoint
+func (s *Server) Endpoint() string { return s.URL + "/compute/v1/" }
+
+// Service returns a client for the fake that sends no credentials
+func (s *Server) Service(ctx context.Context) (*compute.Service, error) {
+	return compute.NewService(ctx, option.WithEndpoint(s.Endpoint()), option.WithoutAuthentication())
+}
+
+// requestPath reads the resource path from the route's wildcards
+func requestPath(r *http.Request) Path {
+	p := Path{Project: r.PathValue("project"), Scope: "global", Collection: r.PathValue("collection"), Name: r.PathValue("name")}
+	if region := r.PathValue("region"); region != "" {
+		p.Scope = "regions/" + region
+	} else if zone := r.PathValue("zone"); zone != "" {
+		p.Scope = "zones/" + zone
+	}
+	for regional, global := range aggregatedWith {
+		if p.Scope == "global" && p.Collection == regional {
+			p.Collection = global
+		}
+	}
+	return p
+}
+
+func (s *Server) get(w http.ResponseWriter, r *http.Request) {
+	p := requestPath(r)
+	if p.Collection == "" || p.Collection == "operations" {
+		s.getOperation(w, p)
+		return
+	}
+	if _, ok := collections[p.Collection]; !ok {
+		fail(w, http.StatusNotImplemented, "notImplemented", fmt.Sprintf("collection %s is not served by the fake", p.Collection))
+		return
+	}
+	resource, ok := s.Store.Get(p)
+	if !ok {
+		fail(w, http.StatusNotFound, "notFound", (&ErrNotFound{Path: p}).Error())
+		return
+	}
+	respond(w, http.StatusOK, resource)
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	scope := requestPath(r)
+	c, ok := collections[scope.Collection]
+	if !ok {
+		fail(w, http.StatusNotImplemented, "notImplemented", fmt.Sprintf("collection %s is not served by the fake", scope.Collection))
+		return
+	}
+	match, err := parseFilter(r.URL.Query().Get("filter"))
+	if err != nil {
+		fail(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+
+	var items []Resource
+	for _, p := range s.Paths() {
+		if p.Project != scope.Project || p.Scope != scope.Scope || p.Collection != scope.Collection {
+			continue
+		}
+		if resource, ok := s.Store.Get(p); ok && match(resource) {
+			items = append(items, resource)
+		}
+	}
+	page, next, err := paginate(items, r)
+	if err != nil {
+		fail(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+	body := map[string]interface{}{
+		"kind":     c.kind + "List",
+		"id":       scope.String(),
+		"selfLink": SelfLinkBase + strings.TrimSuffix(scope.String(), "/"),
+		"items":    page,
+	}
+	if next != "" {
+		body["nextPageToken"] = next
+	}
+	respond(w, http.StatusOK, body)
+}
+
+// aggregatedWith names the global collection the API folds into a regional
+// collection's aggregated list
+var aggregatedWith = map[string]string{
+	"forwardingRules": "globalForwardingRules",
+	"addresses":       "globalAddresses",
+}
+
+// aggregated lists a collection across every scope, keyed by scope
+func (s *Server) aggregated(w http.ResponseWriter, r *http.Request) {
+	project, name := r.PathValue("project"), r.PathValue("collection")
+	c, ok := collections[name]
+	if !ok {
+		fail(w, http.StatusNotImplemented, "notImplemented", fmt.Sprintf("collection %s is not served by the fake", name))
+		return
+	}
+	match, err := parseFilter(r.URL.Query().Get("filter"))
+	if err != nil {
+		fail(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+
+	scoped := map[string]map[string][]Resource{}
+	for _, p := range s.Paths() {
+		if p.Project != project || (p.Collection != name && p.Collection != aggregatedWith[name]) {
+			continue
+		}
+		resource, ok := s.Store.Get(p)
+		if !ok || !match(resource) {
+			continue
+		}
+		if scoped[p.Scope] == nil {
+			scoped[p.Scope] = map[string][]Resource{}
+		}
+		scoped[p.Scope][name] = append(scoped[p.Scope][name], resource)
+	}
+	respond(w, http.StatusOK, map[string]interface{}{
+		"kind":     strings.Replace(c.kind, "#", "#aggregated", 1) + "List",
+		"id":       "projects/" + project + "/aggregated/" + name,
+		"selfLink": SelfLinkBase + "projects/" + project + "/aggregated/" + name,
+		"items":    scoped,
+	})
+}
+
+func (s *Server) insert(w http.ResponseWriter, r *http.Request) {
+	p := requestPath(r)
+	var body Resource
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		fail(w, http.StatusBadRequest, "invalid", "Invalid JSON payload received. "+err.Error())
+		return
+	}
+	p.Name, _ = body["name"].(string)
+	if p.Name == "" {
+		fail(w, http.StatusBadRequest, "required", "Required field 'resource.name' not specified")
+		return
+	}
+
+	s.mu.Lock()
+	if _, exists := s.resources[p.String()]; exists {
+		s.mu.Unlock()
+		fail(w, http.StatusConflict, "alreadyExists", fmt.Sprintf("The resource '%s' already exists", p))
+		return
+	}
+	delete(body, "id")
+	delete(body, "creationTimestamp")
+	resource, err := s.normalize(p, body)
+	if err == nil {
+		s.resources[p.String()] = resource
+	}
+	s.mu.Unlock()
+	if err != nil {
+		fail(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+	respond(w, http.StatusOK, s.operation(p, "insert"))
+}
+
+func (s *Server) delete(w http.ResponseWriter, r *http.Request) {
+	p := requestPath(r)
+	if _, ok := collections[p.Collection]; !ok {
+		fail(w, http.StatusNotImplemented, "notImplemented", fmt.Sprintf("collection %s is not served by the fake", p.Collection))
+		return
+	}
+	err := s.Store.Delete(p)
+	var notFound *ErrNotFound
+	var inUse *ErrInUse
+	switch {
+	case errors.As(err, &notFound):
+		fail(w, http.StatusNotFound, "notFound", err.Error())
+	case errors.As(err, &inUse):
+		fail(w, http.StatusBadRequest, "resourceInUseByAnotherResource", err.Error())
+	case err != nil:
+		fail(w, http.StatusInternalServerError, "backendError", err.Error())
+	default:
+		respond(w, http.StatusOK, s.operation(p, "delete"))
+	}
+}
+
+// operation records a finished operation against the resource at p
+func (s *Server) operation(p Path, kind string) map[string]interface{} {
+	s.Store.mu.Lock()
+	s.nextID++
+	id := s.nextID
+	now := s.now().UTC().Format("2006-01-02T15:04:05.000-07:00")
+	s.Store.mu.Unlock()
+
+	name := fmt.Sprintf("operation-%d", id)
+	opPath := Path{Project: p.Project, Scope: p.Scope, Collection: "operations", Name: name}
+	op := map[string]interface{}{
+		"kind":          "compute#operation",
+		"id":            strconv.FormatUint(id, 10),
+		"name":          name,
+		"operationType": kind,
+		"status":        "DONE",
+		"progress":      100,
+		"targetLink":    p.SelfLink(),
+		"selfLink":      opPath.SelfLink(),
+		"insertTime":    now,
+		"startTime":     now,
+		"endTime":       now,
+	}
+	switch scope, location, _ := strings.Cut(p.Scope, "/"); scope {
+	case "regions":
+		op["region"] = SelfLinkBase + "projects/" + p.Project + "/regions/" + location
+	case "zones":
+		op["zone"] = SelfLinkBase + "projects/" + p.Project + "/zones/" + location
+	}
+
+	s.opMu.Lock()
+	defer s.opMu.Unlock()
+	s.operations[opPath.String()] = op
+	return op
+}
+
+func (s *Server) getOperation(w http.ResponseWriter, p Path) {
+	p.Collection = "operations"
+	s.opMu.Lock()
+	op, ok := s.operations[p.String()]
+	s.opMu.Unlock()
+	if !ok {
+		fail(w, http.StatusNotFound, "notFound", (&ErrNotFound{Path: p}).Error())
+		return
+	}
+	respond(w, http.StatusOK, op)
+}
+
+// paginate applies maxResults and pageToken, where the token is the offset
+// of the next page
+func paginate(items []Resource, r *http.Request) ([]Resource, string, error) {
+	sort.Slice(items, func(i, j int) bool { return fmt.Sprint(items[i]["name"]) < fmt.Sprint(items[j]["name"]) })
+	start := 0
+	if token := r.URL.Query().Get("pageToken"); token != "" {
+		n, err := strconv.Atoi(token)
+		if err != nil || n < 0 || n > len(items) {
+			return nil, "", fmt.Errorf("invalid pageToken %q", token)
+		}
+		start = n
+	}
+	end := len(items)
+	if max := r.URL.Query().Get("maxResults"); max != "" {
+		n, err := strconv.Atoi(max)
+		if err != nil || n <= 0 {
+			return nil, "", fmt.Errorf("invalid maxResults %q", max)
+		}
+		end = min(start+n, len(items))
+	}
+	next := ""
+	if end < len(items) {
+		next = strconv.Itoa(end)
+	}
+	if items == nil {
+		items = []Resource{}
+	}
+	return items[start:end], next, nil
+}
+
+// apiError is the Compute API error envelope
+type apiError struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Errors  []struct {
+			Message string `json:"message"`
+			Domain  string `json:"domain"`
+			Reason  string `json:"reason"`
+		} `json:"errors"`
+	} `json:"error"`
+}
+
+func fail(w http.ResponseWriter, status int, reason, message string) {
+	var body apiError
+	body.Error.Code = status
+	body.Error.Message = message
+	body.Error.Errors = append(body.Error.Errors, struct {
+		Message string `json:"message"`
+		Domain  string `json:"domain"`
+		Reason  string `json:"reason"`
+	}{message, "global", reason})
+	respond(w, status, body)
+}
+
+func respond(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
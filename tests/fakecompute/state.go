@@ -0,0 +1,247 @@
+package fakecompute
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// stateTypes maps the provider resource types the modules use to the
+// collection and scope kind they live in
+var stateTypes = map[string]struct{ collection, scope string }{
+	"google_compute_firewall":                      {"firewalls", "global"},
+	"google_compute_network":                       {"networks", "global"},
+	"google_compute_subnetwork":                    {"subnetworks", "regions"},
+	"google_compute_forwarding_rule":               {"forwardingRules", "regions"},
+	"google_compute_global_forwarding_rule":        {"globalForwardingRules", "global"},
+	"google_compute_region_target_https_proxy":     {"targetHttpsProxies", "regions"},
+	"google_compute_target_https_proxy":            {"targetHttpsProxies", "global"},
+	"google_compute_region_target_http_proxy":      {"targetHttpProxies", "regions"},
+	"google_compute_target_http_proxy":             {"targetHttpProxies", "global"},
+	"google_compute_region_backend_service":        {"backendServices", "regions"},
+	"google_compute_backend_service":               {"backendServices", "global"},
+	"google_compute_region_url_map":                {"urlMaps", "regions"},
+	"google_compute_url_map":                       {"urlMaps", "global"},
+	"google_compute_region_security_policy":        {"securityPolicies", "regions"},
+	"google_compute_security_policy":               {"securityPolicies", "global"},
+	"google_compute_region_network_endpoint_group": {"networkEndpointGroups", "regions"},
+	"google_compute_network_endpoint_group":        {"networkEndpointGroups", "zones"},
+	"google_compute_service_attachment":            {"serviceAttachments", "regions"},
+	"google_compute_address":                       {"addresses", "regions"},
+	"google_compute_global_address":                {"globalAddresses", "global"},
+	"google_compute_region_ssl_certificate":        {"sslCertificates", "regions"},
+	"google_compute_ssl_certificate":               {"sslCertificates", "global"},
+	"google_compute_managed_ssl_certificate":       {"sslCertificates", "global"},
+}
+
+// stateOnly are attributes the provider keeps that the API does not return,
+// or that the fake assigns itself
+var stateOnly = map[string]bool{
+	"id": true, "project": true, "self_link": true, "region": true, "zone": true,
+	"labels": true, "terraform_labels": true, "effective_labels": true, "timeouts": true,
+	"private_key": true, "private_key_wo": true, "name_prefix": true,
+	// back-references the API keeps for in-use checks, not references
+	"users": true,
+}
+
+// fieldNames are API names that snake-to-camel conversion gets wrong
+var fieldNames = map[string]string{
+	"ip_address":  "IPAddress",
+	"ip_protocol": "IPProtocol",
+	// firewall allow and deny blocks call it protocol
+	"protocol@allowed": "IPProtocol",
+	"protocol@denied":  "IPProtocol",
+}
+
+// blockNames are repeated blocks whose API field is named differently
+var blockNames = map[string]string{
+	"allow":        "allowed",
+	"deny":         "denied",
+	"backend":      "backends",
+	"rule":         "rules",
+	"host_rule":    "hostRules",
+	"path_matcher": "pathMatchers",
+	"path_rule":    "pathRules",
+}
+
+// singleBlocks are blocks the provider stores as one-element lists that are
+// objects in the API
+var singleBlocks = map[string]bool{
+	"log_config": true, "cloud_run": true, "cloud_function": true, "app_engine": true,
+	"match": true, "config": true, "expr": true, "iap": true, "cdn_policy": true,
+	"consistent_hash": true, "circuit_breakers": true, "outlier_detection": true,
+	"connection_tracking_policy": true, "adaptive_protection_config": true,
+	"advanced_options_config": true, "rate_limit_options": true, "redirect_options": true,
+	"header_action": true, "route_action": true, "url_redirect": true,
+	"default_url_redirect": true, "default_route_action": true, "managed": true,
+	"layer_7_ddos_defense_config": true, "ddos_protection_config": true,
+}
+
+// LoadStateFile adds the Compute resources recorded in a state file
+func (s *Store) LoadStateFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := s.LoadState(data); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// LoadState adds the Compute resources recorded in a version 4 state
+// document, as `tofu state pull` prints it, converting provider attributes
+// to API fields. Data sources and resource types the fake does not serve are
+// skipped.
+func (s *Store) LoadState(data []byte) error {
+	var state struct {
+		Version   int `json:"version"`
+		Resources []struct {
+			Mode      string `json:"mode"`
+			Type      string `json:"type"`
+			Name      string `json:"name"`
+			Instances []struct {
+				Attributes map[string]interface{} `json:"attributes"`
+			} `json:"instances"`
+		} `json:"resources"`
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("parsing state: %w", err)
+	}
+	if state.Version != 4 {
+		return fmt.Errorf("state version %d is not supported", state.Version)
+	}
+
+	for _, res := range state.Resources {
+		kind, ok := stateTypes[res.Type]
+		if res.Mode != "managed" || !ok {
+			continue
+		}
+		for i, instance := range res.Instances {
+			addr := fmt.Sprintf("%s.%s[%d]", res.Type, res.Name, i)
+			path, resource, err := fromState(kind.collection, kind.scope, instance.Attributes)
+			if err != nil {
+				return fmt.Errorf("%s: %w", addr, err)
+			}
+			if err := s.Put(path, resource); err != nil {
+				return fmt.Errorf("%s: %w", addr, err)
+			}
+		}
+	}
+	return nil
+}
+
+// fromState converts one instance's attributes to its path and API form
+func fromState(collection, scope string, attrs map[string]interface{}) (Path, Resource, error) {
+	path := Path{Collection: collection, Scope: "global"}
+	path.Project, _ = attrs["project"].(string)
+	path.Name, _ = attrs["name"].(string)
+	if path.Project == "" || path.Name == "" {
+		return Path{}, nil, fmt.Errorf("project and name are required")
+	}
+	if scope != "global" {
+		location, _ := attrs[strings.TrimSuffix(scope, "s")].(string)
+		if location == "" {
+			return Path{}, nil, fmt.Errorf("%s is required", strings.TrimSuffix(scope, "s"))
+		}
+		path.Scope = scope + "/" + location[strings.LastIndex(location, "/")+1:]
+	}
+
+	resource := Resource{}
+	for key, value := range attrs {
+		if stateOnly[key] {
+			continue
+		}
+		name, converted, keep := convertField(key, value, "")
+		if keep {
+			resource[name] = converted
+		}
+	}
+	if labels, ok := attrs["effective_labels"].(map[string]interface{}); ok && len(labels) > 0 {
+		resource["labels"] = labels
+	} else if labels, ok := attrs["labels"].(map[string]interface{}); ok && len(labels) > 0 {
+		resource["labels"] = labels
+	}
+	// the provider has no enable flag: a log_config block turns logging on
+	if collection == "firewalls" || collection == "subnetworks" {
+		if logConfig, ok := resource["logConfig"].(map[string]interface{}); ok {
+			logConfig["enable"] = true
+		}
+	}
+	return path, resource, nil
+}
+
+// convertField renames a provider attribute and converts its value, within
+// the API block named parent. It reports false for values the API omits:
+// nulls, empty strings, and empty lists or maps.
+func convertField(key string, value interface{}, parent string) (string, interface{}, bool) {
+	name, ok := fieldNames[key+"@"+parent]
+	if !ok {
+		if name, ok = fieldNames[key]; !ok {
+			name = camel(key)
+		}
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return "", nil, false
+	case string:
+		return name, v, v != ""
+	case []interface{}:
+		if len(v) == 0 {
+			return "", nil, false
+		}
+		if block, ok := blockNames[key]; ok {
+			name = block
+		}
+		if singleBlocks[key] {
+			block, ok := convertBlock(v[0], name)
+			return name, block, ok
+		}
+		items := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			if block, ok := convertBlock(item, name); ok {
+				items = append(items, block)
+			} else if _, isMap := item.(map[string]interface{}); !isMap {
+				items = append(items, item)
+			}
+		}
+		return name, items, len(items) > 0
+	case map[string]interface{}:
+		block, ok := convertBlock(v, name)
+		return name, block, ok
+	default:
+		return name, v, true
+	}
+}
+
+// convertBlock converts every field of a nested block, reporting false when
+// the value is not a block or nothing in it is kept
+func convertBlock(value interface{}, parent string) (map[string]interface{}, bool) {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	out := map[string]interface{}{}
+	for key, item := range m {
+		if name, converted, keep := convertField(key, item, parent); keep {
+			out[name] = converted
+		}
+	}
+	return out, len(out) > 0
+}
+
+// camel turns a provider attribute name into its API field name
+func camel(key string) string {
+	parts := strings.Split(key, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			r := []rune(parts[i])
+			r[0] = unicode.ToUpper(r[0])
+			parts[i] = string(r)
+		}
+	}
+	return strings.Join(parts, "")
+}
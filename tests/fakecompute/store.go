@@ -0,0 +1,280 @@
+// Package fakecompute is an in-process stand-in for the Compute Engine v1 API
+// covering the resources the modules create: firewalls, networks,
+// subnetworks, forwarding rules, target proxies, backend services, URL maps,
+// security policies, network endpoint groups, service attachments, addresses
+// and SSL certificates. Resources live in a Store, which can be filled from
+// the state file of an applied module, so assertions written against
+// compute.Service can run against a known inventory without a project.
+package fakecompute
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+// SelfLinkBase prefixes every self link, as in the real API whatever
+// endpoint a client uses
+const SelfLinkBase = "https://www.googleapis.com/compute/v1/"
+
+// collection describes one resource collection the fake serves
+type collection struct {
+	kind string
+	// scopes lists where the collection lives: "global", "regions", "zones"
+	scopes []string
+	// typed returns the client type a resource must decode into
+	typed func() interface{}
+}
+
+var collections = map[string]collection{
+	"firewalls":             {"compute#firewall", []string{"global"}, func() interface{} { return &compute.Firewall{} }},
+	"networks":              {"compute#network", []string{"global"}, func() interface{} { return &compute.Network{} }},
+	"subnetworks":           {"compute#subnetwork", []string{"regions"}, func() interface{} { return &compute.Subnetwork{} }},
+	"forwardingRules":       {"compute#forwardingRule", []string{"regions"}, func() interface{} { return &compute.ForwardingRule{} }},
+	"globalForwardingRules": {"compute#forwardingRule", []string{"global"}, func() interface{} { return &compute.ForwardingRule{} }},
+	"targetHttpsProxies":    {"compute#targetHttpsProxy", []string{"global", "regions"}, func() interface{} { return &compute.TargetHttpsProxy{} }},
+	"targetHttpProxies":     {"compute#targetHttpProxy", []string{"global", "regions"}, func() interface{} { return &compute.TargetHttpProxy{} }},
+	"backendServices":       {"compute#backendService", []string{"global", "regions"}, func() interface{} { return &compute.BackendService{} }},
+	"urlMaps":               {"compute#urlMap", []string{"global", "regions"}, func() interface{} { return &compute.UrlMap{} }},
+	"securityPolicies":      {"compute#securityPolicy", []string{"global", "regions"}, func() interface{} { return &compute.SecurityPolicy{} }},
+	"networkEndpointGroups": {"compute#networkEndpointGroup", []string{"regions", "zones"}, func() interface{} { return &compute.NetworkEndpointGroup{} }},
+	"serviceAttachments":    {"compute#serviceAttachment", []string{"regions"}, func() interface{} { return &compute.ServiceAttachment{} }},
+	"addresses":             {"compute#address", []string{"regions"}, func() interface{} { return &compute.Address{} }},
+	"globalAddresses":       {"compute#address", []string{"global"}, func() interface{} { return &compute.Address{} }},
+	"sslCertificates":       {"compute#sslCertificate", []string{"global", "regions"}, func() interface{} { return &compute.SslCertificate{} }},
+}
+
+// Resource is a stored resource in its API JSON form
+type Resource map[string]interface{}
+
+// Path is where a resource lives: projects/P/global/C/N,
+// projects/P/regions/R/C/N or projects/P/zones/Z/C/N
+type Path struct {
+	Project string
+	// Scope is "global", "regions/<region>" or "zones/<zone>"
+	Scope      string
+	Collection string
+	Name       string
+}
+
+func (p Path) String() string {
+	return fmt.Sprintf("projects/%s/%s/%s/%s", p.Project, p.Scope, p.Collection, p.Name)
+}
+
+// SelfLink is the resource's full URL
+func (p Path) SelfLink() string { return SelfLinkBase + p.String() }
+
+// ParsePath reads a relative path or self link
+func ParsePath(link string) (Path, error) {
+	rel := link
+	if i := strings.Index(rel, "projects/"); i >= 0 {
+		rel = rel[i:]
+	}
+	parts := strings.Split(rel, "/")
+	switch {
+	case len(parts) == 5 && parts[0] == "projects" && parts[2] == "global":
+		return Path{Project: parts[1], Scope: "global", Collection: parts[3], Name: parts[4]}, nil
+	case len(parts) == 6 && parts[0] == "projects" && (parts[2] == "regions" || parts[2] == "zones"):
+		return Path{Project: parts[1], Scope: parts[2] + "/" + parts[3], Collection: parts[4], Name: parts[5]}, nil
+	}
+	return Path{}, fmt.Errorf("%q is not a compute resource path", link)
+}
+
+// Store holds the fake's resources. It is safe for concurrent use.
+type Store struct {
+	mu        sync.Mutex
+	resources map[string]Resource
+	nextID    uint64
+	now       func() time.Time
+}
+
+// NewStore returns an empty store
+func NewStore() *Store {
+	return &Store{resources: map[string]Resource{}, nextID: 1000000000000000000, now: time.Now}
+}
+
+// Put stores a resource at path, replacing any existing one. The resource is
+// a compute.* struct or its JSON form; it must decode into the collection's
+// client type. Name, kind, id, selfLink, region or zone, and
+// creationTimestamp are filled in when missing.
+func (s *Store) Put(path Path, resource interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, err := s.normalize(path, resource)
+	if err != nil {
+		return err
+	}
+	s.resources[path.String()] = r
+	return nil
+}
+
+// Get returns a copy of the resource at path
+func (s *Store) Get(path Path) (Resource, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.resources[path.String()]
+	if !ok {
+		return nil, false
+	}
+	return copyResource(r), true
+}
+
+// Delete removes the resource at path, refusing while another resource
+// refers to it, as the API does
+func (s *Store) Delete(path Path) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.delete(path)
+}
+
+// Paths lists every stored resource path in order
+func (s *Store) Paths() []Path {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Path, 0, len(s.resources))
+	for key := range s.resources {
+		p, _ := ParsePath(key)
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].String() < out[j].String() })
+	return out
+}
+
+// ErrInUse is returned when deleting a resource another one refers to
+type ErrInUse struct {
+	Path  Path
+	Users []Path
+}
+
+func (e *ErrInUse) Error() string {
+	users := make([]string, len(e.Users))
+	for i, u := range e.Users {
+		users[i] = u.String()
+	}
+	return fmt.Sprintf("The resource '%s' is already being used by '%s'", e.Path, strings.Join(users, "', '"))
+}
+
+// ErrNotFound is returned for a missing resource
+type ErrNotFound struct{ Path Path }
+
+func (e *ErrNotFound) Error() string {
+	return fmt.Sprintf("The resource '%s' was not found", e.Path)
+}
+
+// delete removes a resource; the caller holds s.mu
+func (s *Store) delete(path Path) error {
+	key := path.String()
+	if _, ok := s.resources[key]; !ok {
+		return &ErrNotFound{Path: path}
+	}
+	var users []Path
+	for other, r := range s.resources {
+		if other != key && refersTo(r, key) {
+			p, _ := ParsePath(other)
+			users = append(users, p)
+		}
+	}
+	if len(users) > 0 {
+		sort.Slice(users, func(i, j int) bool { return users[i].String() < users[j].String() })
+		return &ErrInUse{Path: path, Users: users}
+	}
+	delete(s.resources, key)
+	return nil
+}
+
+// normalize round-trips a resource through its client type, dropping fields
+// the API does not have, and fills in server-assigned fields; the caller
+// holds s.mu
+func (s *Store) normalize(path Path, resource interface{}) (Resource, error) {
+	c, ok := collections[path.Collection]
+	if !ok {
+		return nil, fmt.Errorf("collection %q is not served by the fake", path.Collection)
+	}
+	scope, _, _ := strings.Cut(path.Scope, "/")
+	if !contains(c.scopes, scope) {
+		return nil, fmt.Errorf("%s are not %s resources", path.Collection, scope)
+	}
+
+	data, err := json.Marshal(resource)
+	if err != nil {
+		return nil, err
+	}
+	typed := c.typed()
+	if err := json.Unmarshal(data, typed); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if data, err = json.Marshal(typed); err != nil {
+		return nil, err
+	}
+	var r Resource
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+
+	if name, _ := r["name"].(string); name == "" {
+		r["name"] = path.Name
+	} else if name != path.Name {
+		return nil, fmt.Errorf("%s: resource is named %q", path, name)
+	}
+	r["kind"] = c.kind
+	r["selfLink"] = path.SelfLink()
+	if id, _ := r["id"].(string); id == "" || id == "0" {
+		s.nextID++
+		r["id"] = fmt.Sprint(s.nextID)
+	}
+	if ts, _ := r["creationTimestamp"].(string); ts == "" {
+		r["creationTimestamp"] = s.now().UTC().Format(time.RFC3339)
+	}
+	switch kind, location, _ := strings.Cut(path.Scope, "/"); kind {
+	case "regions":
+		r["region"] = SelfLinkBase + "projects/" + path.Project + "/regions/" + location
+	case "zones":
+		r["zone"] = SelfLinkBase + "projects/" + path.Project + "/zones/" + location
+	}
+	return r, nil
+}
+
+// refersTo reports whether any string in r names the resource at key, as a
+// relative path or self link
+func refersTo(r interface{}, key string) bool {
+	switch v := r.(type) {
+	case string:
+		return v == key || strings.HasSuffix(v, "/"+key)
+	case []interface{}:
+		for _, item := range v {
+			if refersTo(item, key) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		for field, item := range v {
+			if field != "selfLink" && refersTo(item, key) {
+				return true
+			}
+		}
+	case Resource:
+		return refersTo(map[string]interface{}(v), key)
+	}
+	return false
+}
+
+func copyResource(r Resource) Resource {
+	data, _ := json.Marshal(r)
+	var out Resource
+	_ = json.Unmarshal(data, &out)
+	return out
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,276 @@
+package fakegcs
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Bucket is the bucket resource as the JSON API returns it
+type Bucket struct {
+	Kind             string            `json:"kind"`
+	ID               string            `json:"id"`
+	Name             string            `json:"name"`
+	SelfLink         string            `json:"selfLink"`
+	ProjectNumber    string            `json:"projectNumber"`
+	Location         string            `json:"location"`
+	StorageClass     string            `json:"storageClass"`
+	Metageneration   int64             `json:"metageneration,string"`
+	Labels           map[string]string `json:"labels,omitempty"`
+	Versioning       *Versioning       `json:"versioning,omitempty"`
+	IAMConfiguration *IAMConfiguration `json:"iamConfiguration,omitempty"`
+	TimeCreated      time.Time         `json:"timeCreated"`
+	Updated          time.Time         `json:"updated"`
+}
+
+// Versioning is the bucket's object versioning setting
+type Versioning struct {
+	Enabled bool `json:"enabled"`
+}
+
+// IAMConfiguration holds uniform bucket-level access and public access
+// prevention
+type IAMConfiguration struct {
+	UniformBucketLevelAccess *UniformBucketLevelAccess `json:"uniformBucketLevelAccess,omitempty"`
+	PublicAccessPrevention   string                    `json:"publicAccessPrevention,omitempty"`
+}
+
+// UniformBucketLevelAccess is the UBLA setting
+type UniformBucketLevelAccess struct {
+	Enabled bool `json:"enabled"`
+}
+
+type bucket struct {
+	Bucket
+	objects map[string]*object
+	// noncurrent holds replaced generations while versioning is enabled
+	noncurrent map[string][]*object
+	bindings   []Binding
+	// policyVersion counts IAM updates, for the policy etag
+	policyVersion int
+}
+
+// CreateBucket adds an empty bucket, or returns an error when it exists
+func (s *Server) CreateBucket(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.buckets[name]; ok {
+		return fmt.Errorf("bucket %q already exists", name)
+	}
+	s.buckets[name] = s.newBucket(Bucket{Name: name})
+	return nil
+}
+
+// BucketAttrs returns a copy of a bucket's metadata
+func (s *Server) BucketAttrs(name string) (Bucket, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[name]
+	if !ok {
+		return Bucket{}, false
+	}
+	return b.Bucket, true
+}
+
+// newBucket fills in the server-assigned fields; the caller holds s.mu
+func (s *Server) newBucket(in Bucket) *bucket {
+	now := s.now().UTC()
+	in.Kind = "storage#bucket"
+	in.ID = in.Name
+	in.SelfLink = s.URL + "/storage/v1/b/" + in.Name
+	if in.ProjectNumber == "" {
+		in.ProjectNumber = "123456789012"
+	}
+	if in.Location == "" {
+		in.Location = "US"
+	}
+	if in.StorageClass == "" {
+		in.StorageClass = "STANDARD"
+	}
+	in.Metageneration = 1
+	in.TimeCreated = now
+	in.Updated = now
+	return &bucket{Bucket: in, objects: map[string]*object{}, noncurrent: map[string][]*object{}}
+}
+
+func (s *Server) insertBucket(w http.ResponseWriter, r *http.Request) {
+	var in Bucket
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil || in.Name == "" {
+		fail(w, http.StatusBadRequest, "bucket insert requires a JSON body with a name")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.buckets[in.Name]; ok {
+		fail(w, http.StatusConflict, fmt.Sprintf("The requested bucket name %s is not available.", in.Name))
+		return
+	}
+	b := s.newBucket(in)
+	s.buckets[in.Name] = b
+	respond(w, http.StatusOK, b.Bucket)
+}
+
+func (s *Server) getBucket(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[r.PathValue("bucket")]
+	if !ok {
+		fail(w, http.StatusNotFound, "The specified bucket does not exist.")
+		return
+	}
+	respond(w, http.StatusOK, b.Bucket)
+}
+
+// patchBucket updates the settings present in the body
+func (s *Server) patchBucket(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		Labels           map[string]string `json:"labels"`
+		Versioning       *Versioning       `json:"versioning"`
+		IAMConfiguration *IAMConfiguration `json:"iamConfiguration"`
+		StorageClass     string            `json:"storageClass"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		fail(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[r.PathValue("bucket")]
+	if !ok {
+		fail(w, http.StatusNotFound, "The specified bucket does not exist.")
+		return
+	}
+	if in.Labels != nil {
+		b.Labels = in.Labels
+	}
+	if in.Versioning != nil {
+		b.Versioning = in.Versioning
+	}
+	if in.IAMConfiguration != nil {
+		if b.IAMConfiguration == nil {
+			b.IAMConfiguration = &IAMConfiguration{}
+		}
+		if in.IAMConfiguration.UniformBucketLevelAccess != nil {
+			b.IAMConfiguration.UniformBucketLevelAccess = in.IAMConfiguration.UniformBucketLevelAccess
+		}
+		if in.IAMConfiguration.PublicAccessPrevention != "" {
+			b.IAMConfiguration.PublicAccessPrevention = in.IAMConfiguration.PublicAccessPrevention
+		}
+	}
+	if in.StorageClass != "" {
+		b.StorageClass = in.StorageClass
+	}
+	b.Metageneration++
+	b.Updated = s.now().UTC()
+	respond(w, http.StatusOK, b.Bucket)
+}
+
+func (s *Server) deleteBucket(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name := r.PathValue("bucket")
+	b, ok := s.buckets[name]
+	if !ok {
+		fail(w, http.StatusNotFound, "The specified bucket does not exist.")
+		return
+	}
+	if len(b.objects) > 0 {
+		fail(w, http.StatusConflict, "The bucket you tried to delete is not empty.")
+		return
+	}
+	delete(s.buckets, name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// versioned reports whether replaced objects are kept
+func (b *bucket) versioned() bool {
+	return b.Versioning != nil && b.Versioning.Enabled
+}
+
+// Policy is a bucket's IAM policy as the JSON API returns it
+type Policy struct {
+	Kind       string    `json:"kind"`
+	ResourceID string    `json:"resourceId"`
+	Version    int       `json:"version"`
+	Etag       string    `json:"etag"`
+	Bindings   []Binding `json:"bindings"`
+}
+
+// Binding grants a role to members
+type Binding struct {
+	Role    string   `json:"role"`
+	Members []string `json:"members"`
+}
+
+// BucketPolicy returns a copy of a bucket's IAM policy
+func (s *Server) BucketPolicy(name string) (Policy, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[name]
+	if !ok {
+		return Policy{}, false
+	}
+	return b.policy(), true
+}
+
+// SetBucketPolicy replaces a bucket's IAM bindings
+func (s *Server) SetBucketPolicy(name string, bindings []Binding) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[name]
+	if !ok {
+		return fmt.Errorf("bucket %q does not exist", name)
+	}
+	b.bindings = append([]Binding(nil), bindings...)
+	b.policyVersion++
+	return nil
+}
+
+// policy renders the bucket's bindings; the etag changes with every update
+func (b *bucket) policy() Policy {
+	return Policy{
+		Kind:       "storage#policy",
+		ResourceID: "projects/_/buckets/" + b.Name,
+		Version:    1,
+		Etag:       base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("policy-%d", b.policyVersion))),
+		Bindings:   append([]Binding{}, b.bindings...),
+	}
+}
+
+func (s *Server) getBucketPolicy(w http.ResponseWriter, r *http.Request) {
+	policy, ok := s.BucketPolicy(r.PathValue("bucket"))
+	if !ok {
+		fail(w, http.StatusNotFound, "The specified bucket does not exist.")
+		return
+	}
+	respond(w, http.StatusOK, policy)
+}
+
+// setBucketPolicy replaces the bindings, refusing a stale etag as the API
+// does so concurrent read-modify-writes do not lose grants
+func (s *Server) setBucketPolicy(w http.ResponseWriter, r *http.Request) {
+	var in Policy
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		fail(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[r.PathValue("bucket")]
+	if !ok {
+		fail(w, http.StatusNotFound, "The specified bucket does not exist.")
+		return
+	}
+	if in.Etag != "" && in.Etag != b.policy().Etag {
+		fail(w, http.StatusPreconditionFailed, "Precondition Failed")
+		return
+	}
+	b.bindings = in.Bindings
+	b.policyVersion++
+	respond(w, http.StatusOK, b.policy())
+}
@@ -0,0 +1,56 @@
+package fakegcs
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Credentials returns a service account key whose token_uri is the server,
+// so a client authenticating with it never contacts Google
+func (s *Server) Credentials() ([]byte, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(map[string]string{
+		"type":           "service_account",
+		"project_id":     "fake-gcs",
+		"private_key_id": "fake-gcs-key",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"client_email":   "fake-gcs@fake-gcs.iam.gserviceaccount.com",
+		"client_id":      "000000000000000000000",
+		"auth_uri":       s.URL + "/auth",
+		"token_uri":      s.URL + "/token",
+	}, "", "  ")
+}
+
+// BackendEnv returns the environment that sends the gcs backend, and every
+// terraform_remote_state data source using it, to the server while leaving
+// the google providers' credentials alone. The service account key is
+// written to dir. GOOGLE_OAUTH_ACCESS_TOKEN, when set, takes precedence over
+// these credentials in the backend and should be unset. Pass the result as
+// terraform.Options.EnvVars.
+func (s *Server) BackendEnv(dir string) (map[string]string, error) {
+	creds, err := s.Credentials()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, "fake-gcs-credentials.json")
+	if err := os.WriteFile(path, creds, 0o600); err != nil {
+		return nil, fmt.Errorf("writing credentials: %w", err)
+	}
+	return map[string]string{
+		"GOOGLE_BACKEND_STORAGE_CUSTOM_ENDPOINT": s.Endpoint(),
+		"GOOGLE_BACKEND_CREDENTIALS":             path,
+	}, nil
+}
@@ -0,0 +1,233 @@
+package fakegcs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+
+	"vibetics-cloudedge/tests/planfixture"
+	"vibetics-cloudedge/tests/stack"
+)
+
+func newClient(t *testing.T) (*Server, *storage.Client) {
+	t.Helper()
+	s := NewServer()
+	t.Cleanup(s.Close)
+	client, err := storage.NewClient(context.Background(), option.WithEndpoint(s.Endpoint()), option.WithoutAuthentication())
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return s, client
+}
+
+func write(ctx context.Context, obj *storage.ObjectHandle, data string) error {
+	w := obj.NewWriter(ctx)
+	if _, err := io.WriteString(w, data); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func read(t *testing.T, ctx context.Context, obj *storage.ObjectHandle) string {
+	t.Helper()
+	r, err := obj.NewReader(ctx)
+	require.NoError(t, err)
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestObjectRoundTrip(t *testing.T) {
+	t.Parallel()
+	s, client := newClient(t)
+	ctx := context.Background()
+	require.NoError(t, s.CreateBucket("test-project-tfstate"))
+	bucket := client.Bucket("test-project-tfstate")
+
+	require.NoError(t, write(ctx, bucket.Object("core/default.tfstate"), `{"version":4}`))
+	assert.Equal(t, `{"version":4}`, read(t, ctx, bucket.Object("core/default.tfstate")))
+
+	attrs, err := bucket.Object("core/default.tfstate").Attrs(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, len(`{"version":4}`), attrs.Size)
+	assert.NotZero(t, attrs.Generation)
+
+	_, err = bucket.Object("missing").NewReader(ctx)
+	assert.ErrorIs(t, err, storage.ErrObjectNotExist)
+
+	// resumable uploads are used for anything larger than one chunk
+	w := bucket.Object("big/default.tfstate").NewWriter(ctx)
+	w.ChunkSize = 256 * 1024
+	big := strings.Repeat("x", 600*1024)
+	_, err = io.WriteString(w, big)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.Equal(t, big, read(t, ctx, bucket.Object("big/default.tfstate")))
+}
+
+func TestListWithDelimiter(t *testing.T) {
+	t.Parallel()
+	s, client := newClient(t)
+	ctx := context.Background()
+	for _, name := range []string{"core/default.tfstate", "core/staging.tfstate", "demo/default.tfstate", "top.txt"} {
+		s.PutObject("b", name, []byte(name))
+	}
+
+	var names, prefixes []string
+	it := client.Bucket("b").Objects(ctx, &storage.Query{Delimiter: "/"})
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		require.NoError(t, err)
+		if attrs.Prefix != "" {
+			prefixes = append(prefixes, attrs.Prefix)
+		} else {
+			names = append(names, attrs.Name)
+		}
+	}
+	assert.Equal(t, []string{"top.txt"}, names)
+	assert.Equal(t, []string{"core/", "demo/"}, prefixes)
+
+	names = nil
+	it = client.Bucket("b").Objects(ctx, &storage.Query{Prefix: "core/"})
+	it.PageInfo().MaxSize = 1
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, attrs.Name)
+	}
+	assert.Equal(t, []string{"core/default.tfstate", "core/staging.tfstate"}, names)
+}
+
+// TestStateLock follows the gcs backend: the lock object is created only if
+// absent and deleted only at the generation that was written
+func TestStateLock(t *testing.T) {
+	t.Parallel()
+	s, client := newClient(t)
+	ctx := context.Background()
+	require.NoError(t, s.CreateBucket("b"))
+	lock := client.Bucket("b").Object("core/default.tflock")
+
+	require.NoError(t, write(ctx, lock.If(storage.Conditions{DoesNotExist: true}), `{"ID":"1"}`))
+	err := write(ctx, lock.If(storage.Conditions{DoesNotExist: true}), `{"ID":"2"}`)
+	var apiErr *googleapi.Error
+	require.ErrorAs(t, err, &apiErr, "second lock should fail")
+	assert.Equal(t, http.StatusPreconditionFailed, apiErr.Code)
+
+	attrs, err := lock.Attrs(ctx)
+	require.NoError(t, err)
+	require.Error(t, lock.If(storage.Conditions{GenerationMatch: attrs.Generation + 1}).Delete(ctx))
+	require.NoError(t, lock.If(storage.Conditions{GenerationMatch: attrs.Generation}).Delete(ctx))
+	assert.Empty(t, s.ObjectNames("b"))
+}
+
+func TestBucketSettings(t *testing.T) {
+	t.Parallel()
+	s, client := newClient(t)
+	ctx := context.Background()
+	bucket := client.Bucket("test-project-tfstate")
+
+	require.NoError(t, bucket.Create(ctx, "test-project", &storage.BucketAttrs{Location: "US-CENTRAL1"}))
+	_, err := bucket.Update(ctx, storage.BucketAttrsToUpdate{
+		VersioningEnabled:        true,
+		UniformBucketLevelAccess: &storage.UniformBucketLevelAccess{Enabled: true},
+	})
+	require.NoError(t, err)
+
+	attrs, err := bucket.Attrs(ctx)
+	require.NoError(t, err)
+	assert.True(t, attrs.VersioningEnabled)
+	assert.True(t, attrs.UniformBucketLevelAccess.Enabled)
+
+	// replaced generations are kept while versioning is on
+	require.NoError(t, write(ctx, bucket.Object("s"), "one"))
+	require.NoError(t, write(ctx, bucket.Object("s"), "two"))
+	versions := 0
+	it := bucket.Objects(ctx, &storage.Query{Versions: true})
+	for {
+		_, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		require.NoError(t, err)
+		versions++
+	}
+	assert.Equal(t, 2, versions)
+
+	stored, ok := s.BucketAttrs("test-project-tfstate")
+	require.True(t, ok)
+	assert.Equal(t, "US-CENTRAL1", stored.Location)
+}
+
+func TestBucketPolicy(t *testing.T) {
+	t.Parallel()
+	s, client := newClient(t)
+	ctx := context.Background()
+	require.NoError(t, s.CreateBucket("test-project-tfstate"))
+	handle := client.Bucket("test-project-tfstate").IAM()
+
+	policy, err := handle.Policy(ctx)
+	require.NoError(t, err)
+	policy.Add("user:alice@example.com", "roles/storage.objectAdmin")
+	require.NoError(t, handle.SetPolicy(ctx, policy))
+
+	stored, ok := s.BucketPolicy("test-project-tfstate")
+	require.True(t, ok)
+	assert.Equal(t, []Binding{{Role: "roles/storage.objectAdmin", Members: []string{"user:alice@example.com"}}}, stored.Bindings)
+
+	// a write based on the policy before that update is refused
+	policy.Add("allUsers", "roles/storage.objectViewer")
+	assert.Error(t, handle.SetPolicy(ctx, policy))
+}
+
+func TestSeedRemoteStates(t *testing.T) {
+	t.Parallel()
+	s, client := newClient(t)
+	ctx := context.Background()
+	vars := planfixture.BaseVars("core")
+	vars["enable_demo_web_app_psc_neg"] = true
+	require.NoError(t, s.SeedRemoteStates(vars))
+
+	locations, err := stack.RemoteStates(vars)
+	require.NoError(t, err)
+	assert.Equal(t, stack.StateLocation{Bucket: "test-project-tfstate", Prefix: "test-project-singleton"}, locations["project-singleton"])
+	assert.Equal(t, stack.StateLocation{Bucket: "test-demo-project-tfstate", Prefix: "demo-web-app"}, locations["demo-web-app"])
+
+	var singleton, demo struct {
+		Version int `json:"version"`
+		Outputs map[string]struct {
+			Value interface{}     `json:"value"`
+			Type  json.RawMessage `json:"type"`
+		} `json:"outputs"`
+	}
+	loc := locations["project-singleton"]
+	require.NoError(t, json.Unmarshal([]byte(read(t, ctx, client.Bucket(loc.Bucket).Object(loc.StateObject()))), &singleton))
+	assert.Equal(t, 4, singleton.Version)
+	assert.Equal(t, true, singleton.Outputs["enable_logging"].Value)
+	assert.JSONEq(t, `"bool"`, string(singleton.Outputs["enable_logging"].Type))
+	assert.Equal(t, "projects/test-project/global/sslCertificates/external-https-lb-cert-demo-web-app",
+		singleton.Outputs["external_https_lb_cert_id"].Value)
+
+	loc = locations["demo-web-app"]
+	require.NoError(t, json.Unmarshal([]byte(read(t, ctx, client.Bucket(loc.Bucket).Object(loc.StateObject()))), &demo))
+	assert.Equal(t, "projects/test-demo-project/regions/us-central1/serviceAttachments/demo-web-app-psc-attachment",
+		demo.Outputs["web_app_psc_service_attachment_self_link"].Value)
+	assert.Equal(t, "projects/test-demo-project/regions/us-central1/backendServices/demo-web-app-internal-backend",
+		demo.Outputs["web_app_backend_service_id"].Value)
+}
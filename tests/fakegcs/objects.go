@@ -0,0 +1,502 @@
+package fakegcs
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Object is the object resource as the JSON API returns it
+type Object struct {
+	Kind           string            `json:"kind"`
+	ID             string            `json:"id"`
+	SelfLink       string            `json:"selfLink"`
+	MediaLink      string            `json:"mediaLink"`
+	Name           string            `json:"name"`
+	Bucket         string            `json:"bucket"`
+	Generation     int64             `json:"generation,string"`
+	Metageneration int64             `json:"metageneration,string"`
+	ContentType    string            `json:"contentType"`
+	Size           int64             `json:"size,string"`
+	MD5Hash        string            `json:"md5Hash"`
+	CRC32C         string            `json:"crc32c"`
+	Metadata       map[string]string `json:"metadata,omitempty"`
+	TimeCreated    time.Time         `json:"timeCreated"`
+	Updated        time.Time         `json:"updated"`
+	TimeDeleted    *time.Time        `json:"timeDeleted,omitempty"`
+}
+
+type object struct {
+	Object
+	data []byte
+}
+
+// objectMetadata is the writable part of an object sent with an upload
+type objectMetadata struct {
+	Name        string            `json:"name"`
+	ContentType string            `json:"contentType"`
+	Metadata    map[string]string `json:"metadata"`
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// PutObject writes an object, creating the bucket when it does not exist
+func (s *Server) PutObject(bucketName, name string, data []byte) Object {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[bucketName]
+	if !ok {
+		b = s.newBucket(Bucket{Name: bucketName})
+		s.buckets[bucketName] = b
+	}
+	return s.store(b, objectMetadata{Name: name}, data).Object
+}
+
+// ReadObject returns the live content of an object
+func (s *Server) ReadObject(bucketName, name string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[bucketName]
+	if !ok {
+		return nil, false
+	}
+	o, ok := b.objects[name]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), o.data...), true
+}
+
+// ObjectNames lists the live objects of a bucket in name order
+func (s *Server) ObjectNames(bucketName string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[bucketName]
+	if !ok {
+		return nil
+	}
+	names := make([]string, 0, len(b.objects))
+	for name := range b.objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// store writes a new generation of an object; the caller holds s.mu
+func (s *Server) store(b *bucket, meta objectMetadata, data []byte) *object {
+	now := s.now().UTC()
+	s.generation++
+	if meta.ContentType == "" {
+		meta.ContentType = "application/octet-stream"
+	}
+
+	sum := md5.Sum(data)
+	var crc [4]byte
+	binary.BigEndian.PutUint32(crc[:], crc32.Checksum(data, castagnoli))
+	o := &object{
+		Object: Object{
+			Kind:           "storage#object",
+			ID:             fmt.Sprintf("%s/%s/%d", b.Name, meta.Name, s.generation),
+			SelfLink:       s.URL + "/storage/v1/b/" + b.Name + "/o/" + url.PathEscape(meta.Name),
+			MediaLink:      s.URL + "/download/storage/v1/b/" + b.Name + "/o/" + url.PathEscape(meta.Name) + "?alt=media",
+			Name:           meta.Name,
+			Bucket:         b.Name,
+			Generation:     s.generation,
+			Metageneration: 1,
+			ContentType:    meta.ContentType,
+			Size:           int64(len(data)),
+			MD5Hash:        base64.StdEncoding.EncodeToString(sum[:]),
+			CRC32C:         base64.StdEncoding.EncodeToString(crc[:]),
+			Metadata:       meta.Metadata,
+			TimeCreated:    now,
+			Updated:        now,
+		},
+		data: append([]byte(nil), data...),
+	}
+
+	if previous, ok := b.objects[meta.Name]; ok && b.versioned() {
+		previous.TimeDeleted = &now
+		b.noncurrent[meta.Name] = append(b.noncurrent[meta.Name], previous)
+	}
+	b.objects[meta.Name] = o
+	return o
+}
+
+// lookup finds the bucket and the addressed generation of an object (the
+// live one unless ?generation= is given); the caller holds s.mu
+func (s *Server) lookup(w http.ResponseWriter, r *http.Request) (*bucket, *object, bool) {
+	b, ok := s.buckets[r.PathValue("bucket")]
+	if !ok {
+		fail(w, http.StatusNotFound, "The specified bucket does not exist.")
+		return nil, nil, false
+	}
+	name := objectName(r.PathValue("object"))
+	o := b.objects[name]
+	if raw := r.URL.Query().Get("generation"); raw != "" {
+		generation, _ := strconv.ParseInt(raw, 10, 64)
+		o = nil
+		candidates := append([]*object{b.objects[name]}, b.noncurrent[name]...)
+		for _, candidate := range candidates {
+			if candidate != nil && candidate.Generation == generation {
+				o = candidate
+			}
+		}
+	}
+	if o == nil {
+		fail(w, http.StatusNotFound, fmt.Sprintf("No such object: %s/%s", b.Name, name))
+		return b, nil, false
+	}
+	return b, o, true
+}
+
+func (s *Server) getObject(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("alt") == "media" {
+		s.downloadObject(w, r)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, o, ok := s.lookup(w, r); ok {
+		respond(w, http.StatusOK, o.Object)
+	}
+}
+
+// downloadObject serves object content on the JSON media and XML paths,
+// with the x-goog headers the Go client validates
+func (s *Server) downloadObject(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	_, o, ok := s.lookup(w, r)
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", o.ContentType)
+	h.Set("Last-Modified", o.Updated.Format(http.TimeFormat))
+	h.Set("X-Goog-Generation", strconv.FormatInt(o.Generation, 10))
+	h.Set("X-Goog-Metageneration", strconv.FormatInt(o.Metageneration, 10))
+	h.Set("X-Goog-Stored-Content-Length", strconv.Itoa(len(o.data)))
+	h.Set("X-Goog-Hash", "crc32c="+o.CRC32C+",md5="+o.MD5Hash)
+	h.Set("Etag", `"`+o.MD5Hash+`"`)
+
+	start, end, partial := byteRange(r.Header.Get("Range"), len(o.data))
+	if start > end {
+		h.Set("Content-Range", fmt.Sprintf("bytes */%d", len(o.data)))
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	h.Set("Content-Length", strconv.Itoa(end-start))
+	if partial {
+		h.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end-1, len(o.data)))
+		w.WriteHeader(http.StatusPartialContent)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	_, _ = w.Write(o.data[start:end])
+}
+
+// byteRange parses a single "bytes=a-b", "bytes=a-" or "bytes=-n" range
+func byteRange(header string, size int) (start, end int, partial bool) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return 0, size, false
+	}
+	first, last, _ := strings.Cut(spec, "-")
+	switch {
+	case first == "":
+		n, _ := strconv.Atoi(last)
+		return max(size-n, 0), size, true
+	case last == "":
+		start, _ = strconv.Atoi(first)
+		return start, size, start != 0
+	default:
+		start, _ = strconv.Atoi(first)
+		end, _ = strconv.Atoi(last)
+		return start, min(end+1, size), true
+	}
+}
+
+func (s *Server) deleteObject(w http.ResponseWriter, r *http.Request) {
+	pre, err := parsePreconditions(r)
+	if err != nil {
+		fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, o, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	if !pre.check(o) {
+		fail(w, http.StatusPreconditionFailed, "At least one of the pre-conditions you specified did not hold.")
+		return
+	}
+	if b.objects[o.Name] == o {
+		delete(b.objects, o.Name)
+		if b.versioned() {
+			now := s.now().UTC()
+			o.TimeDeleted = &now
+			b.noncurrent[o.Name] = append(b.noncurrent[o.Name], o)
+		}
+	} else {
+		versions := b.noncurrent[o.Name]
+		for i, candidate := range versions {
+			if candidate == o {
+				b.noncurrent[o.Name] = append(versions[:i:i], versions[i+1:]...)
+				break
+			}
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// objectList is the response of objects.list
+type objectList struct {
+	Kind          string   `json:"kind"`
+	Items         []Object `json:"items"`
+	Prefixes      []string `json:"prefixes,omitempty"`
+	NextPageToken string   `json:"nextPageToken,omitempty"`
+}
+
+func (s *Server) listObjects(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	prefix, delimiter, token := q.Get("prefix"), q.Get("delimiter"), q.Get("pageToken")
+	maxResults, _ := strconv.Atoi(q.Get("maxResults"))
+	if maxResults <= 0 {
+		maxResults = 1000
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[r.PathValue("bucket")]
+	if !ok {
+		fail(w, http.StatusNotFound, "The specified bucket does not exist.")
+		return
+	}
+
+	var all []*object
+	for _, o := range b.objects {
+		all = append(all, o)
+	}
+	if q.Get("versions") == "true" {
+		for _, versions := range b.noncurrent {
+			all = append(all, versions...)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Name != all[j].Name {
+			return all[i].Name < all[j].Name
+		}
+		return all[i].Generation < all[j].Generation
+	})
+
+	list := objectList{Kind: "storage#objects", Items: []Object{}}
+	seenPrefixes := map[string]bool{}
+	count := 0
+	for _, o := range all {
+		if !strings.HasPrefix(o.Name, prefix) || (token != "" && o.Name <= token) {
+			continue
+		}
+		if count == maxResults {
+			list.NextPageToken = list.Items[len(list.Items)-1].Name
+			break
+		}
+		if delimiter != "" {
+			if i := strings.Index(o.Name[len(prefix):], delimiter); i >= 0 {
+				p := o.Name[:len(prefix)+i+len(delimiter)]
+				if !seenPrefixes[p] {
+					seenPrefixes[p] = true
+					list.Prefixes = append(list.Prefixes, p)
+				}
+				continue
+			}
+		}
+		list.Items = append(list.Items, o.Object)
+		count++
+	}
+	respond(w, http.StatusOK, list)
+}
+
+// upload handles uploadType=media, multipart and the start of resumable, and
+// the chunks of a resumable upload the Go client POSTs to its session URI
+func (s *Server) upload(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("upload_id") != "" {
+		s.resumeUpload(w, r)
+		return
+	}
+	pre, err := parsePreconditions(r)
+	if err != nil {
+		fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var meta objectMetadata
+	var data []byte
+	switch uploadType := r.URL.Query().Get("uploadType"); uploadType {
+	case "media":
+		meta.Name = r.URL.Query().Get("name")
+		meta.ContentType = r.Header.Get("Content-Type")
+		data, err = io.ReadAll(r.Body)
+	case "multipart":
+		meta, data, err = readMultipart(r)
+	case "resumable":
+		s.startResumable(w, r, pre)
+		return
+	default:
+		err = fmt.Errorf("unsupported uploadType %q", uploadType)
+	}
+	if err != nil {
+		fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if meta.Name == "" {
+		meta.Name = r.URL.Query().Get("name")
+	}
+	s.finishUpload(w, r.PathValue("bucket"), meta, data, pre)
+}
+
+// finishUpload stores the object if the bucket exists and the preconditions hold
+func (s *Server) finishUpload(w http.ResponseWriter, bucketName string, meta objectMetadata, data []byte, pre preconditions) {
+	if meta.Name == "" {
+		fail(w, http.StatusBadRequest, "object name is required")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[bucketName]
+	if !ok {
+		fail(w, http.StatusNotFound, "The specified bucket does not exist.")
+		return
+	}
+	if !pre.check(b.objects[meta.Name]) {
+		fail(w, http.StatusPreconditionFailed, "At least one of the pre-conditions you specified did not hold.")
+		return
+	}
+	respond(w, http.StatusOK, s.store(b, meta, data).Object)
+}
+
+// readMultipart splits a multipart/related upload into metadata and media
+func readMultipart(r *http.Request) (objectMetadata, []byte, error) {
+	var meta objectMetadata
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		return meta, nil, fmt.Errorf("multipart upload needs a multipart Content-Type, got %q", r.Header.Get("Content-Type"))
+	}
+	reader := multipart.NewReader(r.Body, params["boundary"])
+
+	part, err := reader.NextPart()
+	if err != nil {
+		return meta, nil, fmt.Errorf("reading metadata part: %w", err)
+	}
+	if err := json.NewDecoder(part).Decode(&meta); err != nil {
+		return meta, nil, fmt.Errorf("decoding metadata part: %w", err)
+	}
+	part, err = reader.NextPart()
+	if err != nil {
+		return meta, nil, fmt.Errorf("reading media part: %w", err)
+	}
+	data, err := io.ReadAll(part)
+	if err != nil {
+		return meta, nil, err
+	}
+	if meta.ContentType == "" {
+		meta.ContentType = part.Header.Get("Content-Type")
+	}
+	return meta, data, nil
+}
+
+// upload is an unfinished resumable upload
+type upload struct {
+	bucket string
+	meta   objectMetadata
+	pre    preconditions
+	data   []byte
+}
+
+func (s *Server) startResumable(w http.ResponseWriter, r *http.Request, pre preconditions) {
+	var meta objectMetadata
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&meta); err != nil && err != io.EOF {
+			fail(w, http.StatusBadRequest, "decoding upload metadata: "+err.Error())
+			return
+		}
+	}
+	if meta.Name == "" {
+		meta.Name = r.URL.Query().Get("name")
+	}
+
+	s.mu.Lock()
+	s.generation++
+	id := fmt.Sprintf("upload-%d", s.generation)
+	s.uploads[id] = &upload{bucket: r.PathValue("bucket"), meta: meta, pre: pre}
+	s.mu.Unlock()
+
+	w.Header().Set("Location", fmt.Sprintf("%s/upload/storage/v1/b/%s/o?uploadType=resumable&upload_id=%s", s.URL, r.PathValue("bucket"), id))
+	w.WriteHeader(http.StatusOK)
+}
+
+// resumeUpload appends a chunk; Content-Range "bytes a-b/total" with a known
+// total completes the upload, "bytes a-b/*" asks for more. An unfinished
+// upload answers 308, or 200 with X-Http-Status-Code-Override when the client
+// sends X-GUploader-No-308.
+func (s *Server) resumeUpload(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("upload_id")
+	s.mu.Lock()
+	u, ok := s.uploads[id]
+	s.mu.Unlock()
+	if !ok {
+		fail(w, http.StatusNotFound, fmt.Sprintf("no resumable upload %q", id))
+		return
+	}
+
+	chunk, err := io.ReadAll(r.Body)
+	if err != nil {
+		fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	total := -1
+	if contentRange := r.Header.Get("Content-Range"); contentRange != "" {
+		_, size, _ := strings.Cut(contentRange, "/")
+		if size != "*" {
+			total, _ = strconv.Atoi(size)
+		}
+	} else {
+		total = len(u.data) + len(chunk)
+	}
+
+	s.mu.Lock()
+	u.data = append(u.data, chunk...)
+	received := len(u.data)
+	if total < 0 || received < total {
+		s.mu.Unlock()
+		if received > 0 {
+			w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", received-1))
+		}
+		if r.Header.Get("X-GUploader-No-308") == "yes" {
+			w.Header().Set("X-Http-Status-Code-Override", "308")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusPermanentRedirect)
+		return
+	}
+	delete(s.uploads, id)
+	s.mu.Unlock()
+	s.finishUpload(w, u.bucket, u.meta, u.data, u.pre)
+}
@@ -0,0 +1,175 @@
+package inspector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	cloudasset "google.golang.org/api/cloudasset/v1"
+	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// GCP inspects one project through the Compute and Cloud Asset APIs
+type GCP struct {
+	Project string
+	Compute *compute.Service
+	Assets  *cloudasset.Service
+}
+
+var _ Inspector = (*GCP)(nil)
+
+// NewGCP creates the API clients with Application Default Credentials
+// unless opts say otherwise
+func NewGCP(ctx context.Context, project string, opts ...option.ClientOption) (*GCP, error) {
+	computeService, err := compute.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating Compute client: %w", err)
+	}
+	assets, err := cloudasset.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating Cloud Asset client: %w", err)
+	}
+	return &GCP{Project: project, Compute: computeService, Assets: assets}, nil
+}
+
+// Network implements Inspector
+func (g *GCP) Network(ctx context.Context, name string) (*Network, error) {
+	n, err := g.Compute.Networks.Get(g.Project, name).Context(ctx).Do()
+	if err != nil {
+		return nil, lookupError("network", name, err)
+	}
+	return &Network{Name: n.Name, SelfLink: n.SelfLink, AutoCreateSubnetworks: n.AutoCreateSubnetworks}, nil
+}
+
+// Subnetwork implements Inspector
+func (g *GCP) Subnetwork(ctx context.Context, region, name string) (*Subnetwork, error) {
+	s, err := g.Compute.Subnetworks.Get(g.Project, region, name).Context(ctx).Do()
+	if err != nil {
+		return nil, lookupError("subnetwork", region+"/"+name, err)
+	}
+	return &Subnetwork{
+		Name:                  s.Name,
+		Region:                lastSegment(s.Region),
+		Network:               s.Network,
+		IPCIDRRange:           s.IpCidrRange,
+		Purpose:               s.Purpose,
+		PrivateIPGoogleAccess: s.PrivateIpGoogleAccess,
+		FlowLogs:              s.LogConfig != nil && s.LogConfig.Enable,
+	}, nil
+}
+
+// Firewall implements Inspector
+func (g *GCP) Firewall(ctx context.Context, name string) (*Firewall, error) {
+	fw, err := g.Compute.Firewalls.Get(g.Project, name).Context(ctx).Do()
+	if err != nil {
+		return nil, lookupError("firewall rule", name, err)
+	}
+	out := firewall(fw)
+	return &out, nil
+}
+
+// Firewalls implements Inspector
+func (g *GCP) Firewalls(ctx context.Context, network string) ([]Firewall, error) {
+	var out []Firewall
+	err := g.Compute.Firewalls.List(g.Project).Pages(ctx, func(page *compute.FirewallList) error {
+		for _, fw := range page.Items {
+			if rule := firewall(fw); rule.OnNetwork(network) {
+				out = append(out, rule)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing firewall rules: %w", err)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// SecurityPolicy implements Inspector
+func (g *GCP) SecurityPolicy(ctx context.Context, region, name string) (*SecurityPolicy, error) {
+	var (
+		p   *compute.SecurityPolicy
+		err error
+	)
+	if region == "" {
+		p, err = g.Compute.SecurityPolicies.Get(g.Project, name).Context(ctx).Do()
+	} else {
+		p, err = g.Compute.RegionSecurityPolicies.Get(g.Project, region, name).Context(ctx).Do()
+	}
+	if err != nil {
+		return nil, lookupError("security policy", strings.TrimPrefix(region+"/"+name, "/"), err)
+	}
+	out := &SecurityPolicy{Name: p.Name, Region: lastSegment(p.Region), Type: p.Type, Labels: p.Labels}
+	for _, rule := range p.Rules {
+		r := SecurityPolicyRule{Priority: rule.Priority, Action: rule.Action, Preview: rule.Preview}
+		if rule.Match != nil && rule.Match.Expr != nil {
+			r.Expression = rule.Match.Expr.Expression
+		}
+		out.Rules = append(out.Rules, r)
+	}
+	return out, nil
+}
+
+// LabeledResources implements Inspector with a Cloud Asset search, which
+// only sees resources once they are indexed
+func (g *GCP) LabeledResources(ctx context.Context, labels map[string]string) ([]Resource, error) {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	terms := make([]string, len(keys))
+	for i, key := range keys {
+		terms[i] = fmt.Sprintf("labels.%s=%s", key, labels[key])
+	}
+
+	var out []Resource
+	call := g.Assets.V1.SearchAllResources("projects/" + g.Project).Query(strings.Join(terms, " AND "))
+	err := call.Pages(ctx, func(page *cloudasset.SearchAllResourcesResponse) error {
+		for _, r := range page.Results {
+			out = append(out, Resource{Name: r.Name, AssetType: r.AssetType, Location: r.Location, Labels: r.Labels})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("searching resources labeled %s: %w", strings.Join(terms, ", "), err)
+	}
+	return out, nil
+}
+
+func firewall(fw *compute.Firewall) Firewall {
+	out := Firewall{
+		Name:         fw.Name,
+		Network:      fw.Network,
+		Direction:    fw.Direction,
+		Priority:     fw.Priority,
+		Disabled:     fw.Disabled,
+		SourceRanges: fw.SourceRanges,
+	}
+	for _, a := range fw.Allowed {
+		out.Allowed = append(out.Allowed, FirewallRule{Protocol: a.IPProtocol, Ports: a.Ports})
+	}
+	for _, d := range fw.Denied {
+		out.Denied = append(out.Denied, FirewallRule{Protocol: d.IPProtocol, Ports: d.Ports})
+	}
+	return out
+}
+
+// lookupError wraps ErrNotFound for a 404 and describes any other failure
+func lookupError(kind, name string, err error) error {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+		return fmt.Errorf("%s %s: %w", kind, name, ErrNotFound)
+	}
+	return fmt.Errorf("fetching %s %s: %w", kind, name, err)
+}
+
+func lastSegment(link string) string {
+	return link[strings.LastIndex(link, "/")+1:]
+}
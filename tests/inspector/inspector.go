@@ -0,0 +1,145 @@
+// Package inspector reads deployed resources back as typed values, so
+// integration tests assert on fields rather than on gcloud's text output.
+// GCP implements Inspector with the Go API clients; tests can point it at
+// tests/fakecompute, or implement Inspector directly.
+package inspector
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrNotFound is wrapped by every lookup of a resource that does not exist
+var ErrNotFound = errors.New("resource not found")
+
+// Inspector fetches the resources the integration tests check
+type Inspector interface {
+	// Network returns a VPC network by name
+	Network(ctx context.Context, name string) (*Network, error)
+	// Subnetwork returns a subnetwork in a region
+	Subnetwork(ctx context.Context, region, name string) (*Subnetwork, error)
+	// Firewall returns a firewall rule by name
+	Firewall(ctx context.Context, name string) (*Firewall, error)
+	// Firewalls returns every firewall rule attached to the named network
+	Firewalls(ctx context.Context, network string) ([]Firewall, error)
+	// SecurityPolicy returns a Cloud Armor policy; region is empty for a
+	// global policy
+	SecurityPolicy(ctx context.Context, region, name string) (*SecurityPolicy, error)
+	// LabeledResources returns every resource in the project carrying all
+	// of the given labels
+	LabeledResources(ctx context.Context, labels map[string]string) ([]Resource, error)
+}
+
+// Network is a VPC network. Networks carry no labels in the Compute API.
+type Network struct {
+	Name                  string
+	SelfLink              string
+	AutoCreateSubnetworks bool
+}
+
+// Subnetwork is a regional subnet
+type Subnetwork struct {
+	Name                  string
+	Region                string
+	Network               string
+	IPCIDRRange           string
+	Purpose               string
+	PrivateIPGoogleAccess bool
+	// FlowLogs is true when VPC flow logs are enabled
+	FlowLogs bool
+}
+
+// Firewall is a VPC firewall rule
+type Firewall struct {
+	Name         string
+	Network      string
+	Direction    string
+	Priority     int64
+	Disabled     bool
+	SourceRanges []string
+	Allowed      []FirewallRule
+	Denied       []FirewallRule
+}
+
+// FirewallRule is one protocol and its ports; no ports means every port
+type FirewallRule struct {
+	Protocol string
+	Ports    []string
+}
+
+// OnNetwork reports whether the rule is attached to the named network
+func (f Firewall) OnNetwork(network string) bool {
+	return f.Network == network || strings.HasSuffix(f.Network, "/networks/"+network)
+}
+
+// Allows reports whether an enabled rule allows the protocol and port,
+// following "all" protocols, port ranges such as "20-25" and empty port
+// lists
+func (f Firewall) Allows(protocol string, port int) bool {
+	if f.Disabled {
+		return false
+	}
+	for _, rule := range f.Allowed {
+		if rule.Protocol != "all" && rule.Protocol != protocol {
+			continue
+		}
+		if len(rule.Ports) == 0 {
+			return true
+		}
+		for _, ports := range rule.Ports {
+			low, high, isRange := strings.Cut(ports, "-")
+			if !isRange {
+				high = low
+			}
+			from, errLow := strconv.Atoi(low)
+			to, errHigh := strconv.Atoi(high)
+			if errLow == nil && errHigh == nil && from <= port && port <= to {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// OpenToInternet reports whether an ingress rule admits any source address
+func (f Firewall) OpenToInternet() bool {
+	if f.Direction != "" && f.Direction != "INGRESS" {
+		return false
+	}
+	for _, source := range f.SourceRanges {
+		if source == "0.0.0.0/0" || source == "::/0" {
+			return true
+		}
+	}
+	return false
+}
+
+// SecurityPolicy is a Cloud Armor policy
+type SecurityPolicy struct {
+	Name   string
+	Region string
+	Type   string
+	Labels map[string]string
+	Rules  []SecurityPolicyRule
+}
+
+// SecurityPolicyRule is one policy rule; Expression is empty for rules
+// matching source ranges
+type SecurityPolicyRule struct {
+	Priority   int64
+	Action     string
+	Expression string
+	Preview    bool
+}
+
+// Resource is a labeled resource found by search
+type Resource struct {
+	// Name is the full resource name, such as
+	// //compute.googleapis.com/projects/p/regions/r/forwardingRules/n
+	Name      string
+	AssetType string
+	Location  string
+	Labels    map[string]string
+}
@@ -0,0 +1,106 @@
+package inspector
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	cloudasset "google.golang.org/api/cloudasset/v1"
+	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/option"
+
+	"vibetics-cloudedge/tests/fakecompute"
+)
+
+func newGCP(t *testing.T) (*GCP, *fakecompute.Server) {
+	t.Helper()
+	server := fakecompute.NewServer()
+	t.Cleanup(server.Close)
+	require.NoError(t, server.LoadStateFile("../fakecompute/testdata/core.tfstate"))
+	svc, err := server.Service(context.Background())
+	require.NoError(t, err)
+	return &GCP{Project: "test-project", Compute: svc}, server
+}
+
+func TestGCPCompute(t *testing.T) {
+	t.Parallel()
+	g, server := newGCP(t)
+	ctx := context.Background()
+
+	network, err := g.Network(ctx, "ingress-vpc")
+	require.NoError(t, err)
+	assert.False(t, network.AutoCreateSubnetworks)
+	_, err = g.Network(ctx, "default")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	subnet, err := g.Subnetwork(ctx, "us-central1", "ingress-subnet")
+	require.NoError(t, err)
+	assert.Equal(t, "us-central1", subnet.Region)
+	assert.True(t, subnet.PrivateIPGoogleAccess)
+	assert.True(t, subnet.FlowLogs)
+
+	policy, err := g.SecurityPolicy(ctx, "us-central1", "edge-waf-policy")
+	require.NoError(t, err)
+	require.Len(t, policy.Rules, 3)
+	assert.Equal(t, "deny(403)", policy.Rules[0].Action)
+	assert.Equal(t, "evaluatePreconfiguredExpr('sqli-v33-stable')", policy.Rules[0].Expression)
+	_, err = g.SecurityPolicy(ctx, "", "edge-waf-policy")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, server.Put(fakecompute.Path{Project: "test-project", Scope: "global", Collection: "firewalls", Name: "allow-admin"},
+		&compute.Firewall{
+			Network:      fakecompute.SelfLinkBase + "projects/test-project/global/networks/ingress-vpc",
+			Direction:    "INGRESS",
+			Allowed:      []*compute.FirewallAllowed{{IPProtocol: "tcp", Ports: []string{"20-25", "3389"}}},
+			SourceRanges: []string{"0.0.0.0/0"},
+		}))
+	require.NoError(t, server.Put(fakecompute.Path{Project: "test-project", Scope: "global", Collection: "firewalls", Name: "other-network"},
+		&compute.Firewall{Network: "projects/test-project/global/networks/default", Allowed: []*compute.FirewallAllowed{{IPProtocol: "all"}}}))
+
+	rules, err := g.Firewalls(ctx, "ingress-vpc")
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	admin, https := rules[0], rules[1]
+	assert.Equal(t, "allow-admin", admin.Name)
+	assert.True(t, admin.Allows("tcp", 22))
+	assert.True(t, admin.Allows("tcp", 3389))
+	assert.False(t, admin.Allows("tcp", 443))
+	assert.True(t, admin.OpenToInternet())
+	assert.Equal(t, "nonprod-allow-https", https.Name)
+	assert.True(t, https.Allows("tcp", 443))
+	assert.False(t, https.Allows("udp", 443))
+	assert.False(t, https.OpenToInternet())
+
+	other, err := g.Firewall(ctx, "other-network")
+	require.NoError(t, err)
+	assert.True(t, other.Allows("udp", 53), "all protocols and no ports allows everything")
+}
+
+func TestGCPLabeledResources(t *testing.T) {
+	t.Parallel()
+	var query string
+	assets := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query().Get("query")
+		_ = json.NewEncoder(w).Encode(cloudasset.SearchAllResourcesResponse{Results: []*cloudasset.ResourceSearchResult{{
+			Name:      "//run.googleapis.com/projects/test-project/locations/us-central1/services/demo-web-app",
+			AssetType: "run.googleapis.com/Service",
+			Location:  "us-central1",
+			Labels:    map[string]string{"managed-by": "opentofu", "project-suffix": "nonprod"},
+		}}})
+	}))
+	t.Cleanup(assets.Close)
+	svc, err := cloudasset.NewService(context.Background(), option.WithEndpoint(assets.URL), option.WithoutAuthentication())
+	require.NoError(t, err)
+
+	g := &GCP{Project: "test-project", Assets: svc}
+	resources, err := g.LabeledResources(context.Background(), map[string]string{"project-suffix": "nonprod", "managed-by": "opentofu"})
+	require.NoError(t, err)
+	assert.Equal(t, "labels.managed-by=opentofu AND labels.project-suffix=nonprod", query)
+	require.Len(t, resources, 1)
+	assert.Equal(t, "run.googleapis.com/Service", resources[0].AssetType)
+	assert.Equal(t, "opentofu", resources[0].Labels["managed-by"])
+}
@@ -0,0 +1,98 @@
+package gcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+
+	"vibetics-cloudedge/tests/inspector"
+)
+
+// CloudflareIPv4Ranges are the source ranges core allows on the ingress
+// firewall when enable_cloudflare_proxy is true (core.tf locals)
+var CloudflareIPv4Ranges = []string{
+	"173.245.48.0/20",
+	"103.21.244.0/22",
+	"103.22.200.0/22",
+	"103.31.4.0/22",
+	"141.101.64.0/18",
+	"108.162.192.0/18",
+	"190.93.240.0/20",
+	"188.114.96.0/20",
+	"197.234.240.0/22",
+	"198.41.128.0/17",
+	"162.158.0.0/15",
+	"104.16.0.0/13",
+	"104.24.0.0/14",
+	"172.64.0.0/13",
+	"131.0.72.0/22",
+}
+
+// FirewallSourceRestriction fetches an ingress firewall rule and describes
+// every way it departs from the HTTPS restriction core promises: TCP 443
+// allowed, INGRESS, attached to the ingress VPC network, source ranges
+// exactly wantRanges and never 0.0.0.0/0. The error is for failing to fetch
+// the rule.
+func FirewallSourceRestriction(ctx context.Context, insp inspector.Inspector, rule, network string, wantRanges []string) ([]string, error) {
+	fw, err := insp.Firewall(ctx, rule)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	if !fw.Allows("tcp", 443) {
+		problems = append(problems, "does not allow HTTPS (tcp/443)")
+	}
+	if fw.OpenToInternet() {
+		problems = append(problems, "allows unrestricted internet access (0.0.0.0/0)")
+	}
+	if got, want := sorted(fw.SourceRanges), sorted(wantRanges); strings.Join(got, ",") != strings.Join(want, ",") {
+		problems = append(problems, fmt.Sprintf("source ranges are %v, want %v", got, want))
+	}
+	if fw.Direction != "INGRESS" {
+		problems = append(problems, fmt.Sprintf("direction is %q, want INGRESS", fw.Direction))
+	}
+	if !fw.OnNetwork(network) {
+		problems = append(problems, fmt.Sprintf("is on network %q, not the ingress VPC", fw.Network))
+	}
+	return problems, nil
+}
+
+// RegionNEGExists reports whether a regional network endpoint group exists,
+// such as core's demo-web-app-psc-neg
+func RegionNEGExists(ctx context.Context, svc *compute.Service, project, region, name string) (bool, error) {
+	_, err := svc.RegionNetworkEndpointGroups.Get(project, region, name).Context(ctx).Do()
+	return exists(err)
+}
+
+// ServiceAttachmentExists reports whether a PSC service attachment exists,
+// such as demo-web-app's demo-web-app-psc-attachment
+func ServiceAttachmentExists(ctx context.Context, svc *compute.Service, project, region, name string) (bool, error) {
+	_, err := svc.ServiceAttachments.Get(project, region, name).Context(ctx).Do()
+	return exists(err)
+}
+
+// exists turns a Get error into found, not found, or a failed lookup
+func exists(err error) (bool, error) {
+	var apiErr *googleapi.Error
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+func sorted(list []string) []string {
+	out := append([]string(nil), list...)
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,60 @@
+package gcp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	compute "google.golang.org/api/compute/v1"
+
+	"vibetics-cloudedge/tests/fakecompute"
+	"vibetics-cloudedge/tests/inspector"
+)
+
+// TestAssertionsAgainstFake runs the verification helpers against the
+// applied-state inventory in fakecompute/testdata, without a project
+func TestAssertionsAgainstFake(t *testing.T) {
+	t.Parallel()
+	server := fakecompute.NewServer()
+	t.Cleanup(server.Close)
+	require.NoError(t, server.LoadStateFile("../../fakecompute/testdata/core.tfstate"))
+	require.NoError(t, server.LoadStateFile("../../fakecompute/testdata/demo-web-app.tfstate"))
+	ctx := context.Background()
+	svc, err := server.Service(ctx)
+	require.NoError(t, err)
+	insp := &inspector.GCP{Project: "test-project", Compute: svc}
+
+	problems, err := FirewallSourceRestriction(ctx, insp, "nonprod-allow-https", "ingress-vpc", CloudflareIPv4Ranges)
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+
+	problems, err = FirewallSourceRestriction(ctx, insp, "nonprod-allow-https", "ingress-vpc", []string{"203.0.113.0/24"})
+	require.NoError(t, err)
+	assert.Len(t, problems, 1, "only the source ranges differ")
+
+	_, err = FirewallSourceRestriction(ctx, insp, "prod-allow-https", "ingress-vpc", CloudflareIPv4Ranges)
+	assert.ErrorIs(t, err, inspector.ErrNotFound)
+
+	// an open rule on another network breaks every promise but the port
+	require.NoError(t, server.Put(fakecompute.Path{Project: "test-project", Scope: "global", Collection: "firewalls", Name: "open-https"},
+		&compute.Firewall{
+			Network:      "projects/test-project/global/networks/default",
+			Direction:    "INGRESS",
+			Allowed:      []*compute.FirewallAllowed{{IPProtocol: "tcp", Ports: []string{"443"}}},
+			SourceRanges: []string{"0.0.0.0/0"},
+		}))
+	problems, err = FirewallSourceRestriction(ctx, insp, "open-https", "ingress-vpc", CloudflareIPv4Ranges)
+	require.NoError(t, err)
+	assert.Len(t, problems, 3)
+
+	exists, err := RegionNEGExists(ctx, svc, "test-project", "us-central1", "demo-web-app-psc-neg")
+	require.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = ServiceAttachmentExists(ctx, svc, "test-demo-project", "us-central1", "demo-web-app-psc-attachment")
+	require.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = ServiceAttachmentExists(ctx, svc, "test-project", "us-central1", "demo-web-app-psc-attachment")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
@@ -1,40 +1,25 @@
 package gcp
 
 import (
-	"os"
+	"context"
 	"testing"
 
-	"github.com/gruntwork-io/terratest/modules/gcp"
-	"github.com/gruntwork-io/terratest/modules/shell"
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"vibetics-cloudedge/tests/testconfig"
 )
 
 func TestCISCompliance(t *testing.T) {
 	t.Parallel()
 
-	projectID := gcp.GetGoogleProjectIDFromEnvVar(t)
-	region := "northamerica-northeast2"
-	projectSuffix := "nonprod"
-
-	// Require necessary environment variables
-	require.NotEmpty(t, os.Getenv("CLOUDFLARE_API_TOKEN"), "CLOUDFLARE_API_TOKEN must be set")
-	require.NotEmpty(t, os.Getenv("CLOUDFLARE_ZONE_ID"), "CLOUDFLARE_ZONE_ID must be set")
-
-	terraformOptions := &terraform.Options{
-		TerraformDir: "../../../deploy/opentofu/gcp/core",
-		Vars: map[string]interface{}{
-			"project_suffix":              projectSuffix,
-			"cloudedge_github_repository": "vibetics-cloudedge",
-			"cloudedge_project_id":        projectID,
-			"region":                      region,
-			"enable_demo_web_app":         false,
-			"cloudflare_api_token":        os.Getenv("CLOUDFLARE_API_TOKEN"),
-			"cloudflare_zone_id":          os.Getenv("CLOUDFLARE_ZONE_ID"),
-			"billing_account_name":        "Test Billing Account",
-		},
-	}
+	profile := testconfig.Require(t, "core").Unique()
+	projectID := profile.Project
+	region := profile.Region
+	names := profile.MustNames(t)
+
+	terraformOptions := profile.MustOptions(t, "core", nil)
 
 	defer terraform.Destroy(t, terraformOptions)
 
@@ -42,60 +27,42 @@ func TestCISCompliance(t *testing.T) {
 
 	t.Log("Running CIS GCP Foundation Benchmark compliance checks...")
 
-	// CIS 3.9: Ensure that VPC Flow Logs is enabled for every subnet in VPC Network
-	// Note: Private Google Access is enabled, which is part of CIS compliance
-	t.Log("Verifying CIS 3.9: Private Google Access enabled on VPC subnets...")
+	// The plan-time rule pack (tests/compliance, TestCISBenchmarkContract)
+	// covers 3.1 and 3.6-3.10; this test confirms the deployed result.
+	// Private Google Access is hardening the benchmark does not number.
+	t.Log("Verifying Private Google Access enabled on VPC subnets...")
+
+	ctx := context.Background()
+	insp := newInspector(t, projectID)
 
 	// Get ingress VPC subnet details
-	ingressSubnetCmd := shell.Command{
-		Command: "gcloud",
-		Args: []string{
-			"compute", "networks", "subnets", "describe",
-			"ingress-subnet",
-			"--project=" + projectID,
-			"--region=" + region,
-			"--format=value(privateIpGoogleAccess)",
-		},
-	}
-	ingressPGA := shell.RunCommandAndGetOutput(t, ingressSubnetCmd)
-	assert.Contains(t, ingressPGA, "True", "CIS 3.9: Private Google Access must be enabled on ingress subnet")
+	ingressSubnet, err := insp.Subnetwork(ctx, region, names.IngressSubnet)
+	require.NoError(t, err, "Ingress subnet should exist")
+	assert.True(t, ingressSubnet.PrivateIPGoogleAccess, "Private Google Access must be enabled on ingress subnet")
+
+	t.Log("✓ Private Google Access enabled")
 
-	t.Log("✓ CIS 3.9 compliance verified: Private Google Access enabled")
+	// List firewall rules for ingress VPC
+	firewalls, err := insp.Firewalls(ctx, names.IngressVPC)
+	require.NoError(t, err, "Failed to list ingress VPC firewall rules")
 
 	// CIS 3.6: Ensure that SSH access is restricted from the Internet (firewall rules)
 	t.Log("Verifying CIS 3.6: SSH access restricted from Internet...")
 
-	// List firewall rules for ingress VPC
-	firewallListCmd := shell.Command{
-		Command: "gcloud",
-		Args: []string{
-			"compute", "firewall-rules", "list",
-			"--project=" + projectID,
-			"--filter=network:ingress-vpc AND allowed.ports:22",
-			"--format=json",
-		},
-	}
-	firewallOutput := shell.RunCommandAndGetOutput(t, firewallListCmd)
-
 	// Verify no SSH rules allow 0.0.0.0/0 source range
-	assert.NotContains(t, firewallOutput, "\"sourceRanges\": [\"0.0.0.0/0\"]", "CIS 3.6: SSH should not be open to Internet (0.0.0.0/0)")
+	for _, fw := range firewalls {
+		assert.False(t, fw.Allows("tcp", 22) && fw.OpenToInternet(),
+			"CIS 3.6: SSH should not be open to Internet (0.0.0.0/0), but %s allows it", fw.Name)
+	}
 	t.Log("✓ CIS 3.6 compliance verified: SSH access restricted")
 
 	// CIS 3.7: Ensure that RDP access is restricted from the Internet
 	t.Log("Verifying CIS 3.7: RDP access restricted from Internet...")
 
-	rdpFirewallCmd := shell.Command{
-		Command: "gcloud",
-		Args: []string{
-			"compute", "firewall-rules", "list",
-			"--project=" + projectID,
-			"--filter=network:ingress-vpc AND allowed.ports:3389",
-			"--format=json",
-		},
+	for _, fw := range firewalls {
+		assert.False(t, fw.Allows("tcp", 3389) && fw.OpenToInternet(),
+			"CIS 3.7: RDP should not be open to Internet (0.0.0.0/0), but %s allows it", fw.Name)
 	}
-	rdpOutput := shell.RunCommandAndGetOutput(t, rdpFirewallCmd)
-
-	assert.NotContains(t, rdpOutput, "\"sourceRanges\": [\"0.0.0.0/0\"]", "CIS 3.7: RDP should not be open to Internet (0.0.0.0/0)")
 	t.Log("✓ CIS 3.7 compliance verified: RDP access restricted")
 
 	// Summary
@@ -104,8 +71,8 @@ func TestCISCompliance(t *testing.T) {
 	t.Log("========================================")
 	t.Log("✓ CIS 3.6: SSH access restricted")
 	t.Log("✓ CIS 3.7: RDP access restricted")
-	t.Log("✓ CIS 3.9: Private Google Access enabled")
+	t.Log("✓ Private Google Access enabled")
 	t.Log("========================================")
-	t.Log("CIS Compliance: PASSED (3/3 controls)")
+	t.Log("CIS Compliance: PASSED (2/2 controls)")
 	t.Log("========================================")
 }
@@ -1,38 +1,24 @@
 package gcp
 
 import (
-	"os"
 	"testing"
 
-	"github.com/gruntwork-io/terratest/modules/gcp"
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/require"
+
+	"vibetics-cloudedge/tests/testconfig"
 )
 
 func TestDemoWebApp(t *testing.T) {
 	t.Parallel()
 
-	projectID := gcp.GetGoogleProjectIDFromEnvVar(t)
-	region := "northamerica-northeast2"
-
-	// Require necessary environment variables
-	require.NotEmpty(t, projectID, "GCP Project ID must be set")
-
-	terraformOptions := &terraform.Options{
-		TerraformDir: "../../../deploy/opentofu/gcp/demo-web-app",
-		Vars: map[string]interface{}{
-			"project_suffix":                   "nonprod",
-			"cloudedge_github_repository":      "vibetics-cloudedge",
-			"cloudedge_project_id":             projectID,
-			"demo_web_app_project_id":          projectID,
-			"region":                           region,
-			"enable_demo_web_app":              true,
-			"demo_web_app_image":               "us-docker.pkg.dev/cloudrun/container/hello",
-			"enable_demo_web_app_psc_neg":      false,
-			"enable_demo_web_app_internal_alb": true,
-		},
-	}
+	profile := testconfig.Require(t, "demo-web-app").Unique()
+
+	terraformOptions := profile.MustOptions(t, "demo-web-app", map[string]interface{}{
+		"demo_web_app_image":               "us-docker.pkg.dev/cloudrun/container/hello",
+		"enable_demo_web_app_psc_neg":      false,
+		"enable_demo_web_app_internal_alb": true,
+	})
 
 	defer terraform.Destroy(t, terraformOptions)
 
@@ -0,0 +1,21 @@
+package gcp
+
+import (
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/gcp"
+
+	"vibetics-cloudedge/tests/steps"
+)
+
+// TestFeatures runs the @integration scenarios of the module feature files
+// against the deployed infrastructure. Steps the shared library does not bind
+// yet are reported as undefined instead of failing the run.
+func TestFeatures(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+	gcp.GetGoogleProjectIDFromEnvVar(t)
+
+	steps.Run(t, steps.Integration, steps.Features...)
+}
@@ -1,47 +1,35 @@
 package gcp
 
 import (
+	"context"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
-	"time"
 
-	"github.com/gruntwork-io/terratest/modules/gcp"
-	"github.com/gruntwork-io/terratest/modules/shell"
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	compute "google.golang.org/api/compute/v1"
+
+	"vibetics-cloudedge/tests/stack"
+	"vibetics-cloudedge/tests/testconfig"
 )
 
 func TestFullBaseline(t *testing.T) {
 	t.Parallel()
 
-	projectID := gcp.GetGoogleProjectIDFromEnvVar(t)
-	region := "northamerica-northeast2"
-	projectSuffix := "nonprod"
-
-	// Require necessary environment variables
-	require.NotEmpty(t, os.Getenv("CLOUDFLARE_API_TOKEN"), "CLOUDFLARE_API_TOKEN must be set")
-	require.NotEmpty(t, os.Getenv("CLOUDFLARE_ZONE_ID"), "CLOUDFLARE_ZONE_ID must be set")
-
-	// Configure core infrastructure
-	coreOptions := &terraform.Options{
-		TerraformDir: "../../../deploy/opentofu/gcp/core",
-		Vars: map[string]interface{}{
-			"project_suffix":              projectSuffix,
-			"cloudedge_github_repository": "vibetics-cloudedge",
-			"cloudedge_project_id":        projectID,
-			"region":                      region,
-			"enable_demo_web_app":         true,
-			"enable_waf":                  true,
-			"enable_cloudflare_proxy":     false, // Test without Cloudflare proxy
-			"enable_demo_web_app_psc_neg": false, // Test direct backend connection
-			"cloudflare_api_token":        os.Getenv("CLOUDFLARE_API_TOKEN"),
-			"cloudflare_zone_id":          os.Getenv("CLOUDFLARE_ZONE_ID"),
-			"billing_account_name":        "Test Billing Account",
-			"allowed_https_source_ranges": []string{"0.0.0.0/0"}, // Allow all for testing
-		},
-	}
+	profile := testconfig.Require(t, "core").Unique()
+	projectID := profile.Project
+	names := profile.MustNames(t)
+
+	coreOptions := profile.MustOptions(t, "core", map[string]interface{}{
+		"enable_demo_web_app":         true,
+		"enable_waf":                  true,
+		"enable_cloudflare_proxy":     false,                 // Test without Cloudflare proxy
+		"enable_demo_web_app_psc_neg": false,                 // Test direct backend connection
+		"allowed_https_source_ranges": []string{"0.0.0.0/0"}, // Allow all for testing
+	})
 
 	defer terraform.Destroy(t, coreOptions)
 
@@ -80,18 +68,14 @@ func TestFullBaseline(t *testing.T) {
 	assert.Equal(t, "true", cloudArmorEnabled, "Cloud Armor should be enabled")
 
 	// Verify firewall rules
-	firewallCmd := shell.Command{
-		Command: "gcloud",
-		Args: []string{
-			"compute", "firewall-rules", "list",
-			"--project=" + projectID,
-			"--filter=network:ingress-vpc",
-			"--format=value(name)",
-		},
+	firewalls, err := newInspector(t, projectID).Firewalls(context.Background(), names.IngressVPC)
+	require.NoError(t, err, "Failed to list ingress VPC firewall rules")
+	assert.NotEmpty(t, firewalls, "Firewall rules should exist")
+	var firewallNames []string
+	for _, fw := range firewalls {
+		firewallNames = append(firewallNames, fw.Name)
 	}
-	firewallOutput := shell.RunCommandAndGetOutput(t, firewallCmd)
-	assert.NotEmpty(t, firewallOutput, "Firewall rules should exist")
-	assert.Contains(t, firewallOutput, "allow-https", "HTTPS firewall rule should exist")
+	assert.Contains(t, firewallNames, names.HTTPSFirewall, "HTTPS firewall rule should exist")
 	t.Log("✓ Firewall rules provisioned")
 
 	t.Log("========================================")
@@ -116,16 +100,40 @@ func TestFullBaseline(t *testing.T) {
 	t.Log("========================================")
 }
 
-// TestFullBaselineWithDemo tests the complete stack including demo web app
+// TestFullBaselineWithDemo deploys project-singleton, demo-web-app and core
+// as one stack and checks the PSC path between them. Set
+// CLOUDEDGE_RESUME_FROM to a stage name (e.g. apply_core) to resume a run
+// whose earlier stages already applied.
 func TestFullBaselineWithDemo(t *testing.T) {
-	t.Skip("Skipping full demo test - requires sequential deployment of core then demo-web-app modules")
-
-	// This test would require:
-	// 1. Deploy core module with enable_demo_web_app=true
-	// 2. Deploy demo-web-app module
-	// 3. Test connectivity through load balancer
-	// 4. Teardown in reverse order
+	t.Parallel()
 
-	// For now, users should test core and demo-web-app modules separately
-	// using the individual test files (demo_web_app_test.go, etc.)
+	profile := testconfig.Require(t)
+	s, err := stack.ForProfile(profile, map[string]map[string]interface{}{
+		"core": {"enable_demo_web_app": true, "enable_waf": true},
+	})
+	require.NoError(t, err)
+	require.NoError(t, s.UseBackend(nil))
+	s.DataDir = filepath.Join(os.TempDir(), "cloudedge-stack-"+profile.Project)
+	s.ResumeFrom = os.Getenv("CLOUDEDGE_RESUME_FROM")
+	names := profile.MustNames(t)
+	t.Logf("Deploying %s", strings.Join(s.Order(), " → "))
+
+	s.Run(t, func(s *stack.Stack) {
+		coreOptions := s.Stage("core").Options
+		demoOptions := s.Stage("demo-web-app").Options
+
+		assert.NotEmpty(t, terraform.Output(t, coreOptions, "load_balancer_ip"), "Load balancer IP should be provisioned")
+		assert.Equal(t, "true", terraform.Output(t, coreOptions, "psc_enabled"))
+		assert.Equal(t, "true", terraform.Output(t, demoOptions, "psc_enabled"))
+
+		ctx := context.Background()
+		svc, err := compute.NewService(ctx)
+		require.NoError(t, err, "Failed to create Compute API client")
+		exists, err := RegionNEGExists(ctx, svc, profile.Project, profile.Region, names.PSCNEG)
+		require.NoError(t, err)
+		assert.True(t, exists, "core should connect to demo-web-app through the PSC NEG")
+		exists, err = ServiceAttachmentExists(ctx, svc, profile.DemoProject, profile.Region, names.DemoPSCAttachment)
+		require.NoError(t, err)
+		assert.True(t, exists, "demo-web-app should publish the PSC service attachment")
+	})
 }
@@ -1,49 +1,35 @@
 package gcp
 
 import (
-	"os"
-	"strings"
+	"context"
 	"testing"
 
-	"github.com/gruntwork-io/terratest/modules/gcp"
-	"github.com/gruntwork-io/terratest/modules/shell"
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"vibetics-cloudedge/tests/testconfig"
 )
 
 // TestMandatoryResourceTagging verifies mandatory tags on all deployed resources (FR-007)
 func TestMandatoryResourceTagging(t *testing.T) {
 	t.Parallel()
 
-	projectID := gcp.GetGoogleProjectIDFromEnvVar(t)
-	region := "northamerica-northeast2"
-	projectSuffix := "nonprod"
-
-	// Require necessary environment variables
-	require.NotEmpty(t, os.Getenv("CLOUDFLARE_API_TOKEN"), "CLOUDFLARE_API_TOKEN must be set")
-	require.NotEmpty(t, os.Getenv("CLOUDFLARE_ZONE_ID"), "CLOUDFLARE_ZONE_ID must be set")
-
-	terraformOptions := &terraform.Options{
-		TerraformDir: "../../../deploy/opentofu/gcp/core",
-		Vars: map[string]interface{}{
-			"project_suffix":              projectSuffix,
-			"cloudedge_github_repository": "vibetics-cloudedge",
-			"cloudedge_project_id":        projectID,
-			"region":                      region,
-			"enable_demo_web_app":         false,
-			"enable_waf":                  true,
-			"cloudflare_api_token":        os.Getenv("CLOUDFLARE_API_TOKEN"),
-			"cloudflare_zone_id":          os.Getenv("CLOUDFLARE_ZONE_ID"),
-			"billing_account_name":        "Test Billing Account",
-			"resource_tags": map[string]interface{}{
-				"project-suffix": projectSuffix,
-				"managed-by":     "opentofu",
-				"team":           "infrastructure",
-				"cost-center":    "engineering",
-			},
+	profile := testconfig.Require(t, "core").Unique()
+	projectID := profile.Project
+	region := profile.Region
+	projectSuffix := profile.ProjectSuffix
+	names := profile.MustNames(t)
+
+	terraformOptions := profile.MustOptions(t, "core", map[string]interface{}{
+		"enable_waf": true,
+		"resource_tags": map[string]interface{}{
+			"project-suffix": projectSuffix,
+			"managed-by":     "opentofu",
+			"team":           "infrastructure",
+			"cost-center":    "engineering",
 		},
-	}
+	})
 
 	defer terraform.Destroy(t, terraformOptions)
 
@@ -58,77 +44,50 @@ func TestMandatoryResourceTagging(t *testing.T) {
 		"project",
 	}
 
-	// Test VPC Networks
-	t.Log("Checking VPC network tags...")
-	ingressVPCCmd := shell.Command{
-		Command: "gcloud",
-		Args: []string{
-			"compute", "networks", "describe",
-			"ingress-vpc",
-			"--project=" + projectID,
-			"--format=json(labels)",
-		},
-	}
-	ingressVPCOutput := shell.RunCommandAndGetOutput(t, ingressVPCCmd)
-	assert.NotEmpty(t, ingressVPCOutput, "Ingress VPC should exist")
+	ctx := context.Background()
+	insp := newInspector(t, projectID)
 
-	for _, tag := range mandatoryTags {
-		assert.Contains(t, ingressVPCOutput, "\""+tag+"\"", "VPC must have mandatory tag: "+tag)
-	}
-	assert.Contains(t, ingressVPCOutput, "\"managed-by\": \"opentofu\"", "managed-by tag should be 'opentofu'")
-	assert.Contains(t, ingressVPCOutput, "\"project-suffix\": \""+projectSuffix+"\"", "project-suffix tag should match")
+	// VPC networks carry no labels in the Compute API, so the network is only
+	// checked for existence; labels are checked on every labeled resource below
+	t.Log("Checking VPC network...")
+	_, err := insp.Network(ctx, names.IngressVPC)
+	require.NoError(t, err, "Ingress VPC should exist")
 
-	t.Log("✓ VPC tagging verified")
+	t.Log("✓ VPC verified")
 
 	// Test WAF Policy (Cloud Armor)
 	t.Log("Checking WAF policy tags...")
-	wafPolicyCmd := shell.Command{
-		Command: "gcloud",
-		Args: []string{
-			"compute", "security-policies", "describe",
-			"edge-waf-policy",
-			"--project=" + projectID,
-			"--region=" + region,
-			"--format=json(labels)",
-		},
-	}
-	wafOutput := shell.RunCommandAndGetOutput(t, wafPolicyCmd)
+	wafPolicy, err := insp.SecurityPolicy(ctx, region, names.WAFPolicy)
+	require.NoError(t, err, "WAF policy should exist when enable_waf=true")
 
 	// WAF policy labels (regional security policies may have limited label support)
-	if strings.Contains(wafOutput, "labels") {
+	if len(wafPolicy.Labels) > 0 {
 		for _, tag := range mandatoryTags {
-			assert.Contains(t, wafOutput, "\""+tag+"\"", "WAF policy should have tag: "+tag)
+			assert.Contains(t, wafPolicy.Labels, tag, "WAF policy should have tag: "+tag)
 		}
 		t.Log("✓ WAF policy tagging verified")
 	} else {
 		t.Log("⚠ Warning: Regional security policies may not support labels")
 	}
 
-	// Test custom user-provided tags
-	t.Log("Checking user-provided custom tags...")
-	assert.Contains(t, ingressVPCOutput, "\"team\": \"infrastructure\"", "Custom tag 'team' should be present")
-	assert.Contains(t, ingressVPCOutput, "\"cost-center\": \"engineering\"", "Custom tag 'cost-center' should exist")
-
-	t.Log("✓ Custom user tags verified")
-
-	// List all tagged resources
+	// Every resource of this run must carry the mandatory tags and the
+	// user-provided custom tags. project-suffix would also match parallel
+	// runs, which deploy without the custom tags; name-prefix is this run's.
 	t.Log("Checking tagging coverage across all resources...")
-	resourcesCmd := shell.Command{
-		Command: "gcloud",
-		Args: []string{
-			"asset", "search-all-resources",
-			"--project=" + projectID,
-			"--filter=labels.project-suffix=" + projectSuffix,
-			"--format=value(name)",
-		},
-	}
-	resourcesList := shell.RunCommandAndGetOutput(t, resourcesCmd)
-
-	if resourcesList != "" {
-		resourceCount := len(strings.Split(strings.TrimSpace(resourcesList), "\n"))
-		if resourceCount > 0 {
-			t.Logf("✓ Found %d resources with project-suffix tag", resourceCount)
+	resources, err := insp.LabeledResources(ctx, map[string]string{"name-prefix": profile.NamePrefix})
+	require.NoError(t, err, "Failed to search labeled resources")
+
+	if len(resources) > 0 {
+		for _, resource := range resources {
+			for _, tag := range mandatoryTags {
+				assert.Contains(t, resource.Labels, tag, "%s must have mandatory tag: %s", resource.Name, tag)
+			}
+			assert.Equal(t, "opentofu", resource.Labels["managed-by"], "%s: managed-by tag should be 'opentofu'", resource.Name)
+			assert.Equal(t, "infrastructure", resource.Labels["team"], "%s: custom tag 'team' should be present", resource.Name)
+			assert.Equal(t, "engineering", resource.Labels["cost-center"], "%s: custom tag 'cost-center' should exist", resource.Name)
 		}
+		t.Logf("✓ Found %d resources with name-prefix tag %s", len(resources), profile.NamePrefix)
+		t.Log("✓ Custom user tags verified")
 	} else {
 		t.Log("⚠ Warning: Asset API may not be enabled or resources not yet indexed")
 	}
@@ -137,7 +96,7 @@ func TestMandatoryResourceTagging(t *testing.T) {
 	t.Log("========================================")
 	t.Log("Mandatory Resource Tagging Results")
 	t.Log("========================================")
-	t.Log("✓ VPCs: All mandatory tags present")
+	t.Log("✓ Labeled resources: All mandatory tags present")
 	t.Log("✓ WAF Policy: Validated (if labels supported)")
 	t.Log("✓ Custom Tags: User-provided tags applied")
 	t.Log("========================================")
@@ -1,42 +1,27 @@
 package gcp
 
 import (
-	"os"
-	"strings"
+	"context"
+	"errors"
 	"testing"
 
-	"github.com/gruntwork-io/terratest/modules/gcp"
-	"github.com/gruntwork-io/terratest/modules/shell"
 	"github.com/gruntwork-io/terratest/modules/terraform"
-	"github.com/stretchr/testify/require"
+
+	"vibetics-cloudedge/tests/inspector"
+	"vibetics-cloudedge/tests/testconfig"
 )
 
 func TestTeardown(t *testing.T) {
 	t.Parallel()
 
-	projectID := gcp.GetGoogleProjectIDFromEnvVar(t)
-	region := "northamerica-northeast2"
-	projectSuffix := "nonprod"
-
-	// Require necessary environment variables
-	require.NotEmpty(t, os.Getenv("CLOUDFLARE_API_TOKEN"), "CLOUDFLARE_API_TOKEN must be set")
-	require.NotEmpty(t, os.Getenv("CLOUDFLARE_ZONE_ID"), "CLOUDFLARE_ZONE_ID must be set")
-
-	terraformOptions := &terraform.Options{
-		TerraformDir: "../../../deploy/opentofu/gcp/core",
-		Vars: map[string]interface{}{
-			"project_suffix":              projectSuffix,
-			"cloudedge_github_repository": "vibetics-cloudedge",
-			"cloudedge_project_id":        projectID,
-			"region":                      region,
-			"enable_demo_web_app":         false,
-			"enable_waf":                  true,
-			"enable_logging":              false, // Fast teardown for testing
-			"cloudflare_api_token":        os.Getenv("CLOUDFLARE_API_TOKEN"),
-			"cloudflare_zone_id":          os.Getenv("CLOUDFLARE_ZONE_ID"),
-			"billing_account_name":        "Test Billing Account",
-		},
-	}
+	profile := testconfig.Require(t, "core").Unique()
+	projectID := profile.Project
+	names := profile.MustNames(t)
+
+	terraformOptions := profile.MustOptions(t, "core", map[string]interface{}{
+		"enable_waf":     true,
+		"enable_logging": false, // Fast teardown for testing
+	})
 
 	// Deploy infrastructure
 	t.Log("Deploying infrastructure for teardown test...")
@@ -45,34 +30,18 @@ func TestTeardown(t *testing.T) {
 	// Verify key resources exist before teardown
 	t.Log("Verifying resources exist before teardown...")
 
+	ctx := context.Background()
+	insp := newInspector(t, projectID)
+	firewallRuleName := names.HTTPSFirewall
+
 	// Check ingress VPC exists
-	ingressVPCCmd := shell.Command{
-		Command: "gcloud",
-		Args: []string{
-			"compute", "networks", "describe",
-			"ingress-vpc",
-			"--project=" + projectID,
-			"--format=value(name)",
-		},
-	}
-	ingressVPCOutput := shell.RunCommandAndGetOutput(t, ingressVPCCmd)
-	if !strings.Contains(ingressVPCOutput, "ingress-vpc") {
-		t.Fatal("Ingress VPC not found after deployment")
+	if _, err := insp.Network(ctx, names.IngressVPC); err != nil {
+		t.Fatalf("Ingress VPC not found after deployment: %v", err)
 	}
 
 	// Check firewall rule exists
-	firewallCmd := shell.Command{
-		Command: "gcloud",
-		Args: []string{
-			"compute", "firewall-rules", "describe",
-			projectSuffix + "-allow-https",
-			"--project=" + projectID,
-			"--format=value(name)",
-		},
-	}
-	firewallOutput := shell.RunCommandAndGetOutput(t, firewallCmd)
-	if !strings.Contains(firewallOutput, "allow-https") {
-		t.Fatal("Firewall rule not found after deployment")
+	if _, err := insp.Firewall(ctx, firewallRuleName); err != nil {
+		t.Fatalf("Firewall rule not found after deployment: %v", err)
 	}
 
 	t.Log("✓ Resources verified before teardown")
@@ -90,41 +59,27 @@ func TestTeardown(t *testing.T) {
 		t.Logf("WARNING: Terraform state not empty after destroy. Remaining resources: %s", stateList)
 	}
 
-	// Verify ingress VPC is deleted
-	ingressVPCCheckCmd := shell.Command{
-		Command: "gcloud",
-		Args: []string{
-			"compute", "networks", "describe",
-			"ingress-vpc",
-			"--project=" + projectID,
-			"--format=value(name)",
-		},
-	}
-
-	// Use RunCommandE which will fail if VPC doesn't exist
-	err := shell.RunCommandE(t, ingressVPCCheckCmd)
-	if err == nil {
+	// Verify ingress VPC is deleted; any error other than not found means
+	// the check itself failed, not that the VPC is gone
+	_, err := insp.Network(ctx, names.IngressVPC)
+	switch {
+	case err == nil:
 		t.Error("Ingress VPC still exists after teardown")
-	} else {
+	case errors.Is(err, inspector.ErrNotFound):
 		t.Log("✓ Ingress VPC successfully deleted (resource not found as expected)")
+	default:
+		t.Errorf("Could not check the ingress VPC after teardown: %v", err)
 	}
 
 	// Verify firewall rule is deleted
-	firewallCheckCmd := shell.Command{
-		Command: "gcloud",
-		Args: []string{
-			"compute", "firewall-rules", "describe",
-			projectSuffix + "-allow-https",
-			"--project=" + projectID,
-			"--format=value(name)",
-		},
-	}
-
-	err = shell.RunCommandE(t, firewallCheckCmd)
-	if err == nil {
+	_, err = insp.Firewall(ctx, firewallRuleName)
+	switch {
+	case err == nil:
 		t.Error("Firewall rule still exists after teardown")
-	} else {
+	case errors.Is(err, inspector.ErrNotFound):
 		t.Log("✓ Firewall rule successfully deleted (resource not found as expected)")
+	default:
+		t.Errorf("Could not check the firewall rule after teardown: %v", err)
 	}
 
 	t.Log("✓ Teardown completed successfully - all resources destroyed")
@@ -136,29 +91,12 @@ func TestTeardownWithLogging(t *testing.T) {
 
 	t.Parallel()
 
-	projectID := gcp.GetGoogleProjectIDFromEnvVar(t)
-	region := "northamerica-northeast2"
-	projectSuffix := "nonprod"
-
-	// Require necessary environment variables
-	require.NotEmpty(t, os.Getenv("CLOUDFLARE_API_TOKEN"), "CLOUDFLARE_API_TOKEN must be set")
-	require.NotEmpty(t, os.Getenv("CLOUDFLARE_ZONE_ID"), "CLOUDFLARE_ZONE_ID must be set")
-
-	terraformOptions := &terraform.Options{
-		TerraformDir: "../../../deploy/opentofu/gcp/core",
-		Vars: map[string]interface{}{
-			"project_suffix":              projectSuffix,
-			"cloudedge_github_repository": "vibetics-cloudedge",
-			"cloudedge_project_id":        projectID,
-			"region":                      region,
-			"enable_demo_web_app":         false,
-			"enable_waf":                  true,
-			"enable_logging":              true, // Test with logging enabled
-			"cloudflare_api_token":        os.Getenv("CLOUDFLARE_API_TOKEN"),
-			"cloudflare_zone_id":          os.Getenv("CLOUDFLARE_ZONE_ID"),
-			"billing_account_name":        "Test Billing Account",
-		},
-	}
+	profile := testconfig.Require(t, "core").Unique()
+
+	terraformOptions := profile.MustOptions(t, "core", map[string]interface{}{
+		"enable_waf":     true,
+		"enable_logging": true, // Test with logging enabled
+	})
 
 	// Deploy infrastructure
 	t.Log("Deploying infrastructure with logging enabled...")
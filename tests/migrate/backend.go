@@ -0,0 +1,70 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// BackendConfig is the bucket/prefix pair of a partial gcs backend config
+type BackendConfig struct {
+	Bucket string
+	Prefix string
+}
+
+// ReadBackendConfig parses a backend-config.hcl file. Both keys must be string
+// literals; prefix may be empty.
+func ReadBackendConfig(path string) (BackendConfig, error) {
+	file, diags := hclparse.NewParser().ParseHCLFile(path)
+	if diags.HasErrors() {
+		return BackendConfig{}, diags
+	}
+	attrs, diags := file.Body.JustAttributes()
+	if diags.HasErrors() {
+		return BackendConfig{}, diags
+	}
+
+	values := map[string]string{}
+	for _, key := range []string{"bucket", "prefix"} {
+		attr, ok := attrs[key]
+		if !ok {
+			return BackendConfig{}, fmt.Errorf("%s: missing %q", path, key)
+		}
+		value, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			return BackendConfig{}, diags
+		}
+		if value.Type() != cty.String || value.IsNull() {
+			return BackendConfig{}, fmt.Errorf("%s: %s is %s, expected a string", path, key, value.Type().FriendlyName())
+		}
+		values[key] = value.AsString()
+	}
+	if values["bucket"] == "" {
+		return BackendConfig{}, fmt.Errorf("%s: bucket is empty", path)
+	}
+	return BackendConfig{Bucket: values["bucket"], Prefix: values["prefix"]}, nil
+}
+
+// SetBackendPrefix rewrites the prefix attribute of a backend config file,
+// keeping every other attribute, comment and the file mode
+func SetBackendPrefix(path, prefix string) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	file, diags := hclwrite.ParseConfig(src, path, hcl.InitialPos)
+	if diags.HasErrors() {
+		return fmt.Errorf("parsing %s: %s", path, diags.Error())
+	}
+	file.Body().SetAttributeValue("prefix", cty.StringVal(strings.Trim(prefix, "/")))
+	return os.WriteFile(path, file.Bytes(), info.Mode().Perm())
+}
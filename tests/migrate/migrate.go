@@ -0,0 +1,317 @@
+// Package migrate relocates the OpenTofu configuration from the repository root
+// into its cloud-provider directory (deploy/opentofu/gcp), as described in
+// features/directory_migration.feature:
+//
+//  1. refuse to start while another operation holds the state lock
+//  2. back up the current state as state-backup-<timestamp>.tfstate
+//  3. delete .terraform/ provider and module caches
+//  4. move root *.tf files, backend-config.hcl and modules/ into the target
+//  5. copy .terraform.lock.hcl so both locations pin the same providers
+//  6. rewrite relative module sources that would otherwise dangle
+//  7. point the backend prefix at the new location
+//  8. push the backup to the state object under the new prefix and check
+//     its lineage and serial, restoring the old backend config on failure
+//
+// Every change is planned before anything is touched, so a dry run reports
+// exactly what a real run would do.
+package migrate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	// DefaultTarget is where the configuration lives after migration
+	DefaultTarget = "deploy/opentofu/gcp"
+	// BackendConfigFile holds the partial GCS backend configuration
+	BackendConfigFile = "backend-config.hcl"
+	// LockFile pins provider versions and stays in the root as well
+	LockFile = ".terraform.lock.hcl"
+	// ModulesDir holds local child modules
+	ModulesDir = "modules"
+
+	backupTimeFormat = "20060102150405"
+)
+
+// Options configures a migration run
+type Options struct {
+	// Root is the repository root holding the configuration to move
+	Root string
+	// Target is the destination relative to Root; DefaultTarget when empty
+	Target string
+	// State is checked for locks and backed up before anything moves; nil
+	// skips both
+	State StateSource
+	// Destination receives the backed-up state at the new backend prefix. It
+	// is required with State when backend-config.hcl moves, so the prefix is
+	// never rewritten to a location holding no state.
+	Destination StateStore
+	// LockTimeout is how long to wait for a held state lock to be released
+	// before giving up; zero fails on the first check
+	LockTimeout time.Duration
+	// DryRun plans the migration and reads the state without writing anything
+	DryRun bool
+	// Now stamps the backup file; time.Now when nil
+	Now func() time.Time
+}
+
+// Result records what the migration did (or, for a dry run, would do), with
+// slash-separated paths relative to Root
+type Result struct {
+	DryRun  bool
+	Backup  string
+	Deleted []string
+	Moved   []Move
+	Copied  []Move
+	// Rewrites lists module sources changed so they resolve from the new location
+	Rewrites []SourceRewrite
+	// BackendPrefix is the prefix written to the relocated backend-config.hcl
+	BackendPrefix string
+	// PushedTo is the state object the backup was pushed to
+	PushedTo string
+}
+
+// Move is one relocated (or copied) path
+type Move struct {
+	From string
+	To   string
+}
+
+// Run plans the migration and, unless opts.DryRun is set, carries it out
+func Run(opts Options) (*Result, error) {
+	if opts.Target == "" {
+		opts.Target = DefaultTarget
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	root, err := filepath.Abs(opts.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := plan(root, filepath.ToSlash(filepath.Clean(opts.Target)))
+	if err != nil {
+		return nil, err
+	}
+	result.DryRun = opts.DryRun
+
+	var state []byte
+	if opts.State != nil && result.BackendPrefix != "" {
+		if opts.Destination == nil {
+			return nil, fmt.Errorf("no destination for the state at prefix %q; refusing to rewrite the backend prefix", result.BackendPrefix)
+		}
+		result.PushedTo = opts.Destination.Location()
+	}
+	if opts.State != nil {
+		if err := waitForUnlock(opts.State, opts.LockTimeout); err != nil {
+			return nil, err
+		}
+		if state, err = pullState(opts.State); err != nil {
+			return nil, err
+		}
+		result.Backup = fmt.Sprintf("state-backup-%s.tfstate", opts.Now().Format(backupTimeFormat))
+	}
+	if opts.DryRun {
+		return result, nil
+	}
+	return result, apply(root, result, state, opts.Destination)
+}
+
+// plan works out every change without touching the filesystem
+func plan(root, target string) (*Result, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{}
+	for _, entry := range entries {
+		name := entry.Name()
+		switch {
+		case entry.IsDir() && name == ModulesDir,
+			!entry.IsDir() && (filepath.Ext(name) == ".tf" || name == BackendConfigFile):
+			result.Moved = append(result.Moved, Move{From: name, To: target + "/" + name})
+		case !entry.IsDir() && name == LockFile:
+			result.Copied = append(result.Copied, Move{From: name, To: target + "/" + name})
+		}
+	}
+	if len(result.Moved) == 0 {
+		return nil, fmt.Errorf("no OpenTofu configuration found in %s", root)
+	}
+	for _, m := range append(append([]Move{}, result.Moved...), result.Copied...) {
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(m.To))); err == nil {
+			return nil, fmt.Errorf("%s already exists; refusing to overwrite", m.To)
+		}
+	}
+
+	if result.Deleted, err = findCaches(root); err != nil {
+		return nil, err
+	}
+	if result.Rewrites, err = planRewrites(root, result.Moved); err != nil {
+		return nil, err
+	}
+	for _, m := range result.Moved {
+		if m.From == BackendConfigFile {
+			result.BackendPrefix = target
+		}
+	}
+	return result, nil
+}
+
+// apply carries out a planned migration
+func apply(root string, result *Result, state []byte, destination StateStore) error {
+	abs := func(rel string) string { return filepath.Join(root, filepath.FromSlash(rel)) }
+
+	if result.Backup != "" {
+		if err := os.WriteFile(abs(result.Backup), state, 0o600); err != nil {
+			return err
+		}
+	}
+	for _, dir := range result.Deleted {
+		if err := os.RemoveAll(abs(dir)); err != nil {
+			return err
+		}
+	}
+	for _, m := range result.Moved {
+		if err := os.MkdirAll(filepath.Dir(abs(m.To)), 0o755); err != nil {
+			return err
+		}
+		if err := os.Rename(abs(m.From), abs(m.To)); err != nil {
+			return fmt.Errorf("moving %s: %w", m.From, err)
+		}
+	}
+	for _, c := range result.Copied {
+		if err := copyFile(abs(c.From), abs(c.To)); err != nil {
+			return fmt.Errorf("copying %s: %w", c.From, err)
+		}
+	}
+	for _, r := range result.Rewrites {
+		if err := setModuleSource(abs(r.File), r.Module, r.To); err != nil {
+			return err
+		}
+	}
+	for _, m := range result.Moved {
+		if m.From != BackendConfigFile {
+			continue
+		}
+		config := abs(m.To)
+		original, err := os.ReadFile(config)
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(config)
+		if err != nil {
+			return err
+		}
+		if err := SetBackendPrefix(config, result.BackendPrefix); err != nil {
+			return err
+		}
+		if result.PushedTo == "" {
+			continue
+		}
+		if err := pushState(destination, state); err != nil {
+			if restoreErr := os.WriteFile(config, original, info.Mode().Perm()); restoreErr != nil {
+				return fmt.Errorf("%w; restoring %s: %v", err, m.To, restoreErr)
+			}
+			return fmt.Errorf("%w; %s keeps its old prefix and the backup is in %s", err, m.To, result.Backup)
+		}
+	}
+	return nil
+}
+
+// pushState writes the backup to the destination and reads it back to check
+// it is the same state
+func pushState(destination StateStore, state []byte) error {
+	if err := destination.Push(state); err != nil {
+		return fmt.Errorf("pushing state to %s: %w", destination.Location(), err)
+	}
+	pushed, err := destination.Pull()
+	if err != nil {
+		return fmt.Errorf("reading back %s: %w", destination.Location(), err)
+	}
+	want, err := stateVersion(state)
+	if err != nil {
+		return err
+	}
+	got, err := stateVersion(pushed)
+	if err != nil {
+		return fmt.Errorf("%s: %w", destination.Location(), err)
+	}
+	if got != want {
+		return fmt.Errorf("%s has lineage %s serial %d, want lineage %s serial %d",
+			destination.Location(), got.Lineage, got.Serial, want.Lineage, want.Serial)
+	}
+	return nil
+}
+
+// version identifies a state document
+type version struct {
+	Lineage string
+	Serial  int
+}
+
+// stateVersion reads the lineage and serial of a state document
+func stateVersion(data []byte) (version, error) {
+	var doc struct {
+		Lineage string `json:"lineage"`
+		Serial  *int   `json:"serial"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return version{}, fmt.Errorf("state is not JSON: %w", err)
+	}
+	if doc.Lineage == "" || doc.Serial == nil {
+		return version{}, fmt.Errorf("state has no lineage/serial")
+	}
+	return version{doc.Lineage, *doc.Serial}, nil
+}
+
+// pullState fetches the state and checks it is a state document worth backing up
+func pullState(state StateSource) ([]byte, error) {
+	data, err := state.Pull()
+	if err != nil {
+		return nil, fmt.Errorf("pulling state: %w", err)
+	}
+	if _, err := stateVersion(data); err != nil {
+		return nil, fmt.Errorf("pulled %w; refusing to migrate without a usable backup", err)
+	}
+	return data, nil
+}
+
+// findCaches lists every .terraform directory below root
+func findCaches(root string) ([]string, error) {
+	var caches []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if d.IsDir() && d.Name() == ".terraform" {
+			rel, _ := filepath.Rel(root, path)
+			caches = append(caches, filepath.ToSlash(rel))
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	sort.Strings(caches)
+	return caches, err
+}
+
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, info.Mode().Perm())
+}
@@ -0,0 +1,305 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+
+	"vibetics-cloudedge/tests/fakegcs"
+)
+
+// fakeState serves a fixed state document; the lock, if set, is released
+// after unlockAfter checks (never when zero)
+type fakeState struct {
+	data        []byte
+	err         error
+	lock        *LockInfo
+	unlockAfter int
+	checks      int
+}
+
+func (s *fakeState) Pull() ([]byte, error) { return s.data, s.err }
+
+func (s *fakeState) Lock() (*LockInfo, error) {
+	s.checks++
+	if s.unlockAfter > 0 && s.checks >= s.unlockAfter {
+		s.lock = nil
+	}
+	return s.lock, nil
+}
+
+// fakeStore is a destination that keeps what is pushed; pushErr fails the
+// push and pushed, when set, replaces the document stored
+type fakeStore struct {
+	fakeState
+	pushErr error
+	pushed  []byte
+}
+
+func (s *fakeStore) Push(data []byte) error {
+	if s.pushErr != nil {
+		return s.pushErr
+	}
+	if s.pushed != nil {
+		data = s.pushed
+	}
+	s.data = data
+	return nil
+}
+
+func (s *fakeStore) Location() string { return "gs://b/deploy/opentofu/gcp/default.tfstate" }
+
+const testState = `{"version":4,"serial":3,"lineage":"abc","resources":[]}`
+
+func seed(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+	return root
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	root := seed(t, map[string]string{
+		"main.tf":                      "# main\n",
+		"backend.tf":                   "terraform {\n  backend \"gcs\" {}\n}\n",
+		"backend-config.hcl":           "# state bucket\nbucket = \"b\"\nprefix = \"\"\n",
+		".terraform.lock.hcl":          "# lock\n",
+		".gitignore":                   ".terraform/\n",
+		"modules/gcp/waf/main.tf":      "# waf\n",
+		".terraform/providers/x":       "",
+		"modules/gcp/waf/.terraform/x": "",
+		"docs/README.md":               "docs\n",
+	})
+	require.NoError(t, os.Chmod(filepath.Join(root, BackendConfigFile), 0o644))
+	now := time.Date(2025, 11, 25, 12, 30, 45, 0, time.UTC)
+
+	destination := &fakeStore{}
+	result, err := Run(Options{
+		Root:        root,
+		State:       &fakeState{data: []byte(testState)},
+		Destination: destination,
+		Now:         func() time.Time { return now },
+	})
+	require.NoError(t, err)
+	assert.Equal(t, destination.Location(), result.PushedTo)
+	assert.Equal(t, testState, string(destination.data))
+
+	assert.Equal(t, "state-backup-20251125123045.tfstate", result.Backup)
+	assert.FileExists(t, filepath.Join(root, result.Backup))
+	assert.Equal(t, []string{".terraform", "modules/gcp/waf/.terraform"}, result.Deleted)
+	assert.NoDirExists(t, filepath.Join(root, ".terraform"))
+
+	for _, name := range []string{"main.tf", "backend.tf", "backend-config.hcl", ".terraform.lock.hcl", "modules/gcp/waf/main.tf"} {
+		assert.FileExists(t, filepath.Join(root, DefaultTarget, name))
+	}
+	assert.NoFileExists(t, filepath.Join(root, "main.tf"))
+	assert.NoDirExists(t, filepath.Join(root, "modules"))
+	assert.FileExists(t, filepath.Join(root, ".terraform.lock.hcl"))
+	assert.FileExists(t, filepath.Join(root, ".gitignore"))
+	assert.FileExists(t, filepath.Join(root, "docs/README.md"))
+
+	config, err := os.ReadFile(filepath.Join(root, DefaultTarget, BackendConfigFile))
+	require.NoError(t, err)
+	assert.Equal(t, "# state bucket\nbucket = \"b\"\nprefix = \"deploy/opentofu/gcp\"\n", string(config))
+	assert.Equal(t, DefaultTarget, result.BackendPrefix)
+	info, err := os.Stat(filepath.Join(root, DefaultTarget, BackendConfigFile))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o644), info.Mode().Perm())
+}
+
+func TestRunPushesStateBeforeKeepingThePrefix(t *testing.T) {
+	t.Parallel()
+
+	files := map[string]string{"main.tf": "", "backend-config.hcl": "bucket = \"b\"\nprefix = \"\"\n"}
+	state := &fakeState{data: []byte(testState)}
+
+	// without a destination the prefix would point at an empty state
+	root := seed(t, files)
+	_, err := Run(Options{Root: root, State: state})
+	assert.ErrorContains(t, err, "refusing to rewrite the backend prefix")
+	assert.FileExists(t, filepath.Join(root, "main.tf"))
+
+	for name, destination := range map[string]*fakeStore{
+		"push fails":       {pushErr: errors.New("precondition failed")},
+		"lineage mismatch": {pushed: []byte(`{"version":4,"serial":3,"lineage":"other"}`)},
+		"serial mismatch":  {pushed: []byte(`{"version":4,"serial":2,"lineage":"abc"}`)},
+	} {
+		root := seed(t, files)
+		result, err := Run(Options{Root: root, State: state, Destination: destination})
+		require.Error(t, err, name)
+		assert.Contains(t, err.Error(), "keeps its old prefix", name)
+
+		config, err := os.ReadFile(filepath.Join(root, DefaultTarget, BackendConfigFile))
+		require.NoError(t, err)
+		assert.Equal(t, files[BackendConfigFile], string(config), name)
+		assert.FileExists(t, filepath.Join(root, result.Backup), name)
+	}
+}
+
+func TestGCSStatePush(t *testing.T) {
+	t.Parallel()
+
+	server := fakegcs.NewServer()
+	t.Cleanup(server.Close)
+	client, err := storage.NewClient(context.Background(), option.WithEndpoint(server.Endpoint()), option.WithoutAuthentication())
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	require.NoError(t, server.CreateBucket("b"))
+
+	state := &GCSState{Client: client, Bucket: "b", Prefix: DefaultTarget}
+	assert.Equal(t, "gs://b/deploy/opentofu/gcp/default.tfstate", state.Location())
+	require.NoError(t, state.Push([]byte(testState)))
+	pulled, err := state.Pull()
+	require.NoError(t, err)
+	assert.Equal(t, testState, string(pulled))
+	lock, err := state.Lock()
+	require.NoError(t, err)
+	assert.Nil(t, lock, "the push releases its lock")
+
+	// an existing state is never replaced
+	assert.ErrorContains(t, state.Push([]byte(testState)), "writing gs://b/deploy/opentofu/gcp/default.tfstate")
+
+	// nor is a held lock taken over
+	server.PutObject("b", DefaultTarget+"/default.tflock", []byte(`{"ID":"1"}`))
+	assert.ErrorContains(t, state.Push([]byte(testState)), "locking gs://b/deploy/opentofu/gcp/default.tflock")
+	_, held := server.ReadObject("b", DefaultTarget+"/default.tflock")
+	assert.True(t, held)
+}
+
+func TestRunRequiresUsableBackup(t *testing.T) {
+	t.Parallel()
+
+	for name, state := range map[string]StateSource{
+		"pull fails": &fakeState{err: errors.New("403")},
+		"no lineage": &fakeState{data: []byte(`{"version":4,"serial":1}`)},
+	} {
+		root := seed(t, map[string]string{"main.tf": "", ".terraform/x": ""})
+		_, err := Run(Options{Root: root, State: state})
+		assert.Error(t, err, name)
+
+		// nothing moved or deleted when the backup cannot be taken
+		assert.FileExists(t, filepath.Join(root, "main.tf"), name)
+		assert.DirExists(t, filepath.Join(root, ".terraform"), name)
+	}
+}
+
+func TestRunRefusesToOverwrite(t *testing.T) {
+	t.Parallel()
+
+	root := seed(t, map[string]string{"main.tf": "new", DefaultTarget + "/main.tf": "old"})
+	_, err := Run(Options{Root: root})
+	assert.ErrorContains(t, err, "deploy/opentofu/gcp/main.tf already exists")
+}
+
+func TestRunDryRun(t *testing.T) {
+	t.Parallel()
+
+	root := seed(t, map[string]string{
+		"main.tf":             "",
+		"backend-config.hcl":  "bucket = \"b\"\nprefix = \"\"\n",
+		".terraform.lock.hcl": "",
+		".terraform/x":        "",
+	})
+	destination := &fakeStore{}
+	result, err := Run(Options{Root: root, State: &fakeState{data: []byte(testState)}, Destination: destination, DryRun: true})
+	require.NoError(t, err)
+
+	assert.True(t, result.DryRun)
+	assert.Equal(t, destination.Location(), result.PushedTo)
+	assert.Nil(t, destination.data, "a dry run pushes nothing")
+	assert.Equal(t, []Move{
+		{From: "backend-config.hcl", To: "deploy/opentofu/gcp/backend-config.hcl"},
+		{From: "main.tf", To: "deploy/opentofu/gcp/main.tf"},
+	}, result.Moved)
+	assert.Equal(t, []Move{{From: ".terraform.lock.hcl", To: "deploy/opentofu/gcp/.terraform.lock.hcl"}}, result.Copied)
+	assert.Equal(t, []string{".terraform"}, result.Deleted)
+	assert.NotEmpty(t, result.Backup)
+
+	assert.NoFileExists(t, filepath.Join(root, result.Backup))
+	assert.DirExists(t, filepath.Join(root, ".terraform"))
+	assert.NoDirExists(t, filepath.Join(root, "deploy"))
+	config, err := os.ReadFile(filepath.Join(root, BackendConfigFile))
+	require.NoError(t, err)
+	assert.Contains(t, string(config), `prefix = ""`)
+}
+
+func TestRunRewritesModuleSources(t *testing.T) {
+	t.Parallel()
+
+	root := seed(t, map[string]string{
+		"main.tf": `module "waf" {
+  source = "./modules/gcp/waf"
+}
+
+module "labels" {
+  # shared with other stacks, stays in the root
+  source = "./shared/labels"
+}
+
+module "registry" {
+  source = "terraform-google-modules/network/google"
+}
+`,
+		"modules/gcp/waf/main.tf": `module "rules" {
+  source = "../rules"
+}
+
+module "naming" {
+  source = "../../../shared/naming"
+}
+`,
+		"shared/labels/main.tf": "",
+	})
+	result, err := Run(Options{Root: root})
+	require.NoError(t, err)
+
+	assert.Equal(t, []SourceRewrite{
+		{File: "deploy/opentofu/gcp/main.tf", Module: "labels", From: "./shared/labels", To: "../../../shared/labels"},
+		{File: "deploy/opentofu/gcp/modules/gcp/waf/main.tf", Module: "naming", From: "../../../shared/naming", To: "../../../../../../shared/naming"},
+	}, result.Rewrites)
+
+	main, err := os.ReadFile(filepath.Join(root, DefaultTarget, "main.tf"))
+	require.NoError(t, err)
+	assert.Contains(t, string(main), `source = "./modules/gcp/waf"`)
+	assert.Contains(t, string(main), "  # shared with other stacks, stays in the root\n  source = \"../../../shared/labels\"")
+	assert.Contains(t, string(main), `source = "terraform-google-modules/network/google"`)
+
+	waf, err := os.ReadFile(filepath.Join(root, DefaultTarget, "modules/gcp/waf/main.tf"))
+	require.NoError(t, err)
+	assert.Contains(t, string(waf), `source = "../rules"`)
+}
+
+func TestRunRefusesLockedState(t *testing.T) {
+	t.Parallel()
+
+	lock := &LockInfo{ID: "1700000000000000", Operation: "OperationTypeApply", Who: "ci@runner"}
+	root := seed(t, map[string]string{"main.tf": ""})
+
+	state := &fakeState{data: []byte(testState), lock: lock}
+	_, err := Run(Options{Root: root, State: state, LockTimeout: 30 * time.Millisecond})
+	var locked *LockedError
+	require.ErrorAs(t, err, &locked)
+	assert.Equal(t, "ci@runner", locked.Lock.Who)
+	assert.Contains(t, err.Error(), "state is locked by ci@runner (operation OperationTypeApply")
+	assert.FileExists(t, filepath.Join(root, "main.tf"))
+
+	// a lock released within the timeout only delays the run
+	state = &fakeState{data: []byte(testState), lock: lock, unlockAfter: 2}
+	_, err = Run(Options{Root: root, State: state, LockTimeout: time.Minute})
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(root, DefaultTarget, "main.tf"))
+}
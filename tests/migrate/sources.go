@@ -0,0 +1,150 @@
+package migrate
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// SourceRewrite is a module source changed so it still resolves after the move
+type SourceRewrite struct {
+	// File is the relocated file holding the module block
+	File   string
+	Module string
+	From   string
+	To     string
+}
+
+// planRewrites finds every local module source ("./" or "../") in the moved
+// files and recomputes it from the file's new directory. Sources pointing into
+// a moved tree follow it; sources pointing elsewhere keep their target.
+func planRewrites(root string, moves []Move) ([]SourceRewrite, error) {
+	var rewrites []SourceRewrite
+	for _, m := range moves {
+		err := filepath.WalkDir(filepath.Join(root, filepath.FromSlash(m.From)), func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() && d.Name() == ".terraform" {
+				// deleted before the move; downloaded modules are not ours to rewrite
+				return filepath.SkipDir
+			}
+			if d.IsDir() || filepath.Ext(p) != ".tf" {
+				return nil
+			}
+			rel, _ := filepath.Rel(root, p)
+			from := filepath.ToSlash(rel)
+			to := relocate(from, moves)
+
+			sources, err := moduleSources(p)
+			if err != nil {
+				return err
+			}
+			for _, s := range sources {
+				newSource := rebase(s.source, path.Dir(from), path.Dir(to), moves)
+				if newSource != s.source {
+					rewrites = append(rewrites, SourceRewrite{File: to, Module: s.module, From: s.source, To: newSource})
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rewrites, nil
+}
+
+type moduleSource struct {
+	module string
+	source string
+}
+
+// moduleSources returns the literal local sources of the module blocks in a file
+func moduleSources(filename string) ([]moduleSource, error) {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	file, diags := hclsyntax.ParseConfig(src, filename, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	var sources []moduleSource
+	for _, block := range file.Body.(*hclsyntax.Body).Blocks {
+		if block.Type != "module" || len(block.Labels) != 1 {
+			continue
+		}
+		attr, ok := block.Body.Attributes["source"]
+		if !ok {
+			continue
+		}
+		value, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() || value.Type() != cty.String || value.IsNull() {
+			continue
+		}
+		if s := value.AsString(); strings.HasPrefix(s, "./") || strings.HasPrefix(s, "../") {
+			sources = append(sources, moduleSource{module: block.Labels[0], source: s})
+		}
+	}
+	return sources, nil
+}
+
+// relocate maps a root-relative path to where it lives after the moves
+func relocate(p string, moves []Move) string {
+	for _, m := range moves {
+		if p == m.From {
+			return m.To
+		}
+		if strings.HasPrefix(p, m.From+"/") {
+			return m.To + strings.TrimPrefix(p, m.From)
+		}
+	}
+	return p
+}
+
+// rebase recomputes a local source written in oldDir so that, written in
+// newDir, it names the (possibly relocated) same directory
+func rebase(source, oldDir, newDir string, moves []Move) string {
+	target := relocate(path.Join(oldDir, source), moves)
+	rel, err := filepath.Rel(filepath.FromSlash(newDir), filepath.FromSlash(target))
+	if err != nil {
+		return source
+	}
+	rel = filepath.ToSlash(rel)
+	if !strings.HasPrefix(rel, "../") {
+		rel = "./" + rel
+	}
+	return rel
+}
+
+// setModuleSource rewrites the source of one module block in place
+func setModuleSource(filename, module, source string) error {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	file, diags := hclwrite.ParseConfig(src, filename, hcl.InitialPos)
+	if diags.HasErrors() {
+		return fmt.Errorf("parsing %s: %s", filename, diags.Error())
+	}
+	block := file.Body().FirstMatchingBlock("module", []string{module})
+	if block == nil {
+		return fmt.Errorf("%s: module %q not found", filename, module)
+	}
+	block.Body().SetAttributeValue("source", cty.StringVal(source))
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, file.Bytes(), info.Mode().Perm())
+}
@@ -0,0 +1,176 @@
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// StateSource gives the migration access to the current state
+type StateSource interface {
+	// Pull returns the current state document, like `tofu state pull`
+	Pull() ([]byte, error)
+	// Lock returns the lock currently held on the state, or nil when unlocked
+	Lock() (*LockInfo, error)
+}
+
+// StateStore is a backend location the migration writes the backed-up state to
+type StateStore interface {
+	StateSource
+	// Push writes the state document while holding the location's lock. It
+	// refuses to replace a state that is already there.
+	Push(data []byte) error
+	// Location names the state object, for reports
+	Location() string
+}
+
+// LockInfo is the lock record OpenTofu writes while an operation holds the state
+type LockInfo struct {
+	ID        string    `json:"ID"`
+	Operation string    `json:"Operation"`
+	Info      string    `json:"Info"`
+	Who       string    `json:"Who"`
+	Version   string    `json:"Version"`
+	Created   time.Time `json:"Created"`
+	Path      string    `json:"Path"`
+}
+
+// LockedError is returned when the state stays locked past the lock timeout
+type LockedError struct {
+	Lock    LockInfo
+	Waited  time.Duration
+	Timeout time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("state is locked by %s (operation %s, lock ID %s, since %s); gave up after %s",
+		e.Lock.Who, e.Lock.Operation, e.Lock.ID, e.Lock.Created.Format(time.RFC3339), e.Waited.Round(time.Millisecond))
+}
+
+// lockPollInterval is how often a held lock is re-checked
+var lockPollInterval = time.Second
+
+// waitForUnlock polls the state lock until it is released or timeout passes
+func waitForUnlock(state StateSource, timeout time.Duration) error {
+	start := time.Now()
+	for {
+		lock, err := state.Lock()
+		if err != nil {
+			return fmt.Errorf("checking state lock: %w", err)
+		}
+		if lock == nil {
+			return nil
+		}
+		waited := time.Since(start)
+		if waited >= timeout {
+			return &LockedError{Lock: *lock, Waited: waited, Timeout: timeout}
+		}
+		time.Sleep(min(lockPollInterval, timeout-waited))
+	}
+}
+
+// GCSState reads state straight from the bucket the gcs backend writes to:
+// <prefix>/<workspace>.tfstate, locked by <prefix>/<workspace>.tflock
+type GCSState struct {
+	Client *storage.Client
+	Bucket string
+	Prefix string
+	// Workspace defaults to "default"
+	Workspace string
+}
+
+// Pull downloads the state object
+func (s *GCSState) Pull() ([]byte, error) {
+	data, err := s.read(".tfstate")
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, fmt.Errorf("no state at gs://%s/%s", s.Bucket, s.object(".tfstate"))
+	}
+	return data, err
+}
+
+// Lock reads the lock object, if any
+func (s *GCSState) Lock() (*LockInfo, error) {
+	data, err := s.read(".tflock")
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var lock LockInfo
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("gs://%s/%s: %w", s.Bucket, s.object(".tflock"), err)
+	}
+	return &lock, nil
+}
+
+// Push writes the state object under a lock of its own, as `tofu state push`
+// does. Both objects are created only if they do not exist, so a held lock
+// or a state already at the prefix makes it fail.
+func (s *GCSState) Push(data []byte) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	lock, err := json.Marshal(LockInfo{
+		ID:        fmt.Sprint(time.Now().UnixNano()),
+		Operation: "OperationTypeMigrate",
+		Who:       "cloudedge migrate",
+		Created:   time.Now().UTC(),
+		Path:      s.Location(),
+	})
+	if err != nil {
+		return err
+	}
+	lockObject := s.Client.Bucket(s.Bucket).Object(s.object(".tflock"))
+	if err := s.create(ctx, lockObject, lock); err != nil {
+		return fmt.Errorf("locking gs://%s/%s: %w", s.Bucket, s.object(".tflock"), err)
+	}
+	defer func() {
+		if unlockErr := lockObject.Delete(ctx); unlockErr != nil && err == nil {
+			err = fmt.Errorf("unlocking gs://%s/%s: %w", s.Bucket, s.object(".tflock"), unlockErr)
+		}
+	}()
+	if err := s.create(ctx, s.Client.Bucket(s.Bucket).Object(s.object(".tfstate")), data); err != nil {
+		return fmt.Errorf("writing %s: %w", s.Location(), err)
+	}
+	return nil
+}
+
+// Location is the gs:// URL of the state object
+func (s *GCSState) Location() string {
+	return fmt.Sprintf("gs://%s/%s", s.Bucket, s.object(".tfstate"))
+}
+
+// create writes a new object, failing when one already exists
+func (s *GCSState) create(ctx context.Context, object *storage.ObjectHandle, data []byte) error {
+	w := object.If(storage.Conditions{DoesNotExist: true}).NewWriter(ctx)
+	if _, err := w.Write(data); err != nil {
+		_ = w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (s *GCSState) read(ext string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	r, err := s.Client.Bucket(s.Bucket).Object(s.object(ext)).NewReader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func (s *GCSState) object(ext string) string {
+	workspace := s.Workspace
+	if workspace == "" {
+		workspace = "default"
+	}
+	return path.Join(s.Prefix, workspace+ext)
+}
@@ -0,0 +1,145 @@
+package modcontract
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ContractVersion is the contract file format this package understands
+const ContractVersion = 1
+
+// Contract is the versioned interface a module promises its callers
+type Contract struct {
+	Version   int                     `yaml:"version"`
+	Module    string                  `yaml:"module"`
+	Variables map[string]VariableSpec `yaml:"variables"`
+	Outputs   map[string]OutputSpec   `yaml:"outputs"`
+
+	path string
+}
+
+// VariableSpec is the contract for one input variable
+type VariableSpec struct {
+	Type string `yaml:"type"`
+	// Required variables have no default; Default is ignored for them
+	Required    bool         `yaml:"required"`
+	Default     interface{}  `yaml:"default"`
+	Sensitive   bool         `yaml:"sensitive"`
+	Validations []Validation `yaml:"validations"`
+}
+
+// LoadContract reads a contract file
+func LoadContract(path string) (*Contract, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Contract
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if c.Version != ContractVersion {
+		return nil, fmt.Errorf("%s: contract version %d is not supported (want %d)", path, c.Version, ContractVersion)
+	}
+	c.path = path
+	return &c, nil
+}
+
+// CheckVariables compares the module's variables with the contract and returns
+// one message per discrepancy, sorted; an empty result means they agree
+func (c *Contract) CheckVariables(m *Module) []string {
+	var problems []string
+	report := func(name, format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf("variable %q: ", name)+fmt.Sprintf(format, args...))
+	}
+
+	for name, spec := range c.Variables {
+		actual, ok := m.Variables[name]
+		if !ok {
+			report(name, "in contract but not declared in %s", m.Dir)
+			continue
+		}
+
+		wantType, err := normalizeType(spec.Type)
+		if err != nil {
+			report(name, "contract: %v", err)
+		} else if actual.Type != wantType {
+			report(name, "type is %s, contract expects %s", actual.Type, wantType)
+		}
+
+		switch {
+		case spec.Required && actual.HasDefault:
+			report(name, "has default %s, contract expects it to be required", render(actual.Default))
+		case !spec.Required && !actual.HasDefault:
+			report(name, "is required, contract expects default %s", render(spec.Default))
+		case !spec.Required:
+			want, err := asJSON(spec.Default)
+			if err != nil {
+				report(name, "contract default: %v", err)
+			} else if !reflect.DeepEqual(actual.Default, want) {
+				report(name, "default is %s, contract expects %s", render(actual.Default), render(want))
+			}
+		}
+
+		if actual.Sensitive != spec.Sensitive {
+			report(name, "sensitive is %t, contract expects %t", actual.Sensitive, spec.Sensitive)
+		}
+
+		problems = append(problems, checkValidations(name, actual.Validations, spec.Validations)...)
+	}
+
+	for name := range m.Variables {
+		if _, ok := c.Variables[name]; !ok {
+			report(name, "declared in %s but missing from contract %s", m.Dir, c.path)
+		}
+	}
+
+	sort.Strings(problems)
+	return problems
+}
+
+func checkValidations(name string, actual, want []Validation) []string {
+	var problems []string
+	if len(actual) != len(want) {
+		problems = append(problems, fmt.Sprintf("variable %q: has %d validation block(s), contract expects %d",
+			name, len(actual), len(want)))
+	}
+	for i := 0; i < len(actual) && i < len(want); i++ {
+		wantCondition := collapseSpace(want[i].Condition)
+		if actual[i].Condition != wantCondition {
+			problems = append(problems, fmt.Sprintf("variable %q: validation %d condition is %q, contract expects %q",
+				name, i, actual[i].Condition, wantCondition))
+		}
+		if actual[i].ErrorMessage != want[i].ErrorMessage {
+			problems = append(problems, fmt.Sprintf("variable %q: validation %d error_message is %q, contract expects %q",
+				name, i, actual[i].ErrorMessage, want[i].ErrorMessage))
+		}
+	}
+	return problems
+}
+
+// asJSON converts a YAML-decoded value into the shape encoding/json produces
+func asJSON(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func render(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
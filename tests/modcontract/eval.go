@@ -0,0 +1,274 @@
+package modcontract
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/tryfunc"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// functions is the subset of the tofu function library that variable
+// validations and plain locals use; expressions calling anything else fail to
+// evaluate rather than being guessed at
+var functions = map[string]function.Function{
+	"can":        tryfunc.CanFunc,
+	"coalesce":   stdlib.CoalesceFunc,
+	"concat":     stdlib.ConcatFunc,
+	"contains":   stdlib.ContainsFunc,
+	"distinct":   stdlib.DistinctFunc,
+	"format":     stdlib.FormatFunc,
+	"join":       stdlib.JoinFunc,
+	"keys":       stdlib.KeysFunc,
+	"length":     stdlib.LengthFunc,
+	"lookup":     stdlib.LookupFunc,
+	"lower":      stdlib.LowerFunc,
+	"merge":      stdlib.MergeFunc,
+	"regex":      stdlib.RegexFunc,
+	"regexall":   stdlib.RegexAllFunc,
+	"replace":    stdlib.ReplaceFunc,
+	"split":      stdlib.SplitFunc,
+	"substr":     stdlib.SubstrFunc,
+	"trimprefix": stdlib.TrimPrefixFunc,
+	"trimsuffix": stdlib.TrimSuffixFunc,
+	"try":        tryfunc.TryFunc,
+	"upper":      stdlib.UpperFunc,
+	"values":     stdlib.ValuesFunc,
+}
+
+// Validate checks value against the variable's validation blocks, the way
+// `tofu validate` does for a -var argument, and returns the error message of
+// every failing condition. The value is converted to the declared type first.
+func (v Variable) Validate(value interface{}) ([]string, error) {
+	val, err := toCty(value, v.ty)
+	if err != nil {
+		return nil, fmt.Errorf("variable %q: %w", v.Name, err)
+	}
+	ctx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{"var": cty.ObjectVal(map[string]cty.Value{v.Name: val})},
+		Functions: functions,
+	}
+
+	var failures []string
+	for i, validation := range v.Validations {
+		if validation.expr == nil {
+			return nil, fmt.Errorf("variable %q: validation %d was not parsed from a module", v.Name, i)
+		}
+		result, diags := validation.expr.Value(ctx)
+		if diags.HasErrors() {
+			// tofu reports a condition that cannot be evaluated as invalid too
+			failures = append(failures, diags.Error())
+			continue
+		}
+		result, err := convert.Convert(result, cty.Bool)
+		if err != nil || result.IsNull() || !result.IsKnown() {
+			return nil, fmt.Errorf("variable %q: validation %d condition is not a bool", v.Name, i)
+		}
+		if result.False() {
+			failures = append(failures, validation.ErrorMessage)
+		}
+	}
+	return failures, nil
+}
+
+// Local evaluates the named local value with the given variables, falling back
+// to the declared defaults. Only locals built from variables, other locals and
+// the functions above can be evaluated; anything reading resources or data
+// sources returns an error.
+func (m *Module) Local(name string, vars map[string]interface{}) (interface{}, error) {
+	varValues := map[string]cty.Value{}
+	for varName, v := range m.Variables {
+		value, set := vars[varName]
+		if !set {
+			if !v.HasDefault {
+				varValues[varName] = cty.UnknownVal(v.ty)
+				continue
+			}
+			value = v.Default
+		}
+		val, err := toCty(value, v.ty)
+		if err != nil {
+			return nil, fmt.Errorf("variable %q: %w", varName, err)
+		}
+		varValues[varName] = val
+	}
+
+	e := &localEvaluator{module: m, vars: cty.ObjectVal(varValues), done: map[string]cty.Value{}}
+	val, err := e.eval(name, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !val.IsWhollyKnown() {
+		return nil, fmt.Errorf("local.%s depends on a required variable that was not set", name)
+	}
+	return fromCty(val)
+}
+
+// EnvVars returns the variables the named locals read, taken from TF_VAR_*
+// entries of environ (as os.Environ gives them). Each value is parsed the way
+// tofu parses the environment: literally for string, number and bool
+// variables, as an HCL expression for every other type. Variables the locals
+// do not read are ignored, so a malformed unrelated TF_VAR_ cannot fail them.
+func (m *Module) EnvVars(environ []string, locals ...string) (map[string]interface{}, error) {
+	names := map[string]bool{}
+	for _, local := range locals {
+		if err := m.localVariables(local, names, nil); err != nil {
+			return nil, err
+		}
+	}
+	vars := map[string]interface{}{}
+	for _, kv := range environ {
+		key, raw, ok := strings.Cut(kv, "=")
+		name, isVar := strings.CutPrefix(key, "TF_VAR_")
+		if !ok || !isVar || !names[name] {
+			continue
+		}
+		v, declared := m.Variables[name]
+		if !declared {
+			continue
+		}
+		value, err := v.envValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		vars[name] = value
+	}
+	return vars, nil
+}
+
+// localVariables adds the variables local name reads, directly or through
+// other locals, to names
+func (m *Module) localVariables(name string, names map[string]bool, stack []string) error {
+	for _, seen := range stack {
+		if seen == name {
+			return fmt.Errorf("local.%s refers to itself (%s)", name, strings.Join(append(stack, name), " -> "))
+		}
+	}
+	expr, ok := m.locals[name]
+	if !ok {
+		return fmt.Errorf("%s declares no local %q", m.Dir, name)
+	}
+	for _, traversal := range expr.Variables() {
+		if len(traversal) < 2 {
+			continue
+		}
+		attr, ok := traversal[1].(hcl.TraverseAttr)
+		if !ok {
+			continue
+		}
+		switch traversal.RootName() {
+		case "var":
+			names[attr.Name] = true
+		case "local":
+			if err := m.localVariables(attr.Name, names, append(stack, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// envValue parses a TF_VAR_ value for the variable
+func (v Variable) envValue(raw string) (interface{}, error) {
+	if v.ty.IsPrimitiveType() {
+		return raw, nil
+	}
+	expr, diags := hclsyntax.ParseExpression([]byte(raw), "TF_VAR_"+v.Name, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("variable %q: %s", v.Name, diags.Error())
+	}
+	val, diags := expr.Value(nil)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("variable %q: %s", v.Name, diags.Error())
+	}
+	val, err := convert.Convert(val, v.ty)
+	if err != nil {
+		return nil, fmt.Errorf("variable %q: %w", v.Name, err)
+	}
+	return fromCty(val)
+}
+
+type localEvaluator struct {
+	module *Module
+	vars   cty.Value
+	done   map[string]cty.Value
+}
+
+func (e *localEvaluator) eval(name string, stack []string) (cty.Value, error) {
+	if val, ok := e.done[name]; ok {
+		return val, nil
+	}
+	for _, seen := range stack {
+		if seen == name {
+			return cty.NilVal, fmt.Errorf("local.%s refers to itself (%s)", name, strings.Join(append(stack, name), " -> "))
+		}
+	}
+	expr, ok := e.module.locals[name]
+	if !ok {
+		return cty.NilVal, fmt.Errorf("%s declares no local %q", e.module.Dir, name)
+	}
+
+	locals := map[string]cty.Value{}
+	for _, traversal := range expr.Variables() {
+		switch traversal.RootName() {
+		case "var":
+		case "local":
+			attr, ok := traversal[1].(hcl.TraverseAttr)
+			if !ok {
+				continue
+			}
+			val, err := e.eval(attr.Name, append(stack, name))
+			if err != nil {
+				return cty.NilVal, err
+			}
+			locals[attr.Name] = val
+		default:
+			return cty.NilVal, fmt.Errorf("local.%s reads %s, which cannot be evaluated without a plan", name, traversal.RootName())
+		}
+	}
+
+	ctx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{"var": e.vars, "local": cty.ObjectVal(locals)},
+		Functions: functions,
+	}
+	val, diags := expr.Value(ctx)
+	if diags.HasErrors() {
+		return cty.NilVal, fmt.Errorf("local.%s: %s", name, diags.Error())
+	}
+	e.done[name] = val
+	return val, nil
+}
+
+// toCty converts a JSON-shaped Go value to the given type; DynamicPseudoType
+// (type "any") keeps the type implied by the value
+func toCty(value interface{}, ty cty.Type) (cty.Value, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	if ty == cty.NilType || ty == cty.DynamicPseudoType {
+		if ty, err = ctyjson.ImpliedType(data); err != nil {
+			return cty.NilVal, err
+		}
+	}
+	return ctyjson.Unmarshal(data, ty)
+}
+
+func fromCty(val cty.Value) (interface{}, error) {
+	data, err := ctyjson.Marshal(val, val.Type())
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,335 @@
+package modcontract
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testContract = `version: 1
+module: core
+variables:
+  project_suffix:
+    type: string
+    required: true
+    validations:
+      - condition: 'contains(["nonprod", "prod"], var.project_suffix)'
+        error_message: "project_suffix must be 'nonprod' or 'prod'."
+  enable_demo_web_app_psc_neg:
+    type: bool
+    default: false
+  allowed_https_source_ranges:
+    type: list( string )
+    default: ["0.0.0.0/0"]
+  cloudflare_api_token:
+    type: string
+    required: true
+    sensitive: true
+  url_map_path_matchers:
+    type: map(object({ path_rules = optional(list(string)), default_service = string }))
+    default: {}
+`
+
+const testVariables = `
+variable "project_suffix" {
+  type = string
+  validation {
+    condition     = contains(["nonprod", "prod"],
+                             var.project_suffix)
+    error_message = "project_suffix must be 'nonprod' or 'prod'."
+  }
+}
+
+variable "enable_demo_web_app_psc_neg" {
+  type    = bool
+  default = false
+}
+
+variable "allowed_https_source_ranges" {
+  type    = list(string)
+  default = ["0.0.0.0/0"]
+}
+
+variable "cloudflare_api_token" {
+  type      = string
+  sensitive = true
+}
+
+variable "url_map_path_matchers" {
+  type = map(object({
+    default_service = string
+    path_rules      = optional(list(string), [])
+  }))
+  default = {}
+}
+`
+
+func writeModule(t *testing.T, variables string) (*Module, *Contract) {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "variables.tf"), []byte(variables), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "contract.yaml"), []byte(testContract), 0o600))
+
+	m, err := LoadModule(dir)
+	require.NoError(t, err)
+	c, err := LoadContract(filepath.Join(dir, "contract.yaml"))
+	require.NoError(t, err)
+	return m, c
+}
+
+func TestCheckVariablesAgree(t *testing.T) {
+	t.Parallel()
+
+	m, c := writeModule(t, testVariables)
+	assert.Empty(t, c.CheckVariables(m))
+}
+
+func TestCheckVariablesRetyped(t *testing.T) {
+	t.Parallel()
+
+	m, c := writeModule(t, replace(t, testVariables, `type    = bool
+  default = false`, `type    = string
+  default = "false"`))
+
+	assert.Equal(t, []string{
+		`variable "enable_demo_web_app_psc_neg": default is "false", contract expects false`,
+		`variable "enable_demo_web_app_psc_neg": type is string, contract expects bool`,
+	}, c.CheckVariables(m))
+}
+
+func TestCheckVariablesDroppedAndAdded(t *testing.T) {
+	t.Parallel()
+
+	variables := replace(t, testVariables, `variable "enable_demo_web_app_psc_neg" {
+  type    = bool
+  default = false
+}`, `variable "enable_psc_neg" {
+  type    = bool
+  default = false
+}`)
+	m, c := writeModule(t, variables)
+
+	problems := c.CheckVariables(m)
+	require.Len(t, problems, 2)
+	assert.Contains(t, problems[0], `variable "enable_demo_web_app_psc_neg": in contract but not declared in`)
+	assert.Contains(t, problems[1], `variable "enable_psc_neg": declared in`)
+	assert.Contains(t, problems[1], "but missing from contract")
+}
+
+func TestCheckVariablesSensitiveAndValidation(t *testing.T) {
+	t.Parallel()
+
+	variables := replace(t, testVariables, "sensitive = true\n", "")
+	variables = replace(t, variables, `contains(["nonprod", "prod"],`, `contains(["nonprod", "prod", "dev"],`)
+	m, c := writeModule(t, variables)
+
+	assert.Equal(t, []string{
+		`variable "cloudflare_api_token": sensitive is false, contract expects true`,
+		`variable "project_suffix": validation 0 condition is "contains([\"nonprod\", \"prod\", \"dev\"], var.project_suffix)", contract expects "contains([\"nonprod\", \"prod\"], var.project_suffix)"`,
+	}, c.CheckVariables(m))
+}
+
+func TestCheckVariablesDefaultRemoved(t *testing.T) {
+	t.Parallel()
+
+	m, c := writeModule(t, replace(t, testVariables, `default = ["0.0.0.0/0"]`, ""))
+
+	assert.Equal(t, []string{
+		`variable "allowed_https_source_ranges": is required, contract expects default ["0.0.0.0/0"]`,
+	}, c.CheckVariables(m))
+}
+
+func replace(t *testing.T, s, old, new string) string {
+	t.Helper()
+	require.Contains(t, s, old)
+	return strings.Replace(s, old, new, 1)
+}
+
+func TestDiffOutputs(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "outputs.tf"), []byte(`
+output "ingress_vpc_id" {
+  value = "x"
+}
+
+output "load_balancer_ip" {
+  value = "x"
+}
+
+output "cloudflare_origin_cert_id" {
+  value     = "x"
+  sensitive = false
+}
+`), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "contract.yaml"), []byte(`version: 1
+module: core
+outputs:
+  ingress_vpc_id:
+    sensitive: false
+  external_lb_ip:
+    sensitive: false
+  cloudflare_origin_cert_id:
+    sensitive: true
+`), 0o600))
+
+	m, err := LoadModule(dir)
+	require.NoError(t, err)
+	c, err := LoadContract(filepath.Join(dir, "contract.yaml"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "--- "+filepath.Join(dir, "contract.yaml")+" (contract)\n"+
+		"+++ "+dir+" (module)\n"+
+		"- cloudflare_origin_cert_id (sensitive)\n"+
+		"+ cloudflare_origin_cert_id\n"+
+		"- external_lb_ip\n"+
+		"  ingress_vpc_id\n"+
+		"+ load_balancer_ip\n", c.DiffOutputs(m))
+
+	delete(c.Outputs, "external_lb_ip")
+	c.Outputs["load_balancer_ip"] = OutputSpec{}
+	c.Outputs["cloudflare_origin_cert_id"] = OutputSpec{}
+	assert.Empty(t, c.DiffOutputs(m))
+}
+
+func TestCheckRemoteState(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	write := func(module, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, module), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(root, module, "main.tf"), []byte(content), 0o600))
+	}
+	write("project-singleton", `
+output "enable_logging" { value = true }
+output "external_https_lb_certificate_id" { value = "x" }
+`)
+	write("demo-web-app", `
+output "web_app_backend_service_id" { value = "x" }
+`)
+	write("core", `
+data "terraform_remote_state" "singleton" {
+  backend = "gcs"
+}
+
+data "terraform_remote_state" "demo_web_app" {
+  count   = 1
+  backend = "gcs"
+}
+
+locals {
+  logging = data.terraform_remote_state.singleton.outputs.enable_logging
+  index   = 0
+}
+
+resource "x" "y" {
+  cert    = data.terraform_remote_state.singleton.outputs.external_https_lb_cert_id
+  backend = data.terraform_remote_state.demo_web_app[0].outputs.web_app_backend_service_id
+  nested {
+    attachment = data.terraform_remote_state.demo_web_app[local.index].outputs.web_app_psc_service_attachment_self_link
+  }
+}
+`)
+
+	findings, err := CheckRemoteState(root, nil)
+	require.NoError(t, err)
+	require.Len(t, findings, 2)
+
+	assert.Equal(t, "project-singleton", findings[0].Producer)
+	assert.Equal(t, "external_https_lb_cert_id", findings[0].Ref.Output)
+	assert.Equal(t, "external_https_lb_certificate_id", findings[0].Suggestion)
+	assert.Contains(t, findings[0].String(),
+		`reads data.terraform_remote_state.singleton.outputs.external_https_lb_cert_id, but project-singleton does not export "external_https_lb_cert_id"; renamed to "external_https_lb_certificate_id"?`)
+
+	assert.Equal(t, "demo-web-app", findings[1].Producer)
+	assert.Equal(t, "web_app_psc_service_attachment_self_link", findings[1].Ref.Output)
+	assert.Empty(t, findings[1].Suggestion)
+
+	_, err = CheckRemoteState(root, StateProducers{"singleton": "missing-module"})
+	assert.ErrorContains(t, err, `remote state "singleton" maps to module "missing-module", which does not exist`)
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	m, _ := writeModule(t, testVariables)
+	suffix := m.Variables["project_suffix"]
+
+	failures, err := suffix.Validate("prod")
+	require.NoError(t, err)
+	assert.Empty(t, failures)
+
+	failures, err = suffix.Validate("staging")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"project_suffix must be 'nonprod' or 'prod'."}, failures)
+}
+
+func TestLocal(t *testing.T) {
+	t.Parallel()
+
+	variables := testVariables + `
+locals {
+  suffix     = upper(var.project_suffix)
+  project_id = "edge-${local.suffix}"
+  first_cidr = var.allowed_https_source_ranges[0]
+}
+`
+	m, _ := writeModule(t, variables)
+
+	value, err := m.Local("project_id", map[string]interface{}{"project_suffix": "prod"})
+	require.NoError(t, err)
+	assert.Equal(t, "edge-PROD", value)
+
+	value, err = m.Local("first_cidr", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "0.0.0.0/0", value)
+
+	_, err = m.Local("project_id", nil)
+	assert.ErrorContains(t, err, "required variable")
+}
+
+func TestEnvVars(t *testing.T) {
+	t.Parallel()
+
+	variables := testVariables + `
+locals {
+  first_cidr = var.allowed_https_source_ranges[0]
+  label      = "${var.project_suffix}-${local.first_cidr}"
+  psc        = var.enable_demo_web_app_psc_neg
+}
+`
+	m, _ := writeModule(t, variables)
+
+	environ := []string{
+		"TF_VAR_project_suffix=prod",
+		`TF_VAR_allowed_https_source_ranges=["35.191.0.0/16", "130.211.0.0/22"]`,
+		"TF_VAR_enable_demo_web_app_psc_neg=true",
+		"TF_VAR_url_map_path_matchers=not an expression [",
+		"TF_VAR_undeclared=x",
+	}
+	vars, err := m.EnvVars(environ, "label")
+	require.NoError(t, err, "variables label does not read are not parsed")
+	assert.Equal(t, map[string]interface{}{
+		"project_suffix":              "prod",
+		"allowed_https_source_ranges": []interface{}{"35.191.0.0/16", "130.211.0.0/22"},
+	}, vars)
+	value, err := m.Local("label", vars)
+	require.NoError(t, err)
+	assert.Equal(t, "prod-35.191.0.0/16", value)
+
+	vars, err = m.EnvVars(environ, "psc")
+	require.NoError(t, err)
+	value, err = m.Local("psc", vars)
+	require.NoError(t, err)
+	assert.Equal(t, true, value)
+
+	_, err = m.EnvVars([]string{`TF_VAR_allowed_https_source_ranges=35.191.0.0/16`}, "first_cidr")
+	assert.ErrorContains(t, err, "TF_VAR_allowed_https_source_ranges")
+	_, err = m.EnvVars(nil, "missing")
+	assert.ErrorContains(t, err, `declares no local "missing"`)
+}
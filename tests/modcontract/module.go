@@ -0,0 +1,117 @@
+// Package modcontract checks the interface an OpenTofu module exposes (its
+// variables and outputs) against a versioned contract file. Modules are read
+// with the HCL parser, so the checks need neither tofu nor provider plugins and
+// catch a dropped, retyped or newly added variable before anything is planned.
+package modcontract
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// Module is the parsed interface of one module directory
+type Module struct {
+	Dir       string
+	Variables map[string]Variable
+	Outputs   map[string]Output
+	// Resources maps each managed resource address (type.name) to its declaration
+	Resources map[string]hcl.Range
+	// RemoteStates maps each terraform_remote_state data source to its declaration
+	RemoteStates map[string]hcl.Range
+	// RemoteStateRefs lists every `data.terraform_remote_state.X.outputs.Y` reference
+	RemoteStateRefs []RemoteStateRef
+
+	locals map[string]hcl.Expression
+}
+
+// LoadModule parses every top-level *.tf file of dir
+func LoadModule(dir string) (*Module, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.tf"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .tf files in %s", dir)
+	}
+	sort.Strings(files)
+
+	m := &Module{
+		Dir:          dir,
+		Variables:    map[string]Variable{},
+		Outputs:      map[string]Output{},
+		Resources:    map[string]hcl.Range{},
+		RemoteStates: map[string]hcl.Range{},
+		locals:       map[string]hcl.Expression{},
+	}
+	parser := hclparse.NewParser()
+	for _, path := range files {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		file, diags := parser.ParseHCL(src, path)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		body, ok := file.Body.(*hclsyntax.Body)
+		if !ok {
+			return nil, fmt.Errorf("%s: not native HCL syntax", path)
+		}
+		for _, block := range body.Blocks {
+			if len(block.Labels) != 1 {
+				continue
+			}
+			switch block.Type {
+			case "variable":
+				v, err := decodeVariable(block, src)
+				if err != nil {
+					return nil, err
+				}
+				if prev, dup := m.Variables[v.Name]; dup {
+					return nil, fmt.Errorf("variable %q declared twice (%s and %s)", v.Name, prev.Range, v.Range)
+				}
+				m.Variables[v.Name] = v
+			case "output":
+				o, err := decodeOutput(block)
+				if err != nil {
+					return nil, err
+				}
+				if prev, dup := m.Outputs[o.Name]; dup {
+					return nil, fmt.Errorf("output %q declared twice (%s and %s)", o.Name, prev.Range, o.Range)
+				}
+				m.Outputs[o.Name] = o
+			}
+		}
+		for _, block := range body.Blocks {
+			switch {
+			case block.Type == "resource" && len(block.Labels) == 2:
+				m.Resources[block.Labels[0]+"."+block.Labels[1]] = block.DefRange()
+			case block.Type == "data" && len(block.Labels) == 2 && block.Labels[0] == "terraform_remote_state":
+				m.RemoteStates[block.Labels[1]] = block.DefRange()
+			case block.Type == "locals":
+				for name, attr := range block.Body.Attributes {
+					m.locals[name] = attr.Expr
+				}
+			}
+		}
+		m.RemoteStateRefs = append(m.RemoteStateRefs, remoteStateRefs(body)...)
+	}
+	return m, nil
+}
+
+// sourceText returns the normalized source of an expression: runs of whitespace
+// collapse to a single space so reformatting does not count as a change
+func sourceText(src []byte, rng hcl.Range) string {
+	return collapseSpace(string(rng.SliceBytes(src)))
+}
+
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
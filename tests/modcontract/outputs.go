@@ -0,0 +1,82 @@
+package modcontract
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// Output is a declared output value
+type Output struct {
+	Name      string
+	Sensitive bool
+	Range     hcl.Range
+}
+
+// OutputSpec is the contract for one output
+type OutputSpec struct {
+	Sensitive bool `yaml:"sensitive"`
+}
+
+func decodeOutput(block *hclsyntax.Block) (Output, error) {
+	o := Output{Name: block.Labels[0], Range: block.DefRange()}
+	if attr, ok := block.Body.Attributes["sensitive"]; ok {
+		value, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() || value.IsNull() {
+			return o, fmt.Errorf("output %q (%s): sensitive must be a literal bool", o.Name, o.Range)
+		}
+		o.Sensitive = value.True()
+	}
+	return o, nil
+}
+
+// DiffOutputs compares the module's outputs with the contract. It returns an
+// empty string when they agree, otherwise a diff with one line per output:
+// "-" lines are what the contract promises, "+" lines what the module declares.
+func (c *Contract) DiffOutputs(m *Module) string {
+	names := map[string]bool{}
+	for name := range c.Outputs {
+		names[name] = true
+	}
+	for name := range m.Outputs {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var diff strings.Builder
+	changed := false
+	for _, name := range sorted {
+		spec, inContract := c.Outputs[name]
+		actual, inModule := m.Outputs[name]
+		switch {
+		case inContract && inModule && spec.Sensitive == actual.Sensitive:
+			fmt.Fprintf(&diff, "  %s\n", describeOutput(name, spec.Sensitive))
+		default:
+			changed = true
+			if inContract {
+				fmt.Fprintf(&diff, "- %s\n", describeOutput(name, spec.Sensitive))
+			}
+			if inModule {
+				fmt.Fprintf(&diff, "+ %s\n", describeOutput(name, actual.Sensitive))
+			}
+		}
+	}
+	if !changed {
+		return ""
+	}
+	return fmt.Sprintf("--- %s (contract)\n+++ %s (module)\n%s", c.path, m.Dir, diff.String())
+}
+
+func describeOutput(name string, sensitive bool) string {
+	if sensitive {
+		return name + " (sensitive)"
+	}
+	return name
+}
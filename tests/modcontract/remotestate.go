@@ -0,0 +1,251 @@
+package modcontract
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// RemoteStateRef is one read of another module's output through a
+// terraform_remote_state data source
+type RemoteStateRef struct {
+	// DataSource is the data source name, e.g. singleton
+	DataSource string
+	// Output is the output read, e.g. external_https_lb_cert_id
+	Output string
+	Range  hcl.Range
+}
+
+func (r RemoteStateRef) String() string {
+	return fmt.Sprintf("data.terraform_remote_state.%s.outputs.%s", r.DataSource, r.Output)
+}
+
+// RemoteStateFinding is a reference whose producing module does not export the output
+type RemoteStateFinding struct {
+	Consumer string
+	Ref      RemoteStateRef
+	Producer string
+	// Suggestion is the closest output the producer does export, if any
+	Suggestion string
+}
+
+func (f RemoteStateFinding) String() string {
+	msg := fmt.Sprintf("%s (%s) reads %s, but %s does not export %q",
+		f.Consumer, f.Ref.Range, f.Ref, f.Producer, f.Ref.Output)
+	if f.Suggestion != "" {
+		msg += fmt.Sprintf("; renamed to %q?", f.Suggestion)
+	}
+	return msg
+}
+
+// StateProducers maps terraform_remote_state data source names to the module
+// directory (relative to the modules root) that writes that state. Names not
+// listed resolve to a sibling directory called like the data source with
+// underscores as hyphens (demo_web_app -> demo-web-app), or to the single
+// sibling ending in "-<name>" (singleton -> project-singleton).
+type StateProducers map[string]string
+
+// Resolve returns which of modules writes the state read through the
+// terraform_remote_state data source named dataSource
+func (p StateProducers) Resolve(dataSource string, modules []string) (string, error) {
+	return resolveProducer(dataSource, p, modules)
+}
+
+// CheckRemoteState loads every module under root, resolves each remote state
+// data source to its producing module and reports the output references the
+// producer does not declare, ordered by consumer and source position.
+func CheckRemoteState(root string, producers StateProducers) ([]RemoteStateFinding, error) {
+	modules, err := loadModules(root)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(modules))
+	for name := range modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var findings []RemoteStateFinding
+	for _, consumerName := range names {
+		consumer := modules[consumerName]
+		for _, ref := range consumer.RemoteStateRefs {
+			if _, declared := consumer.RemoteStates[ref.DataSource]; !declared {
+				return nil, fmt.Errorf("%s (%s): %s refers to an undeclared data source", consumerName, ref.Range, ref)
+			}
+			producerName, err := resolveProducer(ref.DataSource, producers, names)
+			if err != nil {
+				return nil, fmt.Errorf("%s (%s): %w", consumerName, ref.Range, err)
+			}
+			producer := modules[producerName]
+			if _, ok := producer.Outputs[ref.Output]; ok {
+				continue
+			}
+			findings = append(findings, RemoteStateFinding{
+				Consumer:   consumerName,
+				Ref:        ref,
+				Producer:   producerName,
+				Suggestion: closestOutput(ref.Output, producer.Outputs),
+			})
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.Consumer != b.Consumer {
+			return a.Consumer < b.Consumer
+		}
+		if a.Ref.Range.Filename != b.Ref.Range.Filename {
+			return a.Ref.Range.Filename < b.Ref.Range.Filename
+		}
+		return a.Ref.Range.Start.Byte < b.Ref.Range.Start.Byte
+	})
+	return findings, nil
+}
+
+// loadModules parses every directory under root that contains .tf files
+func loadModules(root string) (map[string]*Module, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	modules := map[string]*Module{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(root, entry.Name())
+		if files, _ := filepath.Glob(filepath.Join(dir, "*.tf")); len(files) == 0 {
+			continue
+		}
+		m, err := LoadModule(dir)
+		if err != nil {
+			return nil, err
+		}
+		modules[entry.Name()] = m
+	}
+	return modules, nil
+}
+
+func resolveProducer(dataSource string, producers StateProducers, modules []string) (string, error) {
+	if name, ok := producers[dataSource]; ok {
+		if !contains(modules, name) {
+			return "", fmt.Errorf("remote state %q maps to module %q, which does not exist", dataSource, name)
+		}
+		return name, nil
+	}
+
+	hyphenated := strings.ReplaceAll(dataSource, "_", "-")
+	if contains(modules, hyphenated) {
+		return hyphenated, nil
+	}
+	var suffixed []string
+	for _, name := range modules {
+		if strings.HasSuffix(name, "-"+hyphenated) {
+			suffixed = append(suffixed, name)
+		}
+	}
+	if len(suffixed) == 1 {
+		return suffixed[0], nil
+	}
+	return "", fmt.Errorf("cannot tell which module produces remote state %q (candidates: %v); add it to StateProducers",
+		dataSource, suffixed)
+}
+
+// remoteStateRefs collects `data.terraform_remote_state.X[...].outputs.Y`
+// traversals anywhere in a body
+func remoteStateRefs(body *hclsyntax.Body) []RemoteStateRef {
+	var refs []RemoteStateRef
+	hclsyntax.VisitAll(body, func(node hclsyntax.Node) hcl.Diagnostics {
+		var traversal hcl.Traversal
+		switch expr := node.(type) {
+		case *hclsyntax.ScopeTraversalExpr:
+			traversal = expr.Traversal
+		case *hclsyntax.RelativeTraversalExpr:
+			// data.x.y[local.i].outputs.z parses as an index expression followed
+			// by a relative traversal; the dynamic index does not matter here
+			index, ok := expr.Source.(*hclsyntax.IndexExpr)
+			if !ok {
+				return nil
+			}
+			source, ok := index.Collection.(*hclsyntax.ScopeTraversalExpr)
+			if !ok {
+				return nil
+			}
+			traversal = append(append(hcl.Traversal{}, source.Traversal...), expr.Traversal...)
+		default:
+			return nil
+		}
+		if ref, ok := parseRemoteStateRef(traversal); ok {
+			refs = append(refs, ref)
+		}
+		return nil
+	})
+	return refs
+}
+
+func parseRemoteStateRef(traversal hcl.Traversal) (RemoteStateRef, bool) {
+	var names []string
+	for _, step := range traversal {
+		switch s := step.(type) {
+		case hcl.TraverseRoot:
+			names = append(names, s.Name)
+		case hcl.TraverseAttr:
+			names = append(names, s.Name)
+		}
+		// index steps (count/for_each keys) are skipped
+	}
+	if len(names) < 5 || names[0] != "data" || names[1] != "terraform_remote_state" || names[3] != "outputs" {
+		return RemoteStateRef{}, false
+	}
+	return RemoteStateRef{DataSource: names[2], Output: names[4], Range: traversal.SourceRange()}, true
+}
+
+// closestOutput suggests the declared output most likely to be the renamed
+// one: the smallest edit distance within half the name's length
+func closestOutput(name string, outputs map[string]Output) string {
+	best, bestDistance := "", len(name)/2+1
+	candidates := make([]string, 0, len(outputs))
+	for candidate := range outputs {
+		candidates = append(candidates, candidate)
+	}
+	sort.Strings(candidates)
+	for _, candidate := range candidates {
+		if d := editDistance(name, candidate); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr := make([]int, len(b)+1)
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev = curr
+	}
+	return prev[len(b)]
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package modcontract
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// typeString renders a type constraint canonically. Unlike typeexpr.TypeString
+// it keeps optional() object attributes, since making an attribute optional (or
+// required) changes what callers may pass.
+func typeString(ty cty.Type) string {
+	switch {
+	case ty == cty.DynamicPseudoType:
+		return "any"
+	case ty.IsListType():
+		return fmt.Sprintf("list(%s)", typeString(ty.ElementType()))
+	case ty.IsSetType():
+		return fmt.Sprintf("set(%s)", typeString(ty.ElementType()))
+	case ty.IsMapType():
+		return fmt.Sprintf("map(%s)", typeString(ty.ElementType()))
+	case ty.IsObjectType():
+		attrs := ty.AttributeTypes()
+		names := make([]string, 0, len(attrs))
+		for name := range attrs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		parts := make([]string, len(names))
+		for i, name := range names {
+			attr := typeString(attrs[name])
+			if ty.AttributeOptional(name) {
+				attr = fmt.Sprintf("optional(%s)", attr)
+			}
+			parts[i] = name + "=" + attr
+		}
+		return "object({" + strings.Join(parts, ",") + "})"
+	case ty.IsTupleType():
+		elems := ty.TupleElementTypes()
+		parts := make([]string, len(elems))
+		for i, elem := range elems {
+			parts[i] = typeString(elem)
+		}
+		return "tuple([" + strings.Join(parts, ",") + "])"
+	default:
+		return typeexpr.TypeString(ty)
+	}
+}
+
+// normalizeType parses a type constraint written in a contract file so that
+// formatting differences (spaces, attribute order) do not matter
+func normalizeType(constraint string) (string, error) {
+	expr, diags := hclsyntax.ParseExpression([]byte(constraint), "contract", hcl.InitialPos)
+	if diags.HasErrors() {
+		return "", fmt.Errorf("invalid type %q: %s", constraint, diags.Error())
+	}
+	ty, _, diags := typeexpr.TypeConstraintWithDefaults(expr)
+	if diags.HasErrors() {
+		return "", fmt.Errorf("invalid type %q: %s", constraint, diags.Error())
+	}
+	return typeString(ty), nil
+}
@@ -0,0 +1,114 @@
+package modcontract
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// Variable is a declared input variable
+type Variable struct {
+	Name        string
+	Description string
+	// Type is the canonical type constraint, e.g. map(string); "any" when omitted
+	Type string
+	// HasDefault is false for required variables
+	HasDefault bool
+	// Default is the default value in its JSON form (float64 numbers, []interface{} lists)
+	Default     interface{}
+	Sensitive   bool
+	Validations []Validation
+	Range       hcl.Range
+
+	ty cty.Type
+}
+
+// Validation is one validation block of a variable
+type Validation struct {
+	// Condition is the condition expression source with whitespace collapsed
+	Condition    string `yaml:"condition"`
+	ErrorMessage string `yaml:"error_message"`
+
+	expr hcl.Expression
+}
+
+func decodeVariable(block *hclsyntax.Block, src []byte) (Variable, error) {
+	v := Variable{Name: block.Labels[0], Type: "any", Range: block.DefRange(), ty: cty.DynamicPseudoType}
+	where := fmt.Sprintf("variable %q (%s)", v.Name, v.Range)
+
+	for name, attr := range block.Body.Attributes {
+		switch name {
+		case "type":
+			ty, _, diags := typeexpr.TypeConstraintWithDefaults(attr.Expr)
+			if diags.HasErrors() {
+				return v, fmt.Errorf("%s: invalid type: %s", where, diags.Error())
+			}
+			v.Type = typeString(ty)
+			v.ty = ty
+		case "description":
+			if value, diags := attr.Expr.Value(nil); !diags.HasErrors() && value.Type() == cty.String && !value.IsNull() {
+				v.Description = value.AsString()
+			}
+		case "default":
+			value, err := constantJSON(attr.Expr)
+			if err != nil {
+				return v, fmt.Errorf("%s: default: %w", where, err)
+			}
+			v.HasDefault = true
+			v.Default = value
+		case "sensitive":
+			value, diags := attr.Expr.Value(nil)
+			if diags.HasErrors() || value.IsNull() {
+				return v, fmt.Errorf("%s: sensitive must be a literal bool", where)
+			}
+			v.Sensitive = value.True()
+		}
+	}
+
+	for _, nested := range block.Body.Blocks {
+		if nested.Type != "validation" {
+			continue
+		}
+		var validation Validation
+		if attr, ok := nested.Body.Attributes["condition"]; ok {
+			validation.Condition = sourceText(src, attr.Expr.Range())
+			validation.expr = attr.Expr
+		}
+		if attr, ok := nested.Body.Attributes["error_message"]; ok {
+			// Messages are usually literals; interpolated ones are compared as source
+			if value, diags := attr.Expr.Value(nil); !diags.HasErrors() && value.Type() == cty.String && value.IsKnown() && !value.IsNull() {
+				validation.ErrorMessage = value.AsString()
+			} else {
+				validation.ErrorMessage = sourceText(src, attr.Expr.Range())
+			}
+		}
+		v.Validations = append(v.Validations, validation)
+	}
+	return v, nil
+}
+
+// constantJSON evaluates a constant expression and returns it in the shape
+// encoding/json produces, so it compares equal to contract values
+func constantJSON(expr hcl.Expression) (interface{}, error) {
+	value, diags := expr.Value(nil)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("not a constant expression: %s", diags.Error())
+	}
+	if value.IsNull() {
+		return nil, nil
+	}
+	data, err := ctyjson.Marshal(value, value.Type())
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,125 @@
+package planfixture
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	terratesting "github.com/gruntwork-io/terratest/modules/testing"
+
+	"vibetics-cloudedge/tests/modcontract"
+)
+
+// BaseVars returns the variables every scenario of module starts from; callers
+// may modify the returned map
+func BaseVars(module string) map[string]interface{} {
+	switch module {
+	case "core":
+		return coreVars(nil)
+	case "demo-web-app":
+		return demoWebAppVars(nil)
+	case "project-singleton":
+		return singletonVars(nil)
+	}
+	return map[string]interface{}{}
+}
+
+// Match returns the registered scenario of module whose inputs equal vars once
+// the module's defaults are filled in, so {"enable_x": false} matches a
+// scenario that leaves enable_x at its false default.
+func Match(module string, vars map[string]interface{}) (Scenario, error) {
+	m, err := modcontract.LoadModule(ModuleDir(module))
+	if err != nil {
+		return Scenario{}, err
+	}
+	want, err := effectiveVars(m, vars)
+	if err != nil {
+		return Scenario{}, err
+	}
+
+	var candidates []string
+	for _, s := range Scenarios() {
+		if s.Module != module {
+			continue
+		}
+		candidates = append(candidates, s.Name)
+		got, err := effectiveVars(m, s.Vars)
+		if err != nil {
+			return Scenario{}, fmt.Errorf("scenario %s: %w", s.Name, err)
+		}
+		if equalVars(got, want) {
+			return s, nil
+		}
+	}
+	return Scenario{}, fmt.Errorf("no recorded %s plan has inputs %s (recorded: %s); register a Scenario and run `go run ./cmd/cloudedge record-plans`",
+		module, renderVars(vars), strings.Join(candidates, ", "))
+}
+
+// PlanFor plans module with vars: live mode runs tofu, fixture mode loads the
+// recorded scenario that Match finds for the same inputs
+func PlanFor(t terratesting.TestingT, module string, vars map[string]interface{}) (*terraform.PlanStruct, error) {
+	if Live() {
+		scenario := Scenario{Name: strings.ReplaceAll(module, "-", "_") + "_adhoc", Module: module, Vars: vars}
+		planJSON, err := Show(t, scenario)
+		if err != nil {
+			return nil, fmt.Errorf("planning %s: %w", module, err)
+		}
+		return terraform.ParsePlanJSON(planJSON)
+	}
+
+	scenario, err := Match(module, vars)
+	if err != nil {
+		return nil, err
+	}
+	return Load(scenario.Name)
+}
+
+// effectiveVars renders every declared variable to JSON, taking the value from
+// vars or else the default. Variables the module does not declare are an error.
+func effectiveVars(m *modcontract.Module, vars map[string]interface{}) (map[string]string, error) {
+	out := map[string]string{}
+	for name := range vars {
+		if _, ok := m.Variables[name]; !ok {
+			return nil, fmt.Errorf("%s does not declare variable %q", m.Dir, name)
+		}
+	}
+	for name, v := range m.Variables {
+		value, set := vars[name]
+		if !set {
+			value = v.Default
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("variable %q: %w", name, err)
+		}
+		out[name] = string(data)
+	}
+	return out, nil
+}
+
+func equalVars(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func renderVars(vars map[string]interface{}) string {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s=%v", name, vars[name]))
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
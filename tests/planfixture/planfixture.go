@@ -0,0 +1,96 @@
+// Package planfixture serves plans for the contract suite. In fixture mode (the
+// default) plans are loaded from the pre-recorded `tofu show -json` documents in
+// testdata/plans, so the assertions run without tofu, provider downloads or a GCS
+// backend. In live mode each scenario is planned with tofu, exactly as the
+// recorder does when it regenerates the fixtures.
+package planfixture
+
+import (
+	"embed"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// ModeEnvVar selects where contract plans come from
+	ModeEnvVar = "CONTRACT_PLAN_MODE"
+	// ModeFixture loads recorded plans from testdata/plans
+	ModeFixture = "fixture"
+	// ModeLive runs tofu init/plan/show for every scenario
+	ModeLive = "live"
+
+	fixtureDir = "testdata/plans"
+)
+
+//go:embed testdata/plans/*.json
+var recorded embed.FS
+
+// Mode returns the plan source selected through CONTRACT_PLAN_MODE
+func Mode() string {
+	if strings.EqualFold(strings.TrimSpace(os.Getenv(ModeEnvVar)), ModeLive) {
+		return ModeLive
+	}
+	return ModeFixture
+}
+
+// Live reports whether the suite is allowed to run tofu
+func Live() bool {
+	return Mode() == ModeLive
+}
+
+// RequireLive skips the test unless the suite runs in live mode. Use it for
+// checks that need the tofu binary itself rather than a plan.
+func RequireLive(t *testing.T) {
+	t.Helper()
+	if !Live() {
+		t.Skipf("Skipping: requires tofu (set %s=%s)", ModeEnvVar, ModeLive)
+	}
+}
+
+// Plan returns the plan for the named scenario, recorded or live depending on Mode
+func Plan(t *testing.T, name string) *terraform.PlanStruct {
+	t.Helper()
+
+	scenario, ok := Lookup(name)
+	require.Truef(t, ok, "Unknown plan scenario %q", name)
+
+	if Live() {
+		planJSON, err := Show(t, scenario)
+		require.NoError(t, err, "Failed to plan scenario %s", name)
+		plan, err := terraform.ParsePlanJSON(planJSON)
+		require.NoError(t, err, "Failed to parse plan for scenario %s", name)
+		return plan
+	}
+
+	plan, err := Load(name)
+	require.NoError(t, err, "Failed to load recorded plan for scenario %s", name)
+	return plan
+}
+
+// Load parses the recorded plan of the named scenario
+func Load(name string) (*terraform.PlanStruct, error) {
+	data, err := Raw(name)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := terraform.ParsePlanJSON(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s.json: %w", name, err)
+	}
+	return plan, nil
+}
+
+// Raw returns the recorded `tofu show -json` document of the named scenario
+func Raw(name string) ([]byte, error) {
+	data, err := recorded.ReadFile(path.Join(fixtureDir, name+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("no recorded plan for scenario %q (run `go run ./cmd/cloudedge record-plans`): %w", name, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,79 @@
+package planfixture
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRecordedPlans ensures every scenario has a fixture that parses and is
+// already in the canonical form the recorder writes
+func TestRecordedPlans(t *testing.T) {
+	t.Parallel()
+
+	for _, scenario := range Scenarios() {
+		scenario := scenario
+		t.Run(scenario.Name, func(t *testing.T) {
+			t.Parallel()
+
+			data, err := Raw(scenario.Name)
+			require.NoError(t, err)
+
+			plan, err := Load(scenario.Name)
+			require.NoError(t, err)
+			assert.NotEmpty(t, plan.ResourceChangesMap, "Recorded plan should contain resource changes")
+
+			for name := range secretEnvVars {
+				if v, ok := plan.RawPlan.Variables[name]; ok {
+					assert.Equal(t, RedactedValue, v.Value, "Sensitive variable %s should be redacted", name)
+				}
+			}
+
+			redacted, err := Redact(data)
+			require.NoError(t, err)
+			assert.Equal(t, string(data), string(redacted), "Fixture should be stable under Redact; re-record it")
+		})
+	}
+}
+
+// TestLookupReturnsCopy ensures callers cannot mutate the scenario catalog
+func TestLookupReturnsCopy(t *testing.T) {
+	t.Parallel()
+
+	first, ok := Lookup("core_default")
+	require.True(t, ok)
+	first.Vars["region"] = "europe-west1"
+
+	second, _ := Lookup("core_default")
+	assert.Equal(t, "us-central1", second.Vars["region"])
+}
+
+func TestMatch(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		module string
+		vars   map[string]interface{}
+		want   string
+	}{
+		{"core", map[string]interface{}{}, "core_default"},
+		{"core", map[string]interface{}{"enable_demo_web_app_psc_neg": false}, "core_default"},
+		{"core", map[string]interface{}{"enable_demo_web_app_psc_neg": true, "demo_web_app_project_id": "test-project"}, "core_psc_neg_same_project"},
+		{"demo-web-app", map[string]interface{}{"enable_demo_web_app_psc_neg": true, "enable_demo_web_app_internal_alb": true}, "demo_web_app_psc"},
+	} {
+		vars := BaseVars(tc.module)
+		for k, v := range tc.vars {
+			vars[k] = v
+		}
+		scenario, err := Match(tc.module, vars)
+		require.NoError(t, err)
+		assert.Equal(t, tc.want, scenario.Name, "%s %v", tc.module, tc.vars)
+	}
+
+	_, err := Match("core", map[string]interface{}{"enable_waf": true, "enable_demo_web_app_psc_neg": true})
+	assert.ErrorContains(t, err, "no recorded core plan has inputs {enable_demo_web_app_psc_neg=true, enable_waf=true}")
+
+	_, err = Match("core", map[string]interface{}{"no_such_variable": true})
+	assert.ErrorContains(t, err, `does not declare variable "no_such_variable"`)
+}
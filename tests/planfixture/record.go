@@ -0,0 +1,131 @@
+package planfixture
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	terratesting "github.com/gruntwork-io/terratest/modules/testing"
+)
+
+// RedactedValue replaces sensitive variable values in recorded plans
+const RedactedValue = "REDACTED"
+
+// Contract plans keep their own state locally; only terraform_remote_state reads
+// still reach the GCS backend.
+const backendOverride = `terraform {
+  backend "local" {}
+}
+`
+
+// secretEnvVars maps module variables to the environment variables that supply
+// their real values when planning live
+var secretEnvVars = map[string]string{
+	"cloudflare_api_token":     "CLOUDFLARE_API_TOKEN",
+	"cloudflare_origin_ca_key": "CLOUDFLARE_ORIGIN_CA_KEY",
+}
+
+// TerraformOptions builds the options used to plan the scenario from dir
+func (s Scenario) TerraformOptions(dir string) *terraform.Options {
+	vars := merge(s.Vars, nil)
+	for name, env := range secretEnvVars {
+		if _, ok := vars[name]; !ok {
+			continue
+		}
+		if value := os.Getenv(env); value != "" {
+			vars[name] = value
+		}
+	}
+
+	return &terraform.Options{
+		TerraformDir:    dir,
+		TerraformBinary: "tofu",
+		NoColor:         true,
+		Vars:            vars,
+		PlanFilePath:    filepath.Join(dir, "contract.tfplan"),
+	}
+}
+
+// Show copies the scenario's module into a scratch directory with a local backend
+// override, then runs tofu init, plan and show -json and returns the JSON plan.
+func Show(t terratesting.TestingT, s Scenario) (string, error) {
+	workDir, err := os.MkdirTemp("", "contract-plan-"+s.Name+"-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(workDir)
+
+	if err := copyModule(ModuleDir(s.Module), workDir); err != nil {
+		return "", fmt.Errorf("copying module %s: %w", s.Module, err)
+	}
+	if err := os.WriteFile(filepath.Join(workDir, "backend_override.tf"), []byte(backendOverride), 0o600); err != nil {
+		return "", err
+	}
+
+	return terraform.InitAndPlanAndShowE(t, s.TerraformOptions(workDir))
+}
+
+// Redact blanks the values of sensitive input variables and re-indents the plan
+// so recorded fixtures are stable and reviewable.
+func Redact(planJSON []byte) ([]byte, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(planJSON, &doc); err != nil {
+		return nil, err
+	}
+
+	variables, _ := doc["variables"].(map[string]interface{})
+	for name := range sensitiveVariables(doc) {
+		if v, ok := variables[name].(map[string]interface{}); ok {
+			v["value"] = RedactedValue
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sensitiveVariables lists the root module variables declared sensitive
+func sensitiveVariables(doc map[string]interface{}) map[string]bool {
+	out := map[string]bool{}
+	configuration, _ := doc["configuration"].(map[string]interface{})
+	rootModule, _ := configuration["root_module"].(map[string]interface{})
+	declared, _ := rootModule["variables"].(map[string]interface{})
+	for name, raw := range declared {
+		if decl, ok := raw.(map[string]interface{}); ok && decl["sensitive"] == true {
+			out[name] = true
+		}
+	}
+	return out
+}
+
+// copyModule copies the top-level OpenTofu files of a module; nested directories
+// such as .terraform are deliberately left behind.
+func copyModule(src, dst string) error {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || (filepath.Ext(name) != ".tf" && name != ".terraform.lock.hcl") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(src, name))
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dst, name), data, 0o600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
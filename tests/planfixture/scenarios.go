@@ -0,0 +1,156 @@
+package planfixture
+
+import (
+	"path/filepath"
+	"runtime"
+	"sort"
+)
+
+// Scenario is a named combination of module and input variables whose plan the
+// contract suite asserts against. The same catalog drives both the offline
+// fixtures and the recorder that regenerates them.
+type Scenario struct {
+	// Name identifies the scenario and its fixture file (testdata/plans/<Name>.json)
+	Name string
+	// Module is the directory under deploy/opentofu/gcp (core, demo-web-app, project-singleton)
+	Module string
+	// Vars are passed to tofu plan as -var arguments
+	Vars map[string]interface{}
+}
+
+// Base variables shared by every core scenario
+func coreVars(overrides map[string]interface{}) map[string]interface{} {
+	return merge(map[string]interface{}{
+		"project_suffix":              "nonprod",
+		"region":                      "us-central1",
+		"cloudedge_github_repository": "test-repo",
+		"cloudedge_project_id":        "test-project",
+		"billing_account_name":        "test-billing",
+		"cloudflare_api_token":        "test-token",
+		"cloudflare_origin_ca_key":    "test-ca-key",
+		"cloudflare_zone_id":          "test-zone-id",
+		"root_domain":                 "example.com",
+		"enable_demo_web_app":         true,
+		"demo_web_app_project_id":     "test-demo-project",
+	}, overrides)
+}
+
+// Base variables shared by every demo-web-app scenario
+func demoWebAppVars(overrides map[string]interface{}) map[string]interface{} {
+	return merge(map[string]interface{}{
+		"project_suffix":              "nonprod",
+		"region":                      "us-central1",
+		"cloudedge_github_repository": "test-repo",
+		"cloudedge_project_id":        "test-project",
+		"demo_web_app_project_id":     "test-demo-project",
+		"enable_demo_web_app":         true,
+	}, overrides)
+}
+
+// Base variables for project-singleton; no scenario is recorded for it yet, but
+// the feature suites plan it live with these
+func singletonVars(overrides map[string]interface{}) map[string]interface{} {
+	return merge(map[string]interface{}{
+		"project_suffix":              "nonprod",
+		"region":                      "us-central1",
+		"cloudedge_github_repository": "test-repo",
+		"project_id":                  "test-project",
+		"billing_account_name":        "test-billing",
+		"cloudflare_api_token":        "test-token",
+	}, overrides)
+}
+
+var scenarios = []Scenario{
+	{
+		Name:   "core_default",
+		Module: "core",
+		Vars:   coreVars(nil),
+	},
+	{
+		Name:   "core_waf",
+		Module: "core",
+		Vars:   coreVars(map[string]interface{}{"enable_waf": true}),
+	},
+	{
+		Name:   "core_psc_neg",
+		Module: "core",
+		Vars:   coreVars(map[string]interface{}{"enable_demo_web_app_psc_neg": true}),
+	},
+	{
+		Name:   "core_psc_neg_same_project",
+		Module: "core",
+		Vars: coreVars(map[string]interface{}{
+			"enable_demo_web_app_psc_neg": true,
+			"demo_web_app_project_id":     "test-project",
+		}),
+	},
+	{
+		Name:   "demo_web_app_default",
+		Module: "demo-web-app",
+		Vars:   demoWebAppVars(nil),
+	},
+	{
+		Name:   "demo_web_app_psc",
+		Module: "demo-web-app",
+		Vars:   demoWebAppVars(map[string]interface{}{"enable_demo_web_app_psc_neg": true}),
+	},
+	{
+		Name:   "demo_web_app_psc_same_project",
+		Module: "demo-web-app",
+		Vars: demoWebAppVars(map[string]interface{}{
+			"enable_demo_web_app_psc_neg": true,
+			"demo_web_app_project_id":     "test-project",
+		}),
+	},
+	{
+		Name:   "demo_web_app_direct_backend",
+		Module: "demo-web-app",
+		Vars: demoWebAppVars(map[string]interface{}{
+			"enable_demo_web_app_psc_neg":      false,
+			"enable_demo_web_app_internal_alb": false,
+		}),
+	},
+}
+
+// Scenarios returns every registered scenario ordered by name
+func Scenarios() []Scenario {
+	out := make([]Scenario, len(scenarios))
+	for i, s := range scenarios {
+		out[i] = s.clone()
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Lookup returns the scenario registered under name
+func Lookup(name string) (Scenario, bool) {
+	for _, s := range scenarios {
+		if s.Name == name {
+			return s.clone(), true
+		}
+	}
+	return Scenario{}, false
+}
+
+// clone returns a copy whose Vars can be modified without touching the catalog
+func (s Scenario) clone() Scenario {
+	s.Vars = merge(s.Vars, nil)
+	return s
+}
+
+// ModuleDir returns the absolute path of a module under deploy/opentofu/gcp
+func ModuleDir(module string) string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "..", "deploy", "opentofu", "gcp", module)
+}
+
+func merge(base, overrides map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(base)+len(overrides))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range overrides {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,169 @@
+package planquery
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// TestingT is the subset of *testing.T the assertions need
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	FailNow()
+}
+
+// Require returns the single resource matching filters or stops the test
+func (p *Plan) Require(t TestingT, filters ...Filter) Resource {
+	t.Helper()
+	r, err := p.Find(filters...)
+	if err != nil {
+		t.Errorf("%v", err)
+		t.FailNow()
+	}
+	return r
+}
+
+// AssertExists checks that exactly one resource matches filters
+func (p *Plan) AssertExists(t TestingT, filters ...Filter) bool {
+	t.Helper()
+	if _, err := p.Find(filters...); err != nil {
+		t.Errorf("%v", err)
+		return false
+	}
+	return true
+}
+
+// AssertAbsent checks that no resource matches filters
+func (p *Plan) AssertAbsent(t TestingT, filters ...Filter) bool {
+	t.Helper()
+	matches := p.Resources(filters...)
+	if len(matches) == 0 {
+		return true
+	}
+	addresses := make([]string, len(matches))
+	for i, r := range matches {
+		addresses[i] = r.Address()
+	}
+	t.Errorf("expected no planned resource matching %s, found: %s", describe(filters), strings.Join(addresses, ", "))
+	return false
+}
+
+// AssertCount checks how many resources match filters
+func (p *Plan) AssertCount(t TestingT, want int, filters ...Filter) bool {
+	t.Helper()
+	matches := p.Resources(filters...)
+	if len(matches) == want {
+		return true
+	}
+	addresses := make([]string, len(matches))
+	for i, r := range matches {
+		addresses[i] = r.Address()
+	}
+	t.Errorf("expected %d planned resource(s) matching %s, found %d: [%s]",
+		want, describe(filters), len(matches), strings.Join(addresses, ", "))
+	return false
+}
+
+// AssertAction checks the planned action of the single resource matching filters
+func (p *Plan) AssertAction(t TestingT, want Action, filters ...Filter) bool {
+	t.Helper()
+	r, err := p.Find(filters...)
+	if err != nil {
+		t.Errorf("%v", err)
+		return false
+	}
+	return r.AssertAction(t, want)
+}
+
+// AssertCreate checks that the resource matching filters is planned for creation
+func (p *Plan) AssertCreate(t TestingT, filters ...Filter) bool {
+	t.Helper()
+	return p.AssertAction(t, Create, filters...)
+}
+
+// AssertUpdate checks that the resource matching filters is updated in place
+func (p *Plan) AssertUpdate(t TestingT, filters ...Filter) bool {
+	t.Helper()
+	return p.AssertAction(t, Update, filters...)
+}
+
+// AssertDelete checks that the resource matching filters is planned for deletion
+func (p *Plan) AssertDelete(t TestingT, filters ...Filter) bool {
+	t.Helper()
+	return p.AssertAction(t, Delete, filters...)
+}
+
+// AssertReplace checks that the resource matching filters is destroyed and recreated
+func (p *Plan) AssertReplace(t TestingT, filters ...Filter) bool {
+	t.Helper()
+	return p.AssertAction(t, Replace, filters...)
+}
+
+// AssertAction checks the resource's planned action
+func (r Resource) AssertAction(t TestingT, want Action) bool {
+	t.Helper()
+	if err := r.ExpectAction(want); err != nil {
+		t.Errorf("%v", err)
+		return false
+	}
+	return true
+}
+
+// ExpectAction returns an error when the resource's planned action differs from want
+func (r Resource) ExpectAction(want Action) error {
+	if got := r.Action(); got != want {
+		return fmt.Errorf("%s: expected %s, plan has %s", r.Address(), want, got)
+	}
+	return nil
+}
+
+// AssertAfter checks the planned value at path. Expected values are compared in
+// their JSON form, so ints match the float64 numbers decoded from the plan and
+// []string matches a list of strings.
+func (r Resource) AssertAfter(t TestingT, path string, expected interface{}) bool {
+	t.Helper()
+	if err := r.ExpectAfter(path, expected); err != nil {
+		t.Errorf("%v", err)
+		return false
+	}
+	return true
+}
+
+// ExpectAfter returns an error when the planned value at path differs from expected
+func (r Resource) ExpectAfter(path string, expected interface{}) error {
+	actual, err := r.After(path)
+	if err != nil {
+		return err
+	}
+	want, err := asJSON(expected)
+	if err != nil {
+		return fmt.Errorf("%s: cannot compare %s with %T: %w", r.Address(), path, expected, err)
+	}
+	if !reflect.DeepEqual(actual, want) {
+		return fmt.Errorf("%s: %s = %s, expected %s", r.Address(), path, render(actual), render(want))
+	}
+	return nil
+}
+
+// asJSON converts a Go value into the shape encoding/json decodes plans into
+func asJSON(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func render(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
@@ -0,0 +1,211 @@
+// Package planquery answers questions about a `tofu show -json` plan: which
+// resources match a type, name, module address or count index, what a nested
+// attribute is planned to be, and which action tofu will take. Lookups return
+// errors so callers outside `go test` (godog steps, CLI commands) can use them;
+// the Assert/Require helpers in assert.go wrap them for tests.
+package planquery
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// Plan indexes the resource changes of a parsed plan
+type Plan struct {
+	raw       *tfjson.Plan
+	resources []Resource
+}
+
+// New wraps a terratest PlanStruct
+func New(plan *terraform.PlanStruct) *Plan {
+	return FromJSON(plan.RawPlan)
+}
+
+// FromJSON wraps a decoded terraform-json plan
+func FromJSON(raw tfjson.Plan) *Plan {
+	p := &Plan{raw: &raw}
+	for _, change := range raw.ResourceChanges {
+		if change == nil || change.Change == nil {
+			continue
+		}
+		p.resources = append(p.resources, Resource{change: change})
+	}
+	sort.Slice(p.resources, func(i, j int) bool {
+		return p.resources[i].Address() < p.resources[j].Address()
+	})
+	return p
+}
+
+// Raw returns the underlying terraform-json plan
+func (p *Plan) Raw() *tfjson.Plan {
+	return p.raw
+}
+
+// Resources returns every resource change matching all filters, ordered by address
+func (p *Plan) Resources(filters ...Filter) []Resource {
+	var out []Resource
+	for _, r := range p.resources {
+		if matchesAll(r, filters) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Has reports whether at least one resource change matches all filters
+func (p *Plan) Has(filters ...Filter) bool {
+	return len(p.Resources(filters...)) > 0
+}
+
+// Find returns the single resource change matching all filters. It fails when
+// nothing matches or the filters are ambiguous, listing the candidates so the
+// failure explains itself.
+func (p *Plan) Find(filters ...Filter) (Resource, error) {
+	matches := p.Resources(filters...)
+	switch len(matches) {
+	case 1:
+		return matches[0], nil
+	case 0:
+		return Resource{}, fmt.Errorf("no planned resource matches %s%s", describe(filters), p.candidates(filters))
+	default:
+		addresses := make([]string, len(matches))
+		for i, r := range matches {
+			addresses[i] = r.Address()
+		}
+		return Resource{}, fmt.Errorf("%d planned resources match %s, expected exactly one: %s",
+			len(matches), describe(filters), strings.Join(addresses, ", "))
+	}
+}
+
+// candidates lists resources sharing the requested type (or every resource when
+// no type was given) to help spot typos and missing count indexes
+func (p *Plan) candidates(filters []Filter) string {
+	var related []Filter
+	for _, f := range filters {
+		if f.resourceType != "" {
+			related = append(related, Type(f.resourceType))
+		}
+	}
+
+	var addresses []string
+	for _, r := range p.Resources(related...) {
+		addresses = append(addresses, r.Address())
+	}
+	if len(addresses) == 0 {
+		return "; the plan has no resources of that type"
+	}
+	return "; planned candidates: " + strings.Join(addresses, ", ")
+}
+
+// Filter narrows a resource lookup
+type Filter struct {
+	kind  string
+	value string
+	// resourceType is set by filters that pin the type, for failure hints
+	resourceType string
+	match        func(Resource) bool
+}
+
+// Type matches the resource type, e.g. google_compute_network
+func Type(resourceType string) Filter {
+	return Filter{kind: "type", value: resourceType, resourceType: resourceType, match: func(r Resource) bool {
+		return r.Type() == resourceType
+	}}
+}
+
+// Name matches the resource name as written in the configuration
+func Name(name string) Filter {
+	return Filter{kind: "name", value: name, match: func(r Resource) bool {
+		return r.Name() == name
+	}}
+}
+
+// Module matches the module address, e.g. module.network; use Root for the root module
+func Module(address string) Filter {
+	return Filter{kind: "module", value: address, match: func(r Resource) bool {
+		return r.ModuleAddress() == address
+	}}
+}
+
+// Root matches resources declared in the root module
+func Root() Filter {
+	return Filter{kind: "module", value: "<root>", match: func(r Resource) bool {
+		return r.ModuleAddress() == ""
+	}}
+}
+
+// Index matches the count index (int) or for_each key (string) of an instance
+func Index(key interface{}) Filter {
+	want := normalizeIndex(key)
+	return Filter{kind: "index", value: fmt.Sprint(key), match: func(r Resource) bool {
+		return r.change.Index != nil && normalizeIndex(r.change.Index) == want
+	}}
+}
+
+// Address matches the full resource address, e.g. google_compute_network.ingress_vpc[0]
+func Address(address string) Filter {
+	return Filter{kind: "address", value: address, match: func(r Resource) bool {
+		return r.Address() == address
+	}}
+}
+
+// Managed matches managed resources, excluding data sources
+func Managed() Filter {
+	return Filter{kind: "mode", value: "managed", match: func(r Resource) bool {
+		return r.change.Mode == tfjson.ManagedResourceMode
+	}}
+}
+
+// Addr matches the type and name of a `<type>.<name>` reference such as
+// google_compute_network.ingress_vpc, in any module and at any index
+func Addr(typeAndName string) Filter {
+	resourceType, name, _ := strings.Cut(typeAndName, ".")
+	return Filter{kind: "resource", value: typeAndName, resourceType: resourceType, match: func(r Resource) bool {
+		return r.Type() == resourceType && r.Name() == name
+	}}
+}
+
+// Where matches resources accepted by fn; description names the filter in
+// failure messages
+func Where(description string, fn func(Resource) bool) Filter {
+	return Filter{kind: "where", value: description, match: fn}
+}
+
+func matchesAll(r Resource, filters []Filter) bool {
+	for _, f := range filters {
+		if !f.match(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func describe(filters []Filter) string {
+	if len(filters) == 0 {
+		return "(any)"
+	}
+	parts := make([]string, len(filters))
+	for i, f := range filters {
+		parts[i] = fmt.Sprintf("%s=%s", f.kind, f.value)
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+// normalizeIndex makes count indexes decoded from JSON (float64) comparable with
+// the ints callers pass
+func normalizeIndex(key interface{}) interface{} {
+	switch v := key.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	default:
+		return v
+	}
+}
@@ -0,0 +1,132 @@
+package planquery
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vibetics-cloudedge/tests/planfixture"
+)
+
+func loadPlan(t *testing.T, scenario string) *Plan {
+	t.Helper()
+	plan, err := planfixture.Load(scenario)
+	require.NoError(t, err)
+	return New(plan)
+}
+
+func TestFind(t *testing.T) {
+	t.Parallel()
+
+	plan := loadPlan(t, "demo_web_app_default")
+
+	r, err := plan.Find(Type("google_compute_network"), Name("web_vpc"), Index(0), Root())
+	require.NoError(t, err)
+	assert.Equal(t, "google_compute_network.web_vpc[0]", r.Address())
+
+	r, err = plan.Find(Addr("google_cloud_run_v2_service.web_app"))
+	require.NoError(t, err)
+	assert.Equal(t, Create, r.Action())
+
+	_, err = plan.Find(Addr("google_compute_network.web_vpc"), Index(1))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "planned candidates: google_compute_network.web_vpc[0]")
+
+	_, err = plan.Find(Type("google_compute_subnetwork"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "expected exactly one")
+
+	assert.False(t, plan.Has(Addr("google_compute_network.web_vpc"), Module("module.network")))
+	assert.Len(t, plan.Resources(Type("google_compute_subnetwork")), 2)
+}
+
+func TestAfterPaths(t *testing.T) {
+	t.Parallel()
+
+	plan := loadPlan(t, "demo_web_app_default")
+	service, err := plan.Find(Addr("google_cloud_run_v2_service.web_app"))
+	require.NoError(t, err)
+
+	image, err := service.AfterString("template.0.containers.0.image")
+	require.NoError(t, err)
+	assert.Equal(t, "us-docker.pkg.dev/cloudrun/container/hello", image)
+
+	assert.NoError(t, service.ExpectAfter("template.0.containers.0.ports.0.container_port", 3000))
+
+	_, err = service.After("template.0.containers.3.image")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "template.0.containers has 1 element(s); index 3 is out of range")
+
+	_, err = service.After("template.0.no_such_block")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `template.0 has no attribute "no_such_block"`)
+
+	_, err = service.After("uri")
+	assert.True(t, errors.Is(err, ErrUnknown), "uri should be known after apply, got %v", err)
+
+	err = service.ExpectAfter("ingress", "INGRESS_TRAFFIC_ALL")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `ingress = "INGRESS_TRAFFIC_INTERNAL_LOAD_BALANCER", expected "INGRESS_TRAFFIC_ALL"`)
+}
+
+func TestActions(t *testing.T) {
+	t.Parallel()
+
+	change := func(address string, actions ...tfjson.Action) *tfjson.ResourceChange {
+		return &tfjson.ResourceChange{
+			Address: address,
+			Mode:    tfjson.ManagedResourceMode,
+			Type:    "google_compute_firewall",
+			Name:    address[len("google_compute_firewall."):],
+			Change:  &tfjson.Change{Actions: actions},
+		}
+	}
+	plan := FromJSON(tfjson.Plan{ResourceChanges: []*tfjson.ResourceChange{
+		change("google_compute_firewall.created", tfjson.ActionCreate),
+		change("google_compute_firewall.updated", tfjson.ActionUpdate),
+		change("google_compute_firewall.deleted", tfjson.ActionDelete),
+		change("google_compute_firewall.replaced", tfjson.ActionDelete, tfjson.ActionCreate),
+		change("google_compute_firewall.replaced_cbd", tfjson.ActionCreate, tfjson.ActionDelete),
+	}})
+
+	assert.True(t, plan.AssertCreate(t, Name("created")))
+	assert.True(t, plan.AssertUpdate(t, Name("updated")))
+	assert.True(t, plan.AssertDelete(t, Name("deleted")))
+	assert.True(t, plan.AssertReplace(t, Name("replaced")))
+	assert.True(t, plan.AssertReplace(t, Name("replaced_cbd")))
+
+	r, err := plan.Find(Name("replaced"))
+	require.NoError(t, err)
+	assert.EqualError(t, r.ExpectAction(Update), "google_compute_firewall.replaced: expected update, plan has replace")
+}
+
+// recorder captures assertion failures so their messages can be checked
+type recorder struct {
+	errors []string
+}
+
+func (r *recorder) Helper()  {}
+func (r *recorder) FailNow() {}
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertionMessages(t *testing.T) {
+	t.Parallel()
+
+	plan := loadPlan(t, "core_default")
+	rec := &recorder{}
+
+	assert.False(t, plan.AssertAbsent(rec, Type("google_compute_network")))
+	assert.False(t, plan.AssertExists(rec, Addr("google_compute_region_security_policy.edge_waf_policy")))
+	assert.False(t, plan.AssertCount(rec, 3, Type("google_compute_subnetwork")))
+
+	require.Len(t, rec.errors, 3)
+	assert.Equal(t, "expected no planned resource matching [type=google_compute_network], found: google_compute_network.ingress_vpc", rec.errors[0])
+	assert.Equal(t, "no planned resource matches [resource=google_compute_region_security_policy.edge_waf_policy]; the plan has no resources of that type", rec.errors[1])
+	assert.Contains(t, rec.errors[2], "expected 3 planned resource(s) matching [type=google_compute_subnetwork], found 2")
+}
@@ -0,0 +1,196 @@
+package planquery
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// Action summarizes what tofu plans to do with a resource instance
+type Action string
+
+const (
+	Create  Action = "create"
+	Update  Action = "update"
+	Delete  Action = "delete"
+	Replace Action = "replace"
+	Read    Action = "read"
+	NoOp    Action = "no-op"
+)
+
+// ErrUnknown is returned when an attribute is only known after apply
+var ErrUnknown = errors.New("known after apply")
+
+// Resource is one planned resource instance change
+type Resource struct {
+	change *tfjson.ResourceChange
+}
+
+// Address returns the full instance address, e.g. module.x.google_compute_network.vpc[0]
+func (r Resource) Address() string { return r.change.Address }
+
+// Type returns the resource type
+func (r Resource) Type() string { return r.change.Type }
+
+// Name returns the resource name
+func (r Resource) Name() string { return r.change.Name }
+
+// ModuleAddress returns the module address, empty for the root module
+func (r Resource) ModuleAddress() string { return r.change.ModuleAddress }
+
+// Index returns the count index (float64) or for_each key (string), nil for single instances
+func (r Resource) Index() interface{} { return r.change.Index }
+
+// Change exposes the raw terraform-json change
+func (r Resource) Change() *tfjson.ResourceChange { return r.change }
+
+// Action returns the planned action, folding delete+create pairs into Replace
+func (r Resource) Action() Action {
+	actions := r.change.Change.Actions
+	switch {
+	case actions.Replace():
+		return Replace
+	case actions.Create():
+		return Create
+	case actions.Update():
+		return Update
+	case actions.Delete():
+		return Delete
+	case actions.Read():
+		return Read
+	case actions.NoOp():
+		return NoOp
+	}
+	parts := make([]string, len(actions))
+	for i, a := range actions {
+		parts[i] = string(a)
+	}
+	return Action(strings.Join(parts, "+"))
+}
+
+// After returns the planned value at path, e.g. template.0.containers.0.image.
+// Values tofu cannot know until apply yield ErrUnknown.
+func (r Resource) After(path string) (interface{}, error) {
+	if isUnknown(r.change.Change.AfterUnknown, path) {
+		return nil, fmt.Errorf("%s: %s is %w", r.Address(), path, ErrUnknown)
+	}
+	value, err := lookup(r.change.Change.After, path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", r.Address(), err)
+	}
+	return value, nil
+}
+
+// Before returns the prior value at path; it fails for resources being created
+func (r Resource) Before(path string) (interface{}, error) {
+	value, err := lookup(r.change.Change.Before, path)
+	if err != nil {
+		return nil, fmt.Errorf("%s (before): %w", r.Address(), err)
+	}
+	return value, nil
+}
+
+// AfterString returns the planned value at path as a string
+func (r Resource) AfterString(path string) (string, error) {
+	value, err := r.After(path)
+	if err != nil {
+		return "", err
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("%s: %s is %T (%v), not a string", r.Address(), path, value, value)
+	}
+	return s, nil
+}
+
+// AfterList returns the planned value at path as a list
+func (r Resource) AfterList(path string) ([]interface{}, error) {
+	value, err := r.After(path)
+	if err != nil {
+		return nil, err
+	}
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: %s is %T (%v), not a list", r.Address(), path, value, value)
+	}
+	return list, nil
+}
+
+// Unknown reports whether the value at path is only known after apply
+func (r Resource) Unknown(path string) bool {
+	return isUnknown(r.change.Change.AfterUnknown, path)
+}
+
+// lookup walks a decoded JSON value along a dotted path. Numeric segments index
+// lists (nested blocks are lists in plan JSON); other segments are object keys.
+func lookup(root interface{}, path string) (interface{}, error) {
+	current := root
+	walked := make([]string, 0, 4)
+	for _, segment := range splitPath(path) {
+		where := strings.Join(walked, ".")
+		if where == "" {
+			where = "<root>"
+		}
+		switch node := current.(type) {
+		case map[string]interface{}:
+			next, ok := node[segment]
+			if !ok {
+				return nil, fmt.Errorf("%s has no attribute %q (has: %s)", where, segment, keys(node))
+			}
+			current = next
+		case []interface{}:
+			i, err := strconv.Atoi(segment)
+			if err != nil {
+				return nil, fmt.Errorf("%s is a list; segment %q is not an index", where, segment)
+			}
+			if i < 0 || i >= len(node) {
+				return nil, fmt.Errorf("%s has %d element(s); index %d is out of range", where, len(node), i)
+			}
+			current = node[i]
+		case nil:
+			return nil, fmt.Errorf("%s is null; cannot read %q", where, segment)
+		default:
+			return nil, fmt.Errorf("%s is %T (%v); cannot read %q", where, node, node, segment)
+		}
+		walked = append(walked, segment)
+	}
+	return current, nil
+}
+
+// isUnknown walks after_unknown, which mirrors the shape of after with true at
+// unknown leaves. A true ancestor means the whole subtree is unknown.
+func isUnknown(afterUnknown interface{}, path string) bool {
+	current := afterUnknown
+	for _, segment := range splitPath(path) {
+		if b, ok := current.(bool); ok {
+			return b
+		}
+		next, err := lookup(current, segment)
+		if err != nil {
+			return false
+		}
+		current = next
+	}
+	b, ok := current.(bool)
+	return ok && b
+}
+
+func splitPath(path string) []string {
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, ".")
+}
+
+func keys(m map[string]interface{}) string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return strings.Join(out, ", ")
+}
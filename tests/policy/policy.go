@@ -0,0 +1,327 @@
+// Package policy evaluates CEL policies against `tofu show -json` plans, so
+// the repository's own rules run inside `go test` without an external
+// scanner. The bundle under bundle/ ships with the package; teams add their
+// own policy directories next to it. Policies report through the compliance
+// package, one control per policy and one finding per resource.
+package policy
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
+	tfjson "github.com/hashicorp/terraform-json"
+	"gopkg.in/yaml.v3"
+
+	"vibetics-cloudedge/tests/compliance"
+)
+
+// FileVersion is the policy file format this package understands
+const FileVersion = 1
+
+// DirsEnv lists extra policy directories, separated like PATH
+const DirsEnv = "CLOUDEDGE_POLICY_DIRS"
+
+// PlanAddress is the address plan-level policies report their finding under
+const PlanAddress = "plan"
+
+//go:embed bundle/*.yaml
+var bundle embed.FS
+
+// File is one policy file
+type File struct {
+	Version  int      `yaml:"version"`
+	Policies []Policy `yaml:"policies"`
+}
+
+// Policy is one rule. A policy with resource types is evaluated once per
+// planned resource of those types and sees it as `resource`; one without is
+// evaluated once per plan. Every policy sees the plan's input variables as
+// `variables`.
+type Policy struct {
+	ID            string   `yaml:"id"`
+	Title         string   `yaml:"title"`
+	ResourceTypes []string `yaml:"resource_types"`
+	// When is a CEL condition; the policy does not apply where it is false.
+	// Empty means always.
+	When string `yaml:"when"`
+	// Assert is the CEL condition that must hold
+	Assert string `yaml:"assert"`
+	// Message is a CEL string expression describing a violation. Empty
+	// reports the title.
+	Message     string `yaml:"message"`
+	Remediation string `yaml:"remediation"`
+
+	source string
+}
+
+// Bundled returns the policies that ship with the package
+func Bundled() ([]Policy, error) {
+	return loadFS(bundle, "bundle")
+}
+
+// LoadDir reads every .yaml and .yml policy file in dir, in name order
+func LoadDir(dir string) ([]Policy, error) {
+	return loadFS(os.DirFS(dir), ".")
+}
+
+// DirsFromEnv returns the directories listed in DirsEnv
+func DirsFromEnv() []string {
+	var dirs []string
+	for _, dir := range strings.Split(os.Getenv(DirsEnv), string(os.PathListSeparator)) {
+		if dir = strings.TrimSpace(dir); dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+func loadFS(fsys fs.FS, dir string) ([]Policy, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	var policies []Policy
+	for _, entry := range entries {
+		suffix := path.Ext(entry.Name())
+		if entry.IsDir() || (suffix != ".yaml" && suffix != ".yml") {
+			continue
+		}
+		name := path.Join(dir, entry.Name())
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		var f File
+		if err := yaml.Unmarshal(data, &f); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if f.Version != FileVersion {
+			return nil, fmt.Errorf("%s: policy file version %d is not supported (want %d)", name, f.Version, FileVersion)
+		}
+		for _, p := range f.Policies {
+			p.source = name
+			policies = append(policies, p)
+		}
+	}
+	return policies, nil
+}
+
+// compiled is a policy with its CEL programs
+type compiled struct {
+	Policy
+	when, assert, message cel.Program
+}
+
+// Engine evaluates a set of compiled policies
+type Engine struct {
+	policies []compiled
+}
+
+// Load compiles the bundled policies together with those in dirs
+func Load(dirs ...string) (*Engine, error) {
+	policies, err := Bundled()
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range dirs {
+		more, err := LoadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, more...)
+	}
+	return Compile(policies)
+}
+
+// Compile type-checks policies. IDs must be unique, so a custom policy cannot
+// quietly replace a bundled one.
+func Compile(policies []Policy) (*Engine, error) {
+	env, err := cel.NewEnv(
+		cel.Variable("resource", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("variables", cel.MapType(cel.StringType, cel.DynType)),
+		ext.Strings(),
+		ext.Sets(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	e := &Engine{}
+	seen := map[string]string{}
+	for _, p := range policies {
+		where := p.source
+		if where == "" {
+			where = "policy " + p.ID
+		}
+		if p.ID == "" {
+			return nil, fmt.Errorf("%s: policy %q has no id", where, p.Title)
+		}
+		if other, ok := seen[p.ID]; ok {
+			return nil, fmt.Errorf("%s: policy %s is already defined in %s", where, p.ID, other)
+		}
+		seen[p.ID] = where
+		if strings.TrimSpace(p.Assert) == "" {
+			return nil, fmt.Errorf("%s: policy %s has no assert", where, p.ID)
+		}
+
+		c := compiled{Policy: p}
+		for _, expr := range []struct {
+			field string
+			src   string
+			want  *cel.Type
+			prg   *cel.Program
+		}{
+			{"when", p.When, cel.BoolType, &c.when},
+			{"assert", p.Assert, cel.BoolType, &c.assert},
+			{"message", p.Message, cel.StringType, &c.message},
+		} {
+			if strings.TrimSpace(expr.src) == "" {
+				continue
+			}
+			ast, issues := env.Compile(expr.src)
+			if issues.Err() != nil {
+				return nil, fmt.Errorf("%s: policy %s %s: %w", where, p.ID, expr.field, issues.Err())
+			}
+			if out := ast.OutputType(); !out.IsExactType(expr.want) && !out.IsExactType(cel.DynType) {
+				return nil, fmt.Errorf("%s: policy %s %s is %s, want %s", where, p.ID, expr.field, out, expr.want)
+			}
+			if *expr.prg, err = env.Program(ast); err != nil {
+				return nil, fmt.Errorf("%s: policy %s %s: %w", where, p.ID, expr.field, err)
+			}
+		}
+		e.policies = append(e.policies, c)
+	}
+	return e, nil
+}
+
+// IDs returns the IDs of the engine's policies in evaluation order
+func (e *Engine) IDs() []string {
+	ids := make([]string, len(e.policies))
+	for i, p := range e.policies {
+		ids[i] = p.ID
+	}
+	return ids
+}
+
+// Evaluate runs every policy against the plan. A policy whose expression
+// cannot be evaluated, such as one reading an attribute the resource lacks,
+// fails with the error as its detail.
+func (e *Engine) Evaluate(plan *tfjson.Plan) *compliance.Report {
+	variables := map[string]interface{}{}
+	for name, v := range plan.Variables {
+		if v != nil {
+			variables[name] = v.Value
+		}
+	}
+	inv := compliance.FromPlan(plan)
+
+	controls := make([]compliance.Control, len(e.policies))
+	for i, p := range e.policies {
+		p := p
+		controls[i] = compliance.Control{
+			ID:          p.ID,
+			Title:       p.Title,
+			Remediation: p.Remediation,
+			Evaluate: func(inv compliance.Inventory) []compliance.Finding {
+				if len(p.ResourceTypes) == 0 {
+					return []compliance.Finding{p.evaluate(PlanAddress, map[string]interface{}{
+						"resource":  map[string]interface{}{},
+						"variables": variables,
+					})}
+				}
+				var findings []compliance.Finding
+				for _, r := range inv.OfType(p.ResourceTypes...) {
+					findings = append(findings, p.evaluate(r.Address, map[string]interface{}{
+						"resource":  resourceValue(r),
+						"variables": variables,
+					}))
+				}
+				return findings
+			},
+		}
+	}
+	return compliance.EvaluateControls("policy", controls, inv)
+}
+
+func (p compiled) evaluate(address string, activation map[string]interface{}) compliance.Finding {
+	if p.when != nil {
+		applies, err := evalBool(p.when, activation)
+		if err != nil {
+			return compliance.Finding{Address: address, Status: compliance.Fail, Detail: "evaluating when: " + err.Error()}
+		}
+		if !applies {
+			return compliance.Finding{Address: address, Status: compliance.NotApplicable, Detail: "condition does not hold"}
+		}
+	}
+	holds, err := evalBool(p.assert, activation)
+	if err != nil {
+		return compliance.Finding{Address: address, Status: compliance.Fail, Detail: "evaluating assert: " + err.Error()}
+	}
+	if holds {
+		return compliance.Finding{Address: address, Status: compliance.Pass, Detail: p.Title}
+	}
+	detail := p.Title
+	if p.message != nil {
+		if out, _, err := p.message.Eval(activation); err == nil {
+			if s, ok := out.Value().(string); ok {
+				detail = s
+			}
+		}
+	}
+	return compliance.Finding{Address: address, Status: compliance.Fail, Detail: detail}
+}
+
+func evalBool(prg cel.Program, activation map[string]interface{}) (bool, error) {
+	out, _, err := prg.Eval(activation)
+	if err != nil {
+		return false, err
+	}
+	b, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("result is %s, want bool", out.Type())
+	}
+	return b, nil
+}
+
+// resourceValue is what a policy sees as `resource`: address, type, name,
+// the planned values, the names of the attributes known only after apply,
+// and the references of each attribute's configuration expression
+func resourceValue(r compliance.Resource) map[string]interface{} {
+	values := r.Values
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+	unknown := []interface{}{}
+	var names []string
+	for attr := range r.Unknown {
+		if r.IsUnknown(attr) {
+			names = append(names, attr)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		unknown = append(unknown, name)
+	}
+	references := map[string]interface{}{}
+	for attr, refs := range r.References {
+		list := make([]interface{}, len(refs))
+		for i, ref := range refs {
+			list[i] = ref
+		}
+		references[attr] = list
+	}
+	return map[string]interface{}{
+		"address":    r.Address,
+		"type":       r.Type,
+		"name":       r.Name,
+		"values":     values,
+		"unknown":    unknown,
+		"references": references,
+	}
+}
@@ -0,0 +1,137 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vibetics-cloudedge/tests/compliance"
+	"vibetics-cloudedge/tests/planfixture"
+)
+
+func loadPlan(t *testing.T, scenario string) *tfjson.Plan {
+	t.Helper()
+	plan, err := planfixture.Load(scenario)
+	require.NoError(t, err)
+	return &plan.RawPlan
+}
+
+// change returns the planned change of the resource at address
+func change(t *testing.T, plan *tfjson.Plan, address string) *tfjson.Change {
+	t.Helper()
+	for _, rc := range plan.ResourceChanges {
+		if rc.Address == address {
+			return rc.Change
+		}
+	}
+	require.FailNow(t, "no planned change", address)
+	return nil
+}
+
+func failures(report *compliance.Report) map[string][]string {
+	out := map[string][]string{}
+	for _, result := range report.Failed() {
+		for _, f := range result.Evidence {
+			if f.Status == compliance.Fail {
+				out[result.Control] = append(out[result.Control], f.Address+": "+f.Detail)
+			}
+		}
+	}
+	return out
+}
+
+func TestBundlePassesRecordedPlans(t *testing.T) {
+	t.Parallel()
+	engine, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"CE-001", "CE-002", "CE-003"}, engine.IDs())
+
+	for _, scenario := range planfixture.Scenarios() {
+		report := engine.Evaluate(loadPlan(t, scenario.Name))
+		assert.Empty(t, report.Failed(), scenario.Name)
+	}
+
+	report := engine.Evaluate(loadPlan(t, "demo_web_app_default"))
+	run, _ := report.Result("CE-001")
+	assert.Equal(t, compliance.Pass, run.Status)
+	assert.Equal(t, "google_cloud_run_v2_service.web_app[0]", run.Evidence[0].Address)
+}
+
+func TestBundleReportsViolations(t *testing.T) {
+	t.Parallel()
+	engine, err := Load()
+	require.NoError(t, err)
+
+	// Cloud Run reachable directly
+	plan := loadPlan(t, "demo_web_app_default")
+	change(t, plan, "google_cloud_run_v2_service.web_app[0]").After.(map[string]interface{})["ingress"] = "INGRESS_TRAFFIC_ALL"
+	assert.Equal(t, map[string][]string{
+		"CE-001": {"google_cloud_run_v2_service.web_app[0]: ingress is INGRESS_TRAFFIC_ALL"},
+	}, failures(engine.Evaluate(plan)))
+
+	// WAF enabled without the policy on the backend, in production, open to
+	// the internet
+	plan = loadPlan(t, "core_psc_neg")
+	plan.Variables["enable_waf"].Value = true
+	plan.Variables["project_suffix"].Value = "prod"
+	assert.Equal(t, map[string][]string{
+		"CE-002": {"google_compute_region_backend_service.demo_web_app_external_backend[0]: enable_waf is true but security_policy is not set"},
+		"CE-003": {"plan: allowed_https_source_ranges is 0.0.0.0/0"},
+	}, failures(engine.Evaluate(plan)))
+
+	// a policy only known after apply counts as attached
+	backend := change(t, plan, "google_compute_region_backend_service.demo_web_app_external_backend[0]")
+	delete(backend.After.(map[string]interface{}), "security_policy")
+	backend.AfterUnknown.(map[string]interface{})["security_policy"] = true
+	plan.Variables["allowed_https_source_ranges"].Value = []interface{}{"35.191.0.0/16", "130.211.0.0/22"}
+	report := engine.Evaluate(plan)
+	assert.Empty(t, report.Failed())
+	waf, _ := report.Result("CE-002")
+	assert.Equal(t, compliance.Pass, waf.Status)
+	prod, _ := report.Result("CE-003")
+	assert.Equal(t, compliance.Pass, prod.Status)
+}
+
+func TestCustomPolicyDirectory(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "team.yaml"), []byte(`version: 1
+policies:
+  - id: TEAM-1
+    title: Firewalls log their connections
+    resource_types: [google_compute_firewall]
+    assert: has(resource.values.log_config) && size(resource.values.log_config) > 0
+    message: '"%s has no log_config".format([resource.values.name])'
+`), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("not a policy"), 0o600))
+
+	engine, err := Load(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"CE-001", "CE-002", "CE-003", "TEAM-1"}, engine.IDs())
+	assert.Equal(t, map[string][]string{
+		"TEAM-1": {"google_compute_firewall.allow_ingress_vpc_https_ingress: nonprod-allow-https has no log_config"},
+	}, failures(engine.Evaluate(loadPlan(t, "core_default"))))
+}
+
+func TestCompileRejectsBadPolicies(t *testing.T) {
+	t.Parallel()
+	for name, tc := range map[string]struct {
+		policies []Policy
+		err      string
+	}{
+		"duplicate id": {[]Policy{{ID: "CE-001", Assert: "true"}}, "already defined"},
+		"no id":        {[]Policy{{Title: "nameless", Assert: "true"}}, "has no id"},
+		"no assert":    {[]Policy{{ID: "X-1"}}, "has no assert"},
+		"syntax":       {[]Policy{{ID: "X-1", Assert: "resource.values.("}}, "X-1 assert"},
+		"not bool":     {[]Policy{{ID: "X-1", Assert: `"yes"`}}, "assert is string, want bool"},
+	} {
+		bundled, err := Bundled()
+		require.NoError(t, err)
+		_, err = Compile(append(bundled, tc.policies...))
+		assert.ErrorContains(t, err, tc.err, name)
+	}
+}
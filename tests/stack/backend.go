@@ -0,0 +1,121 @@
+package stack
+
+import (
+	"fmt"
+	"path"
+
+	"vibetics-cloudedge/tests/modcontract"
+	"vibetics-cloudedge/tests/planfixture"
+)
+
+// StateLocation is where the gcs backend keeps one module's default workspace
+type StateLocation struct {
+	Bucket string
+	Prefix string
+}
+
+// StateObject is the state file's object name
+func (l StateLocation) StateObject() string { return path.Join(l.Prefix, "default.tfstate") }
+
+// LockObject is the object that exists while the state is locked
+func (l StateLocation) LockObject() string { return path.Join(l.Prefix, "default.tflock") }
+
+// RemoteStates returns where core reads the project-singleton and demo-web-app
+// state for the given core variables, mirroring its terraform_remote_state
+// blocks: ${project_id}-tfstate/${project_id}-singleton and
+// ${demo_web_app_project_id}-tfstate/${demo_web_app_service_name}
+func RemoteStates(coreVars map[string]interface{}) (map[string]StateLocation, error) {
+	core, err := modcontract.LoadModule(planfixture.ModuleDir("core"))
+	if err != nil {
+		return nil, err
+	}
+	locals := map[string]string{}
+	for _, name := range []string{"project_id", "demo_web_app_project_id", "demo_web_app_service_name"} {
+		value, err := core.Local(name, coreVars)
+		if err != nil {
+			return nil, fmt.Errorf("evaluating core local.%s: %w", name, err)
+		}
+		locals[name] = fmt.Sprint(value)
+	}
+	return map[string]StateLocation{
+		"project-singleton": {Bucket: locals["project_id"] + "-tfstate", Prefix: locals["project_id"] + "-singleton"},
+		"demo-web-app":      {Bucket: locals["demo_web_app_project_id"] + "-tfstate", Prefix: locals["demo_web_app_service_name"]},
+	}, nil
+}
+
+// stateLocals are the core locals the state locations are evaluated from
+var stateLocals = []string{"project_id", "demo_web_app_project_id", "demo_web_app_service_name", "name_prefix"}
+
+// EnvVars returns the core variables StateLocations needs from the TF_VAR_*
+// entries of environ, parsed by their declared types as tofu does, so a
+// list-typed TF_VAR_allowed_https_source_ranges neither breaks nor matters.
+func EnvVars(environ []string) (map[string]interface{}, error) {
+	core, err := modcontract.LoadModule(planfixture.ModuleDir("core"))
+	if err != nil {
+		return nil, err
+	}
+	vars, err := core.EnvVars(environ, stateLocals...)
+	if err != nil {
+		return nil, fmt.Errorf("reading core variables from TF_VAR_*: %w", err)
+	}
+	return vars, nil
+}
+
+// StateLocations returns where each module keeps its state for the core
+// variables: the prefixes core's terraform_remote_state blocks read for
+// project-singleton and demo-web-app, and ${project_id}-core for core itself.
+// A resource_name_prefix moves the demo-web-app and core state with the
+// names, so stacks with different prefixes keep separate state; the
+// project-singleton state is shared.
+func StateLocations(coreVars map[string]interface{}) (map[string]StateLocation, error) {
+	locations, err := RemoteStates(coreVars)
+	if err != nil {
+		return nil, err
+	}
+	core, err := modcontract.LoadModule(planfixture.ModuleDir("core"))
+	if err != nil {
+		return nil, err
+	}
+	projectID, err := core.Local("project_id", coreVars)
+	if err != nil {
+		return nil, fmt.Errorf("evaluating core local.project_id: %w", err)
+	}
+	namePrefix, err := core.Local("name_prefix", coreVars)
+	if err != nil {
+		return nil, fmt.Errorf("evaluating core local.name_prefix: %w", err)
+	}
+	locations["core"] = StateLocation{Bucket: fmt.Sprintf("%s-tfstate", projectID), Prefix: fmt.Sprintf("%s-%score", projectID, namePrefix)}
+	return locations, nil
+}
+
+// UseBackend gives every stage the gcs backend config it shares with the
+// others, so core's remote state reads find what the earlier stages wrote.
+// The locations follow the core stage's variables. env is added to every
+// stage's EnvVars, e.g. fakegcs BackendEnv for an emulated bucket.
+func (s *Stack) UseBackend(env map[string]string) error {
+	core := s.Stage("core")
+	if core == nil {
+		return fmt.Errorf("the stack has no core stage to derive state locations from")
+	}
+	locations, err := StateLocations(core.Options.Vars)
+	if err != nil {
+		return err
+	}
+	for _, stage := range s.Stages {
+		loc, ok := locations[stage.Module]
+		if !ok {
+			return fmt.Errorf("no state location for module %s", stage.Module)
+		}
+		stage.Options.BackendConfig = map[string]interface{}{"bucket": loc.Bucket, "prefix": loc.Prefix}
+		if len(env) == 0 {
+			continue
+		}
+		if stage.Options.EnvVars == nil {
+			stage.Options.EnvVars = map[string]string{}
+		}
+		for k, v := range env {
+			stage.Options.EnvVars[k] = v
+		}
+	}
+	return nil
+}
@@ -0,0 +1,335 @@
+// Package stack deploys several modules as one stack for full-stack tests.
+// The apply order comes from the modules' terraform_remote_state blocks: a
+// module is applied after every module whose state it reads, so the default
+// stack runs project-singleton, demo-web-app, then core. Teardown walks the
+// applied modules in reverse, including after a failed apply or validation,
+// and a run can resume from a named stage the way test_structure.RunTestStage
+// stages are skipped. A module is kept while a module reading its state failed
+// to destroy.
+package stack
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+	"github.com/gruntwork-io/terratest/modules/testing"
+
+	"vibetics-cloudedge/tests/modcontract"
+	"vibetics-cloudedge/tests/testconfig"
+)
+
+// ValidateStage is the stage between the applies and the destroys
+const ValidateStage = "validate"
+
+// ApplyStage names the stage that applies module, e.g. apply_project_singleton.
+// Setting SKIP_<stage> skips it, as with test_structure.RunTestStage.
+func ApplyStage(module string) string { return "apply_" + stageSuffix(module) }
+
+// DestroyStage names the stage that destroys module
+func DestroyStage(module string) string { return "destroy_" + stageSuffix(module) }
+
+func stageSuffix(module string) string { return strings.ReplaceAll(module, "-", "_") }
+
+// Stage is one module of the stack
+type Stage struct {
+	Module  string
+	Options *terraform.Options
+	// DependsOn lists the modules in the stack whose state this one reads
+	DependsOn []string
+}
+
+// Stack is an ordered set of module deployments
+type Stack struct {
+	// Stages are in apply order
+	Stages []*Stage
+	// DataDir keeps each stage's options in the test_structure layout, so a
+	// resumed run destroys what an earlier run applied with the same
+	// variables. Empty keeps nothing.
+	DataDir string
+	// ResumeFrom names the first stage to run. Earlier stages are skipped and
+	// their modules count as applied, so they are still destroyed.
+	ResumeFrom string
+
+	applied []*Stage
+	kept    []string
+	apply   func(testing.TestingT, *terraform.Options) (string, error)
+	destroy func(testing.TestingT, *terraform.Options) (string, error)
+}
+
+// New orders the modules by their terraform_remote_state references. Each
+// module is parsed from its options' TerraformDir. A reference to a module
+// outside the stack adds no dependency; that state must already exist.
+func New(options map[string]*terraform.Options) (*Stack, error) {
+	stages := map[string]*Stage{}
+	for module, opts := range options {
+		if opts == nil {
+			return nil, fmt.Errorf("module %s has no options", module)
+		}
+		m, err := modcontract.LoadModule(opts.TerraformDir)
+		if err != nil {
+			return nil, fmt.Errorf("module %s: %w", module, err)
+		}
+		stage := &Stage{Module: module, Options: opts}
+		for dataSource := range m.RemoteStates {
+			producer, err := modcontract.StateProducers{}.Resolve(dataSource, testconfig.Modules)
+			if err != nil {
+				return nil, fmt.Errorf("module %s: %w", module, err)
+			}
+			if _, ok := options[producer]; ok && producer != module {
+				stage.DependsOn = append(stage.DependsOn, producer)
+			}
+		}
+		sort.Strings(stage.DependsOn)
+		stages[module] = stage
+	}
+
+	ordered, err := order(stages)
+	if err != nil {
+		return nil, err
+	}
+	return &Stack{Stages: ordered, apply: terraform.InitAndApplyE, destroy: terraform.DestroyE}, nil
+}
+
+// ForProfile builds a stack of the modules (all of testconfig.Modules when
+// none are given) from the profile, with each module's overrides on top
+func ForProfile(profile *testconfig.Profile, overrides map[string]map[string]interface{}, modules ...string) (*Stack, error) {
+	if len(modules) == 0 {
+		modules = testconfig.Modules
+	}
+	options := map[string]*terraform.Options{}
+	for _, module := range modules {
+		opts, err := profile.Options(module, overrides[module])
+		if err != nil {
+			return nil, err
+		}
+		options[module] = opts
+	}
+	return New(options)
+}
+
+// order sorts the stages so each follows its dependencies. Independent
+// modules keep the order of testconfig.Modules, then sort by name.
+func order(stages map[string]*Stage) ([]*Stage, error) {
+	names := make([]string, 0, len(stages))
+	for name := range stages {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := rank(names[i]), rank(names[j])
+		if a != b {
+			return a < b
+		}
+		return names[i] < names[j]
+	})
+
+	var ordered []*Stage
+	done := map[string]bool{}
+	for len(ordered) < len(names) {
+		progressed := false
+		for _, name := range names {
+			if done[name] || !allDone(stages[name].DependsOn, done) {
+				continue
+			}
+			ordered = append(ordered, stages[name])
+			done[name] = true
+			progressed = true
+			break
+		}
+		if !progressed {
+			var stuck []string
+			for _, name := range names {
+				if !done[name] {
+					stuck = append(stuck, fmt.Sprintf("%s (reads %s)", name, strings.Join(stages[name].DependsOn, ", ")))
+				}
+			}
+			return nil, fmt.Errorf("modules read each other's state in a cycle: %s", strings.Join(stuck, "; "))
+		}
+	}
+	return ordered, nil
+}
+
+func rank(module string) int {
+	for i, m := range testconfig.Modules {
+		if m == module {
+			return i
+		}
+	}
+	return len(testconfig.Modules)
+}
+
+func allDone(modules []string, done map[string]bool) bool {
+	for _, m := range modules {
+		if !done[m] {
+			return false
+		}
+	}
+	return true
+}
+
+// Stage returns the stage deploying module, or nil
+func (s *Stack) Stage(module string) *Stage {
+	for _, stage := range s.Stages {
+		if stage.Module == module {
+			return stage
+		}
+	}
+	return nil
+}
+
+// Order lists the modules in apply order
+func (s *Stack) Order() []string {
+	modules := make([]string, len(s.Stages))
+	for i, stage := range s.Stages {
+		modules[i] = stage.Module
+	}
+	return modules
+}
+
+// StageNames lists every stage in run order: the applies, validate, then the
+// destroys in reverse
+func (s *Stack) StageNames() []string {
+	var names []string
+	for _, stage := range s.Stages {
+		names = append(names, ApplyStage(stage.Module))
+	}
+	names = append(names, ValidateStage)
+	for i := len(s.Stages) - 1; i >= 0; i-- {
+		names = append(names, DestroyStage(s.Stages[i].Module))
+	}
+	return names
+}
+
+// Applied lists the modules this run applied or took as applied, in order
+func (s *Stack) Applied() []string {
+	modules := make([]string, len(s.applied))
+	for i, stage := range s.applied {
+		modules[i] = stage.Module
+	}
+	return modules
+}
+
+// Kept lists the modules teardown left deployed because a module reading
+// their state failed to destroy
+func (s *Stack) Kept() []string { return s.kept }
+
+// Run applies every stage in order and then calls validate. Whatever was
+// applied is destroyed in reverse order afterwards, also when an apply fails
+// or validate stops the test. A failed apply is destroyed too, since it can
+// leave resources behind, and stops the applies after it. Failures are
+// reported on t; destroys carry on past a failed one, except to the modules
+// the failed one reads state from.
+func (s *Stack) Run(t testing.TestingT, validate func(*Stack)) {
+	names := s.StageNames()
+	if s.ResumeFrom != "" && !contains(names, s.ResumeFrom) {
+		t.Fatalf("cannot resume from stage %q; the stages are %s", s.ResumeFrom, strings.Join(names, ", "))
+		return
+	}
+	skipping := s.ResumeFrom != ""
+	skip := func(name string) bool {
+		if name == s.ResumeFrom {
+			skipping = false
+		}
+		if skipping {
+			logger.Default.Logf(t, "Resuming from stage '%s', so skipping stage '%s'.", s.ResumeFrom, name)
+			return true
+		}
+		if os.Getenv("SKIP_"+name) != "" {
+			logger.Default.Logf(t, "The 'SKIP_%s' environment variable is set, so skipping stage '%s'.", name, name)
+			return true
+		}
+		return false
+	}
+
+	defer s.teardown(t, skip)
+
+	s.applied = nil
+	for _, stage := range s.Stages {
+		if skip(ApplyStage(stage.Module)) {
+			s.loadOptions(t, stage)
+			s.applied = append(s.applied, stage)
+			continue
+		}
+		s.saveOptions(t, stage)
+		s.applied = append(s.applied, stage)
+		if _, err := s.apply(t, stage.Options); err != nil {
+			t.Errorf("applying %s: %v", stage.Module, err)
+			return
+		}
+	}
+	if validate != nil && !skip(ValidateStage) {
+		validate(s)
+	}
+}
+
+// teardown destroys the applied stages in reverse order. The producers of a
+// stage that failed to destroy are kept, as are theirs in turn.
+func (s *Stack) teardown(t testing.TestingT, skip func(string) bool) {
+	s.kept = nil
+	deployed := map[string]bool{}
+	for i := len(s.applied) - 1; i >= 0; i-- {
+		stage := s.applied[i]
+		if consumer := s.deployedConsumer(stage.Module, deployed); consumer != "" {
+			t.Errorf("keeping %s: %s reads its state and is still deployed", stage.Module, consumer)
+			s.kept = append(s.kept, stage.Module)
+			deployed[stage.Module] = true
+			continue
+		}
+		if skip(DestroyStage(stage.Module)) {
+			continue
+		}
+		if _, err := s.destroy(t, stage.Options); err != nil {
+			t.Errorf("destroying %s: %v", stage.Module, err)
+			deployed[stage.Module] = true
+			continue
+		}
+		if s.DataDir != "" {
+			test_structure.CleanupTestDataFolder(t, s.stageDir(stage))
+		}
+	}
+}
+
+// deployedConsumer returns a module in deployed that reads module's state
+func (s *Stack) deployedConsumer(module string, deployed map[string]bool) string {
+	for _, stage := range s.applied {
+		if deployed[stage.Module] && contains(stage.DependsOn, module) {
+			return stage.Module
+		}
+	}
+	return ""
+}
+
+func (s *Stack) stageDir(stage *Stage) string { return filepath.Join(s.DataDir, stage.Module) }
+
+func (s *Stack) saveOptions(t testing.TestingT, stage *Stage) {
+	if s.DataDir != "" {
+		test_structure.SaveTerraformOptions(t, s.stageDir(stage), stage.Options)
+	}
+}
+
+// loadOptions replaces a skipped stage's options with those an earlier run
+// saved, when there are any
+func (s *Stack) loadOptions(t testing.TestingT, stage *Stage) {
+	if s.DataDir == "" {
+		return
+	}
+	path := test_structure.FormatTestDataPath(s.stageDir(stage), "TerraformOptions.json")
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+	stage.Options = test_structure.LoadTerraformOptions(t, s.stageDir(stage))
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,243 @@
+package stack
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	terratesting "github.com/gruntwork-io/terratest/modules/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vibetics-cloudedge/tests/testconfig"
+)
+
+var profile = &testconfig.Profile{
+	Project:            "test-project",
+	DemoProject:        "test-demo-project",
+	Region:             "us-central1",
+	ProjectSuffix:      "nonprod",
+	GitHubRepository:   "vibetics-cloudedge",
+	BillingAccountName: "Test Billing Account",
+	Cloudflare:         testconfig.Cloudflare{APIToken: "token", ZoneID: "zone"},
+}
+
+func newStack(t *testing.T) *Stack {
+	t.Helper()
+	s, err := ForProfile(profile, map[string]map[string]interface{}{"core": {"enable_demo_web_app": true}})
+	require.NoError(t, err)
+	return s
+}
+
+// recorder stands in for the test so failures the stack reports can be
+// asserted on; FailNow stops the goroutine like testing.T's does
+type recorder struct {
+	*testing.T
+	errors []string
+	fatal  string
+}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...interface{}) {
+	r.fatal = fmt.Sprintf(format, args...)
+	runtime.Goexit()
+}
+
+func (r *recorder) FailNow() { runtime.Goexit() }
+
+// fake replaces tofu with a log of the calls, failing the applies of the
+// modules in failApply
+func fake(s *Stack, failApply ...string) *[]string {
+	var calls []string
+	module := func(options *terraform.Options) string {
+		for _, stage := range s.Stages {
+			if stage.Options == options {
+				return stage.Module
+			}
+		}
+		return "?"
+	}
+	s.apply = func(_ terratesting.TestingT, options *terraform.Options) (string, error) {
+		m := module(options)
+		calls = append(calls, "apply "+m)
+		for _, f := range failApply {
+			if f == m {
+				return "", errors.New("quota exceeded")
+			}
+		}
+		return "", nil
+	}
+	s.destroy = func(_ terratesting.TestingT, options *terraform.Options) (string, error) {
+		calls = append(calls, "destroy "+module(options))
+		return "", nil
+	}
+	return &calls
+}
+
+func run(s *Stack, rec *recorder, validate func(*Stack)) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.Run(rec, validate)
+	}()
+	wg.Wait()
+}
+
+func TestOrderFollowsRemoteState(t *testing.T) {
+	t.Parallel()
+	s := newStack(t)
+	assert.Equal(t, []string{"project-singleton", "demo-web-app", "core"}, s.Order())
+	assert.Equal(t, []string{"demo-web-app", "project-singleton"}, s.Stage("core").DependsOn)
+	assert.Equal(t, []string{"project-singleton"}, s.Stage("demo-web-app").DependsOn)
+	assert.Empty(t, s.Stage("project-singleton").DependsOn)
+	assert.Equal(t, []string{
+		"apply_project_singleton", "apply_demo_web_app", "apply_core", "validate",
+		"destroy_core", "destroy_demo_web_app", "destroy_project_singleton",
+	}, s.StageNames())
+
+	// a cycle cannot be ordered
+	_, err := order(map[string]*Stage{
+		"core":         {Module: "core", DependsOn: []string{"demo-web-app"}},
+		"demo-web-app": {Module: "demo-web-app", DependsOn: []string{"core"}},
+	})
+	assert.ErrorContains(t, err, "cycle")
+}
+
+func TestUseBackend(t *testing.T) {
+	t.Parallel()
+	s := newStack(t)
+	require.NoError(t, s.UseBackend(map[string]string{"GOOGLE_BACKEND_STORAGE_CUSTOM_ENDPOINT": "http://127.0.0.1/storage/v1/"}))
+
+	assert.Equal(t, map[string]interface{}{"bucket": "test-project-tfstate", "prefix": "test-project-singleton"},
+		s.Stage("project-singleton").Options.BackendConfig)
+	assert.Equal(t, map[string]interface{}{"bucket": "test-demo-project-tfstate", "prefix": "demo-web-app"},
+		s.Stage("demo-web-app").Options.BackendConfig)
+	assert.Equal(t, map[string]interface{}{"bucket": "test-project-tfstate", "prefix": "test-project-core"},
+		s.Stage("core").Options.BackendConfig)
+	for _, stage := range s.Stages {
+		assert.Equal(t, "http://127.0.0.1/storage/v1/", stage.Options.EnvVars["GOOGLE_BACKEND_STORAGE_CUSTOM_ENDPOINT"], stage.Module)
+	}
+}
+
+func TestRunTearsDownInReverseAfterFailure(t *testing.T) {
+	t.Parallel()
+	s := newStack(t)
+	calls := fake(s, "demo-web-app")
+	rec := &recorder{T: t}
+	validated := false
+	run(s, rec, func(*Stack) { validated = true })
+
+	assert.Equal(t, []string{"apply project-singleton", "apply demo-web-app", "destroy demo-web-app", "destroy project-singleton"}, *calls)
+	assert.False(t, validated)
+	assert.Equal(t, []string{"applying demo-web-app: quota exceeded"}, rec.errors)
+}
+
+func TestRunKeepsProducersOfFailedDestroy(t *testing.T) {
+	t.Parallel()
+	s := newStack(t)
+	calls := fake(s)
+	destroy := s.destroy
+	s.destroy = func(t terratesting.TestingT, options *terraform.Options) (string, error) {
+		if options == s.Stage("core").Options {
+			*calls = append(*calls, "destroy core")
+			return "", errors.New("resource in use")
+		}
+		return destroy(t, options)
+	}
+	rec := &recorder{T: t}
+	run(s, rec, nil)
+
+	assert.Equal(t, []string{"apply project-singleton", "apply demo-web-app", "apply core", "destroy core"}, *calls)
+	assert.Equal(t, []string{"demo-web-app", "project-singleton"}, s.Kept())
+	assert.Equal(t, []string{
+		"destroying core: resource in use",
+		"keeping demo-web-app: core reads its state and is still deployed",
+		"keeping project-singleton: demo-web-app reads its state and is still deployed",
+	}, rec.errors)
+}
+
+func TestRunTearsDownWhenValidateStops(t *testing.T) {
+	t.Parallel()
+	s := newStack(t)
+	calls := fake(s)
+	rec := &recorder{T: t}
+	run(s, rec, func(*Stack) { rec.FailNow() })
+
+	assert.Equal(t, []string{
+		"apply project-singleton", "apply demo-web-app", "apply core",
+		"destroy core", "destroy demo-web-app", "destroy project-singleton",
+	}, *calls)
+}
+
+func TestRunResumesFromStage(t *testing.T) {
+	t.Parallel()
+	dataDir := t.TempDir()
+
+	// an earlier run applied project-singleton and demo-web-app, then stopped
+	first := newStack(t)
+	first.DataDir = dataDir
+	first.Stage("project-singleton").Options.Vars["budget_amount"] = 42.0
+	rec := &recorder{T: t}
+	for _, stage := range first.Stages[:2] {
+		first.saveOptions(rec, stage)
+	}
+
+	second := newStack(t)
+	second.DataDir = dataDir
+	second.ResumeFrom = "apply_core"
+	calls := fake(second)
+	run(second, rec, nil)
+
+	assert.Equal(t, []string{"apply core", "destroy core", "destroy demo-web-app", "destroy project-singleton"}, *calls)
+	assert.Equal(t, []string{"project-singleton", "demo-web-app", "core"}, second.Applied())
+	assert.Empty(t, rec.errors)
+	assert.Equal(t, 42.0, second.Stage("project-singleton").Options.Vars["budget_amount"], "options come from the earlier run")
+
+	third := newStack(t)
+	third.ResumeFrom = "launch"
+	rec = &recorder{T: t}
+	run(third, rec, nil)
+	assert.Contains(t, rec.fatal, `cannot resume from stage "launch"`)
+}
+
+func TestStateLocationsFollowNamePrefix(t *testing.T) {
+	t.Parallel()
+	unique := *profile
+	unique.NamePrefix = "run42"
+	locations, err := StateLocations(unique.Vars("core"))
+	require.NoError(t, err)
+	assert.Equal(t, "test-project-singleton", locations["project-singleton"].Prefix)
+	assert.Equal(t, "run42-demo-web-app", locations["demo-web-app"].Prefix)
+	assert.Equal(t, "test-project-run42-core", locations["core"].Prefix)
+
+	// the options of single-module tests use the same locations
+	for module, loc := range locations {
+		backend, err := unique.Backend(module)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"bucket": loc.Bucket, "prefix": loc.Prefix}, backend, module)
+	}
+}
+
+func TestStateLocationsFromEnvironment(t *testing.T) {
+	t.Parallel()
+	vars, err := EnvVars([]string{
+		"TF_VAR_cloudedge_project_id=env-project",
+		"TF_VAR_resource_name_prefix=run42",
+		`TF_VAR_allowed_https_source_ranges=["35.191.0.0/16", "130.211.0.0/22"]`,
+		`TF_VAR_resource_tags={"project-suffix" = "nonprod", managed-by = "opentofu"}`,
+		"PATH=/usr/bin",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"cloudedge_project_id": "env-project", "resource_name_prefix": "run42"}, vars,
+		"only the variables the state locations read are taken")
+	locations, err := StateLocations(vars)
+	require.NoError(t, err)
+	assert.Equal(t, StateLocation{Bucket: "env-project-tfstate", Prefix: "env-project-run42-core"}, locations["core"])
+}
@@ -0,0 +1,290 @@
+package steps
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cucumber/godog"
+)
+
+// sharedVPCPattern matches names and descriptions that would tie a module to
+// a Shared VPC host project
+var sharedVPCPattern = regexp.MustCompile(`(?i)shared[\s_-]?vpc|host[\s_-]?project|xpn`)
+
+// knownDrift lists the "required" cells of variable tables that disagree with
+// the module, keyed by module and variable, with what the module does instead.
+// The feature files are the contract, so a row is never edited to match the
+// code; until the module or the spec is changed on purpose, the disagreement
+// is logged on every run instead of failing it. An entry whose row agrees
+// again fails the step, so the list cannot go stale.
+var knownDrift = map[string]string{
+	"core/cloudedge_project_id": "the module declares no default, so the variable is required",
+	"project-singleton/region":  "the module defaults to northamerica-northeast2, so the variable is optional",
+}
+
+// Background
+
+func (w *World) configurationAt(dir string) error {
+	module := filepath.Base(dir)
+	if _, err := os.Stat(filepath.Join(repoRoot(), dir)); err != nil {
+		return err
+	}
+	return w.selectModule(module)
+}
+
+// singletonDeployed is a precondition for live plans, whose remote state reads
+// need the singleton outputs; recorded plans already carry them
+func (w *World) singletonDeployed() error {
+	return nil
+}
+
+func (w *World) noSharedVPCResources() error {
+	if err := w.requireModule(); err != nil {
+		return err
+	}
+	var found []string
+	for addr, rng := range w.config.Resources {
+		if strings.HasPrefix(addr, "google_compute_shared_vpc_") {
+			found = append(found, fmt.Sprintf("%s (%s)", addr, rng))
+		}
+	}
+	if len(found) > 0 {
+		sort.Strings(found)
+		return fmt.Errorf("%s declares Shared VPC resources: %s", w.module, strings.Join(found, ", "))
+	}
+	return nil
+}
+
+// projectIDPattern evaluates the project_id local with every <variable> of the
+// pattern set to its own placeholder. A project_id variable that is not part of
+// the pattern is the explicit override and is left empty.
+func (w *World) projectIDPattern(pattern string) error {
+	if err := w.requireModule(); err != nil {
+		return err
+	}
+	vars := map[string]interface{}{}
+	for _, m := range regexp.MustCompile(`<(\w+)>`).FindAllStringSubmatch(pattern, -1) {
+		if _, ok := w.config.Variables[m[1]]; !ok {
+			return fmt.Errorf("%s declares no variable %q", w.module, m[1])
+		}
+		vars[m[1]] = m[0]
+	}
+	if _, ok := w.config.Variables["project_id"]; ok && vars["project_id"] == nil {
+		vars["project_id"] = ""
+	}
+
+	got, err := w.config.Local("project_id", vars)
+	if err != nil {
+		return err
+	}
+	if got != pattern {
+		return fmt.Errorf("local.project_id is %q, expected %q", got, pattern)
+	}
+	return nil
+}
+
+// projectSuffixValues checks that both values pass the project_suffix
+// validations and that a value outside them does not
+func (w *World) projectSuffixValues(first, second string) error {
+	if err := w.requireModule(); err != nil {
+		return err
+	}
+	v, ok := w.config.Variables["project_suffix"]
+	if !ok {
+		return fmt.Errorf("%s declares no project_suffix variable", w.module)
+	}
+	for _, value := range []string{first, second} {
+		failures, err := v.Validate(value)
+		if err != nil {
+			return err
+		}
+		if len(failures) > 0 {
+			return fmt.Errorf("project_suffix %q is rejected: %s", value, strings.Join(failures, "; "))
+		}
+	}
+	other := first + "-" + second
+	failures, err := v.Validate(other)
+	if err != nil {
+		return err
+	}
+	if len(failures) == 0 {
+		return fmt.Errorf("project_suffix accepts %q as well", other)
+	}
+	return nil
+}
+
+// Given / When
+
+func (w *World) configurationFor(module string) error {
+	return w.selectModule(module)
+}
+
+func (w *World) deployed(module string) error {
+	return w.selectModule(module)
+}
+
+func (w *World) configured(module string) error {
+	return w.selectModule(module)
+}
+
+func (w *World) validCredentials() error {
+	_, err := integrationProject()
+	return err
+}
+
+func (w *World) setVariable(name, raw string) error {
+	if err := w.requireModule(); err != nil {
+		return err
+	}
+	v, ok := w.config.Variables[name]
+	if !ok {
+		return fmt.Errorf("%s declares no variable %q", w.module, name)
+	}
+	value, err := ParseVariable(v, unquote(raw))
+	if err != nil {
+		return err
+	}
+	w.vars[name] = value
+	w.plan, w.outputs = nil, nil
+	return nil
+}
+
+// setVariables applies a | variable | value | table
+func (w *World) setVariables(table *godog.Table) error {
+	for _, row := range table.Rows[1:] {
+		if err := w.setVariable(strings.TrimSpace(row.Cells[0].Value), strings.TrimSpace(row.Cells[1].Value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// query steps only describe what the following assertions look at; the plan
+// and outputs are fetched when first needed
+func (w *World) query() error {
+	return w.requireModule()
+}
+
+func (w *World) runOutput(module string) error {
+	return w.selectModule(module)
+}
+
+// runValidate checks the variables set so far against their validation blocks.
+// `tofu validate` itself does not evaluate input variables, so this is the
+// offline equivalent of the error a plan with these -var values would report.
+func (w *World) runValidate() error {
+	if err := w.requireModule(); err != nil {
+		return err
+	}
+	w.validationErrors = nil
+	names := make([]string, 0, len(w.vars))
+	for name := range w.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		failures, err := w.config.Variables[name].Validate(w.vars[name])
+		if err != nil {
+			return err
+		}
+		w.validationErrors = append(w.validationErrors, failures...)
+	}
+	w.validated = true
+	return nil
+}
+
+// Then
+
+func (w *World) variablesDefined(ctx context.Context, table *godog.Table) error {
+	if err := w.requireModule(); err != nil {
+		return err
+	}
+	var problems []string
+	for _, row := range table.Rows[1:] {
+		name := strings.TrimSpace(row.Cells[0].Value)
+		wantType := strings.TrimSpace(row.Cells[1].Value)
+		wantRequired := strings.EqualFold(strings.TrimSpace(row.Cells[2].Value), "yes")
+
+		v, ok := w.config.Variables[name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%q is not declared", name))
+			continue
+		}
+		if !typeMatches(v.Type, wantType) {
+			problems = append(problems, fmt.Sprintf("%q has type %s, expected %s", name, v.Type, wantType))
+		}
+		required := !v.HasDefault
+		drift, known := knownDrift[w.module+"/"+name]
+		switch {
+		case required != wantRequired && known:
+			godog.Logf(ctx, "known drift: %s variable %q required=%t, the feature expects %t (%s)", w.module, name, required, wantRequired, drift)
+		case required != wantRequired:
+			problems = append(problems, fmt.Sprintf("%q required=%t, expected %t", name, required, wantRequired))
+		case known:
+			problems = append(problems, fmt.Sprintf("%q is listed in knownDrift but now matches the feature; remove the entry", name))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s variables: %s", w.module, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func (w *World) noVariableNamed(name string) error {
+	if err := w.requireModule(); err != nil {
+		return err
+	}
+	if v, ok := w.config.Variables[name]; ok {
+		return fmt.Errorf("%s declares variable %q (%s)", w.module, name, v.Range)
+	}
+	return nil
+}
+
+func (w *World) noSharedVPCVariables() error {
+	if err := w.requireModule(); err != nil {
+		return err
+	}
+	var found []string
+	for name, v := range w.config.Variables {
+		if sharedVPCPattern.MatchString(name) || sharedVPCPattern.MatchString(v.Description) {
+			found = append(found, fmt.Sprintf("%s (%s)", name, v.Range))
+		}
+	}
+	if len(found) > 0 {
+		sort.Strings(found)
+		return fmt.Errorf("%s has variables referencing Shared VPC: %s", w.module, strings.Join(found, ", "))
+	}
+	return nil
+}
+
+func (w *World) validationResult(outcome string) error {
+	if !w.validated {
+		return fmt.Errorf(`"tofu validate" has not been run`)
+	}
+	switch {
+	case outcome == "fail" && len(w.validationErrors) == 0:
+		return fmt.Errorf("validation passed for %s", renderVars(w.vars))
+	case outcome == "succeed" && len(w.validationErrors) > 0:
+		return fmt.Errorf("validation failed: %s", strings.Join(w.validationErrors, "; "))
+	}
+	return nil
+}
+
+func (w *World) errorMessageIndicates(text string) error {
+	want := strings.TrimSuffix(text, ".")
+	for _, msg := range w.validationErrors {
+		if strings.Contains(msg, want) {
+			return nil
+		}
+	}
+	return fmt.Errorf("no validation error mentions %q (got %q)", text, w.validationErrors)
+}
+
+func renderVars(vars map[string]interface{}) string {
+	return "{" + strings.Join(sortedVars(vars), ", ") + "}"
+}
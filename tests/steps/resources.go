@@ -0,0 +1,237 @@
+package steps
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cucumber/godog"
+
+	"vibetics-cloudedge/tests/planquery"
+)
+
+// resourceAliases maps the names the features give resources onto their
+// `type.name` references
+var resourceAliases = map[string]string{
+	"ingress VPC": "google_compute_network.ingress_vpc",
+	"web VPC":     "google_compute_network.web_vpc",
+}
+
+// Background
+
+// ingressVPCOwnedByCore plans core with its base variables and checks the
+// ingress VPC lands in cloudedge_project_id
+func (w *World) ingressVPCOwnedByCore(ctx context.Context) error {
+	if err := w.requireModule(); err != nil {
+		return err
+	}
+	vars, err := w.planVars(ctx)
+	if err != nil {
+		return err
+	}
+	plan, err := w.planWith(ctx, vars)
+	if err != nil {
+		return err
+	}
+	vpc, err := plan.Find(planquery.Addr(resourceAliases["ingress VPC"]))
+	if err != nil {
+		return err
+	}
+	return vpc.ExpectAfter("project", vars["cloudedge_project_id"])
+}
+
+// webVPCCombinations are the toggle settings compared by webVPCWhenALBOrPSC;
+// each has a recorded demo-web-app plan
+var webVPCCombinations = []map[string]interface{}{
+	{},
+	{"enable_demo_web_app_psc_neg": true},
+	{"enable_demo_web_app_internal_alb": false, "enable_demo_web_app_psc_neg": false},
+}
+
+// webVPCWhenALBOrPSC plans demo-web-app with the ALB and PSC toggles in
+// several positions: the web VPC must be planned, in the demo project, exactly
+// when at least one of them is on
+func (w *World) webVPCWhenALBOrPSC(ctx context.Context) error {
+	if err := w.requireModule(); err != nil {
+		return err
+	}
+	base, err := w.planVars(ctx)
+	if err != nil {
+		return err
+	}
+	for _, overrides := range webVPCCombinations {
+		vars := map[string]interface{}{}
+		for name, value := range base {
+			vars[name] = value
+		}
+		for name, value := range overrides {
+			vars[name] = value
+		}
+		plan, err := w.planWith(ctx, vars)
+		if err != nil {
+			return err
+		}
+
+		want := w.boolVar(vars, "enable_demo_web_app_internal_alb") || w.boolVar(vars, "enable_demo_web_app_psc_neg")
+		vpcs := planned(plan, planquery.Addr(resourceAliases["web VPC"]))
+		if got := len(vpcs) > 0; got != want {
+			return fmt.Errorf("with %s the web VPC planned=%t, expected %t", renderVars(overrides), got, want)
+		}
+		for _, vpc := range vpcs {
+			if err := vpc.ExpectAfter("project", vars["demo_web_app_project_id"]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// boolVar is the value of a bool variable in vars, else its default
+func (w *World) boolVar(vars map[string]interface{}, name string) bool {
+	if value, ok := vars[name].(bool); ok {
+		return value
+	}
+	value, _ := w.config.Variables[name].Default.(bool)
+	return value
+}
+
+// Then
+
+func (w *World) resourceExists(ctx context.Context, ref string) error {
+	plan, err := w.currentPlan(ctx)
+	if err != nil {
+		return err
+	}
+	r, err := plan.Find(refFilter(ref))
+	if err != nil {
+		return err
+	}
+	if r.Action() == planquery.Delete {
+		return fmt.Errorf("%s is planned for deletion", r.Address())
+	}
+	return nil
+}
+
+func (w *World) noResource(ctx context.Context, ref string) error {
+	plan, err := w.currentPlan(ctx)
+	if err != nil {
+		return err
+	}
+	if found := planned(plan, refFilter(ref)); len(found) > 0 {
+		return fmt.Errorf("%s is planned", found[0].Address())
+	}
+	return nil
+}
+
+func (w *World) noResourcesOfType(ctx context.Context, resourceType string) error {
+	plan, err := w.currentPlan(ctx)
+	if err != nil {
+		return err
+	}
+	if found := planned(plan, planquery.Type(resourceType)); len(found) > 0 {
+		addresses := make([]string, len(found))
+		for i, r := range found {
+			addresses[i] = r.Address()
+		}
+		return fmt.Errorf("planned: %s", strings.Join(addresses, ", "))
+	}
+	return nil
+}
+
+func (w *World) resourceAttribute(ctx context.Context, ref, path, raw string) error {
+	plan, err := w.currentPlan(ctx)
+	if err != nil {
+		return err
+	}
+	r, err := plan.Find(refFilter(ref))
+	if err != nil {
+		return err
+	}
+	return r.ExpectAfter(path, parseLiteral(raw))
+}
+
+func (w *World) aliasAttribute(ctx context.Context, alias, path, raw string) error {
+	return w.resourceAttribute(ctx, resourceAliases[alias], path, raw)
+}
+
+// webVPCOwnedByDemoProject requires the web VPC, when planned, to live in the
+// demo-web-app project rather than the core one
+func (w *World) webVPCOwnedByDemoProject(ctx context.Context) error {
+	plan, err := w.currentPlan(ctx)
+	if err != nil {
+		return err
+	}
+	vars, err := w.planVars(ctx)
+	if err != nil {
+		return err
+	}
+	for _, vpc := range planned(plan, planquery.Addr(resourceAliases["web VPC"])) {
+		project, err := vpc.AfterString("project")
+		if err != nil {
+			return err
+		}
+		if project != vars["demo_web_app_project_id"] {
+			return fmt.Errorf("%s is in project %q, not demo_web_app_project_id %q", vpc.Address(), project, vars["demo_web_app_project_id"])
+		}
+	}
+	return nil
+}
+
+// outputsAvailable checks the module declares every listed output; the
+// integration suite also requires a value in the deployed state
+func (w *World) outputsAvailable(ctx context.Context, table *godog.Table) error {
+	if err := w.requireModule(); err != nil {
+		return err
+	}
+	var outputs map[string]interface{}
+	if w.suite == Integration {
+		var err error
+		if outputs, err = w.currentOutputs(ctx); err != nil {
+			return err
+		}
+	}
+
+	var missing []string
+	for _, row := range table.Rows[1:] {
+		name := strings.TrimSpace(row.Cells[0].Value)
+		if _, ok := w.config.Outputs[name]; !ok {
+			missing = append(missing, name+" (not declared)")
+			continue
+		}
+		if outputs != nil {
+			if _, ok := outputs[name]; !ok {
+				missing = append(missing, name+" (not in state)")
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%s outputs missing: %s", w.module, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func (w *World) outputNull(ctx context.Context, name string) error {
+	outputs, err := w.currentOutputs(ctx)
+	if err != nil {
+		return err
+	}
+	value, ok := outputs[name]
+	if !ok {
+		return fmt.Errorf("%s has no output %q", w.module, name)
+	}
+	if value != nil {
+		return fmt.Errorf("output %q is %v, expected null", name, value)
+	}
+	return nil
+}
+
+// planned returns the resources matching filter that the plan keeps or creates
+func planned(plan *planquery.Plan, filter planquery.Filter) []planquery.Resource {
+	var out []planquery.Resource
+	for _, r := range plan.Resources(planquery.Managed(), filter) {
+		if r.Action() != planquery.Delete {
+			out = append(out, r)
+		}
+	}
+	return out
+}
@@ -0,0 +1,124 @@
+// Package steps binds the Gherkin steps shared by the module feature files
+// (core_infrastructure, demo_web_app and project_singleton) so the scenarios in
+// features/ run as Go tests. The same bindings serve two suites: the contract
+// suite answers from the module source and from plans (recorded or live, see
+// planfixture), the integration suite plans against the deployed state and reads
+// real outputs.
+package steps
+
+import (
+	"context"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/cucumber/godog"
+)
+
+// Suite selects which scenarios of a feature run and where their answers come from
+type Suite struct {
+	Name string
+	// Tags is the godog tag expression selecting the suite's scenarios
+	Tags string
+	// Strict fails scenarios with undefined steps instead of reporting them
+	Strict bool
+}
+
+var (
+	// Contract runs the @contract scenarios offline. Every step must be bound.
+	Contract = Suite{Name: "contract", Tags: "@contract", Strict: true}
+	// Integration runs the @integration scenarios against deployed
+	// infrastructure. Steps without a binding yet are reported as undefined
+	// rather than failing the run.
+	Integration = Suite{Name: "integration", Tags: "@integration", Strict: false}
+)
+
+// Features are the feature files whose steps this package binds
+var Features = []string{"core_infrastructure", "demo_web_app", "project_singleton"}
+
+// Run runs the suite's scenarios of each feature as a subtest of t
+func Run(t *testing.T, suite Suite, features ...string) {
+	for _, feature := range features {
+		feature := feature
+		t.Run(feature, func(t *testing.T) {
+			opts := godog.Options{
+				Format:   "pretty",
+				Paths:    []string{FeaturePath(feature)},
+				Tags:     suite.Tags,
+				Strict:   suite.Strict,
+				TestingT: t,
+			}
+
+			status := godog.TestSuite{
+				Name: feature + "_" + suite.Name,
+				ScenarioInitializer: func(ctx *godog.ScenarioContext) {
+					Register(ctx, suite)
+				},
+				Options: &opts,
+			}.Run()
+
+			if status != 0 {
+				t.Fatal("non-zero status returned, failed to run feature tests")
+			}
+		})
+	}
+}
+
+// FeaturePath returns the absolute path of features/<name>.feature
+func FeaturePath(name string) string {
+	return filepath.Join(repoRoot(), "features", name+".feature")
+}
+
+func repoRoot() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "..")
+}
+
+// Register binds every shared step to a fresh World for each scenario
+func Register(ctx *godog.ScenarioContext, suite Suite) {
+	w := &World{}
+
+	ctx.Before(func(ctx context.Context, sc *godog.Scenario) (context.Context, error) {
+		*w = World{suite: suite, vars: map[string]interface{}{}}
+		return ctx, nil
+	})
+
+	// Background
+	ctx.Step(`^the OpenTofu configuration is located at "([^"]*)"$`, w.configurationAt)
+	ctx.Step(`^the project-singleton infrastructure is already deployed$`, w.singletonDeployed)
+	ctx.Step(`^NO Shared VPC resources (?:exist|are used)$`, w.noSharedVPCResources)
+	ctx.Step(`^the ingress VPC is owned directly by the core project$`, w.ingressVPCOwnedByCore)
+	ctx.Step(`^the web app has its own independent VPC when ALB or PSC is enabled$`, w.webVPCWhenALBOrPSC)
+	ctx.Step(`^the project ID follows the pattern "([^"]*)"$`, w.projectIDPattern)
+	ctx.Step(`^the project suffix is either "([^"]*)" or "([^"]*)"$`, w.projectSuffixValues)
+
+	// Given / When
+	ctx.Step(`^I have the OpenTofu configuration for ([\w-]+)$`, w.configurationFor)
+	ctx.Step(`^the (core|demo web app|project singleton) infrastructure is deployed$`, w.deployed)
+	ctx.Step(`^the (core|demo web app|project singleton) (?:infrastructure configuration|is configured)$`, w.configured)
+	ctx.Step(`^I have valid GCP credentials$`, w.validCredentials)
+	ctx.Step(`^(?:I have set|I set) the (\w+) variable to "([^"]*)"$`, w.setVariable)
+	ctx.Step(`^the (\w+) variable is set to ("[^"]*"|true|false|-?\d+(?:\.\d+)?)$`, w.setVariable)
+	ctx.Step(`^I configure the infrastructure with the following variables:$`, w.setVariables)
+	ctx.Step(`^I query .+$`, w.query)
+	ctx.Step(`^I inspect the variables\.tf file$`, w.query)
+	ctx.Step(`^I run "tofu output -json" in the ([\w-]+) directory$`, w.runOutput)
+	ctx.Step(`^I run "tofu validate"$`, w.runValidate)
+
+	// Then: configuration
+	ctx.Step(`^the following variables should be defined:$`, w.variablesDefined)
+	ctx.Step(`^there should be NO variable named "([^"]*)"$`, w.noVariableNamed)
+	ctx.Step(`^there should be NO variable referencing Shared VPC$`, w.noSharedVPCVariables)
+	ctx.Step(`^the validation should (fail|succeed)$`, w.validationResult)
+	ctx.Step(`^the error message should indicate "([^"]*)"$`, w.errorMessageIndicates)
+
+	// Then: plan and outputs
+	ctx.Step(`^the resource "([^"]*)" should exist$`, w.resourceExists)
+	ctx.Step(`^there should be NO resource "([^"]*)"$`, w.noResource)
+	ctx.Step(`^there should be NO "([^"]*)" resources$`, w.noResourcesOfType)
+	ctx.Step(`^the resource "([^"]*)" should have "([^"]*)" set to (.+)$`, w.resourceAttribute)
+	ctx.Step(`^the (ingress VPC|web VPC) should have "([^"]*)" set to (.+)$`, w.aliasAttribute)
+	ctx.Step(`^the web VPC should be independently owned by the demo-web-app project$`, w.webVPCOwnedByDemoProject)
+	ctx.Step(`^the following outputs should be available:$`, w.outputsAvailable)
+	ctx.Step(`^the output "([^"]*)" should be null$`, w.outputNull)
+}
@@ -0,0 +1,51 @@
+package steps
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vibetics-cloudedge/tests/modcontract"
+)
+
+func TestParseVariable(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		varType string
+		raw     string
+		want    interface{}
+	}{
+		{"bool", "true", true},
+		{"number", "443", 443.0},
+		{"string", `""`, ""},
+		{"string", "nonprod", "nonprod"},
+		{"list(string)", `["10.0.0.0/8"]`, []interface{}{"10.0.0.0/8"}},
+	} {
+		got, err := ParseVariable(modcontract.Variable{Name: "v", Type: tc.varType}, tc.raw)
+		require.NoError(t, err, tc.raw)
+		assert.Equal(t, tc.want, got, tc.raw)
+	}
+
+	_, err := ParseVariable(modcontract.Variable{Name: "enable_waf", Type: "bool"}, "yes")
+	assert.EqualError(t, err, `variable "enable_waf": "yes" is not a bool`)
+}
+
+func TestTypeMatches(t *testing.T) {
+	t.Parallel()
+
+	assert.True(t, typeMatches("list(string)", "list(string)"))
+	assert.True(t, typeMatches("list(string)", "list( string )"))
+	assert.True(t, typeMatches("map(string)", "map"))
+	assert.False(t, typeMatches("map(string)", "map(number)"))
+	assert.False(t, typeMatches("string", "map"))
+}
+
+func TestParseLiteral(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, false, parseLiteral("false"))
+	assert.Equal(t, "REGIONAL_MANAGED_PROXY", parseLiteral(`"REGIONAL_MANAGED_PROXY"`))
+	assert.Equal(t, "ingress-vpc", parseLiteral("ingress-vpc"))
+}
@@ -0,0 +1,68 @@
+package steps
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"vibetics-cloudedge/tests/modcontract"
+)
+
+// ParseVariable converts a table cell to the variable's type; `""` is the
+// empty string and collection types are written as JSON
+func ParseVariable(v modcontract.Variable, raw string) (interface{}, error) {
+	switch {
+	case v.Type == "bool":
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("variable %q: %q is not a bool", v.Name, raw)
+		}
+		return b, nil
+	case v.Type == "number":
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("variable %q: %q is not a number", v.Name, raw)
+		}
+		return n, nil
+	case v.Type != "string" && v.Type != "any":
+		var value interface{}
+		if err := json.Unmarshal([]byte(raw), &value); err != nil {
+			return nil, fmt.Errorf("variable %q: %q is not a JSON %s", v.Name, raw, v.Type)
+		}
+		return value, nil
+	}
+	if raw == `""` {
+		return "", nil
+	}
+	return raw, nil
+}
+
+// parseLiteral reads an expected attribute value: JSON (false, 3, "x", ["a"])
+// when it parses as JSON, otherwise the text itself
+func parseLiteral(raw string) interface{} {
+	var value interface{}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(raw)), &value); err != nil {
+		return raw
+	}
+	return value
+}
+
+// unquote strips one pair of surrounding double quotes
+func unquote(s string) string {
+	if len(s) >= 2 && strings.HasPrefix(s, `"`) && strings.HasSuffix(s, `"`) {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// typeMatches compares a declared type with the one a feature table expects;
+// a bare collection kind (map, list) accepts any element type
+func typeMatches(declared, want string) bool {
+	want = strings.Join(strings.Fields(want), "")
+	declared = strings.Join(strings.Fields(declared), "")
+	if declared == want {
+		return true
+	}
+	return !strings.Contains(want, "(") && strings.HasPrefix(declared, want+"(")
+}
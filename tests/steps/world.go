@@ -0,0 +1,247 @@
+package steps
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cucumber/godog"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+
+	"vibetics-cloudedge/tests/migrate"
+	"vibetics-cloudedge/tests/modcontract"
+	"vibetics-cloudedge/tests/planfixture"
+	"vibetics-cloudedge/tests/planquery"
+)
+
+// moduleNames maps the way the features name a module onto its directory
+var moduleNames = map[string]string{
+	"core":              "core",
+	"demo web app":      "demo-web-app",
+	"demo-web-app":      "demo-web-app",
+	"project singleton": "project-singleton",
+	"project-singleton": "project-singleton",
+}
+
+// projectVars are the variables an integration run points at the project
+// under test
+var projectVars = []string{"cloudedge_project_id", "demo_web_app_project_id", "project_id"}
+
+// World is the state of one scenario. Variables set by Given steps apply to
+// the plan, which is computed on first use so that "the X variable is set to"
+// may follow "the infrastructure is deployed".
+type World struct {
+	suite  Suite
+	module string
+	config *modcontract.Module
+	// vars override the module's base variables for this scenario
+	vars map[string]interface{}
+
+	plan    *planquery.Plan
+	outputs map[string]interface{}
+	// validationErrors holds the messages of the last "tofu validate"
+	validationErrors []string
+	validated        bool
+}
+
+// selectModule loads module, refusing to switch to another one mid-scenario
+func (w *World) selectModule(name string) error {
+	module, ok := moduleNames[name]
+	if !ok {
+		return fmt.Errorf("unknown module %q", name)
+	}
+	if w.module != "" && w.module != module {
+		return fmt.Errorf("scenario is about %s, not %s", w.module, module)
+	}
+	if w.config == nil {
+		m, err := modcontract.LoadModule(planfixture.ModuleDir(module))
+		if err != nil {
+			return err
+		}
+		w.config = m
+	}
+	w.module = module
+	return nil
+}
+
+func (w *World) requireModule() error {
+	if w.config == nil {
+		return fmt.Errorf("no OpenTofu configuration selected")
+	}
+	return nil
+}
+
+// planVars are the module's base variables with the scenario overrides applied
+func (w *World) planVars(ctx context.Context) (map[string]interface{}, error) {
+	vars := planfixture.BaseVars(w.module)
+	if w.suite == Integration {
+		project, err := integrationProject()
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range projectVars {
+			if _, ok := w.config.Variables[name]; ok {
+				vars[name] = project
+			}
+		}
+	}
+	for name, value := range w.vars {
+		vars[name] = value
+	}
+	return vars, nil
+}
+
+// currentPlan plans the module with the scenario's variables once
+func (w *World) currentPlan(ctx context.Context) (*planquery.Plan, error) {
+	if w.plan != nil {
+		return w.plan, nil
+	}
+	if err := w.requireModule(); err != nil {
+		return nil, err
+	}
+	vars, err := w.planVars(ctx)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := w.planWith(ctx, vars)
+	if err != nil {
+		return nil, err
+	}
+	w.plan = plan
+	return plan, nil
+}
+
+// planWith plans the module with vars. Plans are shared by every scenario of
+// the process, so backgrounds that compare several variable combinations cost
+// one plan (or fixture load) per combination rather than one per scenario.
+func (w *World) planWith(ctx context.Context, vars map[string]interface{}) (*planquery.Plan, error) {
+	key := w.suite.Name + " " + w.module + " " + renderVars(vars)
+	plansMu.Lock()
+	defer plansMu.Unlock()
+	if plan, ok := plans[key]; ok {
+		return plan, nil
+	}
+
+	var plan *planquery.Plan
+	if w.suite == Integration {
+		var err error
+		if plan, err = integrationPlan(ctx, w.module, vars); err != nil {
+			return nil, err
+		}
+	} else {
+		raw, err := planfixture.PlanFor(godog.T(ctx), w.module, vars)
+		if err != nil {
+			return nil, err
+		}
+		plan = planquery.New(raw)
+	}
+	plans[key] = plan
+	return plan, nil
+}
+
+var (
+	plansMu sync.Mutex
+	plans   = map[string]*planquery.Plan{}
+)
+
+// currentOutputs returns the module outputs: the planned values in the
+// contract suite, `tofu output -json` in the integration suite
+func (w *World) currentOutputs(ctx context.Context) (map[string]interface{}, error) {
+	if w.outputs != nil {
+		return w.outputs, nil
+	}
+	if err := w.requireModule(); err != nil {
+		return nil, err
+	}
+	if w.suite == Integration {
+		outputs, err := terraform.OutputAllE(godog.T(ctx), integrationOptions(w.module, nil))
+		if err != nil {
+			return nil, err
+		}
+		w.outputs = outputs
+		return outputs, nil
+	}
+
+	plan, err := w.currentPlan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	w.outputs = map[string]interface{}{}
+	for name, change := range plan.Raw().OutputChanges {
+		if change == nil {
+			continue
+		}
+		if unknown, _ := change.AfterUnknown.(bool); unknown {
+			w.outputs[name] = planquery.ErrUnknown.Error()
+			continue
+		}
+		w.outputs[name] = change.After
+	}
+	return w.outputs, nil
+}
+
+// projectEnvVars are read in order for the project under test, as terratest's
+// gcp.GetGoogleProjectIDFromEnvVar does
+var projectEnvVars = []string{"GOOGLE_PROJECT", "GOOGLE_CLOUD_PROJECT", "GOOGLE_CLOUD_PROJECT_ID", "GCLOUD_PROJECT", "CLOUDSDK_CORE_PROJECT"}
+
+// integrationProject is the project under test
+func integrationProject() (string, error) {
+	for _, name := range projectEnvVars {
+		if project := os.Getenv(name); project != "" {
+			return project, nil
+		}
+	}
+	return "", fmt.Errorf("none of %s is set", strings.Join(projectEnvVars, ", "))
+}
+
+// integrationOptions points tofu at the module directory and its deployed
+// state, using the backend-config.hcl that setup-backend.sh generates at the
+// repository root
+func integrationOptions(module string, vars map[string]interface{}) *terraform.Options {
+	opts := planfixture.Scenario{Module: module, Vars: vars}.TerraformOptions(planfixture.ModuleDir(module))
+	if backend, err := migrate.ReadBackendConfig(filepath.Join(repoRoot(), migrate.BackendConfigFile)); err == nil {
+		opts.BackendConfig = map[string]interface{}{"bucket": backend.Bucket, "prefix": backend.Prefix}
+	}
+	return opts
+}
+
+// integrationPlan plans the deployed module; resources that already exist
+// show up as no-op changes
+func integrationPlan(ctx context.Context, module string, vars map[string]interface{}) (*planquery.Plan, error) {
+	opts := integrationOptions(module, vars)
+	planFile, err := os.CreateTemp("", "features-"+module+"-*.tfplan")
+	if err != nil {
+		return nil, err
+	}
+	planFile.Close()
+	defer os.Remove(planFile.Name())
+	opts.PlanFilePath = planFile.Name()
+
+	raw, err := terraform.InitAndPlanAndShowWithStructE(godog.T(ctx), opts)
+	if err != nil {
+		return nil, fmt.Errorf("planning %s: %w", module, err)
+	}
+	return planquery.New(raw), nil
+}
+
+func sortedVars(vars map[string]interface{}) []string {
+	out := make([]string, 0, len(vars))
+	for name, value := range vars {
+		out = append(out, fmt.Sprintf("%s=%#v", name, value))
+	}
+	sort.Strings(out)
+	return out
+}
+
+// refFilter matches a `type.name` reference at any index, or a full address
+// when ref carries an index or module path
+func refFilter(ref string) planquery.Filter {
+	if strings.ContainsAny(ref, "[") || strings.HasPrefix(ref, "module.") {
+		return planquery.Address(ref)
+	}
+	return planquery.Addr(ref)
+}
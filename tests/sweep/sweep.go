@@ -0,0 +1,508 @@
+// Package sweep removes the compute resources integration runs leave behind
+// when they never reach their destroy: a cancelled CI job, a crashed runner
+// or a panic before the deferred cleanup. Every run deploys with a
+// resource_name_prefix, which the modules put in each resource name and in a
+// name-prefix label on the forwarding rules and addresses. A run whose newest
+// labelled resource is older than the TTL is taken as abandoned, and every
+// resource named with its prefix is deleted, consumers before the resources
+// they use. Deployments without a prefix carry no name-prefix label and are
+// never touched. Only compute resources are swept: Cloud Run services and
+// Cloudflare DNS records named with the prefix are left for manual cleanup.
+package sweep
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// NamePrefixLabel is the label the modules set to var.resource_name_prefix
+const NamePrefixLabel = "name-prefix"
+
+// DefaultLabels select the resources the modules deploy for nonprod
+var DefaultLabels = map[string]string{"managed-by": "opentofu", "project-suffix": "nonprod"}
+
+// Options controls a sweep
+type Options struct {
+	Project string
+	// Labels must all match on a run's forwarding rules and addresses;
+	// DefaultLabels when nil
+	Labels map[string]string
+	// TTL is how long after its newest labelled resource a run is abandoned
+	TTL time.Duration
+	// DryRun reports what would be deleted without deleting it
+	DryRun bool
+	// Now is the time the TTL counts back from; time.Now when zero
+	Now time.Time
+}
+
+// Resource is one compute resource of a run
+type Resource struct {
+	Collection string
+	// Scope is "global", "regions/<region>" or "zones/<zone>"
+	Scope   string
+	Name    string
+	Created time.Time
+	Labels  map[string]string
+}
+
+func (r Resource) String() string { return r.Scope + "/" + r.Collection + "/" + r.Name }
+
+// Failure is a resource the sweep could not delete
+type Failure struct {
+	Resource Resource
+	Err      error
+}
+
+// Report is the outcome of a sweep
+type Report struct {
+	DryRun bool
+	// Expired lists the prefixes of the abandoned runs
+	Expired []string
+	// Live lists the prefixes still within the TTL, which were left alone
+	Live []string
+	// Found lists the abandoned runs' resources in deletion order
+	Found []Resource
+	// Skipped lists resources under an abandoned prefix created within the
+	// TTL, which may belong to a run that has not labelled anything yet; they
+	// are kept until a later sweep finds them older
+	Skipped []Resource
+	Deleted []Resource
+	Failed  []Failure
+}
+
+// kind is one collection the sweep lists and deletes
+type kind struct {
+	collection string
+	list       func(ctx context.Context, svc *compute.Service, project, filter string) ([]Resource, error)
+	// delete holds the call for each scope type: "global", "regions" or "zones"
+	delete map[string]deleter
+}
+
+type deleter func(ctx context.Context, svc *compute.Service, project, location, name string) (*compute.Operation, error)
+
+// kinds are in deletion order: a resource comes after the ones that refer to
+// it. The few references that run the other way (a service attachment points
+// at the demo-web-app forwarding rule) are resolved by retrying.
+var kinds = []kind{
+	{"forwardingRules", func(ctx context.Context, svc *compute.Service, project, filter string) ([]Resource, error) {
+		var found []Resource
+		err := svc.ForwardingRules.AggregatedList(project).Filter(filter).Pages(ctx, func(page *compute.ForwardingRuleAggregatedList) error {
+			return collect(&found, "forwardingRules", page.Items)
+		})
+		return found, err
+	}, map[string]deleter{
+		"global": func(ctx context.Context, svc *compute.Service, project, _, name string) (*compute.Operation, error) {
+			return svc.GlobalForwardingRules.Delete(project, name).Context(ctx).Do()
+		},
+		"regions": func(ctx context.Context, svc *compute.Service, project, region, name string) (*compute.Operation, error) {
+			return svc.ForwardingRules.Delete(project, region, name).Context(ctx).Do()
+		},
+	}},
+	{"targetHttpsProxies", func(ctx context.Context, svc *compute.Service, project, filter string) ([]Resource, error) {
+		var found []Resource
+		err := svc.TargetHttpsProxies.AggregatedList(project).Filter(filter).Pages(ctx, func(page *compute.TargetHttpsProxyAggregatedList) error {
+			return collect(&found, "targetHttpsProxies", page.Items)
+		})
+		return found, err
+	}, map[string]deleter{
+		"global": func(ctx context.Context, svc *compute.Service, project, _, name string) (*compute.Operation, error) {
+			return svc.TargetHttpsProxies.Delete(project, name).Context(ctx).Do()
+		},
+		"regions": func(ctx context.Context, svc *compute.Service, project, region, name string) (*compute.Operation, error) {
+			return svc.RegionTargetHttpsProxies.Delete(project, region, name).Context(ctx).Do()
+		},
+	}},
+	{"targetHttpProxies", func(ctx context.Context, svc *compute.Service, project, filter string) ([]Resource, error) {
+		var found []Resource
+		err := svc.TargetHttpProxies.AggregatedList(project).Filter(filter).Pages(ctx, func(page *compute.TargetHttpProxyAggregatedList) error {
+			return collect(&found, "targetHttpProxies", page.Items)
+		})
+		return found, err
+	}, map[string]deleter{
+		"global": func(ctx context.Context, svc *compute.Service, project, _, name string) (*compute.Operation, error) {
+			return svc.TargetHttpProxies.Delete(project, name).Context(ctx).Do()
+		},
+		"regions": func(ctx context.Context, svc *compute.Service, project, region, name string) (*compute.Operation, error) {
+			return svc.RegionTargetHttpProxies.Delete(project, region, name).Context(ctx).Do()
+		},
+	}},
+	{"sslCertificates", func(ctx context.Context, svc *compute.Service, project, filter string) ([]Resource, error) {
+		var found []Resource
+		err := svc.SslCertificates.AggregatedList(project).Filter(filter).Pages(ctx, func(page *compute.SslCertificateAggregatedList) error {
+			return collect(&found, "sslCertificates", page.Items)
+		})
+		return found, err
+	}, map[string]deleter{
+		"global": func(ctx context.Context, svc *compute.Service, project, _, name string) (*compute.Operation, error) {
+			return svc.SslCertificates.Delete(project, name).Context(ctx).Do()
+		},
+		"regions": func(ctx context.Context, svc *compute.Service, project, region, name string) (*compute.Operation, error) {
+			return svc.RegionSslCertificates.Delete(project, region, name).Context(ctx).Do()
+		},
+	}},
+	{"urlMaps", func(ctx context.Context, svc *compute.Service, project, filter string) ([]Resource, error) {
+		var found []Resource
+		err := svc.UrlMaps.AggregatedList(project).Filter(filter).Pages(ctx, func(page *compute.UrlMapsAggregatedList) error {
+			return collect(&found, "urlMaps", page.Items)
+		})
+		return found, err
+	}, map[string]deleter{
+		"global": func(ctx context.Context, svc *compute.Service, project, _, name string) (*compute.Operation, error) {
+			return svc.UrlMaps.Delete(project, name).Context(ctx).Do()
+		},
+		"regions": func(ctx context.Context, svc *compute.Service, project, region, name string) (*compute.Operation, error) {
+			return svc.RegionUrlMaps.Delete(project, region, name).Context(ctx).Do()
+		},
+	}},
+	{"backendServices", func(ctx context.Context, svc *compute.Service, project, filter string) ([]Resource, error) {
+		var found []Resource
+		err := svc.BackendServices.AggregatedList(project).Filter(filter).Pages(ctx, func(page *compute.BackendServiceAggregatedList) error {
+			return collect(&found, "backendServices", page.Items)
+		})
+		return found, err
+	}, map[string]deleter{
+		"global": func(ctx context.Context, svc *compute.Service, project, _, name string) (*compute.Operation, error) {
+			return svc.BackendServices.Delete(project, name).Context(ctx).Do()
+		},
+		"regions": func(ctx context.Context, svc *compute.Service, project, region, name string) (*compute.Operation, error) {
+			return svc.RegionBackendServices.Delete(project, region, name).Context(ctx).Do()
+		},
+	}},
+	{"securityPolicies", func(ctx context.Context, svc *compute.Service, project, filter string) ([]Resource, error) {
+		var found []Resource
+		err := svc.SecurityPolicies.AggregatedList(project).Filter(filter).Pages(ctx, func(page *compute.SecurityPoliciesAggregatedList) error {
+			return collect(&found, "securityPolicies", page.Items)
+		})
+		return found, err
+	}, map[string]deleter{
+		"global": func(ctx context.Context, svc *compute.Service, project, _, name string) (*compute.Operation, error) {
+			return svc.SecurityPolicies.Delete(project, name).Context(ctx).Do()
+		},
+		"regions": func(ctx context.Context, svc *compute.Service, project, region, name string) (*compute.Operation, error) {
+			return svc.RegionSecurityPolicies.Delete(project, region, name).Context(ctx).Do()
+		},
+	}},
+	{"networkEndpointGroups", func(ctx context.Context, svc *compute.Service, project, filter string) ([]Resource, error) {
+		var found []Resource
+		err := svc.NetworkEndpointGroups.AggregatedList(project).Filter(filter).Pages(ctx, func(page *compute.NetworkEndpointGroupAggregatedList) error {
+			return collect(&found, "networkEndpointGroups", page.Items)
+		})
+		return found, err
+	}, map[string]deleter{
+		"regions": func(ctx context.Context, svc *compute.Service, project, region, name string) (*compute.Operation, error) {
+			return svc.RegionNetworkEndpointGroups.Delete(project, region, name).Context(ctx).Do()
+		},
+		"zones": func(ctx context.Context, svc *compute.Service, project, zone, name string) (*compute.Operation, error) {
+			return svc.NetworkEndpointGroups.Delete(project, zone, name).Context(ctx).Do()
+		},
+	}},
+	{"serviceAttachments", func(ctx context.Context, svc *compute.Service, project, filter string) ([]Resource, error) {
+		var found []Resource
+		err := svc.ServiceAttachments.AggregatedList(project).Filter(filter).Pages(ctx, func(page *compute.ServiceAttachmentAggregatedList) error {
+			return collect(&found, "serviceAttachments", page.Items)
+		})
+		return found, err
+	}, map[string]deleter{
+		"regions": func(ctx context.Context, svc *compute.Service, project, region, name string) (*compute.Operation, error) {
+			return svc.ServiceAttachments.Delete(project, region, name).Context(ctx).Do()
+		},
+	}},
+	{"addresses", func(ctx context.Context, svc *compute.Service, project, filter string) ([]Resource, error) {
+		var found []Resource
+		err := svc.Addresses.AggregatedList(project).Filter(filter).Pages(ctx, func(page *compute.AddressAggregatedList) error {
+			return collect(&found, "addresses", page.Items)
+		})
+		return found, err
+	}, map[string]deleter{
+		"global": func(ctx context.Context, svc *compute.Service, project, _, name string) (*compute.Operation, error) {
+			return svc.GlobalAddresses.Delete(project, name).Context(ctx).Do()
+		},
+		"regions": func(ctx context.Context, svc *compute.Service, project, region, name string) (*compute.Operation, error) {
+			return svc.Addresses.Delete(project, region, name).Context(ctx).Do()
+		},
+	}},
+	{"firewalls", func(ctx context.Context, svc *compute.Service, project, filter string) ([]Resource, error) {
+		var found []Resource
+		err := svc.Firewalls.List(project).Filter(filter).Pages(ctx, func(page *compute.FirewallList) error {
+			return collect(&found, "firewalls", map[string]interface{}{"global": map[string]interface{}{"firewalls": page.Items}})
+		})
+		return found, err
+	}, map[string]deleter{
+		"global": func(ctx context.Context, svc *compute.Service, project, _, name string) (*compute.Operation, error) {
+			return svc.Firewalls.Delete(project, name).Context(ctx).Do()
+		},
+	}},
+	{"subnetworks", func(ctx context.Context, svc *compute.Service, project, filter string) ([]Resource, error) {
+		var found []Resource
+		err := svc.Subnetworks.AggregatedList(project).Filter(filter).Pages(ctx, func(page *compute.SubnetworkAggregatedList) error {
+			return collect(&found, "subnetworks", page.Items)
+		})
+		return found, err
+	}, map[string]deleter{
+		"regions": func(ctx context.Context, svc *compute.Service, project, region, name string) (*compute.Operation, error) {
+			return svc.Subnetworks.Delete(project, region, name).Context(ctx).Do()
+		},
+	}},
+	{"networks", func(ctx context.Context, svc *compute.Service, project, filter string) ([]Resource, error) {
+		var found []Resource
+		err := svc.Networks.List(project).Filter(filter).Pages(ctx, func(page *compute.NetworkList) error {
+			return collect(&found, "networks", map[string]interface{}{"global": map[string]interface{}{"networks": page.Items}})
+		})
+		return found, err
+	}, map[string]deleter{
+		"global": func(ctx context.Context, svc *compute.Service, project, _, name string) (*compute.Operation, error) {
+			return svc.Networks.Delete(project, name).Context(ctx).Do()
+		},
+	}},
+}
+
+// scopeOf reads the scope from a self link
+var scopeOf = regexp.MustCompile(`projects/[^/]+/(global|regions/[^/]+|zones/[^/]+)/`)
+
+// collect adds the resources of an aggregated list's items, which map each
+// scope to a scoped list holding the collection and possibly a warning
+func collect(found *[]Resource, collection string, items interface{}) error {
+	data, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+	var scoped map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(data, &scoped); err != nil {
+		return err
+	}
+	for _, lists := range scoped {
+		var resources []struct {
+			Name              string            `json:"name"`
+			SelfLink          string            `json:"selfLink"`
+			CreationTimestamp string            `json:"creationTimestamp"`
+			Labels            map[string]string `json:"labels"`
+		}
+		if raw, ok := lists[collection]; ok {
+			if err := json.Unmarshal(raw, &resources); err != nil {
+				return err
+			}
+		}
+		for _, r := range resources {
+			m := scopeOf.FindStringSubmatch(r.SelfLink)
+			if m == nil {
+				return fmt.Errorf("%s %s has no scope in its self link %q", collection, r.Name, r.SelfLink)
+			}
+			created, err := time.Parse(time.RFC3339, r.CreationTimestamp)
+			if err != nil {
+				return fmt.Errorf("%s %s: creationTimestamp: %w", collection, r.Name, err)
+			}
+			*found = append(*found, Resource{Collection: collection, Scope: m[1], Name: r.Name, Created: created, Labels: r.Labels})
+		}
+	}
+	return nil
+}
+
+// labelFilter selects resources carrying every label
+func labelFilter(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	terms := make([]string, len(keys))
+	for i, k := range keys {
+		terms[i] = fmt.Sprintf("labels.%s = %q", k, labels[k])
+	}
+	return strings.Join(terms, " AND ")
+}
+
+// Sweep finds the runs past the TTL and deletes their resources. A resource
+// belongs to the longest known prefix its name starts with, so a live run
+// whose prefix extends an abandoned one's (ci-42 and ci-42-x1y2z3) keeps its
+// resources. A resource created within the TTL is skipped even when no
+// prefix but an abandoned one matches it, since a run nested under that
+// prefix may not have labelled anything yet.
+// The error is for listing failures; resources that could not be deleted are
+// in the report's Failed.
+func Sweep(ctx context.Context, svc *compute.Service, opts Options) (*Report, error) {
+	if opts.Project == "" {
+		return nil, errors.New("sweep: no project")
+	}
+	labels := opts.Labels
+	if labels == nil {
+		labels = DefaultLabels
+	}
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	// the forwarding rules and addresses carry the labels and date each run
+	newest := map[string]time.Time{}
+	for _, k := range kinds {
+		if k.collection != "forwardingRules" && k.collection != "addresses" {
+			continue
+		}
+		roots, err := k.list(ctx, svc, opts.Project, labelFilter(labels))
+		if err != nil {
+			return nil, fmt.Errorf("listing %s: %w", k.collection, err)
+		}
+		for _, r := range roots {
+			prefix := r.Labels[NamePrefixLabel]
+			if prefix != "" && r.Created.After(newest[prefix]) {
+				newest[prefix] = r.Created
+			}
+		}
+	}
+
+	report := &Report{DryRun: opts.DryRun}
+	expired := map[string]bool{}
+	for prefix, created := range newest {
+		if created.Before(now.Add(-opts.TTL)) {
+			expired[prefix] = true
+			report.Expired = append(report.Expired, prefix)
+		} else {
+			report.Live = append(report.Live, prefix)
+		}
+	}
+	sort.Strings(report.Expired)
+	sort.Strings(report.Live)
+	if len(expired) == 0 {
+		return report, nil
+	}
+
+	// longest first, so owner finds the most specific prefix
+	prefixes := make([]string, 0, len(newest))
+	for prefix := range newest {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+	owner := func(name string) string {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(name, prefix+"-") {
+				return prefix
+			}
+		}
+		return ""
+	}
+
+	nameFilter := fmt.Sprintf("name eq \"(%s)-.*\"", strings.Join(report.Expired, "|"))
+	for _, k := range kinds {
+		resources, err := k.list(ctx, svc, opts.Project, nameFilter)
+		if err != nil {
+			return nil, fmt.Errorf("listing %s: %w", k.collection, err)
+		}
+		sort.Slice(resources, func(i, j int) bool { return resources[i].String() < resources[j].String() })
+		for _, r := range resources {
+			switch {
+			case !expired[owner(r.Name)]:
+			case !r.Created.Before(now.Add(-opts.TTL)):
+				report.Skipped = append(report.Skipped, r)
+			default:
+				report.Found = append(report.Found, r)
+			}
+		}
+	}
+	if opts.DryRun {
+		return report, nil
+	}
+
+	// each pass deletes what nothing uses any more; stop when a pass frees nothing
+	pending := report.Found
+	for len(pending) > 0 {
+		var retry []Resource
+		var inUse []error
+		for _, r := range pending {
+			err := remove(ctx, svc, opts.Project, r)
+			switch {
+			case err == nil || isNotFound(err):
+				report.Deleted = append(report.Deleted, r)
+			case isInUse(err):
+				retry = append(retry, r)
+				inUse = append(inUse, err)
+			default:
+				report.Failed = append(report.Failed, Failure{Resource: r, Err: err})
+			}
+		}
+		if len(retry) == len(pending) {
+			for i, r := range retry {
+				report.Failed = append(report.Failed, Failure{Resource: r, Err: inUse[i]})
+			}
+			break
+		}
+		pending = retry
+	}
+	return report, nil
+}
+
+// remove deletes r and waits for the operation
+func remove(ctx context.Context, svc *compute.Service, project string, r Resource) error {
+	var k *kind
+	for i := range kinds {
+		if kinds[i].collection == r.Collection {
+			k = &kinds[i]
+		}
+	}
+	scope, location, _ := strings.Cut(r.Scope, "/")
+	if k == nil || k.delete[scope] == nil {
+		return fmt.Errorf("cannot delete %s", r)
+	}
+	op, err := k.delete[scope](ctx, svc, project, location, r.Name)
+	if err != nil {
+		return err
+	}
+	for op.Status != "DONE" {
+		switch {
+		case op.Zone != "":
+			op, err = svc.ZoneOperations.Wait(project, lastSegment(op.Zone), op.Name).Context(ctx).Do()
+		case op.Region != "":
+			op, err = svc.RegionOperations.Wait(project, lastSegment(op.Region), op.Name).Context(ctx).Do()
+		default:
+			op, err = svc.GlobalOperations.Wait(project, op.Name).Context(ctx).Do()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if op.Error != nil && len(op.Error.Errors) > 0 {
+		e := op.Error.Errors[0]
+		return &operationError{code: e.Code, message: e.Message}
+	}
+	return nil
+}
+
+func lastSegment(link string) string { return link[strings.LastIndex(link, "/")+1:] }
+
+// operationError is a delete that the API accepted but could not carry out
+type operationError struct {
+	code    string
+	message string
+}
+
+func (e *operationError) Error() string { return e.code + ": " + e.message }
+
+func isNotFound(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
+
+// isInUse reports a resource another one still refers to, which a later pass
+// can delete
+func isInUse(err error) bool {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		for _, item := range apiErr.Errors {
+			if item.Reason == "resourceInUseByAnotherResource" {
+				return true
+			}
+		}
+		return strings.Contains(apiErr.Message, "is already being used by")
+	}
+	var opErr *operationError
+	return errors.As(err, &opErr) && opErr.code == "RESOURCE_IN_USE_BY_ANOTHER_RESOURCE"
+}
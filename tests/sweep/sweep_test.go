@@ -0,0 +1,178 @@
+package sweep
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	compute "google.golang.org/api/compute/v1"
+
+	"vibetics-cloudedge/tests/fakecompute"
+)
+
+var now = time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// seed deploys a core-shaped run named with prefix, created age ago. An
+// empty prefix is a deployment without resource_name_prefix.
+func seed(t *testing.T, s *fakecompute.Server, prefix, suffix string, age time.Duration) {
+	t.Helper()
+	name := func(n string) string {
+		if prefix == "" {
+			return n
+		}
+		return prefix + "-" + n
+	}
+	labels := map[string]string{"managed-by": "opentofu", "project-suffix": suffix}
+	if prefix != "" {
+		labels[NamePrefixLabel] = prefix
+	}
+	created := now.Add(-age).Format(time.RFC3339)
+	path := func(scope, collection, n string) fakecompute.Path {
+		return fakecompute.Path{Project: "test-project", Scope: scope, Collection: collection, Name: name(n)}
+	}
+	const region = "regions/us-central1"
+	network := path("global", "networks", "ingress-vpc")
+	subnet := path(region, "subnetworks", "ingress-subnet")
+	firewall := path("global", "firewalls", suffix+"-allow-https")
+	backend := path(region, "backendServices", "demo-web-app-external-backend")
+	urlMap := path(region, "urlMaps", "external-https-lb")
+	proxy := path(region, "targetHttpsProxies", "external-https-lb-proxy")
+	address := path(region, "addresses", suffix+"-external-lb-ip")
+	rule := path(region, "forwardingRules", "external-https-lb")
+
+	for p, resource := range map[fakecompute.Path]interface{}{
+		network:  &compute.Network{CreationTimestamp: created},
+		subnet:   &compute.Subnetwork{CreationTimestamp: created, Network: network.SelfLink()},
+		firewall: &compute.Firewall{CreationTimestamp: created, Network: network.SelfLink()},
+		backend:  &compute.BackendService{CreationTimestamp: created},
+		urlMap:   &compute.UrlMap{CreationTimestamp: created, DefaultService: backend.SelfLink()},
+		proxy:    &compute.TargetHttpsProxy{CreationTimestamp: created, UrlMap: urlMap.SelfLink()},
+		address:  &compute.Address{CreationTimestamp: created, Labels: labels},
+		rule: &compute.ForwardingRule{CreationTimestamp: created, Labels: labels, Target: proxy.SelfLink(),
+			IPAddress: address.SelfLink(), Network: network.SelfLink(), Subnetwork: subnet.SelfLink()},
+	} {
+		require.NoError(t, s.Put(p, resource))
+	}
+}
+
+func newFake(t *testing.T) (*fakecompute.Server, *compute.Service) {
+	t.Helper()
+	s := fakecompute.NewServer()
+	t.Cleanup(s.Close)
+	svc, err := s.Service(context.Background())
+	require.NoError(t, err)
+
+	seed(t, s, "t1old", "nonprod", 30*time.Hour)
+	// a live run whose prefix extends the abandoned one's
+	seed(t, s, "t1old-b2", "nonprod", time.Hour)
+	seed(t, s, "t2new", "nonprod", time.Hour)
+	// the long-lived deployment and an old prefixed run in another environment
+	seed(t, s, "", "nonprod", 90*24*time.Hour)
+	seed(t, s, "t3prod", "prod", 30*time.Hour)
+	// a Unique run under the abandoned prefix that has not labelled anything yet
+	require.NoError(t, s.Put(fakecompute.Path{Project: "test-project", Scope: "global", Collection: "networks", Name: "t1old-k9m2p4-ingress-vpc"},
+		&compute.Network{CreationTimestamp: now.Add(-time.Minute).Format(time.RFC3339)}))
+	return s, svc
+}
+
+func names(resources []Resource) []string {
+	var out []string
+	for _, r := range resources {
+		out = append(out, r.Collection+"/"+r.Name)
+	}
+	return out
+}
+
+func TestSweepDryRun(t *testing.T) {
+	t.Parallel()
+	s, svc := newFake(t)
+	before := len(s.Paths())
+
+	report, err := Sweep(context.Background(), svc, Options{Project: "test-project", TTL: 6 * time.Hour, DryRun: true, Now: now})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"t1old"}, report.Expired)
+	assert.Equal(t, []string{"t1old-b2", "t2new"}, report.Live)
+	assert.Equal(t, []string{
+		"forwardingRules/t1old-external-https-lb",
+		"targetHttpsProxies/t1old-external-https-lb-proxy",
+		"urlMaps/t1old-external-https-lb",
+		"backendServices/t1old-demo-web-app-external-backend",
+		"addresses/t1old-nonprod-external-lb-ip",
+		"firewalls/t1old-nonprod-allow-https",
+		"subnetworks/t1old-ingress-subnet",
+		"networks/t1old-ingress-vpc",
+	}, names(report.Found))
+	assert.Equal(t, []string{"networks/t1old-k9m2p4-ingress-vpc"}, names(report.Skipped))
+	assert.Empty(t, report.Deleted)
+	assert.Len(t, s.Paths(), before, "a dry run deletes nothing")
+}
+
+func TestSweepDeletesExpiredRuns(t *testing.T) {
+	t.Parallel()
+	s, svc := newFake(t)
+
+	report, err := Sweep(context.Background(), svc, Options{Project: "test-project", TTL: 6 * time.Hour, Now: now})
+	require.NoError(t, err)
+	assert.Empty(t, report.Failed)
+	assert.Equal(t, names(report.Found), names(report.Deleted))
+	for _, p := range s.Paths() {
+		assert.NotRegexp(t, `^t1old-[a-z]+(-|$)`, p.Name, "%s survived", p)
+	}
+	assert.Len(t, s.Paths(), 4*8+1, "the other runs are untouched")
+
+	// with a TTL past every run, the prod labels still keep t3prod
+	report, err = Sweep(context.Background(), svc, Options{Project: "test-project", TTL: time.Minute, Now: now})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"t1old-b2", "t2new"}, report.Expired)
+	assert.Len(t, report.Deleted, 16)
+	assert.Len(t, s.Paths(), 2*8+1)
+}
+
+func TestSweepDeletesSixCharacterServiceNames(t *testing.T) {
+	t.Parallel()
+	s := fakecompute.NewServer()
+	t.Cleanup(s.Close)
+	svc, err := s.Service(context.Background())
+	require.NoError(t, err)
+	seed(t, s, "t1old", "nonprod", 30*time.Hour)
+
+	// demo_web_app_service_name "webapp-api" looks like a Unique ID after the prefix
+	created := now.Add(-30 * time.Hour).Format(time.RFC3339)
+	neg := fakecompute.Path{Project: "test-project", Scope: "regions/us-central1", Collection: "networkEndpointGroups", Name: "t1old-webapp-api-psc-neg"}
+	backend := neg
+	backend.Collection, backend.Name = "backendServices", "t1old-webapp-api-external-backend"
+	require.NoError(t, s.Put(neg, &compute.NetworkEndpointGroup{CreationTimestamp: created}))
+	require.NoError(t, s.Put(backend, &compute.BackendService{CreationTimestamp: created}))
+
+	report, err := Sweep(context.Background(), svc, Options{Project: "test-project", TTL: 6 * time.Hour, Now: now})
+	require.NoError(t, err)
+	assert.Empty(t, report.Skipped)
+	assert.Empty(t, report.Failed)
+	assert.Contains(t, names(report.Deleted), "networkEndpointGroups/t1old-webapp-api-psc-neg")
+	assert.Contains(t, names(report.Deleted), "backendServices/t1old-webapp-api-external-backend")
+	assert.Empty(t, s.Paths())
+}
+
+func TestSweepRetriesResourcesInUse(t *testing.T) {
+	t.Parallel()
+	s := fakecompute.NewServer()
+	t.Cleanup(s.Close)
+	svc, err := s.Service(context.Background())
+	require.NoError(t, err)
+	seed(t, s, "t1old", "nonprod", 30*time.Hour)
+
+	// a service attachment refers to the forwarding rule listed before it
+	rule := fakecompute.Path{Project: "test-project", Scope: "regions/us-central1", Collection: "forwardingRules", Name: "t1old-external-https-lb"}
+	attachment := rule
+	attachment.Collection, attachment.Name = "serviceAttachments", "t1old-demo-web-app-psc-attachment"
+	require.NoError(t, s.Put(attachment, &compute.ServiceAttachment{CreationTimestamp: now.Add(-30 * time.Hour).Format(time.RFC3339), TargetService: rule.SelfLink()}))
+
+	report, err := Sweep(context.Background(), svc, Options{Project: "test-project", TTL: 6 * time.Hour, Now: now})
+	require.NoError(t, err)
+	assert.Empty(t, report.Failed)
+	assert.Len(t, report.Deleted, 9)
+	assert.Equal(t, "serviceAttachments/t1old-demo-web-app-psc-attachment", names(report.Deleted)[0])
+	assert.Empty(t, s.Paths())
+}
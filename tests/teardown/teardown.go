@@ -0,0 +1,408 @@
+// Package teardown destroys a deployed stack module by module, in the reverse
+// of the order the stack applies them. Each destroy is retried while its
+// errors match a retryable pattern and given up on at the first fatal one; a
+// module whose dependents are still deployed is skipped rather than
+// half-destroyed. The project logging bucket is handled specially: GCP keeps
+// a deleted bucket in DELETE_REQUESTED for days, and destroying one in that
+// state fails, so it is dropped from state instead. The outcome is a Result
+// that marshals to the JSON CI reads.
+package teardown
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/gruntwork-io/terratest/modules/testing"
+
+	"vibetics-cloudedge/tests/stack"
+)
+
+// LogsBucketAddress is project-singleton's logging bucket, which GCP
+// soft-deletes
+const LogsBucketAddress = "google_logging_project_bucket_config.logs_bucket[0]"
+
+// logsBucketOutput is the output holding the bucket's resource name
+const logsBucketOutput = "logs_bucket_id"
+
+// Bucket lifecycle states of the Cloud Logging API
+const (
+	BucketActive          = "ACTIVE"
+	BucketDeleteRequested = "DELETE_REQUESTED"
+	// BucketNotFound is reported by LogBuckets for a bucket that is gone
+	BucketNotFound = "NOT_FOUND"
+)
+
+// GCPRetryableErrors are transient GCP failures seen during destroys, on top
+// of terraform.DefaultRetryableTerraformErrors
+var GCPRetryableErrors = map[string]string{
+	".*is already being used by.*":            "Resource is still referenced by one being deleted.",
+	".*resourceInUseByAnotherResource.*":      "Resource is still referenced by one being deleted.",
+	".*googleapi: Error 429.*":                "GCP API rate limit exceeded.",
+	".*googleapi: Error 503.*":                "GCP API temporarily unavailable.",
+	".*Error acquiring the state lock.*":      "State is locked by another operation.",
+	".*operation.*is currently in progress.*": "Another operation on the resource is in progress.",
+}
+
+// softDeletedBucket matches a destroy that failed on a soft-deleted bucket
+var softDeletedBucket = regexp.MustCompile(`(?s)logs_bucket.*(DELETE_REQUESTED|deleted state|FAILED_PRECONDITION)`)
+
+// Tofu runs the commands the teardown needs in a module directory
+type Tofu interface {
+	Destroy(options *terraform.Options) (string, error)
+	// Output returns an output of the module's state
+	Output(options *terraform.Options, name string) (string, error)
+	// StateRemove forgets a resource without destroying it
+	StateRemove(options *terraform.Options, address string) error
+}
+
+// LogBuckets reads a logging bucket's lifecycle state by its resource name,
+// projects/P/locations/L/buckets/B. A missing bucket is BucketNotFound.
+type LogBuckets interface {
+	LifecycleState(ctx context.Context, name string) (string, error)
+}
+
+// Status is how a module's teardown ended
+type Status string
+
+const (
+	Destroyed Status = "destroyed"
+	Failed    Status = "failed"
+	// Skipped modules were left alone because a module reading their state
+	// was not destroyed
+	Skipped Status = "skipped"
+)
+
+// Attempt is one failed destroy
+type Attempt struct {
+	Number    int    `json:"number"`
+	Retryable bool   `json:"retryable"`
+	Reason    string `json:"reason"`
+	Error     string `json:"error"`
+}
+
+// ModuleResult is the teardown of one module
+type ModuleResult struct {
+	Module   string    `json:"module"`
+	Status   Status    `json:"status"`
+	Attempts []Attempt `json:"failed_attempts,omitempty"`
+	// StateRemoved lists the addresses forgotten instead of destroyed
+	StateRemoved []string `json:"state_removed,omitempty"`
+	// BlockedBy lists the modules that kept a skipped module deployed
+	BlockedBy []string `json:"blocked_by,omitempty"`
+	Seconds   float64  `json:"seconds"`
+}
+
+// Result is the teardown of a stack
+type Result struct {
+	Succeeded bool           `json:"succeeded"`
+	Modules   []ModuleResult `json:"modules"`
+}
+
+// Module returns the result for module, or nil
+func (r *Result) Module(module string) *ModuleResult {
+	for i := range r.Modules {
+		if r.Modules[i].Module == module {
+			return &r.Modules[i]
+		}
+	}
+	return nil
+}
+
+// Teardown destroys a stack
+type Teardown struct {
+	Stack *stack.Stack
+	Tofu  Tofu
+	// Buckets checks the logging bucket before a module is destroyed; nil
+	// leaves it to the destroy
+	Buckets LogBuckets
+	// MaxAttempts bounds the destroys of one module; 3 when zero
+	MaxAttempts int
+	// TimeBetweenRetries is the wait after a retryable failure; 10s when zero
+	TimeBetweenRetries time.Duration
+	// RetryableErrors maps patterns of retryable output to a reason; the
+	// terratest defaults and GCPRetryableErrors when nil
+	RetryableErrors map[string]string
+	// Logf reports progress; nothing is logged when nil
+	Logf func(format string, args ...interface{})
+
+	sleep func(time.Duration)
+	now   func() time.Time
+}
+
+// Classify reports whether a destroy failure is worth retrying, with the
+// reason of the first pattern that matches
+func Classify(output string, err error, retryable map[string]string) (bool, string) {
+	text := output
+	if err != nil {
+		text += "\n" + err.Error()
+	}
+	patterns := make([]string, 0, len(retryable))
+	for pattern := range retryable {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		if matched, _ := regexp.MatchString(pattern, text); matched {
+			return true, retryable[pattern]
+		}
+	}
+	return false, "fatal: no retryable error pattern matched"
+}
+
+// Run destroys the stack's modules in reverse apply order
+func (td *Teardown) Run(ctx context.Context) *Result {
+	retryable := td.RetryableErrors
+	if retryable == nil {
+		retryable = map[string]string{}
+		for k, v := range terraform.DefaultRetryableTerraformErrors {
+			retryable[k] = v
+		}
+		for k, v := range GCPRetryableErrors {
+			retryable[k] = v
+		}
+	}
+
+	result := &Result{Succeeded: true}
+	remaining := map[string]bool{}
+	for i := len(td.Stack.Stages) - 1; i >= 0; i-- {
+		stage := td.Stack.Stages[i]
+		var blockers []string
+		for _, other := range td.Stack.Stages {
+			if remaining[other.Module] && contains(other.DependsOn, stage.Module) {
+				blockers = append(blockers, other.Module)
+			}
+		}
+		if len(blockers) > 0 {
+			td.logf("Skipping %s: %s still reads its state", stage.Module, strings.Join(blockers, ", "))
+			result.Modules = append(result.Modules, ModuleResult{Module: stage.Module, Status: Skipped, BlockedBy: blockers})
+			remaining[stage.Module] = true
+			result.Succeeded = false
+			continue
+		}
+
+		m := td.destroy(ctx, stage, retryable)
+		if m.Status != Destroyed {
+			remaining[stage.Module] = true
+			result.Succeeded = false
+		}
+		result.Modules = append(result.Modules, m)
+	}
+	return result
+}
+
+// destroy tears down one module, retrying retryable failures
+func (td *Teardown) destroy(ctx context.Context, stage *stack.Stage, retryable map[string]string) (m ModuleResult) {
+	start := td.clock()
+	m = ModuleResult{Module: stage.Module, Status: Failed}
+	defer func() { m.Seconds = td.clock().Sub(start).Seconds() }()
+
+	if err := td.checkLogsBucket(ctx, stage, &m); err != nil {
+		m.Attempts = append(m.Attempts, Attempt{Number: 0, Reason: "fatal: checking the logging bucket", Error: err.Error()})
+		return m
+	}
+
+	attempts := td.MaxAttempts
+	if attempts <= 0 {
+		attempts = 3
+	}
+	for n := 1; n <= attempts; n++ {
+		td.logf("Destroying %s (attempt %d/%d)", stage.Module, n, attempts)
+		output, err := td.Tofu.Destroy(stage.Options)
+		if err == nil {
+			m.Status = Destroyed
+			return m
+		}
+
+		attempt := Attempt{Number: n, Error: lastLines(output, err)}
+		if softDeletedBucket.MatchString(output+"\n"+err.Error()) && !contains(m.StateRemoved, LogsBucketAddress) {
+			attempt.Retryable, attempt.Reason = true, "logging bucket is soft-deleted; removed from state"
+			if rmErr := td.Tofu.StateRemove(stage.Options, LogsBucketAddress); rmErr != nil {
+				attempt.Retryable, attempt.Reason = false, "fatal: removing the soft-deleted logging bucket from state: "+rmErr.Error()
+			} else {
+				m.StateRemoved = append(m.StateRemoved, LogsBucketAddress)
+			}
+		} else {
+			attempt.Retryable, attempt.Reason = Classify(output, err, retryable)
+		}
+		m.Attempts = append(m.Attempts, attempt)
+		td.logf("Destroying %s failed (%s)", stage.Module, attempt.Reason)
+		if !attempt.Retryable {
+			return m
+		}
+		if n < attempts {
+			td.wait()
+		}
+	}
+	return m
+}
+
+// checkLogsBucket forgets the module's logging bucket when GCP has already
+// deleted it, and waits out a bucket that is being created or updated
+func (td *Teardown) checkLogsBucket(ctx context.Context, stage *stack.Stage, m *ModuleResult) error {
+	if td.Buckets == nil {
+		return nil
+	}
+	name, err := td.Tofu.Output(stage.Options, logsBucketOutput)
+	if err != nil || name == "" || name == "<nil>" {
+		// no such output, or logging is disabled
+		return nil
+	}
+	for n := 1; ; n++ {
+		state, err := td.Buckets.LifecycleState(ctx, name)
+		if err != nil {
+			return err
+		}
+		switch state {
+		case BucketActive:
+			return nil
+		case BucketDeleteRequested, BucketNotFound:
+			td.logf("Logging bucket %s is %s; removing it from %s's state", name, state, stage.Module)
+			if err := td.Tofu.StateRemove(stage.Options, LogsBucketAddress); err != nil {
+				return err
+			}
+			m.StateRemoved = append(m.StateRemoved, LogsBucketAddress)
+			return nil
+		}
+		if n == 10 {
+			td.logf("Logging bucket %s is still %s; destroying anyway", name, state)
+			return nil
+		}
+		td.logf("Logging bucket %s is %s; waiting", name, state)
+		td.wait()
+	}
+}
+
+func (td *Teardown) wait() {
+	d := td.TimeBetweenRetries
+	if d <= 0 {
+		d = 10 * time.Second
+	}
+	if td.sleep != nil {
+		td.sleep(d)
+		return
+	}
+	time.Sleep(d)
+}
+
+func (td *Teardown) clock() time.Time {
+	if td.now != nil {
+		return td.now()
+	}
+	return time.Now()
+}
+
+func (td *Teardown) logf(format string, args ...interface{}) {
+	if td.Logf != nil {
+		td.Logf(format, args...)
+	}
+}
+
+// lastLines keeps the end of a failed destroy's output, where tofu prints
+// the errors
+func lastLines(output string, err error) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) > 20 {
+		lines = lines[len(lines)-20:]
+	}
+	text := strings.TrimSpace(strings.Join(lines, "\n"))
+	if text == "" {
+		return err.Error()
+	}
+	return text
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// terratestTofu runs tofu through terratest
+type terratestTofu struct {
+	t testing.TestingT
+}
+
+// Terratest returns a Tofu that runs the commands with terratest, named after
+// t. Failures terratest reports through t.Error or t.Fatal instead of its
+// error returns come back as the command's error and never reach t, so a
+// t that exits the process cannot end a teardown halfway.
+func Terratest(t testing.TestingT) Tofu { return terratestTofu{t: t} }
+
+func (r terratestTofu) Destroy(options *terraform.Options) (output string, err error) {
+	err = r.run(func(t testing.TestingT) (err error) {
+		output, err = terraform.DestroyE(t, options)
+		return err
+	})
+	return output, err
+}
+
+func (r terratestTofu) Output(options *terraform.Options, name string) (output string, err error) {
+	err = r.run(func(t testing.TestingT) (err error) {
+		output, err = terraform.OutputE(t, options, name)
+		return err
+	})
+	return output, err
+}
+
+func (r terratestTofu) StateRemove(options *terraform.Options, address string) error {
+	return r.run(func(t testing.TestingT) error {
+		_, err := terraform.RunTerraformCommandE(t, options, "state", "rm", address)
+		return err
+	})
+}
+
+// run calls command with a recordingT and folds what it recorded into the
+// returned error
+func (r terratestTofu) run(command func(t testing.TestingT) error) (err error) {
+	t := &recordingT{name: r.t.Name()}
+	defer func() {
+		if p := recover(); p != nil && p != errFatal {
+			panic(p)
+		}
+		switch {
+		case len(t.errors) == 0:
+		case err == nil:
+			err = errors.New(strings.Join(t.errors, "; "))
+		default:
+			err = fmt.Errorf("%w; %s", err, strings.Join(t.errors, "; "))
+		}
+	}()
+	return command(t)
+}
+
+// errFatal unwinds a command that called FailNow or Fatal
+var errFatal = errors.New("fatal")
+
+// recordingT keeps the failures reported to it; FailNow and Fatal stop the
+// command with errFatal, which run recovers
+type recordingT struct {
+	name   string
+	errors []string
+}
+
+func (t *recordingT) Fail()    { t.errors = append(t.errors, "failed") }
+func (t *recordingT) FailNow() { t.Fail(); panic(errFatal) }
+
+func (t *recordingT) Error(args ...interface{}) { t.errors = append(t.errors, fmt.Sprint(args...)) }
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func (t *recordingT) Fatal(args ...interface{}) { t.Error(args...); panic(errFatal) }
+
+func (t *recordingT) Fatalf(format string, args ...interface{}) {
+	t.Errorf(format, args...)
+	panic(errFatal)
+}
+
+func (t *recordingT) Name() string { return t.name }
@@ -0,0 +1,208 @@
+package teardown
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	tt "github.com/gruntwork-io/terratest/modules/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vibetics-cloudedge/tests/stack"
+	"vibetics-cloudedge/tests/testconfig"
+)
+
+var profile = &testconfig.Profile{
+	Project:            "test-project",
+	Region:             "us-central1",
+	ProjectSuffix:      "nonprod",
+	GitHubRepository:   "vibetics-cloudedge",
+	BillingAccountName: "Test Billing Account",
+	Cloudflare:         testconfig.Cloudflare{APIToken: "token", ZoneID: "zone"},
+}
+
+const bucketName = "projects/test-project/locations/us-central1/buckets/test-project-logs"
+
+// fakeTofu answers each module's destroys from a script of errors, nil
+// meaning success, and logs the calls
+type fakeTofu struct {
+	stack    *stack.Stack
+	failures map[string][]error
+	outputs  map[string]string
+	calls    []string
+}
+
+func (f *fakeTofu) module(options *terraform.Options) string {
+	for _, stage := range f.stack.Stages {
+		if stage.Options == options {
+			return stage.Module
+		}
+	}
+	return "?"
+}
+
+func (f *fakeTofu) Destroy(options *terraform.Options) (string, error) {
+	m := f.module(options)
+	f.calls = append(f.calls, "destroy "+m)
+	if len(f.failures[m]) == 0 {
+		return "Destroy complete!", nil
+	}
+	err := f.failures[m][0]
+	f.failures[m] = f.failures[m][1:]
+	if err == nil {
+		return "Destroy complete!", nil
+	}
+	return "Error: " + err.Error(), err
+}
+
+func (f *fakeTofu) Output(options *terraform.Options, name string) (string, error) {
+	if v, ok := f.outputs[f.module(options)+"."+name]; ok {
+		return v, nil
+	}
+	return "", errors.New("Output \"" + name + "\" not found")
+}
+
+func (f *fakeTofu) StateRemove(options *terraform.Options, address string) error {
+	f.calls = append(f.calls, "state rm "+f.module(options)+" "+address)
+	return nil
+}
+
+type fakeBuckets map[string]string
+
+func (b fakeBuckets) LifecycleState(_ context.Context, name string) (string, error) {
+	if state, ok := b[name]; ok {
+		return state, nil
+	}
+	return BucketNotFound, nil
+}
+
+func newTeardown(t *testing.T, failures map[string][]error) (*Teardown, *fakeTofu) {
+	t.Helper()
+	s, err := stack.ForProfile(profile, map[string]map[string]interface{}{"core": {"enable_demo_web_app": true}})
+	require.NoError(t, err)
+	tofu := &fakeTofu{stack: s, failures: failures, outputs: map[string]string{}}
+	return &Teardown{Stack: s, Tofu: tofu, sleep: func(time.Duration) {}}, tofu
+}
+
+func TestClassify(t *testing.T) {
+	t.Parallel()
+	retryable, reason := Classify("Error: Provider produced inconsistent result after apply", errors.New("exit status 1"), terraform.DefaultRetryableTerraformErrors)
+	assert.True(t, retryable)
+	assert.Equal(t, "Provider eventual consistency error.", reason)
+
+	retryable, reason = Classify("Error: Error when reading or editing Network: googleapi: Error 400: The network resource 'ingress-vpc' is already being used by 'ingress-subnet'",
+		errors.New("exit status 1"), GCPRetryableErrors)
+	assert.True(t, retryable)
+	assert.Equal(t, "Resource is still referenced by one being deleted.", reason)
+
+	retryable, reason = Classify("Error: googleapi: Error 403: Permission denied", errors.New("exit status 1"), GCPRetryableErrors)
+	assert.False(t, retryable)
+	assert.Contains(t, reason, "fatal")
+}
+
+func TestRunRetriesInReverseOrder(t *testing.T) {
+	t.Parallel()
+	td, tofu := newTeardown(t, map[string][]error{
+		"core": {errors.New("googleapi: Error 503: backend unavailable"), nil},
+	})
+	result := td.Run(context.Background())
+
+	assert.True(t, result.Succeeded)
+	assert.Equal(t, []string{"destroy core", "destroy core", "destroy demo-web-app", "destroy project-singleton"}, tofu.calls)
+	core := result.Module("core")
+	require.Len(t, core.Attempts, 1)
+	assert.True(t, core.Attempts[0].Retryable)
+	assert.Equal(t, "GCP API temporarily unavailable.", core.Attempts[0].Reason)
+}
+
+func TestRunSkipsDependenciesOfFailedModule(t *testing.T) {
+	t.Parallel()
+	td, tofu := newTeardown(t, map[string][]error{
+		"demo-web-app": {errors.New("googleapi: Error 403: Permission denied")},
+	})
+	result := td.Run(context.Background())
+
+	assert.False(t, result.Succeeded)
+	assert.Equal(t, []string{"destroy core", "destroy demo-web-app"}, tofu.calls, "a fatal error is not retried")
+	assert.Equal(t, Destroyed, result.Module("core").Status)
+	assert.Equal(t, Failed, result.Module("demo-web-app").Status)
+	assert.False(t, result.Module("demo-web-app").Attempts[0].Retryable)
+	singleton := result.Module("project-singleton")
+	assert.Equal(t, Skipped, singleton.Status)
+	assert.Equal(t, []string{"demo-web-app"}, singleton.BlockedBy)
+
+	// the result is what CI parses
+	data, err := json.Marshal(result)
+	require.NoError(t, err)
+	var parsed map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &parsed))
+	assert.Equal(t, false, parsed["succeeded"])
+	modules := parsed["modules"].([]interface{})
+	assert.Equal(t, "skipped", modules[2].(map[string]interface{})["status"])
+}
+
+func TestRunForgetsSoftDeletedLogsBucket(t *testing.T) {
+	t.Parallel()
+	td, tofu := newTeardown(t, nil)
+	tofu.outputs["project-singleton.logs_bucket_id"] = bucketName
+	td.Buckets = fakeBuckets{bucketName: BucketDeleteRequested}
+	result := td.Run(context.Background())
+
+	assert.True(t, result.Succeeded)
+	assert.Equal(t, []string{
+		"destroy core", "destroy demo-web-app",
+		"state rm project-singleton " + LogsBucketAddress, "destroy project-singleton",
+	}, tofu.calls)
+	assert.Equal(t, []string{LogsBucketAddress}, result.Module("project-singleton").StateRemoved)
+
+	// without the bucket check, the failed destroy gives it away
+	td, tofu = newTeardown(t, map[string][]error{
+		"project-singleton": {errors.New(`deleting google_logging_project_bucket_config.logs_bucket[0]: googleapi: Error 400: Bucket is in DELETE_REQUESTED state`), nil},
+	})
+	result = td.Run(context.Background())
+	assert.True(t, result.Succeeded)
+	assert.Equal(t, []string{
+		"destroy core", "destroy demo-web-app", "destroy project-singleton",
+		"state rm project-singleton " + LogsBucketAddress, "destroy project-singleton",
+	}, tofu.calls)
+	assert.Equal(t, "logging bucket is soft-deleted; removed from state", result.Module("project-singleton").Attempts[0].Reason)
+}
+
+// fatalT stands in for the command's TestingT, which exits the process on
+// any failure; the test fails if a failure reaches it
+type fatalT struct{ *testing.T }
+
+func (t fatalT) Fail()                                     { t.T.Fatal("Fail reached the caller's T") }
+func (t fatalT) FailNow()                                  { t.Fail() }
+func (t fatalT) Error(args ...interface{})                 { t.Fail() }
+func (t fatalT) Errorf(format string, args ...interface{}) { t.Fail() }
+func (t fatalT) Fatal(args ...interface{})                 { t.Fail() }
+func (t fatalT) Fatalf(format string, args ...interface{}) { t.Fail() }
+func (t fatalT) Name() string                              { return "teardown" }
+
+func TestTerratestRecoversFailures(t *testing.T) {
+	t.Parallel()
+	tofu := Terratest(fatalT{t}).(terratestTofu)
+
+	err := tofu.run(func(rt tt.TestingT) error {
+		rt.Errorf("output %s is empty", "logs_bucket")
+		rt.Fatal("tofu exited with status 1")
+		return nil
+	})
+	assert.EqualError(t, err, "output logs_bucket is empty; tofu exited with status 1")
+
+	err = tofu.run(func(rt tt.TestingT) error {
+		rt.Error("lock held")
+		return errors.New("destroy failed")
+	})
+	assert.EqualError(t, err, "destroy failed; lock held")
+
+	assert.NoError(t, tofu.run(func(rt tt.TestingT) error {
+		assert.Equal(t, "teardown", rt.Name())
+		return nil
+	}))
+}
@@ -0,0 +1,42 @@
+package testconfig
+
+import (
+	"fmt"
+
+	"vibetics-cloudedge/tests/modcontract"
+	"vibetics-cloudedge/tests/planfixture"
+)
+
+// Backend returns the gcs backend config the module keeps its state under for
+// the profile: the bucket and prefix core's terraform_remote_state blocks read
+// for project-singleton and demo-web-app, and ${project_id}-${name_prefix}core
+// for core, as stack.StateLocations returns them. A Unique profile moves the
+// demo-web-app and core state with its name prefix, so parallel runs never
+// share a state object or its lock; the project-singleton state is shared.
+func (p *Profile) Backend(module string) (map[string]interface{}, error) {
+	core, err := modcontract.LoadModule(planfixture.ModuleDir("core"))
+	if err != nil {
+		return nil, err
+	}
+	locals := map[string]string{}
+	for _, name := range []string{"project_id", "name_prefix", "demo_web_app_project_id", "demo_web_app_service_name"} {
+		value, err := core.Local(name, p.Vars("core"))
+		if err != nil {
+			return nil, fmt.Errorf("evaluating core local.%s: %w", name, err)
+		}
+		locals[name] = fmt.Sprint(value)
+	}
+
+	bucket, prefix := locals["project_id"]+"-tfstate", ""
+	switch module {
+	case "project-singleton":
+		prefix = locals["project_id"] + "-singleton"
+	case "demo-web-app":
+		bucket, prefix = locals["demo_web_app_project_id"]+"-tfstate", locals["demo_web_app_service_name"]
+	case "core":
+		prefix = fmt.Sprintf("%s-%score", locals["project_id"], locals["name_prefix"])
+	default:
+		return nil, fmt.Errorf("unknown module %q (known: %v)", module, Modules)
+	}
+	return map[string]interface{}{"bucket": bucket, "prefix": prefix}, nil
+}
@@ -0,0 +1,96 @@
+package testconfig
+
+import (
+	"fmt"
+
+	"github.com/gruntwork-io/terratest/modules/testing"
+
+	"vibetics-cloudedge/tests/modcontract"
+	"vibetics-cloudedge/tests/planfixture"
+)
+
+// Names are the resource names core and demo-web-app deploy for a profile.
+// They are evaluated from the modules' locals, so tests follow the modules
+// instead of repeating their naming scheme.
+type Names struct {
+	IngressVPC      string
+	IngressSubnet   string
+	ProxyOnlySubnet string
+	HTTPSFirewall   string
+	WAFPolicy       string
+	ExternalLB      string
+	ExternalLBProxy string
+	ExternalLBIP    string
+	ExternalBackend string
+	PSCNEG          string
+	OriginCert      string
+	// Subdomain is the Cloudflare DNS record, under root_domain, that the
+	// origin certificate is issued for
+	Subdomain string
+
+	DemoService       string
+	DemoVPC           string
+	DemoPSCAttachment string
+}
+
+// Names evaluates the resource names for the profile's variables
+func (p *Profile) Names() (Names, error) {
+	core, err := modcontract.LoadModule(planfixture.ModuleDir("core"))
+	if err != nil {
+		return Names{}, err
+	}
+	value, err := core.Local("resource_names", p.Vars("core"))
+	if err != nil {
+		return Names{}, fmt.Errorf("evaluating core local.resource_names: %w", err)
+	}
+	coreNames, ok := value.(map[string]interface{})
+	if !ok {
+		return Names{}, fmt.Errorf("core local.resource_names is %T, expected a map", value)
+	}
+
+	demo, err := modcontract.LoadModule(planfixture.ModuleDir("demo-web-app"))
+	if err != nil {
+		return Names{}, err
+	}
+	demoNames := map[string]interface{}{}
+	for _, local := range []string{"web_app_service_name", "web_vpc_name"} {
+		if demoNames[local], err = demo.Local(local, p.Vars("demo-web-app")); err != nil {
+			return Names{}, fmt.Errorf("evaluating demo-web-app local.%s: %w", local, err)
+		}
+	}
+
+	name := func(names map[string]interface{}, key string) string {
+		s, _ := names[key].(string)
+		if s == "" && err == nil {
+			err = fmt.Errorf("no resource name %q", key)
+		}
+		return s
+	}
+	names := Names{
+		IngressVPC:        name(coreNames, "ingress_vpc"),
+		IngressSubnet:     name(coreNames, "ingress_subnet"),
+		ProxyOnlySubnet:   name(coreNames, "proxy_only_subnet"),
+		HTTPSFirewall:     name(coreNames, "https_firewall"),
+		WAFPolicy:         name(coreNames, "waf_policy"),
+		ExternalLB:        name(coreNames, "external_lb"),
+		ExternalLBProxy:   name(coreNames, "external_lb_proxy"),
+		ExternalLBIP:      name(coreNames, "external_lb_ip"),
+		ExternalBackend:   name(coreNames, "external_backend"),
+		PSCNEG:            name(coreNames, "psc_neg"),
+		OriginCert:        name(coreNames, "origin_cert"),
+		Subdomain:         name(coreNames, "subdomain"),
+		DemoService:       name(demoNames, "web_app_service_name"),
+		DemoVPC:           name(demoNames, "web_vpc_name"),
+		DemoPSCAttachment: name(demoNames, "web_app_service_name") + "-psc-attachment",
+	}
+	return names, err
+}
+
+// MustNames is Names, failing the test when the modules cannot be evaluated
+func (p *Profile) MustNames(t testing.TestingT) Names {
+	names, err := p.Names()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
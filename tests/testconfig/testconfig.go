@@ -0,0 +1,309 @@
+// Package testconfig loads the environment the integration tests deploy
+// into from one profile, a YAML file overridden by environment variables,
+// and builds terraform.Options for each module from it. A profile is
+// validated up front so a run with missing settings fails once, naming all of
+// them, instead of test by test.
+package testconfig
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+	"github.com/gruntwork-io/terratest/modules/testing"
+	"gopkg.in/yaml.v3"
+
+	"vibetics-cloudedge/tests/planfixture"
+)
+
+// ProfileEnv names the profile file; without it only environment variables
+// and defaults are used
+const ProfileEnv = "CLOUDEDGE_TEST_PROFILE"
+
+// Modules are the modules a profile builds options for
+var Modules = []string{"project-singleton", "demo-web-app", "core"}
+
+// namePrefixPattern mirrors the resource_name_prefix validation of core and
+// demo-web-app
+var namePrefixPattern = regexp.MustCompile(`^[a-z]([a-z0-9-]{0,14}[a-z0-9])?$`)
+
+// Profile is one deployment target
+type Profile struct {
+	// Project hosts the edge; it is cloudedge_project_id and, for
+	// project-singleton, project_id
+	Project string `yaml:"project"`
+	// DemoProject hosts demo-web-app; it defaults to Project
+	DemoProject   string `yaml:"demo_project"`
+	Region        string `yaml:"region"`
+	ProjectSuffix string `yaml:"project_suffix"`
+	// NamePrefix is resource_name_prefix for core and demo-web-app; see Unique
+	NamePrefix string `yaml:"name_prefix"`
+	// GitHubRepository is cloudedge_github_repository
+	GitHubRepository   string            `yaml:"github_repository"`
+	BillingAccountName string            `yaml:"billing_account_name"`
+	BudgetAmount       float64           `yaml:"budget_amount"`
+	ResourceTags       map[string]string `yaml:"resource_tags"`
+	Cloudflare         Cloudflare        `yaml:"cloudflare"`
+}
+
+// Cloudflare holds the DNS and Origin CA settings core needs
+type Cloudflare struct {
+	APIToken    string `yaml:"api_token"`
+	ZoneID      string `yaml:"zone_id"`
+	OriginCAKey string `yaml:"origin_ca_key"`
+	RootDomain  string `yaml:"root_domain"`
+}
+
+// setting is one profile value, where it comes from and who needs it
+type setting struct {
+	key     string
+	env     []string
+	field   func(p *Profile) *string
+	modules []string
+}
+
+var settings = []setting{
+	// the same variables terratest's gcp.GetGoogleProjectIDFromEnvVar reads
+	{"project", []string{"GOOGLE_PROJECT", "GOOGLE_CLOUD_PROJECT", "GOOGLE_CLOUD_PROJECT_ID", "GCLOUD_PROJECT", "CLOUDSDK_CORE_PROJECT"},
+		func(p *Profile) *string { return &p.Project }, Modules},
+	{"demo_project", []string{"CLOUDEDGE_DEMO_PROJECT"}, func(p *Profile) *string { return &p.DemoProject }, nil},
+	{"region", []string{"CLOUDEDGE_REGION", "GOOGLE_REGION"}, func(p *Profile) *string { return &p.Region }, []string{"demo-web-app", "core"}},
+	{"project_suffix", []string{"CLOUDEDGE_PROJECT_SUFFIX"}, func(p *Profile) *string { return &p.ProjectSuffix }, Modules},
+	{"name_prefix", []string{"CLOUDEDGE_NAME_PREFIX"}, func(p *Profile) *string { return &p.NamePrefix }, nil},
+	{"github_repository", []string{"CLOUDEDGE_GITHUB_REPOSITORY"}, func(p *Profile) *string { return &p.GitHubRepository }, Modules},
+	{"billing_account_name", []string{"CLOUDEDGE_BILLING_ACCOUNT_NAME"}, func(p *Profile) *string { return &p.BillingAccountName }, []string{"project-singleton", "core"}},
+	{"cloudflare.api_token", []string{"CLOUDFLARE_API_TOKEN"}, func(p *Profile) *string { return &p.Cloudflare.APIToken }, []string{"project-singleton", "core"}},
+	{"cloudflare.zone_id", []string{"CLOUDFLARE_ZONE_ID"}, func(p *Profile) *string { return &p.Cloudflare.ZoneID }, []string{"core"}},
+	// CLOUDFLARE_ORIGIN_CA_KEY as for record-plans, then the name the
+	// Cloudflare provider itself reads
+	{"cloudflare.origin_ca_key", []string{"CLOUDFLARE_ORIGIN_CA_KEY", "CLOUDFLARE_API_USER_SERVICE_KEY"}, func(p *Profile) *string { return &p.Cloudflare.OriginCAKey }, nil},
+	{"cloudflare.root_domain", []string{"CLOUDEDGE_ROOT_DOMAIN"}, func(p *Profile) *string { return &p.Cloudflare.RootDomain }, nil},
+}
+
+// Load reads the profile file at path, or none when path is empty, then
+// applies environment variables and defaults. It does not validate.
+func Load(path string) (*Profile, error) {
+	p := &Profile{}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading test profile: %w", err)
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(p); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("parsing test profile %s: %w", path, err)
+		}
+	}
+
+	for _, s := range settings {
+		for _, name := range s.env {
+			if value := os.Getenv(name); value != "" {
+				*s.field(p) = value
+				break
+			}
+		}
+	}
+	if value := os.Getenv("CLOUDEDGE_BUDGET_AMOUNT"); value != "" {
+		amount, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("CLOUDEDGE_BUDGET_AMOUNT: %w", err)
+		}
+		p.BudgetAmount = amount
+	}
+
+	if p.DemoProject == "" {
+		p.DemoProject = p.Project
+	}
+	if p.ProjectSuffix == "" {
+		p.ProjectSuffix = "nonprod"
+	}
+	if p.GitHubRepository == "" {
+		p.GitHubRepository = "vibetics-cloudedge"
+	}
+	return p, nil
+}
+
+// FromEnv loads the profile named by CLOUDEDGE_TEST_PROFILE
+func FromEnv() (*Profile, error) {
+	return Load(os.Getenv(ProfileEnv))
+}
+
+// maxUniqueBase is the longest name_prefix Unique keeps whole: the 16
+// characters resource_name_prefix allows, less "-" and a six-character ID
+const maxUniqueBase = 16 - 1 - 6
+
+// Unique returns a copy of the profile whose name prefix ends in a random ID,
+// so tests running in parallel in one project deploy separate resources. The
+// profile's own name_prefix, e.g. a CI run number, comes first, cut to
+// maxUniqueBase characters so the result still fits.
+func (p *Profile) Unique() *Profile {
+	c := *p
+	c.ResourceTags = map[string]string{}
+	for k, v := range p.ResourceTags {
+		c.ResourceTags[k] = v
+	}
+	id := strings.ToLower(random.UniqueId())
+	base := c.NamePrefix
+	if len(base) > maxUniqueBase {
+		base = strings.TrimRight(base[:maxUniqueBase], "-")
+	}
+	if base == "" {
+		c.NamePrefix = "t" + id
+	} else {
+		c.NamePrefix = base + "-" + id
+	}
+	return &c
+}
+
+// Validate reports every setting the modules need that the profile lacks, in
+// one error. No modules means all of them.
+func (p *Profile) Validate(modules ...string) error {
+	if len(modules) == 0 {
+		modules = Modules
+	}
+	for _, module := range modules {
+		if !contains(Modules, module) {
+			return fmt.Errorf("unknown module %q (want one of %s)", module, strings.Join(Modules, ", "))
+		}
+	}
+	if p.NamePrefix != "" && !namePrefixPattern.MatchString(p.NamePrefix) {
+		return fmt.Errorf("test profile name_prefix %q must be at most 16 lowercase letters, digits or hyphens, start with a letter and not end with a hyphen", p.NamePrefix)
+	}
+	var missing []string
+	for _, s := range settings {
+		if *s.field(p) != "" || !needed(s.modules, modules) {
+			continue
+		}
+		missing = append(missing, fmt.Sprintf("  - %s (profile key %s, or %s)", s.key, s.key, strings.Join(s.env, ", ")))
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("test profile is missing %d setting(s) needed by %s:\n%s",
+			len(missing), strings.Join(modules, ", "), strings.Join(missing, "\n"))
+	}
+	return nil
+}
+
+// Require loads the profile from the environment and validates it for the
+// modules, failing the test with every missing setting
+func Require(t testing.TestingT, modules ...string) *Profile {
+	p, err := FromEnv()
+	if err == nil {
+		err = p.Validate(modules...)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// Vars returns the module's input variables from the profile
+func (p *Profile) Vars(module string) map[string]interface{} {
+	vars := map[string]interface{}{
+		"project_suffix":              p.ProjectSuffix,
+		"cloudedge_github_repository": p.GitHubRepository,
+	}
+	if p.Region != "" {
+		vars["region"] = p.Region
+	}
+	if len(p.ResourceTags) > 0 {
+		tags := map[string]interface{}{}
+		for k, v := range p.ResourceTags {
+			tags[k] = v
+		}
+		vars["resource_tags"] = tags
+	}
+
+	if p.NamePrefix != "" && module != "project-singleton" {
+		vars["resource_name_prefix"] = p.NamePrefix
+	}
+
+	switch module {
+	case "core":
+		vars["cloudedge_project_id"] = p.Project
+		vars["demo_web_app_project_id"] = p.DemoProject
+		vars["billing_account_name"] = p.BillingAccountName
+		vars["cloudflare_api_token"] = p.Cloudflare.APIToken
+		vars["cloudflare_zone_id"] = p.Cloudflare.ZoneID
+		vars["enable_demo_web_app"] = false
+		if p.Cloudflare.OriginCAKey != "" {
+			vars["cloudflare_origin_ca_key"] = p.Cloudflare.OriginCAKey
+		}
+		if p.Cloudflare.RootDomain != "" {
+			vars["root_domain"] = p.Cloudflare.RootDomain
+		}
+	case "demo-web-app":
+		vars["cloudedge_project_id"] = p.Project
+		vars["demo_web_app_project_id"] = p.DemoProject
+		vars["enable_demo_web_app"] = true
+	case "project-singleton":
+		vars["project_id"] = p.Project
+		vars["billing_account_name"] = p.BillingAccountName
+		vars["cloudflare_api_token"] = p.Cloudflare.APIToken
+		if p.BudgetAmount > 0 {
+			vars["budget_amount"] = p.BudgetAmount
+		}
+		if p.Cloudflare.RootDomain != "" {
+			vars["root_domain"] = p.Cloudflare.RootDomain
+		}
+	}
+	return vars
+}
+
+// Options returns terraform.Options for the module with the profile's
+// variables and the overrides applied on top. Core defaults to
+// enable_demo_web_app=false, which is what most tests deploy.
+func (p *Profile) Options(module string, overrides map[string]interface{}) (*terraform.Options, error) {
+	if err := p.Validate(module); err != nil {
+		return nil, err
+	}
+	vars := p.Vars(module)
+	for k, v := range overrides {
+		vars[k] = v
+	}
+	return &terraform.Options{TerraformDir: planfixture.ModuleDir(module), Vars: vars}, nil
+}
+
+// MustOptions is Options for a test of its own: the module is copied to a
+// temp directory, so parallel tests never share a .terraform directory, and
+// the state goes to the profile's Backend, so a Unique profile never shares
+// a state object. It fails the test on an invalid profile.
+func (p *Profile) MustOptions(t testing.TestingT, module string, overrides map[string]interface{}) *terraform.Options {
+	options, err := p.Options(module, overrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.BackendConfig, err = p.Backend(module); err != nil {
+		t.Fatal(err)
+	}
+	options.TerraformDir = test_structure.CopyTerraformFolderToTemp(t, filepath.Dir(options.TerraformDir), filepath.Base(options.TerraformDir))
+	return options
+}
+
+// needed reports whether any of the requested modules is in need
+func needed(need, requested []string) bool {
+	for _, m := range requested {
+		if contains(need, m) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package testconfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vibetics-cloudedge/tests/planfixture"
+)
+
+// clearEnv hides the caller's environment so only the test's values apply;
+// t.Setenv rules out t.Parallel for these tests
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, s := range settings {
+		for _, name := range s.env {
+			t.Setenv(name, "")
+		}
+	}
+	t.Setenv("CLOUDEDGE_BUDGET_AMOUNT", "")
+	t.Setenv(ProfileEnv, "")
+}
+
+func TestLoadExample(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("CLOUDFLARE_API_TOKEN", "token-from-env")
+	t.Setenv("CLOUDEDGE_REGION", "us-east1")
+	t.Setenv("CLOUDFLARE_API_USER_SERVICE_KEY", "provider-key")
+	t.Setenv("CLOUDFLARE_ORIGIN_CA_KEY", "origin-ca-key")
+
+	p, err := Load("profile.example.yaml")
+	require.NoError(t, err)
+	require.NoError(t, p.Validate())
+	assert.Equal(t, "us-east1", p.Region, "environment overrides the file")
+	assert.Equal(t, "token-from-env", p.Cloudflare.APIToken)
+	assert.Equal(t, "origin-ca-key", p.Cloudflare.OriginCAKey, "the documented name wins over the provider's")
+	assert.Equal(t, "my-demo-project", p.DemoProject)
+
+	options, err := p.Options("core", map[string]interface{}{"enable_waf": true})
+	require.NoError(t, err)
+	assert.Equal(t, planfixture.ModuleDir("core"), options.TerraformDir)
+	assert.Equal(t, "my-cloudedge-project", options.Vars["cloudedge_project_id"])
+	assert.Equal(t, "us-east1", options.Vars["region"])
+	assert.Equal(t, "Test Billing Account", options.Vars["billing_account_name"])
+	assert.Equal(t, false, options.Vars["enable_demo_web_app"])
+	assert.Equal(t, true, options.Vars["enable_waf"])
+	assert.Equal(t, "vibetics.com", options.Vars["root_domain"])
+
+	// a test's own options: a copy of the module and a state of its own
+	unique := p.Unique()
+	mustOptions := unique.MustOptions(t, "core", nil)
+	t.Cleanup(func() { os.RemoveAll(filepath.Dir(mustOptions.TerraformDir)) })
+	assert.NotEqual(t, planfixture.ModuleDir("core"), mustOptions.TerraformDir)
+	assert.FileExists(t, filepath.Join(mustOptions.TerraformDir, "core.tf"))
+	assert.Equal(t, map[string]interface{}{
+		"bucket": "my-cloudedge-project-tfstate",
+		"prefix": "my-cloudedge-project-" + unique.NamePrefix + "-core",
+	}, mustOptions.BackendConfig)
+	demoBackend, err := unique.Backend("demo-web-app")
+	require.NoError(t, err)
+	assert.Equal(t, "my-demo-project-tfstate", demoBackend["bucket"])
+	assert.Contains(t, demoBackend["prefix"], unique.NamePrefix)
+	_, err = unique.Backend("web")
+	assert.ErrorContains(t, err, `unknown module "web"`)
+
+	singleton := p.Vars("project-singleton")
+	assert.Equal(t, "my-cloudedge-project", singleton["project_id"])
+	assert.Equal(t, float64(100), singleton["budget_amount"])
+	assert.NotContains(t, singleton, "cloudflare_zone_id")
+
+	demo := p.Vars("demo-web-app")
+	assert.Equal(t, "my-demo-project", demo["demo_web_app_project_id"])
+	assert.Equal(t, map[string]interface{}{"project-suffix": "nonprod", "managed-by": "opentofu"}, demo["resource_tags"])
+}
+
+func TestValidateListsEveryMissingSetting(t *testing.T) {
+	clearEnv(t)
+	p, err := Load(filepath.Join("testdata", "partial.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, "nonprod", p.ProjectSuffix)
+	assert.Equal(t, "test-project", p.DemoProject)
+
+	// demo-web-app needs nothing the file lacks
+	require.NoError(t, p.Validate("demo-web-app"))
+
+	err = p.Validate("core")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "missing 2 setting(s) needed by core")
+	assert.Contains(t, err.Error(), "billing_account_name (profile key billing_account_name, or CLOUDEDGE_BILLING_ACCOUNT_NAME)")
+	assert.Contains(t, err.Error(), "cloudflare.api_token")
+	assert.NotContains(t, err.Error(), "zone_id")
+
+	_, err = p.Options("project-singleton", nil)
+	assert.ErrorContains(t, err, "missing 2 setting(s)")
+
+	assert.ErrorContains(t, p.Validate("edge"), `unknown module "edge"`)
+
+	_, err = Load(filepath.Join("testdata", "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestNamesFollowPrefix(t *testing.T) {
+	t.Parallel()
+	p := &Profile{Project: "test-project", Region: "us-central1", ProjectSuffix: "nonprod", GitHubRepository: "vibetics-cloudedge"}
+
+	names, err := p.Names()
+	require.NoError(t, err)
+	assert.Equal(t, "ingress-vpc", names.IngressVPC)
+	assert.Equal(t, "nonprod-allow-https", names.HTTPSFirewall)
+	assert.Equal(t, "cloudflare-origin-cert-demo-web-app", names.OriginCert)
+	assert.Equal(t, "demo-web-app", names.Subdomain)
+	assert.Equal(t, "demo-web-app-psc-attachment", names.DemoPSCAttachment)
+	assert.NotContains(t, p.Vars("core"), "resource_name_prefix")
+
+	unique := p.Unique()
+	assert.Empty(t, p.NamePrefix, "the original profile is unchanged")
+	assert.Regexp(t, `^t[a-z0-9]{6}$`, unique.NamePrefix)
+	require.NoError(t, unique.Validate("demo-web-app"))
+	assert.NotEqual(t, unique.NamePrefix, p.Unique().NamePrefix)
+
+	p.NamePrefix = "run42"
+	names, err = p.Names()
+	require.NoError(t, err)
+	assert.Equal(t, "run42-ingress-vpc", names.IngressVPC)
+	assert.Equal(t, "run42-nonprod-allow-https", names.HTTPSFirewall)
+	assert.Equal(t, "run42-edge-waf-policy", names.WAFPolicy)
+	assert.Equal(t, "run42-external-https-lb", names.ExternalLB)
+	assert.Equal(t, "run42-demo-web-app-psc-neg", names.PSCNEG)
+	assert.Equal(t, "run42-demo-web-app", names.Subdomain)
+	assert.Equal(t, "run42-demo-web-app-web-vpc", names.DemoVPC)
+	assert.Equal(t, "run42-demo-web-app-psc-attachment", names.DemoPSCAttachment)
+	assert.Equal(t, "run42", p.Vars("demo-web-app")["resource_name_prefix"])
+	assert.NotContains(t, p.Vars("project-singleton"), "resource_name_prefix")
+	assert.Regexp(t, `^run42-[a-z0-9]{6}$`, p.Unique().NamePrefix)
+
+	// a long base is cut so the unique prefix still validates
+	p.NamePrefix = "nightly-build-7"
+	unique = p.Unique()
+	assert.Regexp(t, `^nightly-b-[a-z0-9]{6}$`, unique.NamePrefix)
+	require.NoError(t, unique.Validate("demo-web-app"))
+	p.NamePrefix = "nightly--x"
+	assert.Regexp(t, `^nightly-[a-z0-9]{6}$`, p.Unique().NamePrefix)
+
+	p.NamePrefix = "Run-42-"
+	assert.ErrorContains(t, p.Validate("demo-web-app"), "name_prefix")
+}
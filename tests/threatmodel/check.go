@@ -0,0 +1,267 @@
+package threatmodel
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"gopkg.in/yaml.v3"
+
+	"vibetics-cloudedge/tests/compliance"
+	"vibetics-cloudedge/tests/policy"
+)
+
+// MappingVersion is the mapping file format this package understands
+const MappingVersion = 1
+
+// Mapping ties a model to the OpenTofu resources. Patterns match a resource's
+// type.name, without module path or index, with path.Match wildcards:
+// google_compute_forwarding_rule.external_https_lb, tls_*.*
+type Mapping struct {
+	Version int `yaml:"version"`
+	// Assets maps a technical asset ID to the resources that implement it
+	Assets map[string][]string `yaml:"assets"`
+	// Supporting maps patterns of resources the model deliberately leaves
+	// out to the reason
+	Supporting map[string]string `yaml:"supporting"`
+	Claims     []Claim           `yaml:"claims"`
+}
+
+// Claim restates a sentence of the model as a CEL assertion over planned
+// resources. Quote must appear in the model verbatim, so the claim cannot
+// outlive the text it checks. When, Assert and Message work as in a policy
+// of the policy package.
+type Claim struct {
+	ID            string   `yaml:"id"`
+	Asset         string   `yaml:"asset"`
+	Quote         string   `yaml:"quote"`
+	ResourceTypes []string `yaml:"resource_types"`
+	When          string   `yaml:"when"`
+	Assert        string   `yaml:"assert"`
+	Message       string   `yaml:"message"`
+}
+
+// DefaultMappingPath is the mapping of the repository's threat model
+func DefaultMappingPath() string {
+	return repoPath("threat_modelling", "plan-mapping.yaml")
+}
+
+// LoadMapping reads a mapping file
+func LoadMapping(path string) (*Mapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m Mapping
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if m.Version != MappingVersion {
+		return nil, fmt.Errorf("%s: mapping version %d is not supported (want %d)", path, m.Version, MappingVersion)
+	}
+	return &m, nil
+}
+
+// Kind classifies an issue
+type Kind string
+
+const (
+	// Inconsistent is a model or mapping that contradicts itself
+	Inconsistent Kind = "inconsistent"
+	// UnmatchedAsset is an in-scope asset no planned resource implements
+	UnmatchedAsset Kind = "unmatched-asset"
+	// UnmodelledResource is a planned resource no asset or supporting entry
+	// covers
+	UnmodelledResource Kind = "unmodelled-resource"
+	// ContradictedClaim is a claim of the model a planned value contradicts
+	ContradictedClaim Kind = "contradicted-claim"
+)
+
+var kindOrder = map[Kind]int{Inconsistent: 0, UnmatchedAsset: 1, UnmodelledResource: 2, ContradictedClaim: 3}
+
+// Issue is one disagreement between the model and the plans
+type Issue struct {
+	Kind    Kind   `json:"kind"`
+	Subject string `json:"subject"`
+	Detail  string `json:"detail"`
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s %s: %s", i.Kind, i.Subject, i.Detail)
+}
+
+// Report lists the issues of a check, sorted by kind, subject and detail
+type Report struct {
+	Issues []Issue `json:"issues"`
+}
+
+// Check compares the model with the plans. The plans are taken together, so
+// an optional asset only needs a resource in one of them; the deployment
+// variants of a module should all be passed.
+func Check(model *Model, mapping *Mapping, plans []*tfjson.Plan) (*Report, error) {
+	report := &Report{Issues: []Issue{}}
+	seen := map[Issue]bool{}
+	add := func(kind Kind, subject, format string, args ...interface{}) {
+		issue := Issue{kind, subject, fmt.Sprintf(format, args...)}
+		if !seen[issue] {
+			seen[issue] = true
+			report.Issues = append(report.Issues, issue)
+		}
+	}
+
+	for _, problem := range model.Integrity() {
+		add(Inconsistent, "model", "%s", problem)
+	}
+	for id := range mapping.Assets {
+		if _, ok := model.Asset(id); !ok {
+			add(Inconsistent, "mapping", "asset %s is not in the model", id)
+		}
+	}
+
+	// every scenario's instance counts, since values differ between them;
+	// add drops the repeated issues of shared addresses
+	mapped := map[string][]compliance.Resource{}
+	for _, plan := range plans {
+		for _, r := range compliance.FromPlan(plan) {
+			covered := false
+			for id, patterns := range mapping.Assets {
+				if matchAny(patterns, r) {
+					mapped[id] = append(mapped[id], r)
+					covered = true
+				}
+			}
+			for pattern := range mapping.Supporting {
+				if matchAny([]string{pattern}, r) {
+					covered = true
+				}
+			}
+			if !covered {
+				add(UnmodelledResource, r.Address, "no technical asset or supporting entry covers %s.%s", r.Type, r.Name)
+			}
+		}
+	}
+
+	for _, id := range model.AssetIDs() {
+		asset, _ := model.Asset(id)
+		patterns, ok := mapping.Assets[id]
+		switch {
+		case asset.OutOfScope:
+			continue
+		case !ok:
+			add(UnmatchedAsset, id, "no resources are mapped to it")
+			continue
+		case len(mapped[id]) == 0:
+			add(UnmatchedAsset, id, "no planned resource matches %s", strings.Join(patterns, ", "))
+			continue
+		}
+		checkExposure(asset, mapped[id], add)
+	}
+
+	if err := checkClaims(model, mapping.Claims, plans, add); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(report.Issues, func(i, j int) bool {
+		a, b := report.Issues[i], report.Issues[j]
+		if a.Kind != b.Kind {
+			return kindOrder[a.Kind] < kindOrder[b.Kind]
+		}
+		if a.Subject != b.Subject {
+			return a.Subject < b.Subject
+		}
+		return a.Detail < b.Detail
+	})
+	return report, nil
+}
+
+func matchAny(patterns []string, r compliance.Resource) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, r.Type+"."+r.Name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkExposure holds the asset's internet flag against the entry points
+// mapped to it: Cloud Run ingress and forwarding rule schemes
+func checkExposure(asset TechnicalAsset, resources []compliance.Resource, add func(Kind, string, string, ...interface{})) {
+	known, anyExposed := false, false
+	for _, r := range resources {
+		exposed, how, ok := exposure(r)
+		if !ok {
+			continue
+		}
+		known = true
+		if exposed {
+			anyExposed = true
+			if !asset.Internet {
+				add(ContradictedClaim, r.Address, "%s is not reachable from the internet (internet: false), but %s", asset.ID, how)
+			}
+		}
+	}
+	if known && asset.Internet && !anyExposed {
+		add(ContradictedClaim, asset.ID, "reachable from the internet (internet: true), but every planned entry point is internal")
+	}
+}
+
+// exposure says whether r accepts traffic from the internet, and ok when r is
+// an entry point whose exposure the plan knows
+func exposure(r compliance.Resource) (exposed bool, how string, ok bool) {
+	switch r.Type {
+	case "google_cloud_run_v2_service":
+		ingress := r.String("ingress")
+		if ingress == "" {
+			return false, "", false
+		}
+		return ingress == "INGRESS_TRAFFIC_ALL", "ingress is " + ingress, true
+	case "google_compute_forwarding_rule", "google_compute_global_forwarding_rule":
+		scheme := r.String("load_balancing_scheme")
+		if scheme == "" {
+			return false, "", false
+		}
+		return strings.HasPrefix(scheme, "EXTERNAL"), "load_balancing_scheme is " + scheme, true
+	}
+	return false, "", false
+}
+
+// checkClaims evaluates the claims against every plan
+func checkClaims(model *Model, claims []Claim, plans []*tfjson.Plan, add func(Kind, string, string, ...interface{})) error {
+	policies := make([]policy.Policy, 0, len(claims))
+	byID := map[string]Claim{}
+	for _, c := range claims {
+		if _, ok := model.Asset(c.Asset); !ok {
+			add(Inconsistent, "mapping", "claim %s is about asset %s, which is not in the model", c.ID, c.Asset)
+		}
+		if !model.Says(c.Quote) {
+			add(Inconsistent, "mapping", "claim %s quotes %q, which the model no longer says", c.ID, c.Quote)
+		}
+		byID[c.ID] = c
+		policies = append(policies, policy.Policy{
+			ID:            c.ID,
+			Title:         c.Quote,
+			ResourceTypes: c.ResourceTypes,
+			When:          c.When,
+			Assert:        c.Assert,
+			Message:       c.Message,
+		})
+	}
+	engine, err := policy.Compile(policies)
+	if err != nil {
+		return fmt.Errorf("claims: %w", err)
+	}
+	for _, plan := range plans {
+		for _, result := range engine.Evaluate(plan).Failed() {
+			c := byID[result.Control]
+			for _, f := range result.Evidence {
+				if f.Status == compliance.Fail {
+					add(ContradictedClaim, f.Address, "%s says %q (%s), but %s", c.Asset, c.Quote, c.ID, f.Detail)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+// Package threatmodel checks the Threagile model in threat_modelling/ against
+// the plans of the modules it describes. A mapping file ties each technical
+// asset to the resources that implement it and restates the model's claims
+// as CEL assertions. The check reports assets with no resource behind them,
+// resources no asset covers, and claims the planned attribute values
+// contradict.
+package threatmodel
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Model is the part of a Threagile model the checker reads
+type Model struct {
+	Title           string                    `yaml:"title"`
+	DataAssets      map[string]DataAsset      `yaml:"data_assets"`
+	TechnicalAssets map[string]TechnicalAsset `yaml:"technical_assets"`
+	TrustBoundaries map[string]TrustBoundary  `yaml:"trust_boundaries"`
+
+	// text is every string in the model with whitespace collapsed, for
+	// finding the sentences claims quote
+	text []string
+}
+
+// DataAsset is data the system processes or stores
+type DataAsset struct {
+	ID              string `yaml:"id"`
+	Description     string `yaml:"description"`
+	Usage           string `yaml:"usage"`
+	Confidentiality string `yaml:"confidentiality"`
+	Integrity       string `yaml:"integrity"`
+	Availability    string `yaml:"availability"`
+}
+
+// TechnicalAsset is a component of the architecture
+type TechnicalAsset struct {
+	ID          string   `yaml:"id"`
+	Description string   `yaml:"description"`
+	Type        string   `yaml:"type"`
+	Technology  string   `yaml:"technology"`
+	Tags        []string `yaml:"tags"`
+	// Internet says the asset is reachable from the internet
+	Internet            bool                         `yaml:"internet"`
+	OutOfScope          bool                         `yaml:"out_of_scope"`
+	Encryption          string                       `yaml:"encryption"`
+	DataAssetsProcessed []string                     `yaml:"data_assets_processed"`
+	DataAssetsStored    []string                     `yaml:"data_assets_stored"`
+	CommunicationLinks  map[string]CommunicationLink `yaml:"communication_links"`
+}
+
+// CommunicationLink is traffic from one technical asset to another
+type CommunicationLink struct {
+	Target             string   `yaml:"target"`
+	Description        string   `yaml:"description"`
+	Protocol           string   `yaml:"protocol"`
+	Authentication     string   `yaml:"authentication"`
+	Authorization      string   `yaml:"authorization"`
+	IPFiltered         bool     `yaml:"ip_filtered"`
+	DataAssetsSent     []string `yaml:"data_assets_sent"`
+	DataAssetsReceived []string `yaml:"data_assets_received"`
+}
+
+// TrustBoundary groups technical assets
+type TrustBoundary struct {
+	ID                     string   `yaml:"id"`
+	TechnicalAssetsInside  []string `yaml:"technical_assets_inside"`
+	TechnicalAssetsOutside []string `yaml:"technical_assets_outside"`
+}
+
+// repoPath resolves a path relative to the repository root
+func repoPath(elem ...string) string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(append([]string{filepath.Dir(file), "..", ".."}, elem...)...)
+}
+
+// DefaultModelPath is the repository's threat model
+func DefaultModelPath() string {
+	return repoPath("threat_modelling", "threat-model.yaml")
+}
+
+// LoadModel reads a Threagile model
+func LoadModel(path string) (*Model, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m Model
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	m.text = scalars(&root, nil)
+	return &m, nil
+}
+
+// scalars collects the string values under node, whitespace collapsed
+func scalars(node *yaml.Node, out []string) []string {
+	if node.Kind == yaml.ScalarNode {
+		return append(out, collapse(node.Value))
+	}
+	for _, child := range node.Content {
+		out = scalars(child, out)
+	}
+	return out
+}
+
+func collapse(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// Says reports whether the model contains the sentence, ignoring line breaks
+// and indentation
+func (m *Model) Says(sentence string) bool {
+	sentence = collapse(sentence)
+	for _, text := range m.text {
+		if strings.Contains(text, sentence) {
+			return true
+		}
+	}
+	return false
+}
+
+// Asset returns the technical asset with the given ID
+func (m *Model) Asset(id string) (TechnicalAsset, bool) {
+	for _, asset := range m.TechnicalAssets {
+		if asset.ID == id {
+			return asset, true
+		}
+	}
+	return TechnicalAsset{}, false
+}
+
+// AssetIDs returns the IDs of the technical assets, sorted
+func (m *Model) AssetIDs() []string {
+	ids := make([]string, 0, len(m.TechnicalAssets))
+	for _, asset := range m.TechnicalAssets {
+		ids = append(ids, asset.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Integrity returns one message per reference the model cannot resolve: a
+// link to an unknown asset, an unknown data asset, or a trust boundary
+// listing an unknown asset
+func (m *Model) Integrity() []string {
+	assets := map[string]bool{}
+	for _, asset := range m.TechnicalAssets {
+		assets[asset.ID] = true
+	}
+	data := map[string]bool{}
+	for _, d := range m.DataAssets {
+		data[d.ID] = true
+	}
+
+	var problems []string
+	checkData := func(where string, ids []string) {
+		for _, id := range ids {
+			if !data[id] {
+				problems = append(problems, fmt.Sprintf("%s: unknown data asset %s", where, id))
+			}
+		}
+	}
+	for _, asset := range m.TechnicalAssets {
+		checkData(asset.ID, asset.DataAssetsProcessed)
+		checkData(asset.ID, asset.DataAssetsStored)
+		for name, link := range asset.CommunicationLinks {
+			where := asset.ID + ">" + name
+			if !assets[link.Target] {
+				problems = append(problems, fmt.Sprintf("%s: unknown target %s", where, link.Target))
+			}
+			checkData(where, link.DataAssetsSent)
+			checkData(where, link.DataAssetsReceived)
+		}
+	}
+	for _, boundary := range m.TrustBoundaries {
+		for _, ids := range [][]string{boundary.TechnicalAssetsInside, boundary.TechnicalAssetsOutside} {
+			for _, id := range ids {
+				if !assets[id] {
+					problems = append(problems, fmt.Sprintf("trust boundary %s: unknown technical asset %s", boundary.ID, id))
+				}
+			}
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
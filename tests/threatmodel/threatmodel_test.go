@@ -0,0 +1,107 @@
+package threatmodel
+
+import (
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vibetics-cloudedge/tests/planfixture"
+)
+
+func load(t *testing.T) (*Model, *Mapping) {
+	t.Helper()
+	model, err := LoadModel(DefaultModelPath())
+	require.NoError(t, err)
+	mapping, err := LoadMapping(DefaultMappingPath())
+	require.NoError(t, err)
+	return model, mapping
+}
+
+func plans(t *testing.T, scenarios ...string) []*tfjson.Plan {
+	t.Helper()
+	var out []*tfjson.Plan
+	for _, scenario := range scenarios {
+		plan, err := planfixture.Load(scenario)
+		require.NoError(t, err)
+		out = append(out, &plan.RawPlan)
+	}
+	return out
+}
+
+// after returns the planned values of the resource at address
+func after(t *testing.T, plan *tfjson.Plan, address string) map[string]interface{} {
+	t.Helper()
+	for _, rc := range plan.ResourceChanges {
+		if rc.Address == address {
+			return rc.Change.After.(map[string]interface{})
+		}
+	}
+	require.FailNow(t, "no planned change", address)
+	return nil
+}
+
+func TestLoadModel(t *testing.T) {
+	t.Parallel()
+	model, _ := load(t)
+	assert.Equal(t, []string{"cloud-armor-waf", "cloud-run-backend", "cloudflare-proxy", "external-clients", "regional-https-lb"}, model.AssetIDs())
+	lb, ok := model.Asset("regional-https-lb")
+	require.True(t, ok)
+	assert.True(t, lb.Internet)
+	assert.Equal(t, "cloud-run-backend", lb.CommunicationLinks["lb-to-cloud-run"].Target)
+	assert.Len(t, model.DataAssets, 4)
+	assert.Empty(t, model.Integrity())
+	assert.True(t, model.Says("Cloud Run ingress is restricted to\n   INTERNAL_LOAD_BALANCER only"), "line breaks are ignored")
+}
+
+func TestCheckAgreesWithRecordedPlans(t *testing.T) {
+	t.Parallel()
+	model, mapping := load(t)
+	var names []string
+	for _, scenario := range planfixture.Scenarios() {
+		names = append(names, scenario.Name)
+	}
+	report, err := Check(model, mapping, plans(t, names...))
+	require.NoError(t, err)
+	assert.Empty(t, report.Issues)
+}
+
+func TestCheckReportsDisagreements(t *testing.T) {
+	t.Parallel()
+	model, mapping := load(t)
+
+	// the model drifts: a link to a renamed asset, a claim quoting text that
+	// was reworded, and an API resource nobody listed
+	client := model.TechnicalAssets["External Clients"]
+	link := client.CommunicationLinks["client-to-lb"]
+	link.Target = "global-https-lb"
+	client.CommunicationLinks["client-to-lb"] = link
+	mapping.Claims[4].Quote = "TLS 1.3 everywhere"
+	delete(mapping.Supporting, "google_project_service.*")
+
+	// the code drifts: Cloud Run opened to the internet and to allUsers
+	scenarios := plans(t, "core_default", "demo_web_app_default")
+	after(t, scenarios[1], "google_cloud_run_v2_service.web_app[0]")["ingress"] = "INGRESS_TRAFFIC_ALL"
+	after(t, scenarios[1], "google_cloud_run_v2_service_iam_member.invoker[0]")["member"] = "allUsers"
+
+	report, err := Check(model, mapping, scenarios)
+	require.NoError(t, err)
+	assert.Equal(t, []Issue{
+		{Inconsistent, "mapping", `claim TM-005 quotes "TLS 1.3 everywhere", which the model no longer says`},
+		{Inconsistent, "model", "external-clients>client-to-lb: unknown target global-https-lb"},
+		{UnmatchedAsset, "cloud-armor-waf", "no planned resource matches google_compute_region_security_policy.*"},
+		{UnmodelledResource, "google_project_service.run", "no technical asset or supporting entry covers google_project_service.run"},
+		{ContradictedClaim, "google_cloud_run_v2_service.web_app[0]", "cloud-run-backend is not reachable from the internet (internet: false), but ingress is INGRESS_TRAFFIC_ALL"},
+		{ContradictedClaim, "google_cloud_run_v2_service.web_app[0]", `cloud-run-backend says "Cloud Run ingress is restricted to INTERNAL_LOAD_BALANCER only" (TM-001), but ingress is INGRESS_TRAFFIC_ALL`},
+		{ContradictedClaim, "google_cloud_run_v2_service_iam_member.invoker[0]", `cloud-run-backend says "grants roles/run.invoker only to the Compute Engine service agent" (TM-003), but allUsers holds roles/run.invoker`},
+	}, report.Issues)
+}
+
+func TestCheckRejectsBrokenClaims(t *testing.T) {
+	t.Parallel()
+	model, mapping := load(t)
+	mapping.Claims = append(mapping.Claims, Claim{ID: "TM-999", Asset: "cloud-run-backend", Quote: "gVisor sandboxing", Assert: "resource.values."})
+	_, err := Check(model, mapping, nil)
+	assert.ErrorContains(t, err, "TM-999 assert")
+}
@@ -0,0 +1,490 @@
+package trafficpath
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"vibetics-cloudedge/tests/modcontract"
+	"vibetics-cloudedge/tests/planquery"
+)
+
+// edge is an attribute that routes traffic onward and the resource types it
+// may point at. Nested attributes are written block.attribute.
+type edge struct {
+	attribute string
+	targets   []string
+}
+
+var (
+	forwardingRules  = []string{"google_compute_forwarding_rule", "google_compute_global_forwarding_rule"}
+	targetProxies    = []string{"google_compute_region_target_https_proxy", "google_compute_target_https_proxy", "google_compute_region_target_http_proxy", "google_compute_target_http_proxy"}
+	urlMaps          = []string{"google_compute_region_url_map", "google_compute_url_map"}
+	backendServices  = []string{"google_compute_region_backend_service", "google_compute_backend_service"}
+	endpointGroups   = []string{"google_compute_region_network_endpoint_group"}
+	attachments      = []string{"google_compute_service_attachment"}
+	cloudRunServices = []string{"google_cloud_run_v2_service"}
+)
+
+// edges are followed in this order; each resource has at most one of them
+var edges = []edge{
+	{"target", targetProxies},
+	{"url_map", urlMaps},
+	{"default_service", backendServices},
+	{"backend.group", endpointGroups},
+	{"psc_target_service", attachments},
+	{"target_service", forwardingRules},
+	{"cloud_run.service", cloudRunServices},
+}
+
+// collections maps the resource collection of a self link to resource types
+var collections = map[string][]string{
+	"forwardingRules":       forwardingRules,
+	"targetHttpsProxies":    targetProxies,
+	"targetHttpProxies":     targetProxies,
+	"urlMaps":               urlMaps,
+	"backendServices":       backendServices,
+	"networkEndpointGroups": endpointGroups,
+	"serviceAttachments":    attachments,
+}
+
+var selfLinkPattern = regexp.MustCompile(`(?:^|/)projects/([^/]+)/(?:regions/([^/]+)|global)/([A-Za-z]+)/([^/]+)$`)
+
+// Graph links the planned load balancing resources of several modules
+type Graph struct {
+	plans     map[string]*planquery.Plan
+	modules   []string
+	producers modcontract.StateProducers
+	next      map[string]link
+}
+
+type link struct {
+	to  Node
+	via string
+}
+
+// Build resolves every routing attribute of every planned resource in plans,
+// keyed by module directory name. A reference through terraform_remote_state is
+// followed into the producing module's plan, which must be among plans.
+func Build(plans map[string]*planquery.Plan, producers modcontract.StateProducers) (*Graph, error) {
+	g := &Graph{plans: plans, producers: producers, next: map[string]link{}}
+	for module := range plans {
+		g.modules = append(g.modules, module)
+	}
+	sort.Strings(g.modules)
+
+	for _, module := range g.modules {
+		for _, r := range planned(plans[module]) {
+			from := Node{Module: module, Resource: r}
+			for _, e := range edges {
+				to, ok, err := g.resolve(from, e)
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					continue
+				}
+				if prev, dup := g.next[from.String()]; dup {
+					return nil, fmt.Errorf("%s routes both to %s (via %s) and %s (via %s)", from, prev.to, prev.via, to, e.attribute)
+				}
+				g.next[from.String()] = link{to: to, via: e.attribute}
+			}
+		}
+	}
+	return g, nil
+}
+
+// Paths follows the graph from every external forwarding rule
+func (g *Graph) Paths() ([]Path, error) {
+	var paths []Path
+	for _, module := range g.modules {
+		for _, r := range planned(g.plans[module]) {
+			if !contains(forwardingRules, r.Type()) {
+				continue
+			}
+			if scheme, _ := r.AfterString("load_balancing_scheme"); !strings.HasPrefix(scheme, "EXTERNAL") {
+				continue
+			}
+			path, err := g.walk(Node{Module: module, Resource: r})
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+// Path returns the path from the only external forwarding rule
+func (g *Graph) Path() (Path, error) {
+	paths, err := g.Paths()
+	if err != nil {
+		return Path{}, err
+	}
+	switch len(paths) {
+	case 1:
+		return paths[0], nil
+	case 0:
+		return Path{}, fmt.Errorf("no external forwarding rule is planned in %s", strings.Join(g.modules, ", "))
+	default:
+		entries := make([]string, len(paths))
+		for i, p := range paths {
+			entries[i] = p.Steps[0].Node.String()
+		}
+		return Path{}, fmt.Errorf("%d external forwarding rules, expected one: %s", len(paths), strings.Join(entries, ", "))
+	}
+}
+
+func (g *Graph) walk(entry Node) (Path, error) {
+	path := Path{Cloudflare: g.cloudflareRecord(entry)}
+	seen := map[string]bool{}
+	node, via := entry, ""
+	for {
+		if seen[node.String()] {
+			return path, fmt.Errorf("routing loop at %s", node)
+		}
+		seen[node.String()] = true
+
+		var prev *Step
+		if len(path.Steps) > 0 {
+			prev = &path.Steps[len(path.Steps)-1]
+		}
+		path.Steps = append(path.Steps, Step{Node: node, Hop: classify(node, prev), Via: via})
+
+		l, ok := g.next[node.String()]
+		if !ok {
+			break
+		}
+		node, via = l.to, l.via
+	}
+	if last := path.Steps[len(path.Steps)-1]; last.Hop != CloudRun {
+		return path, fmt.Errorf("traffic path from %s ends at %s, not at a Cloud Run service\n%s", entry, last.Node, path.Describe())
+	}
+	return path, nil
+}
+
+// classify names the hop of a node. Forwarding rule, proxy, URL map and a
+// backend service in the same module form one load balancer; a backend service
+// reached from another module's URL map is a hop of its own.
+func classify(n Node, prev *Step) Hop {
+	r := n.Resource
+	switch {
+	case contains(forwardingRules, r.Type()):
+		if scheme, _ := r.AfterString("load_balancing_scheme"); strings.HasPrefix(scheme, "INTERNAL") {
+			return InternalALB
+		}
+		return ExternalLB
+	case contains(targetProxies, r.Type()), contains(urlMaps, r.Type()):
+		if prev != nil {
+			return prev.Hop
+		}
+		return ExternalLB
+	case contains(backendServices, r.Type()):
+		if prev != nil && prev.Module == n.Module && (prev.Hop == ExternalLB || prev.Hop == InternalALB) {
+			return prev.Hop
+		}
+		return BackendService
+	case contains(endpointGroups, r.Type()):
+		// a cloud_run block makes it serverless whatever network_endpoint_type says
+		if blocks, _ := r.AfterList("cloud_run"); len(blocks) > 0 {
+			return ServerlessNEG
+		}
+		if target, _ := r.AfterString("psc_target_service"); target != "" || r.Unknown("psc_target_service") {
+			return PSCNEG
+		}
+		return ServerlessNEG
+	case contains(attachments, r.Type()):
+		return PSCServiceAttachment
+	case contains(cloudRunServices, r.Type()):
+		return CloudRun
+	}
+	return Hop(r.Type())
+}
+
+// resolve finds the node that attribute e of from points at. Known values are
+// matched by self link (or by name for Cloud Run); values known only after
+// apply are resolved through the configuration references, preferring
+// resources of the same plan since remote state values are always known.
+func (g *Graph) resolve(from Node, e edge) (Node, bool, error) {
+	value, known, present := attributeValue(from.Resource, e.attribute)
+	if !present {
+		return Node{}, false, nil
+	}
+	where := fmt.Sprintf("%s %s", from, e.attribute)
+
+	if known {
+		if value == "" {
+			return Node{}, false, nil
+		}
+		if n, ok := g.matchValue(from.Module, value, e.targets); ok {
+			return n, true, nil
+		}
+	}
+
+	refs := g.references(from, e.attribute)
+	var local, remote []Node
+	for _, ref := range refs {
+		nodes, err := g.resolveReference(from.Module, ref, e.targets)
+		if err != nil {
+			return Node{}, false, fmt.Errorf("%s: %w", where, err)
+		}
+		for _, n := range nodes {
+			if n.Module == from.Module {
+				local = appendNode(local, n)
+			} else {
+				remote = appendNode(remote, n)
+			}
+		}
+	}
+	candidates := local
+	if known || len(local) == 0 {
+		candidates = remote
+	}
+	switch len(candidates) {
+	case 1:
+		return candidates[0], true, nil
+	case 0:
+		if known {
+			return Node{}, false, fmt.Errorf("%s = %q matches no planned %s", where, value, strings.Join(e.targets, " or "))
+		}
+		return Node{}, false, fmt.Errorf("%s is known after apply and references no planned %s", where, strings.Join(e.targets, " or "))
+	default:
+		names := make([]string, len(candidates))
+		for i, n := range candidates {
+			names[i] = n.String()
+		}
+		return Node{}, false, fmt.Errorf("%s could be any of %s", where, strings.Join(names, ", "))
+	}
+}
+
+// matchValue finds the planned resource a known self link or name denotes
+func (g *Graph) matchValue(module, value string, types []string) (Node, bool) {
+	project, region, name := "", "", value
+	if m := selfLinkPattern.FindStringSubmatch(value); m != nil {
+		linked, ok := collections[m[3]]
+		if !ok {
+			return Node{}, false
+		}
+		types = intersect(types, linked)
+		project, region, name = m[1], m[2], m[4]
+	} else if strings.Contains(value, "/") {
+		return Node{}, false
+	}
+
+	var found []Node
+	for _, candidate := range g.modules {
+		if project == "" && candidate != module {
+			// a bare name only refers to the same configuration
+			continue
+		}
+		for _, r := range planned(g.plans[candidate]) {
+			if !contains(types, r.Type()) {
+				continue
+			}
+			if got, _ := r.AfterString("name"); got != name {
+				continue
+			}
+			if got, err := r.AfterString("project"); project != "" && err == nil && got != project {
+				continue
+			}
+			if got, err := r.AfterString("region"); region != "" && err == nil && got != region {
+				continue
+			}
+			found = append(found, Node{Module: candidate, Resource: r})
+		}
+	}
+	if len(found) != 1 {
+		return Node{}, false
+	}
+	return found[0], true
+}
+
+// resolveReference turns one configuration reference into planned nodes:
+// resource references within the module, and remote state outputs through
+// the producing module's output expression
+func (g *Graph) resolveReference(module, ref string, types []string) ([]Node, error) {
+	parts := strings.Split(stripIndexes(ref), ".")
+	if len(parts) >= 5 && parts[0] == "data" && parts[1] == "terraform_remote_state" && parts[3] == "outputs" {
+		producer, err := g.producers.Resolve(parts[2], g.modules)
+		if err != nil {
+			// the producer's plan is not part of this graph
+			return nil, nil
+		}
+		output, ok := g.plans[producer].Raw().Config.RootModule.Outputs[parts[4]]
+		if !ok || output.Expression == nil || output.Expression.ExpressionData == nil {
+			return nil, fmt.Errorf("%s does not declare output %q", producer, parts[4])
+		}
+		var nodes []Node
+		for _, r := range output.Expression.References {
+			resolved, err := g.resolveReference(producer, r, types)
+			if err != nil {
+				return nil, err
+			}
+			for _, n := range resolved {
+				nodes = appendNode(nodes, n)
+			}
+		}
+		return nodes, nil
+	}
+	if len(parts) < 2 || !contains(types, parts[0]) {
+		return nil, nil
+	}
+
+	index := indexOf(ref)
+	var nodes []Node
+	for _, r := range planned(g.plans[module]) {
+		if r.Type() != parts[0] || r.Name() != parts[1] {
+			continue
+		}
+		if index != "" && fmt.Sprint(r.Index()) != index {
+			continue
+		}
+		nodes = append(nodes, Node{Module: module, Resource: r})
+	}
+	return nodes, nil
+}
+
+// references returns the configuration references of a (possibly nested)
+// attribute of the resource's declaration
+func (g *Graph) references(n Node, attribute string) []string {
+	var config *tfjson.ConfigResource
+	for _, c := range g.plans[n.Module].Raw().Config.RootModule.Resources {
+		if c.Mode == tfjson.ManagedResourceMode && c.Type == n.Resource.Type() && c.Name == n.Resource.Name() {
+			config = c
+			break
+		}
+	}
+	if config == nil {
+		return nil
+	}
+
+	block, attr, nested := strings.Cut(attribute, ".")
+	expr := config.Expressions[block]
+	if expr == nil || expr.ExpressionData == nil {
+		return nil
+	}
+	if !nested {
+		return expr.References
+	}
+	var refs []string
+	for _, b := range expr.NestedBlocks {
+		if inner := b[attr]; inner != nil && inner.ExpressionData != nil {
+			refs = append(refs, inner.References...)
+		}
+	}
+	return refs
+}
+
+// cloudflareRecord finds a Cloudflare record whose content is the entry's address
+func (g *Graph) cloudflareRecord(entry Node) *Node {
+	address := map[string]bool{}
+	for _, ref := range g.references(entry, "ip_address") {
+		address[resourceOf(ref)] = true
+	}
+	ip, _ := entry.Resource.AfterString("ip_address")
+
+	for _, r := range planned(g.plans[entry.Module]) {
+		if r.Type() != "cloudflare_record" && r.Type() != "cloudflare_dns_record" {
+			continue
+		}
+		n := Node{Module: entry.Module, Resource: r}
+		if content, _ := r.AfterString("content"); ip != "" && content == ip {
+			return &n
+		}
+		for _, ref := range g.references(n, "content") {
+			if address[resourceOf(ref)] {
+				return &n
+			}
+		}
+	}
+	return nil
+}
+
+// attributeValue reads a routing attribute; a nested block.attribute reads
+// the first block. present is false when the attribute is not set at all.
+func attributeValue(r planquery.Resource, attribute string) (value string, known, present bool) {
+	path := attribute
+	if block, attr, nested := strings.Cut(attribute, "."); nested {
+		path = block + ".0." + attr
+		if blocks, err := r.AfterList(block); err != nil || len(blocks) == 0 {
+			return "", false, r.Unknown(block)
+		}
+	}
+	if r.Unknown(path) {
+		return "", false, true
+	}
+	v, err := r.After(path)
+	if err != nil || v == nil {
+		return "", true, false
+	}
+	s, ok := v.(string)
+	return s, true, ok
+}
+
+// planned returns the managed resources the plan keeps or creates
+func planned(plan *planquery.Plan) []planquery.Resource {
+	var out []planquery.Resource
+	for _, r := range plan.Resources(planquery.Managed()) {
+		if r.Action() != planquery.Delete {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+var indexPattern = regexp.MustCompile(`\[[^\]]*\]`)
+
+func stripIndexes(ref string) string {
+	return indexPattern.ReplaceAllString(ref, "")
+}
+
+// indexOf returns the count index or for_each key of a reference's resource
+// part ("0" for x.y[0].id), or "" when it has none
+func indexOf(ref string) string {
+	parts := strings.SplitN(ref, ".", 3)
+	if len(parts) < 2 {
+		return ""
+	}
+	m := indexPattern.FindString(parts[1])
+	return strings.Trim(m, `[]"`)
+}
+
+// resourceOf reduces a reference to its type.name
+func resourceOf(ref string) string {
+	parts := strings.Split(stripIndexes(ref), ".")
+	if len(parts) < 2 {
+		return ref
+	}
+	return parts[0] + "." + parts[1]
+}
+
+func appendNode(nodes []Node, n Node) []Node {
+	for _, existing := range nodes {
+		if existing.String() == n.String() {
+			return nodes
+		}
+	}
+	return append(nodes, n)
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func intersect(a, b []string) []string {
+	var out []string
+	for _, s := range a {
+		if contains(b, s) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
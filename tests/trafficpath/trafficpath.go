@@ -0,0 +1,214 @@
+// Package trafficpath rebuilds the request path through the load balancers from
+// the plans of core and demo-web-app. Starting at each external forwarding rule
+// it follows target, url_map, default_service, backend.group,
+// psc_target_service, target_service and cloud_run.service, across modules
+// where a value came through terraform_remote_state, and names each hop the
+// way the feature files do (External HTTPS LB, PSC NEG, Internal ALB, ...).
+package trafficpath
+
+import (
+	"fmt"
+	"strings"
+
+	"vibetics-cloudedge/tests/modcontract"
+	"vibetics-cloudedge/tests/planquery"
+)
+
+// Hop is one stage of the traffic path as the feature files name it
+type Hop string
+
+const (
+	Internet             Hop = "Internet"
+	Cloudflare           Hop = "Cloudflare"
+	ExternalLB           Hop = "External HTTPS LB"
+	BackendService       Hop = "Backend Service"
+	PSCNEG               Hop = "PSC NEG"
+	PSCServiceAttachment Hop = "PSC Service Attachment"
+	InternalALB          Hop = "Internal ALB"
+	ServerlessNEG        Hop = "Serverless NEG"
+	CloudRun             Hop = "Cloud Run"
+)
+
+// Node is a planned resource instance on the path
+type Node struct {
+	Module   string
+	Resource planquery.Resource
+}
+
+func (n Node) String() string {
+	return n.Module + ": " + n.Resource.Address()
+}
+
+// Step is a node together with the hop it belongs to and the attribute that
+// led to it (empty for the entry point)
+type Step struct {
+	Node
+	Hop Hop
+	Via string
+}
+
+// Path is the chain of resources a request crosses, entry point first
+type Path struct {
+	Steps []Step
+	// Cloudflare is the DNS record proxying to the entry address, if any
+	Cloudflare *Node
+}
+
+// Hops collapses the steps into the feature-file vocabulary, starting with
+// Internet (and Cloudflare when a proxied record points at the entry address)
+func (p Path) Hops() []Hop {
+	hops := []Hop{Internet}
+	if p.Cloudflare != nil {
+		hops = append(hops, Cloudflare)
+	}
+	for _, s := range p.Steps {
+		if hops[len(hops)-1] != s.Hop {
+			hops = append(hops, s.Hop)
+		}
+	}
+	return hops
+}
+
+// String renders the hops joined by arrows, as in the feature files
+func (p Path) String() string {
+	return joinHops(p.Hops())
+}
+
+// Describe lists every resolved resource with its hop and the attribute
+// followed to reach it, one per line
+func (p Path) Describe() string {
+	var b strings.Builder
+	if p.Cloudflare != nil {
+		fmt.Fprintf(&b, "%-24s %s\n", Cloudflare, p.Cloudflare)
+	}
+	for _, s := range p.Steps {
+		via := ""
+		if s.Via != "" {
+			via = " (via " + s.Via + ")"
+		}
+		fmt.Fprintf(&b, "%-24s %s%s\n", s.Hop, s.Node, via)
+	}
+	return b.String()
+}
+
+// Problems reports wiring that plans cleanly but cannot carry traffic: a
+// backend service whose load balancing scheme differs from the forwarding
+// rule of the load balancer that routes to it
+func (p Path) Problems() []string {
+	var problems []string
+	scheme := ""
+	for _, s := range p.Steps {
+		value, _ := s.Resource.AfterString("load_balancing_scheme")
+		switch s.Resource.Type() {
+		case "google_compute_forwarding_rule", "google_compute_global_forwarding_rule":
+			scheme = value
+		case "google_compute_region_backend_service", "google_compute_backend_service":
+			if scheme != "" && value != "" && value != scheme {
+				problems = append(problems, fmt.Sprintf("%s has load_balancing_scheme %s but the forwarding rule routing to it has %s",
+					s.Node, value, scheme))
+			}
+		}
+	}
+	return problems
+}
+
+// Pattern is one of the supported connectivity patterns
+type Pattern struct {
+	Number int
+	Name   string
+	Hops   []Hop
+}
+
+var (
+	// Pattern1 reaches Cloud Run through PSC and the demo project's internal ALB
+	Pattern1 = Pattern{Number: 1, Name: "PSC with Internal ALB", Hops: []Hop{
+		Internet, Cloudflare, ExternalLB, PSCNEG, PSCServiceAttachment, InternalALB, ServerlessNEG, CloudRun,
+	}}
+	// Pattern2 routes the external load balancer straight to the demo backend service
+	Pattern2 = Pattern{Number: 2, Name: "Direct Backend Service", Hops: []Hop{
+		Internet, Cloudflare, ExternalLB, BackendService, ServerlessNEG, CloudRun,
+	}}
+)
+
+func (p Pattern) String() string {
+	return joinHops(p.Hops)
+}
+
+// Select returns the pattern the enable_* flags of the plans ask for. Core and
+// demo-web-app must agree on enable_demo_web_app_psc_neg. An internal ALB
+// without PSC still leaves the external load balancer routing to the demo
+// backend directly, so it is held to Pattern 2; Path.Problems then reports
+// the scheme mismatch.
+func Select(plans map[string]*planquery.Plan) (Pattern, error) {
+	core, ok := plans["core"]
+	if !ok {
+		return Pattern{}, fmt.Errorf("no core plan")
+	}
+	if enabled, err := boolVariable(core, "enable_demo_web_app"); err != nil {
+		return Pattern{}, err
+	} else if !enabled {
+		return Pattern{}, fmt.Errorf("core has enable_demo_web_app = false; there is no traffic path to the demo web app")
+	}
+	psc, err := boolVariable(core, "enable_demo_web_app_psc_neg")
+	if err != nil {
+		return Pattern{}, err
+	}
+	if demo, ok := plans["demo-web-app"]; ok {
+		demoPSC, err := boolVariable(demo, "enable_demo_web_app_psc_neg")
+		if err != nil {
+			return Pattern{}, err
+		}
+		if demoPSC != psc {
+			return Pattern{}, fmt.Errorf("core has enable_demo_web_app_psc_neg = %t but demo-web-app has %t", psc, demoPSC)
+		}
+	}
+	if psc {
+		return Pattern1, nil
+	}
+	return Pattern2, nil
+}
+
+// Verify builds the graph, resolves the single path from the external load
+// balancer and checks it against the pattern the flags select
+func Verify(plans map[string]*planquery.Plan, producers modcontract.StateProducers) (Path, Pattern, error) {
+	pattern, err := Select(plans)
+	if err != nil {
+		return Path{}, Pattern{}, err
+	}
+	graph, err := Build(plans, producers)
+	if err != nil {
+		return Path{}, pattern, err
+	}
+	path, err := graph.Path()
+	if err != nil {
+		return Path{}, pattern, err
+	}
+	if got := path.String(); got != pattern.String() {
+		return path, pattern, fmt.Errorf("traffic path is %s; pattern %d (%s) expects %s\n%s",
+			got, pattern.Number, pattern.Name, pattern, path.Describe())
+	}
+	if problems := path.Problems(); len(problems) > 0 {
+		return path, pattern, fmt.Errorf("traffic path %s is miswired: %s", path, strings.Join(problems, "; "))
+	}
+	return path, pattern, nil
+}
+
+func joinHops(hops []Hop) string {
+	parts := make([]string, len(hops))
+	for i, h := range hops {
+		parts[i] = string(h)
+	}
+	return strings.Join(parts, " → ")
+}
+
+func boolVariable(plan *planquery.Plan, name string) (bool, error) {
+	v, ok := plan.Raw().Variables[name]
+	if !ok || v == nil {
+		return false, fmt.Errorf("plan has no variable %q", name)
+	}
+	b, ok := v.Value.(bool)
+	if !ok {
+		return false, fmt.Errorf("variable %q is %v, not a bool", name, v.Value)
+	}
+	return b, nil
+}
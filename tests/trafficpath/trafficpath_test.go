@@ -0,0 +1,73 @@
+package trafficpath
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vibetics-cloudedge/tests/planfixture"
+	"vibetics-cloudedge/tests/planquery"
+)
+
+func load(t *testing.T, core, demo string) map[string]*planquery.Plan {
+	t.Helper()
+	plans := map[string]*planquery.Plan{}
+	for module, name := range map[string]string{"core": core, "demo-web-app": demo} {
+		plan, err := planfixture.Load(name)
+		require.NoError(t, err)
+		plans[module] = planquery.New(plan)
+	}
+	return plans
+}
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		core, demo string
+		pattern    Pattern
+	}{
+		{"core_psc_neg", "demo_web_app_psc", Pattern1},
+		{"core_psc_neg_same_project", "demo_web_app_psc_same_project", Pattern1},
+		{"core_default", "demo_web_app_direct_backend", Pattern2},
+	} {
+		tc := tc
+		t.Run(tc.core+"+"+tc.demo, func(t *testing.T) {
+			t.Parallel()
+			path, pattern, err := Verify(load(t, tc.core, tc.demo), nil)
+			require.NoError(t, err)
+			assert.Equal(t, tc.pattern.Number, pattern.Number)
+			assert.Equal(t, tc.pattern.Hops, path.Hops())
+			require.NotNil(t, path.Cloudflare)
+			assert.Equal(t, "cloudflare_record", path.Cloudflare.Resource.Type())
+		})
+	}
+}
+
+func TestVerifyReportsSchemeMismatch(t *testing.T) {
+	t.Parallel()
+
+	// the internal ALB without PSC leaves the external LB on an INTERNAL_MANAGED backend
+	_, _, err := Verify(load(t, "core_default", "demo_web_app_default"), nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "load_balancing_scheme INTERNAL_MANAGED")
+}
+
+func TestPathCrossesModules(t *testing.T) {
+	t.Parallel()
+
+	g, err := Build(load(t, "core_psc_neg", "demo_web_app_psc"), nil)
+	require.NoError(t, err)
+	path, err := g.Path()
+	require.NoError(t, err)
+
+	var vias []string
+	for _, s := range path.Steps[1:] {
+		vias = append(vias, s.Via)
+	}
+	assert.Equal(t, []string{"target", "url_map", "default_service", "backend.group", "psc_target_service",
+		"target_service", "target", "url_map", "default_service", "backend.group", "cloud_run.service"}, vias)
+	assert.Equal(t, "core", path.Steps[0].Module)
+	assert.Equal(t, "demo-web-app", path.Steps[len(path.Steps)-1].Module)
+}